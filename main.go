@@ -1,282 +1,9463 @@
 package main
 
 import (
-	"bytes"         // Provides a way to work with byte slices (like a buffer)
-	"context"       // Manages request-scoped values, cancellation signals, and deadlines
-	"io"            // Provides basic interfaces for I/O primitives
-	"log"           // Implements simple logging, often to os.Stderr
-	"net/http"      // Provides HTTP client and server implementations
-	"net/url"       // Parses URLs and implements query escaping
-	"os"            // Provides platform-independent interface to operating system functionality
-	"path/filepath" // Implements utility routines for manipulating filepaths in a way appropriate for the operating system
-	"regexp"        // Implements regular expression search
-	"strings"       // Implements simple functions to manipulate strings
-	"time"          // Provides functionality for measuring and displaying time
-
-	"github.com/chromedp/chromedp" // Chromedp library for driving a headless Chrome browser
-	"golang.org/x/net/html"        // Provides an HTML parser
+	"bufio"            // Reads cached HTTP responses
+	"bytes"            // Provides a way to work with byte slices (like a buffer)
+	"cmp"              // Picks the first non-empty value
+	"context"          // Manages request-scoped values, cancellation signals, and deadlines
+	"crypto/hmac"      // Implements keyed-hash message authentication codes
+	"crypto/md5"       // Checks MD5 checksums published next to downloads
+	"crypto/rand"      // Generates timestamp request nonces
+	"crypto/sha1"      // Checks SHA-1 checksums published next to downloads
+	"crypto/sha256"    // Implements the SHA-256 hash algorithm
+	"crypto/sha512"    // Checks SHA-512 checksums published next to downloads
+	"crypto/x509/pkix" // Algorithm identifiers for timestamp requests
+	"encoding/asn1"    // Encodes RFC 3161 timestamp requests
+	"encoding/csv"     // Reads and writes comma-separated values files
+	"encoding/hex"     // Implements hexadecimal encoding and decoding
+	"encoding/json"    // Implements encoding and decoding of JSON
+	"encoding/xml"     // Encodes the sitemap
+	"flag"             // Implements command-line flag parsing
+	"fmt"              // Implements formatted I/O
+	"hash"             // Common interface of the content hashers
+	"html/template"    // Renders the web dashboard with automatic escaping
+	"io"               // Provides basic interfaces for I/O primitives
+	"io/fs"            // Walks folders being imported
+	"log"              // Implements simple logging, often to os.Stderr
+	"maps"             // Clones and lists the keys of maps
+	"math"             // Bounds the timestamp request nonce
+	"math/big"         // Timestamp request nonces
+	"mime"             // Parses Content-Disposition headers
+	"net"              // Provides the Unix datagram socket used for systemd notifications
+	"net/http"         // Provides HTTP client and server implementations
+	"net/netip"        // Classifies resolved addresses as public or internal
+	"net/url"          // Parses URLs and implements query escaping
+	"os"               // Provides platform-independent interface to operating system functionality
+	"os/exec"          // Runs external commands
+	"os/signal"        // Delivers operating system signals to the program
+	"os/user"          // Names the user in the audit log
+	"path"             // Cleans URL paths
+	"path/filepath"    // Implements utility routines for manipulating filepaths in a way appropriate for the operating system
+	"regexp"           // Implements regular expression search
+	"runtime"          // Reports the operating system the program is running on
+	"runtime/debug"    // Reads the version stamped into the binary
+	"slices"           // Searches slices
+	"sort"             // Provides sorting of slices
+	"strconv"          // Converts strings to and from basic data types
+	"strings"          // Implements simple functions to manipulate strings
+	"sync"             // Provides mutexes for state shared between goroutines
+	"sync/atomic"      // Provides the run-in-progress flag read by the status handlers
+	"syscall"          // Provides signal numbers such as SIGHUP
+	"time"             // Provides functionality for measuring and displaying time
+
+	"github.com/andybalholm/cascadia"                 // CSS selectors for scoping link extraction
+	"github.com/antchfx/htmlquery"                    // XPath queries over parsed HTML
+	"github.com/antchfx/xpath"                        // XPath expression compiler
+	"github.com/chromedp/cdproto/browser"             // CDP download handling
+	"github.com/chromedp/cdproto/cdp"                 // Binds CDP commands to a browser target
+	"github.com/chromedp/cdproto/emulation"           // CDP locale emulation
+	"github.com/chromedp/cdproto/fetch"               // CDP request interception
+	"github.com/chromedp/cdproto/input"               // CDP mouse events
+	"github.com/chromedp/cdproto/network"             // CDP resource types and error reasons
+	"github.com/chromedp/cdproto/page"                // CDP script injection
+	"github.com/chromedp/chromedp"                    // Chromedp library for driving a headless Chrome browser
+	"github.com/zeebo/blake3"                         // BLAKE3 hashing, selectable with -hash
+	"golang.org/x/net/html"                           // Provides an HTML parser
+	"google.golang.org/grpc"                          // gRPC server for the control service
+	"google.golang.org/grpc/codes"                    // gRPC status codes
+	"google.golang.org/grpc/status"                   // gRPC status errors
+	"google.golang.org/protobuf/encoding/protojson"   // Converts JSON events into protobuf structs
+	"google.golang.org/protobuf/types/known/emptypb"  // Empty request message
+	"google.golang.org/protobuf/types/known/structpb" // Generic response and event messages
 )
 
-func main() { // Main function, the entry point of the program
-	outputDirectory := "PDFs/"             // Directory where downloaded PDF files will be saved
-	if !directoryExists(outputDirectory) { // Check if the directory already exists
-		createDirectory(outputDirectory, 0o755) // Create the directory with full read, write, and execute permissions (rwxr-xr-x)
+const maxFilenameLength = 200 // Longest sanitized filename allowed, kept well under the common 255-byte filesystem limit
+
+const filenameHashLength = 12 // Number of hex characters of the URL hash appended to truncated filenames
+
+const maxDownloadAttempts = 3 // Number of times a download that fails PDF validation is re-queued before giving up
+
+const maxRateLimitRetries = 5 // Number of times a download turned away by rate limiting is retried before it counts as failed
+
+const defaultRetryAfter = time.Minute // Pause after a rate-limit response without a usable Retry-After header
+
+const maxRetryAfter = 15 * time.Minute // Longest pause honored, so a bogus Retry-After cannot stall a run
+
+const catalogFilename = "manifest.json" // Name of the catalog file kept in the output directory
+
+const blogListingURL = "https://radiomasterrc.com/blogs/news" // Listing page of the RadioMaster blog/news section
+
+const runHistoryFilename = "runs.jsonl" // Name of the run history file kept in the output directory, one JSON run per line
+
+const brokenLinksFilename = "broken-links.json" // Name of the list of links failing across runs, kept in the output directory
+
+const updateTimelineFilename = "update-timeline" // Base name of the documentation update timeline, written as .json and .html in the output directory
+
+const syncStateFilename = "sync-state.json" // Name of the file recording where a replica's last sync left off, kept in the output directory
+
+const linkCheckFilename = "linkcheck.json" // Name of the linkcheck subcommand's report, kept in the output directory
+
+const checksumsFilename = "SHA256SUMS" // Name of the sha256sum-compatible checksum list kept in the output directory
+
+const provenanceDirectory = "provenance" // Directory inside the output directory receiving one provenance statement per run
+
+const quarantineDirectory = "quarantine/" // Directory keeping downloads that failed validation, for manual inspection
+
+const minFirmwareSize = 256 // Smallest plausible firmware package in bytes; anything smaller is an error message or a stub
+
+var archiveRunMutex sync.Mutex // Held for the duration of a run so scheduled and manually triggered runs never overlap
+
+var archiveRunning atomic.Bool // Set while archiveRunMutex is held, so status handlers never probe the lock itself
+
+var archiveCatalog = &catalog{Entries: make(map[string]*catalogEntry)} // Catalog of every downloaded file, keyed by source URL
+
+var loadedEntryFingerprints = make(map[string]string) // Each entry as last loaded or saved, by URL, to date what changed before the next save
+
+var runStatistics = &runStats{StartedAt: time.Now().UTC()} // Counters describing the current run
+
+var dashboard = &dashboardState{transfers: make(map[int]*transferProgress)} // Live progress shared with the terminal dashboard
+
+var stampXMP = flag.Bool("stamp-xmp", false, "stamp each downloaded PDF's XMP metadata with its source URL and retrieval date (requires exiftool)") // Enables provenance stamping of downloaded PDFs
+
+var downloadChunks = flag.Int("chunks", 4, "split downloads of at least -chunk-threshold bytes into this many byte ranges fetched in parallel; 1 disables it") // Parallel ranges per large download
+
+var chunkThreshold = flag.Int64("chunk-threshold", 64<<20, "smallest download, in bytes, that is fetched in parallel chunks") // Size from which downloads are chunked
+
+var blockResources = flag.Bool("block-resources", true, "block images, fonts, and media while scraping pages in Chrome, since only the DOM's links matter") // Enables resource blocking during scrapes
+
+var captureNetwork = flag.Bool("capture-network", true, "also harvest PDF and firmware URLs requested by the page's scripts, or listed in the JSON its XHR/fetch calls load, during Chrome scrapes") // Enables network link harvesting
+
+var blockBackoff = flag.Duration("block-backoff", time.Minute, "pause before retrying a host that served an anti-bot block or challenge page; doubles with each consecutive block, up to 15 minutes") // First pause after a block page
+
+var blockRetries = flag.Int("block-retries", 2, "times a page that came back as an anti-bot block or challenge page is retried later in the run") // Retries of blocked pages
+
+var remoteBrowserURL = flag.String("browser-url", "", "scrape through a hosted or remote Chrome instead of launching one: a ws:// or wss:// CDP endpoint (e.g. browserless) or an http:// debugging address whose /json/version names it; BROWSER_TOKEN, if set, is sent as the token query parameter") // Remote CDP endpoint
+
+var captchaWait = flag.Duration("captcha-wait", 0, "when a Chrome page shows an interactive challenge, enlarge its window, pause other page scrapes, and wait up to this long for an operator to solve it; needs a local Chrome, so not with -browser-url; 0 disables the prompt") // Time allowed for an operator to solve a challenge
+
+var humanDelay = flag.Duration("human-delay", 0, "longest random pause added before each Chrome page load and between simulated mouse moves and scrolls once the page has loaded; 0 disables the human-like activity") // Upper bound of the random pauses
+
+var humanSteps = flag.Int("human-steps", 6, "mouse moves and small scrolls simulated on each Chrome page when -human-delay is set") // Simulated interactions per page
+
+var stealthMode = flag.Bool("stealth", false, "hide the usual automation tells from page scripts in Chrome sessions (navigator.webdriver, a 1x1 window, a HeadlessChrome user agent, empty plugins) to reduce how often challenges appear") // Enables the stealth tweaks
+
+var plainFirst = flag.Bool("plain-first", false, "fetch each page with a plain HTTP GET first and only render it in Chrome when the response looks like a JavaScript challenge or lacks the expected content; plainly fetched pages are neither scrolled (-auto-scroll) nor watched for script-loaded files (-capture-network); sources with \"chrome\": true always use Chrome") // Tries the cheap fetch first
+
+var autoScroll = flag.Bool("auto-scroll", true, "scroll each page to the bottom in steps before capturing it so lazily rendered rows load") // Enables scrolling before capture
+
+var browserLocale = flag.String("locale", "", "BCP 47 locale (e.g. de-DE) to present to sites through Chrome's locale and the Accept-Language header, to discover region-specific variants") // Locale presented to sites
+
+var maxBrowsers = flag.Int("max-browsers", 2, "most Chrome instances running at once while scraping pages in parallel; lower it on memory-constrained hosts") // Cap on simultaneous Chrome processes
+
+var hashAlgorithm = flag.String("hash", "sha256", "content hash recorded in the catalog and sidecars: sha256 or blake3 (much faster on ARM boards)") // Content hash algorithm
+
+var quarantineAfter = flag.Int("quarantine-after", 3, "skip links that failed to download in this many consecutive runs, re-checking them every -quarantine-recheck; 0 never skips") // Failing runs before a link is quarantined
+
+var quarantineRecheck = flag.Duration("quarantine-recheck", 7*24*time.Hour, "how long a quarantined link is skipped before it is tried again") // Time between re-checks of quarantined links
+
+var clamdAddress = flag.String("scan-clamd", "", "scan firmware downloads with clamd at this Unix socket path or host:port before archiving them; flagged files are quarantined") // clamd to scan firmware with
+
+var scanCommand = flag.String("scan-command", "", "scan firmware downloads with this command (e.g. \"clamscan --no-summary\"), split on spaces without quoting and given the file path last; exit status 1 means infected and the file is quarantined") // External scanner for firmware
+
+var minisignKey = flag.String("minisign-key", "", "minisign secret key file used to sign manifest.json and SHA256SUMS after each run (its password, if any, is read from $MINISIGN_PASSWORD)") // Key for minisign signatures
+
+var gpgKey = flag.String("gpg-key", "", "GnuPG key ID used to write detached, armored signatures of manifest.json and SHA256SUMS after each run") // Key for GnuPG signatures
+
+var writeProvenance = flag.Bool("provenance", false, "write an in-toto statement with SLSA provenance for the files each run downloads (source URLs, tool version, timestamps, hashes) into the output directory's provenance/") // Enables provenance statements
+
+var submitWayback = flag.Bool("wayback", false, "ask the Wayback Machine to save each manual URL not submitted before; uses the WAYBACK_ACCESS_KEY and WAYBACK_SECRET_KEY archive.org keys when set") // Wayback Machine submission
+
+var waybackDelay = flag.Duration("wayback-delay", 10*time.Second, "pause between Wayback Machine submissions, which archive.org rate-limits") // Pause between submissions
+
+var submitArchiveToday = flag.Bool("archive-today", false, "ask archive.today to snapshot each source and product page not submitted before; set it per profile to choose which runs submit") // archive.today submission
+
+var archiveTodayDelay = flag.Duration("archive-today-delay", 30*time.Second, "pause between archive.today submissions, which archive.today rate-limits") // Pause between submissions
+
+var markdownIndexPath = flag.String("markdown-index", "PDFs/index.md", "Markdown table of contents of the manuals, by product, so a Git mirror of the archive is browsable; it only changes when the manuals do; empty disables it") // Markdown index
+
+var translateURL = flag.String("translate-url", "", "LibreTranslate-compatible /translate endpoint each manual's text is sent to, with the TRANSLATE_API_KEY environment variable as api_key when set; empty disables translation") // Translation backend
+
+var allowPrivateAddresses = flag.Bool("allow-private-addresses", false, "let scraped and configured links reach loopback, private, link-local and other internal addresses, e.g. a mirror on the LAN") // SSRF protection opt-out
+
+var allowedHosts = flag.String("allowed-hosts", "", "comma-separated extra domains downloads may come from, besides radiomasterrc.com, the Shopify CDN and the source pages' and mirrors' hosts, with -github-repos adding its repositories' release downloads; file hosts must be listed explicitly (e.g. \"drive.google.com,drive.usercontent.google.com,googleusercontent.com\" for Google Drive, \"dropbox.com,dropboxusercontent.com\" for Dropbox); \"*\" allows any host") // Download domain allow-list
+
+var githubRepositories = flag.String("github-repos", "", "comma-separated GitHub repositories (e.g. \"EdgeTX/edgetx,ExpressLRS/ExpressLRS\") whose release assets are archived under Firmware/ and Software/ in <owner>/<repo>/<tag>/ directories; GITHUB_TOKEN, if set, raises the API rate limit") // GitHub release sources
+
+var githubReleaseCount = flag.Int("github-releases", 5, "newest releases archived per -github-repos repository; drafts and pre-releases are skipped") // Releases mirrored per repository
+
+var httpsUpgrade = flag.Bool("https-upgrade", true, "download http:// links over HTTPS when their host serves the file over HTTPS too, recording the original link in the catalog") // HTTPS upgrade of scraped links
+
+var keepParameters = flag.String("keep-params", "", "comma-separated query parameters that link canonicalization never strips, for sites that select files with a parameter otherwise treated as tracking or cache-busting") // Canonicalization keep-list
+
+var translateLanguages = flag.String("translate-to", "", "comma-separated languages (e.g. \"de,fr\") manuals are translated into, each stored next to the PDF as <name>.<language>.md") // Translation targets
+
+var tsaURL = flag.String("tsa-url", "", "RFC 3161 time-stamping authority (e.g. https://freetsa.org/tsr) asked to timestamp each run's SHA256SUMS into SHA256SUMS.tsr; empty disables it") // Time-stamping authority
+
+var logFilePath = flag.String("log-file", "", "write the log to this file instead of stderr, rotating it by -log-max-size and -log-rotate-every and pruning old copies by -log-max-age and -log-max-backups") // Log file
+
+var logMaxSize = flag.Int("log-max-size", 10, "size in MiB at which -log-file is rotated") // Rotation size of the log file
+
+var logRotateInterval = flag.Duration("log-rotate-every", 24*time.Hour, "age at which -log-file is rotated even if it is below -log-max-size; 0 rotates by size only") // Rotation age of the log file
+
+var logMaxAge = flag.Duration("log-max-age", 30*24*time.Hour, "delete rotated copies of -log-file older than this; 0 keeps them regardless of age") // Retention of rotated logs
+
+var logMaxBackups = flag.Int("log-max-backups", 5, "most rotated copies of -log-file kept; 0 keeps them regardless of count") // Number of rotated logs kept
+
+var logBackend = flag.String("log-backend", "", "send the log to \"syslog\" or \"journald\" instead of stderr or -log-file, at priorities taken from each message") // System log backend
+
+var openSystemLog func(backend string) (io.Writer, error) // Platform-specific system log backends; nil where there are none
+
+var checkOnly = flag.Bool("check-only", false, "send a HEAD request for every cataloged URL instead of running, flagging files whose size, ETag, or Last-Modified changed so the next full run downloads them again") // Fast refresh
+
+var prevalidateDownloads = flag.Bool("prevalidate", true, "send a HEAD request for each link about to be downloaded, in parallel, and drop links answering 404 or 410, an empty body or a wrong content type before the download phase") // Pre-download HEAD validation
+
+var linkCheckTimeout = flag.Duration("linkcheck-timeout", 30*time.Second, "time limit for each request of the linkcheck subcommand") // Per-link request timeout
+
+var strictMode = flag.Bool("strict", false, "stop the run on the first scrape, download, validation or scan error that is not retried, skipping the remaining work but still saving the catalog, then exit with a non-zero status") // Fail fast
+
+var maxFailurePercent = flag.Float64("max-failure-percent", 100, "fail the run (non-zero exit, run_failed event) when more than this percentage of attempted downloads fail; 100 never fails it") // Failure threshold
+
+var eventsFormat = flag.String("events", "", "also write every lifecycle event to stdout; \"ndjson\" writes one JSON object per line") // Event stream on stdout
+
+var stdoutEvents sync.Mutex // Keeps event lines whole on stdout
+
+var logLevel = flag.String("log-level", "info", "least severe log lines shown: \"info\", \"warning\" or \"error\"") // Log level
+
+var logColor = flag.String("color", "auto", "colorize console log lines by level and group them by URL: \"auto\" (when stderr is a terminal), \"always\" or \"never\"") // Console colors
+
+var logToConsole = true // Whether log output goes to stderr rather than a file or the system log
+
+var logDestination io.Writer = os.Stderr // Where log output goes when the dashboard is not capturing it
+
+var auditLogPath = flag.String("audit-log", "", "append a JSON line for every HTTP request (not Chrome's own page loads), file write, and deletion to this file, separate from the human log, for archives operated by several people") // Append-only audit log
+
+var linearizePDFs = flag.Bool("linearize", false, "linearize (\"fast web view\") each downloaded PDF so the first page streams immediately over HTTP (requires qpdf)") // Enables linearization of downloaded PDFs
+
+var convertPDFA = flag.Bool("pdfa", false, "also produce PDF/A-2b copies of every PDF for long-term archival (requires Ghostscript)") // Enables the PDF/A conversion pass
+
+var archivalDirectory = flag.String("archival-dir", "archival/", "directory receiving the PDF/A-2b copies produced by -pdfa") // Where PDF/A copies are written
+
+var compressPDFs = flag.Bool("compress", false, "also produce size-reduced copies of every PDF (image downsampling, stream recompression) for storage-constrained mirrors (requires Ghostscript)") // Enables the compression pass
+
+var compressedDirectory = flag.String("compressed-dir", "compressed/", "directory receiving the size-reduced copies produced by -compress") // Where compressed copies are written
+
+var calibreDirectory = flag.String("calibre-dir", "", "directory to export the manuals into for Calibre, outside the archive: one folder per manual holding the PDF (hard-linked when possible) and a metadata.opf, for \"Add books from folders, one book per folder\", plus calibre.csv; empty disables it") // Where the Calibre export is written
+
+var siteDirectory = flag.String("site-dir", "", "directory to write a static index.html of the archive into (e.g. docs/ for GitHub Pages); empty disables it") // Where the index site is generated
+
+var siteURL = flag.String("site-url", "", "public URL the -site-dir is served from (e.g. https://example.github.io/archive/); enables sitemap.xml") // Public URL of the index site
+
+var scrapeBlog = flag.Bool("blog", false, "archive new posts from the RadioMaster blog/news listing and download any files they attach") // Enables blog/news archiving
+
+var scrapeProducts = flag.Bool("products", false, "also scrape the product pages linked from each source page for specification tables and downloads") // Enables product page scraping
+
+var webhookURL = flag.String("webhook-url", "", "POST a JSON event to this URL for download_completed, new_manual_found, run_finished, and error events") // Destination of lifecycle events
+
+var webhookSecret = flag.String("webhook-secret", os.Getenv("WEBHOOK_SECRET"), "key used to HMAC-SHA256 sign webhook bodies into the X-Signature-256 header (defaults to $WEBHOOK_SECRET)") // Signing key for webhook events
+
+var tuiMode = flag.Bool("tui", false, "show a live terminal dashboard with per-worker progress, queue depth, and recent log lines instead of plain log output") // Enables the terminal dashboard
+
+var httpCacheDirectory = flag.String("http-cache", "", "directory of a disk cache for GET responses up to -http-cache-max-size, honoring Cache-Control and revalidating with ETag/Last-Modified, so repeated runs do not re-hit the site; empty disables it") // HTTP cache
+
+var httpCacheMaxSize = flag.Int64("http-cache-max-size", 2<<20, "largest response body, in bytes, the HTTP cache stores; pages and small assets fit, downloads do not") // Largest cached body
+
+var httpCacheTTL = flag.Duration("http-cache-ttl", 0, "treat cached responses as fresh for at least this long, whatever the server says (e.g. 1h while developing selectors)") // Minimum freshness
+
+var filesListenAddress = flag.String("files-listen", "localhost:8000", "address the serve-files subcommand listens on; the default only serves this machine, \":8000\" serves the whole LAN") // HTTP listen address for serve-files mode
+
+var listenAddress = flag.String("listen", "127.0.0.1:8080", "address the serve subcommand listens on") // HTTP listen address for serve mode
+
+var grpcListenAddress = flag.String("grpc-listen", "", "address for the gRPC control service (TriggerScrape, GetStatus, StreamEvents); empty disables it") // gRPC listen address
+
+var layoutMode = flag.String("layout", "flat", "output layout: \"flat\" stores every file directly in the output directory, \"mirror\" preserves the remote URL path, \"model\" files each download under the radio or accessory it is for") // Selects how downloaded files are arranged on disk
+
+var configPath = flag.String("config", "", "JSON config file with \"sources\" and \"flags\"; command-line flags take precedence, and daemon mode re-reads it on SIGHUP") // Optional configuration file
+
+var inboxDirectory = flag.String("inbox", "", "in daemon mode, a drop folder polled for PDFs: each one is validated, filed per the naming scheme, cataloged, and moved into the archive; rejected files go to its \"rejected\" subdirectory; empty disables it") // Drop folder for manual additions
+
+var inboxPollInterval = flag.Duration("inbox-poll", 30*time.Second, "how often daemon mode checks the -inbox folder") // Inbox polling interval
+
+var inboxSettle = flag.Duration("inbox-settle", 10*time.Second, "leave inbox files modified more recently than this for the next poll, so files still being copied are not imported half-written") // Time a dropped file must be left alone
+
+var runInterval = flag.Duration("interval", 0, "run as a daemon, archiving again after each interval (e.g. 6h); 0 runs once and exits") // Enables daemon mode
+
+var sourceURLs = []string{ // Start of a slice literal containing URLs to be scraped, replaced by "sources" in the config file
+	"https://radiomasterrc.com/pages/user-manuals",
+}
+
+var commandLineFlags = make(map[string]bool) // Flags set explicitly on the command line, which config files never override
+
+var workingDirectory = flag.String("workdir", "", "change to this directory before doing anything else (used by installed services, which start elsewhere)") // Directory the archive lives in
+
+var daemonSignals = make(chan os.Signal, 1) // Reload and stop requests for daemon mode, from the OS or a service manager
+
+var platformMain func() bool // Platform-specific entry point (e.g. the Windows service) that returns true when it handled the run
+
+func main() { // Main function, the entry point of the program
+	flag.Parse()                          // Parse the command-line flags
+	flag.Visit(func(setFlag *flag.Flag) { // Remember which flags were given on the command line
+		commandLineFlags[setFlag.Name] = true // Mark the flag as set by the user
+	}) // End of flag visit
+
+	if *configPath != "" { // A config path given relative to where the program started
+		absoluteConfigPath, absError := filepath.Abs(*configPath) // Resolve it before changing directory
+		if absError != nil {                                      // Check if the path cannot be resolved
+			logFatal(absError) // Stop with a clear message
+		}
+		*configPath = absoluteConfigPath // Reloads read the same file
+	}
+	if *workingDirectory != "" { // Move into the archive directory when asked, so the config's paths are relative to it
+		if chdirError := os.Chdir(*workingDirectory); chdirError != nil { // Change the working directory
+			logFatal(chdirError) // Stop with a clear message
+		}
+	}
+	if *configPath != "" { // Apply the config file when one is given
+		if configError := applyConfig(*configPath); configError != nil { // Load and apply the config
+			logFatal(configError) // Stop with a clear message
+		}
+	}
+	if validationError := validateFlags(); validationError != nil { // Reject invalid settings early
+		logFatal(validationError) // Stop with a clear message
+	}
+
+	if *logFilePath != "" { // Log to a file instead of stderr
+		logFile, openError := openRotatingLogFile(*logFilePath) // Open the file before profiles change directory
+		if openError != nil {                                   // Check if the file could not be opened
+			logFatal(openError) // Stop with a clear message
+		}
+		logDestination = logFile // Send log output to the file
+		logToConsole = false     // Keep escape codes out of the file
+	}
+
+	if *logBackend != "" { // Log to the system log instead of stderr
+		if openSystemLog == nil { // Check if the platform has no system log
+			logFatalf("-log-backend %s is not supported on this platform", *logBackend) // Stop with a clear message
+		}
+		systemLog, openError := openSystemLog(*logBackend) // Connect to the system log
+		if openError != nil {                              // Check if the connection failed
+			logFatal(openError) // Stop with a clear message
+		}
+		log.SetFlags(0)            // The system log timestamps entries itself
+		logDestination = systemLog // Send log output to the system log
+		logToConsole = false       // Keep escape codes out of the system log
+	}
+
+	logDestination = &leveledLogWriter{next: logDestination, minimumPriority: logLevelPriorities[*logLevel], colorize: logToConsole && useConsoleColor()} // Filter, and on a terminal color and group, every log line
+	log.SetOutput(logDestination)                                                                                                                         // Start using it
+
+	if baseTransport, isTransport := http.DefaultTransport.(*http.Transport); isTransport { // Guard the connections of downloads
+		baseTransport.DialContext = publicOnlyDialer(baseTransport.DialContext) // Refuse internal addresses, even after DNS changes or redirects
+	}
+	http.DefaultTransport = &meteringTransport{next: http.DefaultTransport} // Account for the bandwidth of every HTTP client without its own transport
+	if *httpCacheDirectory != "" {                                          // Cache pages and small assets on disk
+		absolutePath, absError := filepath.Abs(*httpCacheDirectory) // Profiles change directory, so fix the cache's location now
+		if absError != nil {                                        // Check if the path cannot be resolved
+			logFatal(absError) // Stop with a clear message
+		}
+		if mkdirError := os.MkdirAll(absolutePath, 0o755); mkdirError != nil { // Create the cache directory
+			logFatal(mkdirError) // Stop with a clear message
+		}
+		http.DefaultTransport = &cachingTransport{next: http.DefaultTransport, directory: absolutePath} // Cache hits never reach the network or the bandwidth account
+	}
+
+	if *auditLogPath != "" { // Audit every request and file change
+		absolutePath, absError := filepath.Abs(*auditLogPath) // Profiles change directory, so fix the log's location now
+		if absError != nil {                                  // Check if the path cannot be resolved
+			logFatal(absError) // Stop with a clear message
+		}
+		*auditLogPath = absolutePath                                            // Use the absolute path
+		http.DefaultTransport = &auditingTransport{next: http.DefaultTransport} // Every HTTP client without its own transport is audited
+	}
+
+	if *inboxDirectory != "" { // Poll a drop folder in daemon mode
+		absolutePath, absError := filepath.Abs(*inboxDirectory) // Profiles change directory, so fix the inbox's location now
+		if absError != nil {                                    // Check if the path cannot be resolved
+			logFatal(absError) // Stop with a clear message
+		}
+		*inboxDirectory = absolutePath // Use the absolute path
+	}
+
+	if platformMain != nil && platformMain() { // Let the platform handle service commands and service runs
+		return // The platform handled the run
+	}
+
+	if flag.Arg(0) == "query" { // The query subcommand only reads the catalog
+		loadCatalog(filepath.Join("PDFs/", catalogFilename))            // Load the catalog to search
+		if queryError := runQuery(flag.Args()[1:]); queryError != nil { // Print the matching files
+			logFatal(queryError) // Stop with a clear message
+		}
+		return // Skip the download run
+	}
+
+	if flag.Arg(0) == "import" { // The import subcommand folds manually downloaded manuals into the archive
+		if importError := runImport(flag.Arg(1), "PDFs/"); importError != nil { // Catalog the folder's PDFs
+			logFatal(importError) // Stop with a clear message
+		}
+		return // Skip the download run
+	}
+
+	if flag.Arg(0) == "sync" { // The sync subcommand pulls new and changed files from a primary instance
+		if syncError := runSync(flag.Arg(1), "PDFs/"); syncError != nil { // Sync from the primary
+			logFatal(syncError) // Stop with a clear message
+		}
+		return // Skip the download run
+	}
+
+	if flag.Arg(0) == "merge" { // The merge subcommand combines another machine's archive into this one
+		if mergeError := runMerge(flag.Arg(1), "PDFs/"); mergeError != nil { // Merge the other archive
+			logFatal(mergeError) // Stop with a clear message
+		}
+		return // Skip the download run
+	}
+
+	if *checkOnly { // The fast refresh only asks the servers about cataloged files
+		catalogPath := filepath.Join("PDFs/", catalogFilename) // Where the catalog is stored
+		loadCatalog(catalogPath)                               // Load the catalog to compare against
+		refreshCatalogHeaders()                                // Flag changed files
+		recordRunTransfers()                                   // Add the requests' bandwidth to the catalog
+		saveCatalog(catalogPath)                               // Keep the flags for the next full run
+		writeUpdateTimeline("PDFs/")                           // Publish any newly dated updates
+		return                                                 // Skip the download run
+	}
+
+	if flag.Arg(0) == "check" { // The check subcommand only compares the live site with the catalog
+		loadCatalog(filepath.Join("PDFs/", catalogFilename)) // Load the catalog to compare against
+		runCheck(removeDuplicatesFromSlice(sourceURLs))      // Print new and removed links without downloading anything
+		return                                               // Skip the download run
+	}
+
+	if flag.Arg(0) == "linkcheck" { // The linkcheck subcommand only asks the servers whether cataloged links still work
+		loadCatalog(filepath.Join("PDFs/", catalogFilename)) // Load the catalog to check
+		runLinkCheck("PDFs/")                                // Report dead, moved and changed links without downloading anything
+		return                                               // Skip the download run
+	}
+
+	settings := captureServerSettings() // Fix what the servers show before any run can switch directories or flags
+
+	if *grpcListenAddress != "" { // Let other services control the archiver
+		go runGRPCServer(*grpcListenAddress) // Serve the control API in the background
+	}
+
+	if flag.Arg(0) == "serve-files" { // The serve-files subcommand only serves the archive tree
+		runFileServer(*filesListenAddress, settings) // Serve the files until the process is stopped
+		return                                       // The server has stopped
+	}
+
+	if flag.Arg(0) == "serve" { // The serve subcommand runs the web dashboard
+		if daemonScheduled() { // Keep archiving on a schedule alongside the dashboard
+			go func() { // Run scheduled archives in the background
+				runDaemon()           // Until stopped
+				exitOnStrictFailure() // A -strict run that stopped ends the process once it has cleaned up
+			}()
+		}
+		runServer(*listenAddress, settings) // Serve the dashboard until the process is stopped
+		return                              // The server has stopped
+	}
+
+	if daemonScheduled() { // Daemon mode keeps archiving on a schedule
+		runDaemon()           // Run until stopped by a signal or a -strict error
+		drainWebhooks()       // Deliver the last events
+		exitOnStrictFailure() // Exit non-zero after a -strict error
+		return                // The daemon has stopped
+	}
+
+	runAllProfiles()      // Archive every profile once
+	drainWebhooks()       // Deliver the last events
+	exitOnStrictFailure() // Exit non-zero after a -strict error
+} // End of the main function
+
+// Takes the run lock, waiting for any other run to finish first
+func lockArchiveRun() { // Function to start exclusive access to the archive
+	archiveRunMutex.Lock()     // Wait for any other run to finish
+	archiveRunning.Store(true) // Report the run as in progress
+} // End of lockArchiveRun function
+
+// Takes the run lock only when no other run is in progress, reporting whether it did
+func tryLockArchiveRun() bool { // Function to start exclusive access without waiting
+	if !archiveRunMutex.TryLock() { // Another run holds the lock
+		return false // Leave it alone
+	}
+	archiveRunning.Store(true) // Report the run as in progress
+	return true                // The caller now holds the lock
+} // End of tryLockArchiveRun function
+
+// Releases the run lock taken by lockArchiveRun or tryLockArchiveRun
+func unlockArchiveRun() { // Function to end exclusive access to the archive
+	archiveRunning.Store(false) // No run is in progress anymore
+	archiveRunMutex.Unlock()    // Allow the next run
+} // End of unlockArchiveRun function
+
+// Starts a run of every profile in the background unless one is already in progress, holding the run lock from the
+// check until the run ends so two triggers can never both start one
+func startBackgroundRun() bool { // Function to trigger a run without waiting for it
+	if !tryLockArchiveRun() { // Refuse to start a second run
+		return false // Tell the caller
+	}
+	go func() { // Run in the background
+		defer unlockArchiveRun() // Allow the next run when done
+		archiveAllProfiles()     // Run every profile under the lock already held
+	}()
+	return true // The run started
+} // End of startBackgroundRun function
+
+// Performs one complete archive run: scrape every source, download new files, and update the catalog and derived trees.
+// Callers must hold archiveRunMutex.
+func archiveOnce() { // Function implementing one archive run
+	runStatistics.reset()                                          // Reset the counters for this run
+	cancelRun := startRunContext()                                 // Give the run a context -strict can cancel
+	defer cancelRun()                                              // End it with the run
+	stopThroughputSampler := startThroughputSampler(runStatistics) // Measure download speeds during the run
+	emitEvent("run_started", runStatistics)                        // Notify listeners that a run began
+
+	if *tuiMode { // Show the live dashboard while the run is in progress
+		stopDashboard := startDashboard() // Take over the terminal
+		defer stopDashboard()             // Restore it and print the summary when the run ends
+	}
+
+	outputDirectory := "PDFs/"             // Directory where downloaded PDF files will be saved
+	if !directoryExists(outputDirectory) { // Check if the directory already exists
+		createDirectory(outputDirectory, 0o755) // Create the directory with full read, write, and execute permissions (rwxr-xr-x)
+	}
+	firmwareDirectory := "Firmware/"                                       // Directory where downloaded firmware packages will be saved
+	softwareDirectory := "Software/"                                       // Directory where downloaded desktop software and drivers will be saved
+	catalogPath := filepath.Join(outputDirectory, catalogFilename)         // Where the catalog is stored
+	loadCatalog(catalogPath)                                               // Load the catalog from previous runs
+	brokenLinksPath := filepath.Join(outputDirectory, brokenLinksFilename) // Where links failing across runs are listed
+	loadBrokenLinks(brokenLinksPath)                                       // Load the failures of previous runs
+
+	// Remove all the duplicate URLs
+	urls := removeDuplicatesFromSlice(sourceURLs) // Calls a custom function to ensure the list of URLs is unique
+
+	var downloadQueue []string             // PDF links waiting to be downloaded
+	var firmwareQueue []string             // Firmware links waiting to be downloaded
+	var softwareQueue []string             // Desktop software and driver links waiting to be downloaded
+	var productPages []string              // Product pages linked from the source pages
+	var hostedLinks []string               // Share links on file hosts, resolved before downloading
+	linkSources := make(map[string]string) // Page each queued link was found on
+
+	scrapedSources := scrapePages(urls) // Scrape every source in parallel, at most -max-browsers at a time
+
+	// Loop through each URL to process
+	for urlIndex, url := range urls { // Iterates over the cleaned slice of URLs
+		// Validate the URL
+		if isUrlValid(url) { // Checks if the current URL is syntactically valid
+			// Fetch HTML content from the URL
+			htmlContent := scrapedSources[urlIndex]        // The fully rendered HTML scraped above
+			linkHTML := scopeToSelectors(url, htmlContent) // Limit link extraction to the source's selectors
+
+			// Extract PDF URLs from the HTML content
+			pdfUrls := extractPDFUrls(url, linkHTML)                                  // Finds all links ending in ".pdf" in the scraped HTML
+			downloadQueue = append(downloadQueue, pdfUrls...)                         // Queue every found PDF link for download
+			firmwareUrls := extractFirmwareUrls(url, linkHTML)                        // Finds all links to firmware packages in the scraped HTML
+			firmwareQueue = append(firmwareQueue, firmwareUrls...)                    // Queue every found firmware link for download
+			softwareUrls := extractSoftwareUrls(url, linkHTML)                        // Finds all links to installers and drivers in the scraped HTML
+			softwareQueue = append(softwareQueue, softwareUrls...)                    // Queue every found software link for download
+			for _, link := range slices.Concat(pdfUrls, firmwareUrls, softwareUrls) { // Remember where each link was found
+				linkSources[link] = url // Record the source page
+			}
+			for _, link := range extractLinks(url, linkHTML, isHostedFileLink) { // Collect share links to file hosts
+				hostedLinks = append(hostedLinks, link) // Queue the link for resolving
+				linkSources[link] = url                 // Record the source page
+			}
+			for _, link := range extractLinks(url, linkHTML, isMegaLink) { // Mega files cannot be downloaded without Mega's client
+				recordExternalAsset(resolveLink(url, link), url) // Record them in the catalog instead
+			}
+
+			if releaseNotes := extractReleaseNotes(linkHTML); releaseNotes != "" { // Keep any release notes published on the page
+				saveReleaseNotes(url, releaseNotes, firmwareDirectory) // Store them as Markdown alongside the firmware
+			}
+
+			for _, productLink := range extractLinks(url, linkHTML, isProductLink) { // Collect links to product pages
+				productPages = append(productPages, canonicalProductURL(resolveLink(url, productLink))) // Remember the absolute, query-free product URL
+			}
+		} // End of URL validation block
+	} // End of the main URL iteration loop
+
+	if *scrapeProducts { // Only visit product pages when requested
+		uniqueProductPages := removeDuplicatesFromSlice(productPages)           // Each product page only needs scraping once
+		scrapedProducts := scrapePages(uniqueProductPages, clickDownloadTabs()) // Render the product pages with their Downloads/Support tabs opened
+		for productIndex, productURL := range uniqueProductPages {              // Visit each unique product page
+			productHTML := scrapedProducts[productIndex] // The rendered product page
+			if productHTML == "" {                       // Check if the page could not be scraped
+				continue // Move on to the next product
+			}
+			recordProductSpecs(productURL, productHTML) // Store the product's specification table in the catalog
+
+			productLinkHTML := scopeToSelectors(productURL, productHTML)       // Limit link extraction to the page's selectors
+			for _, link := range extractPDFUrls(productURL, productLinkHTML) { // Collect PDFs linked from the product page
+				downloadQueue = append(downloadQueue, resolveLink(productURL, link)) // Queue the absolute PDF URL
+				linkSources[resolveLink(productURL, link)] = productURL              // Record the source page
+			}
+			for _, link := range extractFirmwareUrls(productURL, productLinkHTML) { // Collect firmware linked from the product page
+				firmwareQueue = append(firmwareQueue, resolveLink(productURL, link)) // Queue the absolute firmware URL
+				linkSources[resolveLink(productURL, link)] = productURL              // Record the source page
+			}
+			for _, link := range extractSoftwareUrls(productURL, productLinkHTML) { // Collect software linked from the product page
+				softwareQueue = append(softwareQueue, resolveLink(productURL, link)) // Queue the absolute software URL
+				linkSources[resolveLink(productURL, link)] = productURL              // Record the source page
+			}
+			for _, link := range extractLinks(productURL, productLinkHTML, isHostedFileLink) { // Collect share links to file hosts
+				hostedLinks = append(hostedLinks, resolveLink(productURL, link)) // Queue the absolute link for resolving
+				linkSources[resolveLink(productURL, link)] = productURL          // Record the source page
+			}
+			for _, link := range extractLinks(productURL, productLinkHTML, isMegaLink) { // Mega files cannot be downloaded without Mega's client
+				recordExternalAsset(resolveLink(productURL, link), productURL) // Record them in the catalog instead
+			}
+			if releaseNotes := extractReleaseNotes(productHTML); releaseNotes != "" { // Keep any release notes published on the page
+				saveReleaseNotes(productURL, releaseNotes, firmwareDirectory) // Store them as Markdown alongside the firmware
+			}
+		}
+	}
+
+	var updatePosts []string // Blog posts that mention firmware or manual updates
+	if *scrapeBlog {         // Only archive the blog when requested
+		blogPdfUrls, blogFirmwareUrls, flaggedPosts := archiveBlogPosts(blogListingURL, "Blog/") // Archive new posts and collect their attachments
+		downloadQueue = append(downloadQueue, blogPdfUrls...)                                    // Queue PDFs attached to posts
+		firmwareQueue = append(firmwareQueue, blogFirmwareUrls...)                               // Queue firmware attached to posts
+		updatePosts = flaggedPosts                                                               // Remember posts for the end-of-run report
+		for _, link := range append(blogPdfUrls, blogFirmwareUrls...) {                          // Remember where each attachment was found
+			linkSources[link] = blogListingURL // Record the blog as the source
+		}
+	}
+
+	if *githubRepositories != "" { // Only mirror GitHub releases when repositories are configured
+		releaseFirmware, releaseSoftware := listGitHubReleaseAssets(configuredGitHubRepositories(), linkSources) // List the newest releases' assets
+		firmwareQueue = append(firmwareQueue, releaseFirmware...)                                                // Queue firmware images and archives
+		softwareQueue = append(softwareQueue, releaseSoftware...)                                                // Queue companion installers
+	}
+
+	hostedPDFs, hostedFirmware, hostedSoftware := resolveHostedLinks(removeDuplicatesFromSlice(hostedLinks)) // Find out which file each share link serves
+	downloadQueue = append(downloadQueue, hostedPDFs...)                                                     // Queue shared manuals
+	firmwareQueue = append(firmwareQueue, hostedFirmware...)                                                 // Queue shared firmware
+	softwareQueue = append(softwareQueue, hostedSoftware...)                                                 // Queue shared software
+
+	downloadQueue = canonicalizeQueue(downloadQueue, linkSources) // Collapse cache-busted variants of the same PDF
+	firmwareQueue = canonicalizeQueue(firmwareQueue, linkSources) // Collapse cache-busted variants of the same firmware
+	softwareQueue = canonicalizeQueue(softwareQueue, linkSources) // Collapse cache-busted variants of the same installer
+	downloadQueue = restrictToAllowedHosts(downloadQueue)         // Drop manual links to unknown hosts
+	firmwareQueue = restrictToAllowedHosts(firmwareQueue)         // Drop firmware links to unknown hosts
+	softwareQueue = restrictToAllowedHosts(softwareQueue)         // Drop software links to unknown hosts
+	httpsUpgrades := make(map[string]string)                      // Original http:// link of each upgraded link
+	if *httpsUpgrade {                                            // Avoid fetching files over plaintext
+		downloadQueue = upgradeQueueToHTTPS(downloadQueue, linkSources, httpsUpgrades) // Upgrade manual links
+		firmwareQueue = upgradeQueueToHTTPS(firmwareQueue, linkSources, httpsUpgrades) // Upgrade firmware links
+		softwareQueue = upgradeQueueToHTTPS(softwareQueue, linkSources, httpsUpgrades) // Upgrade software links
+	}
+
+	resetDownloadStatuses()                  // Forget failures from earlier runs
+	setDownloadSourcePages(linkSources)      // Let downloads send their page as Referer and use its headers
+	downloadAttempts := make(map[string]int) // Number of attempts made for each queued link
+	if *prevalidateDownloads {               // Only real files reach the download phase
+		downloadQueue = prevalidateQueue(downloadQueue, outputDirectory, pdfContentTypes, linkSources)        // Drop dead manual links
+		firmwareQueue = prevalidateQueue(firmwareQueue, firmwareDirectory, firmwareContentTypes, linkSources) // Drop dead firmware links
+		softwareQueue = prevalidateQueue(softwareQueue, softwareDirectory, softwareContentTypes, linkSources) // Drop dead software links
+	}
+
+	// Download each queued PDF into the designated PDF directory, re-queuing files that arrive corrupt
+	for len(downloadQueue) > 0 && !runStopped() { // Keep going until the queue is empty or the run stops
+		pdfUrl := downloadQueue[0]                                                            // Take the next link from the front of the queue
+		downloadQueue = downloadQueue[1:]                                                     // Remove it from the queue
+		dashboard.setQueueDepth(len(downloadQueue) + len(firmwareQueue) + len(softwareQueue)) // Show how much work is left
+		if downloadAttempts[pdfUrl] == 0 && isQuarantined(pdfUrl) {                           // Links that keep failing are only re-checked now and then
+			logWarningf("Skipping quarantined link: %s", pdfUrl) // Log the skip
+			runStatistics.add(&runStatistics.Skipped, 1)         // Count the skipped file
+			continue                                             // Move on to the next link
+		}
+		downloadAttempts[pdfUrl]++ // Count this attempt
+
+		waitForSourceRateLimit(linkSources[pdfUrl]) // Respect the rate limit of the page the link was found on
+		if !downloadPDF(pdfUrl, outputDirectory) {  // Download the PDF into the 'PDFs/' directory
+			if retryAfterRateLimit(pdfUrl) { // Rate-limited links wait at the back of the queue for their host's pause to end
+				downloadQueue = append(downloadQueue, pdfUrl) // Re-queue the link
+				continue                                      // Carry on with the rest of the queue
+			}
+			if freshURL := refreshExpiredLink(pdfUrl, linkSources); freshURL != "" { // Expired signed links get one retry with a fresh signature
+				runStatistics.add(&runStatistics.Failed, -1)    // The retry decides whether the file failed
+				downloadQueue = append(downloadQueue, freshURL) // Queue the fresh link
+			}
+			continue // Nothing new was saved, so there is nothing to validate
+		}
+
+		savedPath := outputPathForURL(pdfUrl, outputDirectory)                     // Where the PDF was just saved
+		if validationError := validatePDFFile(savedPath); validationError != nil { // Check the saved file for truncation or corruption
+			logWarningf("Corrupt PDF from %s (attempt %d of %d): %v", pdfUrl, downloadAttempts[pdfUrl], maxDownloadAttempts, validationError) // Log the problem
+			runStatistics.add(&runStatistics.Downloaded, -1)                                                                                  // The download no longer counts as completed
+			runStatistics.add(&runStatistics.Failed, 1)                                                                                       // Count it as failed instead
+			quarantineFile(savedPath, pdfUrl, validationError.Error())                                                                        // Move the bad file aside so it can be fetched again
+			delete(archiveCatalog.Entries, pdfUrl)                                                                                            // Forget the bad file in the catalog
+			if downloadAttempts[pdfUrl] < maxDownloadAttempts {                                                                               // Check if there are attempts left
+				downloadQueue = append(downloadQueue, pdfUrl) // Re-queue the link at the back of the queue
+			} else {
+				emitEvent("error", map[string]any{"stage": "validate", "url": pdfUrl, "error": validationError.Error()}) // Notify the webhook once no attempt is left
+			}
+		}
+	} // End of the download queue loop
+
+	attemptedFirmware := downloadPackageQueue(firmwareQueue, firmwareDirectory, "firmware", linkSources, len(softwareQueue)) // Save the firmware into the 'Firmware/' directory
+	attemptedSoftware := downloadPackageQueue(softwareQueue, softwareDirectory, "software", linkSources, 0)                  // Save installers and drivers into the 'Software/' directory
+
+	for link, sourcePage := range linkSources { // Attribute every cataloged link to the page it was found on
+		if entry, found := archiveCatalog.Entries[link]; found { // Check if the link is cataloged
+			entry.SourcePage = sourcePage // Record the source page
+		}
+	}
+	for link, plainLink := range httpsUpgrades { // Record which links were upgraded to HTTPS
+		if entry, found := archiveCatalog.Entries[link]; found { // Check if the link is cataloged
+			entry.UpgradedFrom = plainLink // Record the original link
+		}
+	}
+
+	for pdfUrl := range downloadAttempts { // A link succeeded if its file is on disk, whether downloaded now or before
+		recordLinkOutcome(pdfUrl, linkSources[pdfUrl], fileExists(outputPathForURL(pdfUrl, outputDirectory))) // Track failures across runs
+	}
+	for _, firmwareUrl := range attemptedFirmware { // The same for firmware
+		recordLinkOutcome(firmwareUrl, linkSources[firmwareUrl], fileExists(outputPathForURL(firmwareUrl, firmwareDirectory))) // Track failures across runs
+	}
+	for _, softwareUrl := range attemptedSoftware { // And for software
+		recordLinkOutcome(softwareUrl, linkSources[softwareUrl], fileExists(outputPathForURL(softwareUrl, softwareDirectory))) // Track failures across runs
+	}
+	saveBrokenLinks(brokenLinksPath) // Report the links failing across runs
+
+	if *submitWayback { // Only submit when requested
+		submitToWayback(slices.Sorted(maps.Keys(downloadAttempts))) // Preserve the manual links publicly too
+	}
+	if *submitArchiveToday { // Only submit when requested
+		submitToArchiveToday(removeDuplicatesFromSlice(append(slices.Clone(urls), productPages...))) // Preserve the source and product pages publicly too
+	}
+
+	recordRunTransfers()                                               // Add the run's bandwidth to the catalog
+	saveCatalog(catalogPath)                                           // Persist the catalog for the next run
+	writeUpdateTimeline(outputDirectory)                               // Publish when each product's documentation changed
+	checksumsPath := filepath.Join(outputDirectory, checksumsFilename) // Where the checksum list is written
+	writeChecksums(checksumsPath)                                      // List every archived file's SHA-256 for sha256sum -c
+	signArchiveFiles(catalogPath, checksumsPath)                       // Sign the manifest and the checksums when a key is configured
+	if *tsaURL != "" {                                                 // Only timestamp when a TSA is configured
+		timestampFile(checksumsPath, *tsaURL) // Obtain a trusted timestamp for the checksums
+	}
+	writeProductSpecsCSV(filepath.Join(outputDirectory, "product_specs.csv")) // Export the specification tables for spreadsheets
+	if *translateURL != "" && *translateLanguages != "" {                     // Only translate when a backend and languages are configured
+		translateManuals(*translateURL, strings.Split(*translateLanguages, ",")) // Store translations next to the manuals
+	}
+	if *markdownIndexPath != "" { // Only write the Markdown index when requested
+		writeMarkdownIndex(*markdownIndexPath) // List the manuals for the Git mirror
+	}
+	if *calibreDirectory != "" { // Only export for Calibre when requested
+		writeCalibreExport(*calibreDirectory) // Give Calibre users titled books
+	}
+
+	updateLatestLinks(outputDirectory) // Point each product's "latest" link at its newest manual revision
+
+	if *siteDirectory != "" { // Only generate the index site when requested
+		writeIndexSite(*siteDirectory) // Write the browsable index of the archive
+	}
+
+	if *convertPDFA { // Only convert when requested
+		convertArchiveToPDFA(outputDirectory, *archivalDirectory) // Produce PDF/A copies of any PDFs that lack one
+	}
+
+	if *compressPDFs { // Only compress when requested
+		compressArchivePDFs(outputDirectory, *compressedDirectory) // Produce compressed copies of any PDFs that lack one
+	}
+
+	reportEncryptedPDFs(outputDirectory) // List encrypted PDFs separately so they are not mistaken for processed files
+
+	if downloaded, _, failed := runStatistics.counts(); failed > 0 && float64(failed)*100 > *maxFailurePercent*float64(downloaded+failed) { // Check if failures look systemic rather than transient
+		runStatistics.markFailed()                                                                                                                            // Mark the run as failed
+		logErrorf("Run failed: %d of %d downloads failed, more than the %g%% allowed by -max-failure-percent", failed, downloaded+failed, *maxFailurePercent) // Report it
+		emitEvent("run_failed", map[string]any{"failed": failed, "attempted": downloaded + failed, "max_failure_percent": *maxFailurePercent})                // Notify listeners
+	}
+
+	stopThroughputSampler()                                                                                      // Record the run's average speed
+	_, averageSpeed, peakSpeed := runStatistics.throughput()                                                     // The run's speeds
+	log.Printf("Throughput: %s/s peak, %s/s average", formatByteCount(peakSpeed), formatByteCount(averageSpeed)) // Report them
+	runStatistics.finish()                                                                                       // Record when the run ended
+	emitEvent("run_finished", runStatistics)                                                                     // Notify the webhook with the run's counters
+	appendRunHistory(filepath.Join(outputDirectory, runHistoryFilename), runStatistics)                          // Record the run for the dashboard's history
+	if *writeProvenance {                                                                                        // Only attest when requested
+		writeRunProvenance(filepath.Join(outputDirectory, provenanceDirectory), urls, runStatistics) // Attest where this run's files came from
+	}
+
+	if len(updatePosts) > 0 { // Report blog posts that announce firmware or manual updates
+		log.Printf("%d new blog post(s) mention firmware or manual updates:", len(updatePosts)) // Report header
+		for _, postURL := range updatePosts {                                                   // List each flagged post
+			log.Printf("  update post: %s", postURL) // Report the post
+		}
+	}
+} // End of archiveOnce function
+
+// Uses headless Chrome via chromedp to get the fully rendered HTML from a webpage,
+// waiting 10 seconds to bypass Cloudflare's JavaScript challenge before scraping.
+// Any extra actions run after the page has settled and before the HTML is captured.
+func scrapePageHTMLWithChrome(targetURL string, settings sourceSettings, extraActions ...chromedp.Action) (string, int) { // Function to scrape dynamic content using Chrome
+	acquireBrowserSlot()       // Wait for a free browser slot (-max-browsers)
+	defer releaseBrowserSlot() // Free it once the browser has exited
+
+	log.Println("Scraping:", targetURL)                                                 // Log which page is being scraped
+	if destinationError := checkPublicDestination(targetURL); destinationError != nil { // Chrome must not open internal pages either
+		logWarning(destinationError) // Log the refusal
+		return "", 0                 // Nothing was scraped
+	}
+
+	pageLocale := settings.locale()                                                   // Locale to present to the site
+	browserContext, stopChrome := startChrome(pageLocale, 5*time.Minute+*captchaWait) // Start Chrome, stopping the session after 5 minutes plus any time allowed for a challenge
+	defer stopChrome()                                                                // Stop Chrome when finished
+
+	var renderedHTML string // Variable to store the rendered HTML content
+	pageStatus := 0         // HTTP status the page was served with, which tells challenge interstitials from pages that merely load a bot script
+
+	// Run Chrome automation: set up the session, navigate to the URL, wait for scripts, run any extra actions, then scrape
+	var setupActions []chromedp.Action  // Actions executed in order before the page is opened
+	chromeActions := []chromedp.Action{ // Actions executed in order inside the browser once the page is open
+		chromedp.Sleep(settings.wait), // Wait for Cloudflare JS checks and page scripts to finish
+	} // End of initial actions
+	if *humanDelay > 0 { // Behave less like a script on protected pages
+		setupActions = append([]chromedp.Action{chromedp.Sleep(jitterDuration(*humanDelay))}, setupActions...) // Hesitate before loading the page
+		chromeActions = append(chromeActions, simulateHumanActivity(*humanSteps, *humanDelay))                 // Move the mouse and scroll a little
+	}
+	if *captchaWait > 0 { // Let an operator get past interactive challenges
+		chromeActions = append(chromeActions, awaitChallengeSolved(targetURL, settings.WaitFor, *captchaWait, &pageStatus)) // Wait for the real page if a challenge shows
+	}
+	var networkLinks *networkLinkCollector // URLs seen in the page's network traffic
+	if *captureNetwork {                   // Watch the traffic for files injected by scripts
+		var watchAction chromedp.Action                                        // Action enabling network events
+		networkLinks, watchAction = watchNetworkLinks(browserContext)          // Start listening
+		setupActions = append([]chromedp.Action{watchAction}, setupActions...) // Enable the events before navigating
+	}
+	if settings.WaitFor != "" { // Wait for the content the source needs before going on
+		chromeActions = append(chromeActions, chromedp.WaitVisible(settings.WaitFor, chromedp.ByQuery)) // Block until the selector is visible
+	}
+	if pageLocale != "" { // Present the locale consistently to scripts and servers
+		setupActions = append([]chromedp.Action{emulation.SetLocaleOverride().WithLocale(strings.ReplaceAll(pageLocale, "-", "_"))}, setupActions...)                                  // Make Intl and date formatting follow the locale
+		setupActions = append([]chromedp.Action{network.Enable(), network.SetExtraHTTPHeaders(network.Headers{"Accept-Language": acceptLanguageHeader(pageLocale)})}, setupActions...) // Send the locale with every request; extra headers only apply with the network domain enabled
+	}
+	sourceHeaders := make(map[string]string)               // Headers only the source's own host receives
+	for headerName, headerValue := range downloadHeaders { // Add the config's headers
+		sourceHeaders[http.CanonicalHeaderKey(headerName)] = headerValue // Set the header
+	}
+	for headerName, headerValue := range settings.Headers { // Add the source's headers
+		sourceHeaders[http.CanonicalHeaderKey(headerName)] = headerValue // Set the header
+	}
+	if *blockResources || len(sourceHeaders) > 0 { // Skip heavy resources, or add the headers to the source's own requests
+		setupActions = append([]chromedp.Action{interceptRequests(browserContext, targetURL, sourceHeaders)}, setupActions...) // Intercept before navigating
+	}
+	if *autoScroll { // Load lazily rendered content before anything else looks at the page
+		chromeActions = append(chromeActions, scrollToBottom()) // Scroll until the page stops growing
+	}
+	if settings.Expand || len(settings.ExpandSelectors) > 0 { // Reveal content hidden in collapsed sections
+		chromeActions = append(chromeActions, expandCollapsedSections(settings.ExpandSelectors)) // Open everything that hides links
+	}
+	chromeActions = append(chromeActions, extraActions...)                           // Run page-specific actions such as opening tabs
+	chromeActions = append(chromeActions, chromedp.OuterHTML("html", &renderedHTML)) // Capture the complete rendered HTML content into renderedHTML
+
+	pageResponse, runError := chromedp.RunResponse(browserContext, append(setupActions, chromedp.Navigate(targetURL))...) // Open the target URL, keeping the response
+	if runError == nil {                                                                                                  // Check if the page opened
+		if pageResponse != nil { // Pages served from the cache have no response
+			pageStatus = int(pageResponse.Status) // Remember the status
+		}
+		runError = chromedp.Run(browserContext, chromeActions...) // Executes the rest of the actions in the browser
+	}
+	if runError != nil { // Check for errors during navigation or extraction
+		logError(runError)                                                                                 // Log the error
+		emitEvent("error", map[string]any{"stage": "scrape", "url": targetURL, "error": runError.Error()}) // Notify the webhook
+		return "", pageStatus                                                                              // Return an empty string to indicate failure
+	} // End of error check
+
+	emitEvent("page_scraped", map[string]any{"url": targetURL, "size": len(renderedHTML)}) // Notify listeners that a page rendered
+
+	if networkLinks != nil { // Add the harvested URLs as links so the usual extraction picks them up
+		renderedHTML += networkLinks.anchorsHTML() // Append the synthetic links
+	}
+	return renderedHTML, pageStatus // Return the fully rendered HTML source and its status
+} // End of scrapePageHTMLWithChrome function
+
+// Scrape settings for one source page, or for every page whose URL starts with the configured key
+type sourceSettings struct { // Fields of one "source_settings" entry in the config file
+	Wait            string                          `json:"wait,omitempty"`             // How long to let page scripts run after loading (e.g. "5s"); defaults to 3s
+	WaitFor         string                          `json:"wait_for,omitempty"`         // CSS selector that must be visible before the HTML is captured
+	Chrome          *bool                           `json:"chrome,omitempty"`           // Whether to render the page in Chrome; false fetches it with a plain HTTP GET, true skips the -plain-first attempt
+	RateLimit       string                          `json:"rate_limit,omitempty"`       // Minimum time between requests for the page and files found on it (e.g. "2s")
+	Headers         map[string]string               `json:"headers,omitempty"`          // Extra request headers for the page and the files found on it (e.g. tokens)
+	Locale          string                          `json:"locale,omitempty"`           // Locale presented to the source, overriding -locale (e.g. "en-GB")
+	Expand          bool                            `json:"expand,omitempty"`           // Open <details>, collapsed accordions, and tabs before capturing the page
+	ExpandSelectors []string                        `json:"expand_selectors,omitempty"` // Extra CSS selectors of controls to click when expanding (e.g. ".download-tab")
+	Selectors       []string                        `json:"selectors,omitempty"`        // CSS selectors (e.g. ".manual-list a[href]") limiting where links are extracted from
+	XPaths          []string                        `json:"xpaths,omitempty"`           // XPath expressions (e.g. "//table[@id='manuals']//a/@href") used like Selectors
+	wait            time.Duration                   // Parsed Wait
+	rateLimit       time.Duration                   // Parsed RateLimit
+	selectors       []func(*html.Node) []*html.Node // Compiled Selectors and XPaths, each returning the elements it matches
+} // End of sourceSettings struct
+
+var sourceSettingsByURL = make(map[string]sourceSettings) // Per-source settings from the config file, keyed by URL or URL prefix
+
+// Last request time per rate-limited settings key
+var sourceRequestTimes = struct {
+	sync.Mutex                      // Guards the request times
+	times      map[string]time.Time // Last request per settings key
+}{times: make(map[string]time.Time)}
+
+// Starts a Chrome instance presenting the given locale and returns its browser context, which ends after the timeout,
+// and a function that stops Chrome
+func startChrome(pageLocale string, timeout time.Duration) (context.Context, func()) { // Function to launch Chrome
+	// Configure Chrome options for the browser session
+	chromeOptions := append(chromedp.DefaultExecAllocatorOptions[:], // Starts with default Chrome execution options
+		chromedp.Flag("headless", false),              // Set to true for actual headless mode
+		chromedp.Flag("disable-gpu", true),            // Disable GPU acceleration (good for headless/servers)
+		chromedp.WindowSize(1, 1),                     // Set browser window size
+		chromedp.Flag("no-sandbox", true),             // Disable sandbox (useful for servers/containers)
+		chromedp.Flag("disable-setuid-sandbox", true), // Fix for Linux permission issues
+	) // End of Chrome options slice
+	if pageLocale != "" { // Start Chrome in that locale
+		chromeOptions = append(chromeOptions, chromedp.Flag("lang", pageLocale)) // Sets navigator.language and the default Accept-Language
+	}
+	if *stealthMode { // Look like an ordinary desktop browser
+		chromeOptions = append(chromeOptions, // Override the automation defaults
+			chromedp.WindowSize(1366, 768),                                  // A common laptop screen instead of 1x1
+			chromedp.Flag("disable-blink-features", "AutomationControlled"), // Stops Chrome from announcing automation itself
+			chromedp.Flag("enable-automation", false),                       // Drops the automation infobar and switch
+		) // End of stealth options
+	}
+
+	// Create a new Chrome execution allocator with the configured options, or connect to the remote browser
+	var execAllocatorContext context.Context // Context owning the browser
+	var cancelAllocator context.CancelFunc   // Stops or disconnects the browser
+	if *remoteBrowserURL != "" {             // Use the hosted browser; launch options do not apply to it
+		var remoteOptions []chromedp.RemoteAllocatorOption // How to treat the endpoint
+		if strings.HasPrefix(*remoteBrowserURL, "ws") {    // WebSocket endpoints are used as given
+			remoteOptions = append(remoteOptions, chromedp.NoModifyURL) // Do not look up /json/version
+		}
+		execAllocatorContext, cancelAllocator = chromedp.NewRemoteAllocator(runContext(), remoteBrowserEndpoint(), remoteOptions...) // Connect on first use; the session ends with the run
+	} else {
+		execAllocatorContext, cancelAllocator = chromedp.NewExecAllocator(runContext(), chromeOptions...) // Creates the context and cleanup function for the Chrome process, which ends with the run
+	}
+
+	// Set a timeout context to automatically stop the Chrome session
+	timeoutContext, cancelTimeout := context.WithTimeout(execAllocatorContext, timeout) // Creates a context with the timeout
+
+	// Create a new Chrome browser context for this task
+	browserContext, cancelBrowser := chromedp.NewContext(timeoutContext) // Creates the main browser context for automation
+	if *stealthMode {                                                    // Patch the tab before anything navigates it
+		if stealthError := chromedp.Run(browserContext, applyStealth(pageLocale)); stealthError != nil { // Start the browser and install the patches
+			logErrorf("Failed to apply stealth settings %v", stealthError) // Log the failure; the session still works without them
+		}
+	}
+
+	return browserContext, func() { // Function cleaning up all contexts
+		cancelBrowser()   // Stops the browser context
+		cancelTimeout()   // Stops the timeout context
+		cancelAllocator() // Stops the Chrome process allocator
+	} // End of cleanup function
+} // End of startChrome function
+
+// Script run in every document before the page's own scripts, hiding what differs between automated and ordinary Chrome
+const stealthScript = `(() => {
+	Object.defineProperty(Navigator.prototype, "webdriver", { get: () => undefined });
+	Object.defineProperty(Navigator.prototype, "languages", { get: () => %s });
+	Object.defineProperty(Navigator.prototype, "plugins", { get: () => [
+		{ name: "PDF Viewer", filename: "internal-pdf-viewer", description: "Portable Document Format" },
+		{ name: "Chrome PDF Viewer", filename: "internal-pdf-viewer", description: "Portable Document Format" },
+		{ name: "Chromium PDF Viewer", filename: "internal-pdf-viewer", description: "Portable Document Format" },
+	] });
+	window.chrome = window.chrome || { runtime: {}, app: { isInstalled: false } };
+	const queryPermission = navigator.permissions && navigator.permissions.query.bind(navigator.permissions);
+	if (queryPermission) {
+		navigator.permissions.query = (descriptor) => descriptor && descriptor.name === "notifications"
+			? Promise.resolve({ state: Notification.permission })
+			: queryPermission(descriptor);
+	}
+})();`
+
+// Returns an action that installs stealthScript in the tab and replaces the user agent with the browser's own minus
+// its "Headless" marker, with the locale's Accept-Language
+func applyStealth(pageLocale string) chromedp.Action { // Function to build the stealth action
+	languages := []string{"en-US", "en"} // navigator.languages of an English browser
+	if pageLocale != "" {                // Present the source's locale instead
+		languages = strings.Split(acceptLanguageHeader(pageLocale), ",")                  // The locale, then its language
+		languages[len(languages)-1], _, _ = strings.Cut(languages[len(languages)-1], ";") // Drop the quality value
+	}
+	languagesJSON, _ := json.Marshal(languages) // Encoding strings never fails
+
+	return chromedp.ActionFunc(func(browserContext context.Context) error { // Run against the tab
+		if _, scriptError := page.AddScriptToEvaluateOnNewDocument(fmt.Sprintf(stealthScript, languagesJSON)).Do(browserContext); scriptError != nil { // Install the script
+			return scriptError // Return the error
+		}
+		_, _, _, userAgent, _, versionError := browser.GetVersion().Do(browserContext) // The browser's real user agent
+		if versionError != nil {                                                       // Check if the version is unavailable
+			return versionError // Return the error
+		}
+		userAgentOverride := emulation.SetUserAgentOverride(strings.ReplaceAll(userAgent, "HeadlessChrome", "Chrome")) // Same browser, without the tell
+		if pageLocale != "" {                                                                                          // Keep the locale's Accept-Language
+			userAgentOverride = userAgentOverride.WithAcceptLanguage(acceptLanguageHeader(pageLocale)) // Set it with the user agent
+		}
+		return userAgentOverride.Do(browserContext) // Apply the override
+	}) // End of stealth action
+} // End of applyStealth function
+
+// Returns -browser-url with BROWSER_TOKEN added as its token query parameter, unless the URL already carries one
+func remoteBrowserEndpoint() string { // Function to build the remote browser address
+	browserToken := os.Getenv("BROWSER_TOKEN")              // Token of the browser service
+	endpointURL, parseError := url.Parse(*remoteBrowserURL) // Parse the endpoint; validateFlags has checked it
+	if browserToken == "" || parseError != nil {            // Check if there is a token to add
+		return *remoteBrowserURL // Use the endpoint as given
+	}
+	queryValues := endpointURL.Query()  // Existing parameters, e.g. browserless launch options
+	if queryValues.Get("token") == "" { // A token in the URL wins
+		queryValues.Set("token", browserToken) // Authenticate to the service
+	}
+	endpointURL.RawQuery = queryValues.Encode() // Put the parameters back
+	return endpointURL.String()                 // Return the endpoint
+} // End of remoteBrowserEndpoint function
+
+var browserTokenPattern = regexp.MustCompile(`([?&]token=)[^&\s"']+`) // Token query parameter of a -browser-url, wherever the URL shows up
+
+// Hides the remote browser service's token, from BROWSER_TOKEN or the -browser-url query, in text about to be logged
+func redactBrowserToken(text string) string { // Function to keep the token out of logs
+	if browserToken := os.Getenv("BROWSER_TOKEN"); browserToken != "" { // The token may appear outside a URL too
+		text = strings.ReplaceAll(text, browserToken, "REDACTED") // Hide it
+	}
+	return browserTokenPattern.ReplaceAllString(text, "${1}REDACTED") // Hide tokens given in the URL
+} // End of redactBrowserToken function
+
+// Downloads a file through Chrome, for hosts that answer plain HTTP clients with a block page (e.g. a Cloudflare
+// challenge) instead of the file; Chrome passes the challenge and the navigation turns into a download.
+// Returns nil if no download completed.
+func fetchFileWithChrome(fileURL string) []byte { // Function to download a file through the browser
+	if *remoteBrowserURL != "" { // A remote browser saves downloads on its own machine
+		logWarningf("Cannot fetch %s through the remote browser, which keeps downloads on its own machine", fileURL) // Log the limitation
+		return nil                                                                                                   // Nothing was downloaded
+	}
+	acquireBrowserSlot()       // Wait for a free browser slot (-max-browsers)
+	defer releaseBrowserSlot() // Free it once the browser has exited
+
+	log.Println("Fetching through Chrome:", fileURL)                                  // Log which file is being fetched
+	if destinationError := checkPublicDestination(fileURL); destinationError != nil { // Chrome must not open internal pages either
+		logWarning(destinationError) // Log the refusal
+		return nil                   // Nothing was downloaded
+	}
+
+	settings, _ := lookupSourceSettings(fileURL)                                 // Settings for the file's URL
+	browserContext, stopChrome := startChrome(settings.locale(), 15*time.Minute) // Start Chrome, allowing as long as a plain download
+	defer stopChrome()                                                           // Stop Chrome when finished
+
+	downloadDirectory, directoryError := os.MkdirTemp("", "archiver-download-") // Chrome saves the download here
+	if directoryError != nil {                                                  // Check if the directory could not be created
+		logError(directoryError) // Log the error
+		return nil               // Nothing was downloaded
+	}
+	defer os.RemoveAll(downloadDirectory) // The data is returned in memory, so the directory is only temporary
+
+	downloadStarted := make(chan string, 1)                 // Receives the URL the download comes from once the navigation turns into one
+	downloadFinished := make(chan string, 1)                // Receives the saved file's name, or "" if the download was canceled
+	chromedp.ListenTarget(browserContext, func(event any) { // Watch for download events
+		switch downloadEvent := event.(type) { // Check the event type
+		case *browser.EventDownloadWillBegin: // The download started
+			select {
+			case downloadStarted <- downloadEvent.URL: // Signal the start
+			default:
+			}
+		case *browser.EventDownloadProgress: // The download progressed
+			if downloadEvent.State == browser.DownloadProgressStateInProgress { // Only the end matters
+				return
+			}
+			savedName := ""                                                    // Canceled downloads saved nothing
+			if downloadEvent.State == browser.DownloadProgressStateCompleted { // Check if the download completed
+				savedName = downloadEvent.GUID // Files are saved under their GUID
+			}
+			select {
+			case downloadFinished <- savedName: // Report the outcome
+			default:
+			}
+		}
+	}) // End of download event listener
+
+	runError := chromedp.Run(browserContext, // Allow downloads, then open the file
+		browser.SetDownloadBehavior(browser.SetDownloadBehaviorBehaviorAllowAndName).WithDownloadPath(downloadDirectory).WithEventsEnabled(true), // Save downloads under their GUID and report progress
+		chromedp.Navigate(fileURL), // Open the file; after a challenge the page navigates on by itself
+	)
+	if runError != nil && !strings.Contains(runError.Error(), "net::ERR_ABORTED") { // Navigations that become downloads are reported as aborted
+		logErrorf("Failed to fetch %s through Chrome %v", fileURL, runError) // Log the error
+		return nil                                                           // Nothing was downloaded
+	}
+
+	select { // Give challenges time to pass before concluding the page is a real error page
+	case downloadURL := <-downloadStarted: // The download started
+		if !downloadHostAllowed(downloadURL) { // The page may have sent the browser anywhere
+			logWarningf("Not fetching %s through Chrome: it led to %s, which is not an allowed host (see -allowed-hosts)", fileURL, downloadURL) // Log the refusal
+			return nil                                                                                                                           // Stopping Chrome cancels the download
+		}
+	case <-time.After(settings.wait + time.Minute): // Nothing started
+		logErrorf("Chrome did not receive a file for %s", fileURL) // Log the failure
+		return nil                                                 // Nothing was downloaded
+	case <-browserContext.Done(): // The session timed out
+		return nil // Nothing was downloaded
+	}
+	select { // Wait for the download to end
+	case savedName := <-downloadFinished: // The download ended
+		if savedName == "" { // Check if it was canceled
+			logErrorf("Chrome canceled the download of %s", fileURL) // Log the failure
+			return nil                                               // Nothing was downloaded
+		}
+		fileData, readError := os.ReadFile(filepath.Join(downloadDirectory, savedName)) // Read the saved file
+		if readError != nil {                                                           // Check if the file could not be read
+			logError(readError) // Log the error
+			return nil          // Nothing was downloaded
+		}
+		return fileData // Return the file
+	case <-browserContext.Done(): // The session timed out
+		logErrorf("Timed out fetching %s through Chrome", fileURL) // Log the failure
+		return nil                                                 // Nothing was downloaded
+	}
+} // End of fetchFileWithChrome function
+
+// Reports whether downloaded data is an HTML page, as block pages and themed 404 pages served with a 200 status are
+func looksLikeHTML(data []byte) bool { // Function to sniff HTML
+	return strings.HasPrefix(http.DetectContentType(data), "text/html") // Sniff the leading bytes as browsers do
+} // End of looksLikeHTML function
+
+// Returns the settings whose key is the longest prefix of pageURL, and that key; an exact URL is simply the longest prefix
+func lookupSourceSettings(pageURL string) (sourceSettings, string) { // Function to find the settings for a page
+	matchedKey := ""                               // Best matching key so far
+	for settingsKey := range sourceSettingsByURL { // Check each configured key
+		if strings.HasPrefix(pageURL, settingsKey) && len(settingsKey) > len(matchedKey) { // Prefer the most specific key
+			matchedKey = settingsKey // Remember the better match
+		}
+	}
+	if matchedKey == "" { // No settings apply
+		return sourceSettings{wait: 3 * time.Second}, "" // The defaults
+	}
+	return sourceSettingsByURL[matchedKey], matchedKey // The matched settings
+} // End of lookupSourceSettings function
+
+// Returns the locale presented to the source, falling back to -locale
+func (settings sourceSettings) locale() string { // Method to resolve the locale setting
+	if settings.Locale != "" { // The source has its own locale
+		return settings.Locale // Use it
+	}
+	return *browserLocale // Fall back to the global locale
+} // End of locale method
+
+// Returns an Accept-Language value preferring the locale, then its language (e.g. "de-DE,de;q=0.9")
+func acceptLanguageHeader(locale string) string { // Function to build an Accept-Language header
+	language, _, hasRegion := strings.Cut(locale, "-") // Split off the region, if any
+	if !hasRegion {                                    // A bare language needs no fallback
+		return locale // Use it as is
+	}
+	return locale + "," + language + ";q=0.9" // Prefer the region, accept the language
+} // End of acceptLanguageHeader function
+
+var downloadHeaders map[string]string // Extra headers from the config file, sent with every request
+
+// Credentials for one protected host; they are only sent by the HTTP client, never by Chrome, so protected sources
+// need "chrome": false
+type hostCredentials struct { // Fields of one "credentials" entry in the config file
+	Username    string `json:"username,omitempty"`     // HTTP basic auth user name
+	Password    string `json:"password,omitempty"`     // HTTP basic auth password
+	PasswordEnv string `json:"password_env,omitempty"` // Environment variable holding the password instead
+	Token       string `json:"token,omitempty"`        // Bearer token, sent instead of basic auth
+	TokenEnv    string `json:"token_env,omitempty"`    // Environment variable holding the token instead
+} // End of hostCredentials struct
+
+var hostCredentialsByName = make(map[string]hostCredentials) // Credentials from the config file, keyed by lower-case host name
+
+// Page each queued download was found on, used for its Referer and source settings
+var downloadSourcePages = struct {
+	sync.Mutex                   // Guards pages
+	pages      map[string]string // Source page by file URL
+}{pages: make(map[string]string)}
+
+// Replaces the record of which page each download was found on
+func setDownloadSourcePages(linkSources map[string]string) { // Function to share the link sources with the download client
+	downloadSourcePages.Lock()              // Lock the record
+	defer downloadSourcePages.Unlock()      // Unlock when done
+	downloadSourcePages.pages = linkSources // Use the current run's sources
+} // End of setDownloadSourcePages function
+
+// Builds a GET request for a page or file. Files found on a page are requested with that page as Referer, as a browser
+// would, and with that page's source settings; then the locale's Accept-Language, the config's headers, and the
+// source's headers are applied, later ones winning.
+func newDownloadRequest(fileURL string) (*http.Request, error) { // Function to build download requests
+	downloadRequest, requestError := http.NewRequestWithContext(context.WithValue(runContext(), publicOnlyKey{}, true), http.MethodGet, hostedDownloadURL(fileURL), nil) // Build the GET request, for share links to the file itself; ends with the run, and its connections may only reach public addresses
+	if requestError != nil {                                                                                                                                             // Check if the URL is unusable
+		return nil, requestError // Return the error
+	}
+	if destinationError := checkPublicDestination(downloadRequest.URL.String()); destinationError != nil { // Checked here too, since a proxy makes the connections
+		return nil, destinationError // Refuse the request
+	}
+
+	downloadSourcePages.Lock()                       // Lock the record
+	sourcePage := downloadSourcePages.pages[fileURL] // Page the file was found on, if any
+	downloadSourcePages.Unlock()                     // Unlock
+	settings, _ := lookupSourceSettings(fileURL)     // Settings for the URL itself, e.g. a page
+	if sourcePage != "" {                            // Files use the settings of the page they were found on
+		downloadRequest.Header.Set("Referer", sourcePage) // Some CDNs reject requests without it
+		settings, _ = lookupSourceSettings(sourcePage)    // Use the page's settings
+	}
+
+	if locale := settings.locale(); locale != "" { // Present the locale to the server
+		downloadRequest.Header.Set("Accept-Language", acceptLanguageHeader(locale)) // Ask for the locale's variant
+	}
+	for headerName, headerValue := range downloadHeaders { // Apply the config's headers
+		downloadRequest.Header.Set(headerName, headerValue) // Set the header
+	}
+	for headerName, headerValue := range settings.Headers { // Apply the source's headers
+		downloadRequest.Header.Set(headerName, headerValue) // Set the header
+	}
+	if credentials, found := hostCredentialsByName[strings.ToLower(downloadRequest.URL.Hostname())]; found { // Authenticate to protected hosts
+		if credentials.Token != "" { // Tokens take precedence over basic auth
+			downloadRequest.Header.Set("Authorization", "Bearer "+credentials.Token) // Send the token
+		} else {
+			downloadRequest.SetBasicAuth(credentials.Username, credentials.Password) // Send basic auth
+		}
+	}
+	return downloadRequest, nil // Return the request
+} // End of newDownloadRequest function
+
+// Reports whether the page should be rendered in Chrome
+func (settings sourceSettings) usesChrome() bool { // Method to resolve the Chrome setting
+	return settings.Chrome == nil || *settings.Chrome // Chrome is the default
+} // End of usesChrome method
+
+// Sleeps until the rate limit of the settings matching pageURL allows another request, then records the request
+func waitForSourceRateLimit(pageURL string) { // Function to space out requests per source
+	settings, settingsKey := lookupSourceSettings(pageURL) // Find the applicable settings
+	if settings.rateLimit <= 0 {                           // Check if the source is rate limited
+		return // No limit applies
+	}
+
+	sourceRequestTimes.Lock()                                                    // Lock the request times
+	requestTime := sourceRequestTimes.times[settingsKey].Add(settings.rateLimit) // Earliest time the next request may start
+	if requestTime.Before(time.Now()) {                                          // No waiting when the source has been idle
+		requestTime = time.Now() // Start right away
+	}
+	sourceRequestTimes.times[settingsKey] = requestTime // Reserve the slot so parallel scrapes queue up behind it
+	sourceRequestTimes.Unlock()                         // Unlock before sleeping so other sources are not held up
+	time.Sleep(time.Until(requestTime))                 // Wait for the reserved slot
+} // End of waitForSourceRateLimit function
+
+// Narrows a page's HTML to the parts matched by its source's selectors so footer and legal links are left out;
+// pages without selectors are returned unchanged
+func scopeToSelectors(pageURL string, htmlContent string) string { // Function to scope link extraction
+	settings, _ := lookupSourceSettings(pageURL) // Find the applicable settings
+	if len(settings.selectors) == 0 {            // Check if the source is scoped
+		return htmlContent // Extract from the whole page
+	}
+
+	parsedHTML, parseError := html.Parse(strings.NewReader(htmlContent)) // Parse the page
+	if parseError != nil {                                               // Check if parsing failed
+		logError(parseError) // Log the parsing error
+		return ""            // Nothing can be matched
+	}
+
+	var scopedHTML strings.Builder                     // Rendered matches, one after another
+	for _, selectMatches := range settings.selectors { // Apply each selector
+		for _, matchedNode := range selectMatches(parsedHTML) { // Render each matched element
+			if renderError := html.Render(&scopedHTML, matchedNode); renderError != nil { // Keep the element and its descendants
+				logError(renderError) // Log the rendering error
+			}
+		}
+	}
+	if scopedHTML.Len() == 0 { // Warn when the page layout no longer matches
+		logWarningf("No elements on %s match its selectors", pageURL) // Log the empty result
+	}
+	return scopedHTML.String() // Return the matched elements
+} // End of scopeToSelectors function
+
+// Returns the elements an XPath expression selects; selected href/src attributes become bare <a> elements
+// so the usual link extraction picks them up
+func queryXPath(root *html.Node, expression *xpath.Expr) []*html.Node { // Function to apply an XPath expression
+	var matchedNodes []*html.Node                                              // Elements to extract links from
+	for _, matchedNode := range htmlquery.QuerySelectorAll(root, expression) { // Visit each result
+		if matchedNode.Parent == nil && matchedNode.Type == html.ElementNode { // htmlquery returns selected attributes as detached nodes
+			attributeLink := &html.Node{Type: html.ElementNode, Data: "a", Attr: []html.Attribute{{Key: "href", Val: htmlquery.InnerText(matchedNode)}}} // Wrap the attribute value as a link
+			matchedNodes = append(matchedNodes, attributeLink)                                                                                           // Keep the link
+			continue                                                                                                                                     // Done with this result
+		}
+		matchedNodes = append(matchedNodes, matchedNode) // Keep the element
+	}
+	return matchedNodes // Return the elements
+} // End of queryXPath function
+
+var browserSlots = sync.NewCond(&sync.Mutex{}) // Signaled whenever a Chrome instance exits
+
+var browsersRunning int // Chrome instances currently running, guarded by browserSlots.L
+
+// Waits until fewer than -max-browsers Chrome instances are running, then claims a slot
+func acquireBrowserSlot() { // Function to limit simultaneous Chrome instances
+	browserSlots.L.Lock()                         // Lock the counter
+	for browsersRunning >= max(*maxBrowsers, 1) { // Wait while every slot is taken
+		browserSlots.Wait() // Sleep until a browser exits
+	}
+	browsersRunning++       // Claim a slot
+	browserSlots.L.Unlock() // Unlock the counter
+} // End of acquireBrowserSlot function
+
+// Releases a slot claimed with acquireBrowserSlot
+func releaseBrowserSlot() { // Function to free a Chrome slot
+	browserSlots.L.Lock()   // Lock the counter
+	browsersRunning--       // Free the slot
+	browserSlots.L.Unlock() // Unlock the counter
+	browserSlots.Signal()   // Wake one waiting scrape
+} // End of releaseBrowserSlot function
+
+// Scrapes several pages in parallel with scrapePage, returning their HTML in the same order as pageURLs;
+// invalid URLs are skipped and return ""
+func scrapePages(pageURLs []string, extraActions ...chromedp.Action) []string { // Function to scrape pages concurrently
+	pageHTML := make([]string, len(pageURLs))  // HTML of each page, by index
+	pageBlocked := make([]bool, len(pageURLs)) // Whether each page came back as a block page
+	var waitGroup sync.WaitGroup               // Waits for every scrape
+	for pageIndex, pageURL := range pageURLs { // Start one scrape per page
+		if !isUrlValid(pageURL) { // Skip URLs that cannot be requested
+			continue // Leave the page empty
+		}
+		waitGroup.Add(1) // Track the scrape
+		go func() {      // Scrape in the background; Chrome scrapes wait for a free browser slot
+			defer waitGroup.Done() // Mark the scrape as finished
+			if runStopped() {      // Check if the run stopped while the scrape waited
+				return // Leave the page empty
+			}
+			pageHTML[pageIndex], pageBlocked[pageIndex] = scrapePageAttempt(pageURL, extraActions...) // Store the HTML in the page's position
+		}()
+	}
+	waitGroup.Wait() // Wait for every scrape
+
+	for retry := 1; retry <= *blockRetries; retry++ { // Retry blocked pages after the rest, once their hosts' backoff has passed
+		for pageIndex, pageURL := range pageURLs { // Find the pages that were blocked
+			if !pageBlocked[pageIndex] || runStopped() { // Check if the page needs another attempt
+				continue // Keep its result
+			}
+			waitGroup.Add(1) // Track the retry
+			go func() {      // Retry in the background; each attempt waits out its host's pause
+				defer waitGroup.Done()                                                                    // Mark the retry as finished
+				logWarningf("Retrying blocked page %s (attempt %d of %d)", pageURL, retry, *blockRetries) // Log the retry
+				pageHTML[pageIndex], pageBlocked[pageIndex] = scrapePageAttempt(pageURL, extraActions...) // Replace the empty result
+			}()
+		}
+		waitGroup.Wait() // Wait for the round of retries
+	}
+	return pageHTML // Return the pages
+} // End of scrapePages function
+
+// Scrapes a page with scrapePageAttempt, retrying up to -block-retries times after backing off when it comes back as
+// an anti-bot block page
+func scrapePage(targetURL string, extraActions ...chromedp.Action) string { // Function to fetch a page's HTML
+	for retry := 0; ; retry++ { // Attempt until the page is not blocked or the retries run out
+		pageHTML, pageBlocked := scrapePageAttempt(targetURL, extraActions...) // Scrape the page
+		if !pageBlocked || retry >= *blockRetries {                            // Check if another attempt could help
+			return pageHTML // Return the HTML, empty for a blocked page
+		}
+		logWarningf("Retrying blocked page %s (attempt %d of %d)", targetURL, retry+1, *blockRetries) // Log the retry
+	}
+} // End of scrapePage function
+
+// Scrapes a page using its source settings: rendered in Chrome by default, or fetched with a plain HTTP GET when Chrome
+// is disabled. With -plain-first, pages that need no browser actions are fetched plainly first and only rendered in
+// Chrome when the plain response is unusable. A page that turns out to be an anti-bot block or challenge page returns
+// "" and true, after pausing its host; every Chrome attempt starts with a fresh profile, so retries get new cookies.
+func scrapePageAttempt(targetURL string, extraActions ...chromedp.Action) (string, bool) { // Function to fetch a page's HTML once
+	settings, _ := lookupSourceSettings(targetURL)                        // Find the applicable settings
+	waitForSourceRateLimit(targetURL)                                     // Respect the source's rate limit
+	pageHost := ""                                                        // Host the page is served from
+	if parsedURL, parseError := url.Parse(targetURL); parseError == nil { // Find the host
+		pageHost = parsedURL.Hostname() // Backoff is tracked per host
+	}
+	waitForHostPause(pageHost)  // Wait out a block or rate limit the host sent earlier
+	operatorPause.RLock()       // Wait while an operator is solving a challenge
+	operatorPause.RUnlock()     // Only the gate matters; the scrape itself runs unlocked
+	pageHTML := ""              // HTML of the page, empty on failure
+	pageStatus := http.StatusOK // HTTP status the page was served with; plain fetches only return 200 responses
+	if settings.usesChrome() {  // Render the page in Chrome
+		if *plainFirst && settings.Chrome == nil && len(extraActions) == 0 && !settings.Expand && len(settings.ExpandSelectors) == 0 { // Check if a plain fetch could do
+			log.Println("Fetching:", targetURL)                                                        // Log which page is being fetched
+			_, pageBody, _ := fetchDownload(targetURL, []string{"text/html", "application/xhtml+xml"}) // Fetch the raw HTML
+			if reason := plainPageProblem(targetURL, settings, string(pageBody)); reason != "" {       // Check if the page needs a browser
+				log.Printf("Rendering %s in Chrome: %s", targetURL, reason) // Explain the fallback
+			} else {
+				pageHTML = string(pageBody) // The plain page will do
+			}
+		}
+		if pageHTML == "" { // Fall back to the browser
+			pageHTML, pageStatus = scrapePageHTMLWithChrome(targetURL, settings, extraActions...) // Scrape the rendered HTML
+		}
+	} else { // Fetch the page without a browser
+		log.Println("Fetching:", targetURL)                                                        // Log which page is being fetched
+		_, pageBody, _ := fetchDownload(targetURL, []string{"text/html", "application/xhtml+xml"}) // Fetch the raw HTML
+		pageHTML = string(pageBody)                                                                // Use the body as is
+	}
+
+	if marker := blockMarkerIn(pageHTML, pageStatus); marker != "" { // Check if the page is a block page rather than content
+		backOffFromBlockedHost(pageHost, targetURL, marker) // Pause the host before any retry
+		return "", true                                     // Record no links rather than an empty success
+	}
+	if pageHTML != "" { // Keep the page's OpenGraph metadata for the catalog and index site
+		hostBlocks.Lock()                       // Lock the block counts
+		delete(hostBlocks.counts, pageHost)     // The host serves content again
+		hostBlocks.Unlock()                     // Unlock
+		recordPageMetadata(targetURL, pageHTML) // Store the metadata
+	}
+	return pageHTML, false // Return the HTML
+} // End of scrapePageAttempt function
+
+// Consecutive block pages served by each host, which sets the length of its next pause
+var hostBlocks = struct {
+	sync.Mutex                // Guards counts
+	counts     map[string]int // Consecutive block pages by host name
+}{counts: make(map[string]int)}
+
+// Pauses a host that served a block page for -block-backoff, doubled for each consecutive block, and reports it
+func backOffFromBlockedHost(hostName string, pageURL string, marker string) { // Function to back off adaptively
+	hostBlocks.Lock()                                                                                    // Lock the block counts
+	hostBlocks.counts[hostName]++                                                                        // Count the block
+	consecutiveBlocks := hostBlocks.counts[hostName]                                                     // Blocks in a row, including this one
+	hostBlocks.Unlock()                                                                                  // Unlock
+	pause := min(*blockBackoff<<min(consecutiveBlocks-1, 10), maxRetryAfter)                             // Double the pause per block, within the cap
+	logWarningf("%s is an anti-bot block page (%s)", pageURL, marker)                                    // Log the block
+	runStatistics.add(&runStatistics.PagesBlocked, 1)                                                    // Count it for the run summary
+	emitEvent("page_blocked", map[string]any{"url": pageURL, "marker": marker, "pause": pause.String()}) // Notify listeners
+	pauseHost(hostName, pause)                                                                           // Stop requesting from the host for a while
+} // End of backOffFromBlockedHost function
+
+// Markers of anti-bot interstitials that only let a JavaScript-capable browser through. Bot-protection scripts also
+// load on ordinary pages, so these only count on pages served with the 403 or 503 status the interstitials use.
+var challengeMarkers = []string{"cf-browser-verification", "cf_chl_opt", "<title>just a moment...</title>", "checking your browser before accessing", "enable javascript and cookies to continue", "ddos-guard", "_incapsula_resource", "px-captcha"}
+
+// Markers of pages refusing or rate limiting the client outright
+var blockMarkers = []string{"<title>attention required! | cloudflare</title>", "sorry, you have been blocked", "error code: 1020", "error 1015", "you are being rate limited", "access denied | ", "request unsuccessful. incapsula incident"}
+
+// Returns the first challenge or block marker found in a page served with the given HTTP status, or "" for an
+// ordinary page
+func blockMarkerIn(pageHTML string, statusCode int) string { // Function to recognize anti-bot pages
+	lowerHTML := strings.ToLower(pageHTML)                                                 // Markers are matched case-insensitively
+	markers := blockMarkers                                                                // Block pages are recognized by their text alone
+	if statusCode == http.StatusForbidden || statusCode == http.StatusServiceUnavailable { // Interstitials are served with these
+		markers = slices.Concat(challengeMarkers, blockMarkers) // Look for challenges too
+	}
+	for _, marker := range markers { // Look for each marker
+		if strings.Contains(lowerHTML, marker) { // Check if the page is an anti-bot page
+			return marker // Name what was found
+		}
+	}
+	return "" // An ordinary page
+} // End of blockMarkerIn function
+
+var pageLinkSelector = cascadia.MustCompile("a[href]") // Links a usable page has
+
+// Returns why a plainly fetched page cannot stand in for the Chrome render, or "" when it can: the fetch failed, the
+// page is a JavaScript challenge, or it lacks the wait_for element, selector matches, or file links the source
+// expects. Files cataloged from the page before are expected to be linked again; a page without history must link at
+// least one downloadable file.
+func plainPageProblem(pageURL string, settings sourceSettings, pageHTML string) string { // Function to judge a plain fetch
+	if pageHTML == "" { // The fetch failed or was refused
+		return "the plain fetch failed" // Needs the browser
+	}
+	if marker := blockMarkerIn(pageHTML, http.StatusOK); marker != "" { // Check if the page is a block page
+		return "the page is an anti-bot page (" + marker + ")" // Needs the browser
+	}
+	parsedHTML, parseError := html.Parse(strings.NewReader(pageHTML)) // Parse the page
+	if parseError != nil {                                            // Check if parsing failed
+		return "the page does not parse" // Needs the browser
+	}
+	if settings.WaitFor != "" { // The source names the element it waits for
+		waitForSelector, selectorError := cascadia.Compile(settings.WaitFor)            // Compile it for the static page
+		if selectorError == nil && cascadia.Query(parsedHTML, waitForSelector) == nil { // Check if the element is rendered by scripts
+			return "no element matches wait_for " + settings.WaitFor // Needs the browser
+		}
+	}
+	linkAreas := []*html.Node{parsedHTML} // Where the source's links live
+	if len(settings.selectors) > 0 {      // Only the source's link areas count
+		linkAreas = nil // Replaced by the matches
+	}
+	for _, selectMatches := range settings.selectors { // Check the source's link areas
+		matchedAreas := selectMatches(parsedHTML) // Elements the selector matches
+		if len(matchedAreas) == 0 {               // Check if an area is rendered by scripts
+			return "the source's selectors match nothing" // Needs the browser
+		}
+		linkAreas = append(linkAreas, matchedAreas...) // Look for links in them
+	}
+
+	pageLinks := make(map[string]bool)   // Canonical URLs the areas link to
+	hasFileLinks := false                // Whether any of them is a downloadable file
+	for _, linkArea := range linkAreas { // Collect the links of each area
+		for _, anchor := range cascadia.QueryAll(linkArea, pageLinkSelector) { // Each link in the area
+			for _, attribute := range anchor.Attr { // Find the href
+				if attribute.Key != "href" { // Only the target matters
+					continue // Next attribute
+				}
+				link := resolveLink(pageURL, strings.TrimSpace(attribute.Val))                                                           // The absolute URL
+				pageLinks[canonicalLinkURL(link)] = true                                                                                 // Remember it
+				hasFileLinks = hasFileLinks || isPDFLink(link) || isFirmwareLink(link) || isSoftwareLink(link) || isHostedFileLink(link) // Check if it is a file
+			}
+		}
+	}
+	knownFiles := 0                                // Files cataloged from this page before
+	for _, entry := range archiveCatalog.Entries { // Find them
+		if entry.SourcePage != pageURL { // Found on another page
+			continue // Next entry
+		}
+		knownFiles++                                // Count it
+		if pageLinks[canonicalLinkURL(entry.URL)] { // The plain page still links a known file
+			return "" // The plain page will do
+		}
+	}
+	if knownFiles > 0 { // The page used to link files but the plain fetch shows none of them
+		return fmt.Sprintf("none of the %d files found on the page before are linked", knownFiles) // Needs the browser
+	}
+	if !hasFileLinks { // Script-rendered pages ship without their file links
+		return "the page links no downloadable files" // Needs the browser
+	}
+	return "" // The plain page will do
+} // End of plainPageProblem function
+
+// URLs of downloadable files seen in a page's network traffic
+type networkLinkCollector struct { // Fields of the collector
+	mutex         sync.Mutex                   // Guards links, jsonResponses and closed; events arrive on the browser's goroutine
+	links         map[string]bool              // Harvested URLs
+	jsonResponses map[network.RequestID]string // URLs of XHR/fetch JSON responses still loading, by request
+	pending       sync.WaitGroup               // JSON bodies still being fetched and parsed
+	closed        bool                         // Set once the links are read, after which no more bodies are fetched
+} // End of networkLinkCollector struct
+
+// Records a URL if it points at a PDF or firmware package
+func (collector *networkLinkCollector) add(link string) { // Method to harvest a URL
+	if !isPDFLink(link) && !isFirmwareLink(link) { // Only downloadable files matter
+		return // Ignore the URL
+	}
+	collector.mutex.Lock()         // Lock the links
+	defer collector.mutex.Unlock() // Unlock when done
+	collector.links[link] = true   // Remember the URL
+} // End of add method
+
+// Renders the harvested URLs as anchors inside <div id="archiver-network-links">; sources scoped with selectors can
+// include them with the selector "#archiver-network-links a"
+func (collector *networkLinkCollector) anchorsHTML() string { // Method to expose harvested URLs as HTML links
+	collector.mutex.Lock()         // Lock the collector
+	collector.closed = true        // Stop counting new bodies, so none is added while waiting below
+	collector.mutex.Unlock()       // Unlock so the pending bodies can add their links
+	collector.pending.Wait()       // Let JSON bodies that are still being parsed add their links
+	collector.mutex.Lock()         // Lock the links
+	defer collector.mutex.Unlock() // Unlock when done
+	if len(collector.links) == 0 { // Nothing was harvested
+		return "" // Leave the HTML unchanged
+	}
+
+	var sortedLinks []string            // Links in a stable order
+	for link := range collector.links { // Collect every link
+		sortedLinks = append(sortedLinks, link) // Keep the link
+	}
+	sort.Strings(sortedLinks) // Sort for stable output
+
+	var anchors strings.Builder                              // The rendered anchors
+	anchors.WriteString(`<div id="archiver-network-links">`) // Open the container
+	for _, link := range sortedLinks {                       // Render each link
+		fmt.Fprintf(&anchors, `<a href="%s"></a>`, html.EscapeString(link)) // Escape the URL for the attribute
+	}
+	anchors.WriteString(`</div>`) // Close the container
+	return anchors.String()       // Return the anchors
+} // End of anchorsHTML method
+
+// Adds every PDF and firmware URL found in the string values of a JSON document, resolved against the response URL
+func (collector *networkLinkCollector) addFromJSON(responseURL string, jsonBody []byte) { // Method to harvest links from an API response
+	var document any                                // Decoded JSON of any shape
+	if json.Unmarshal(jsonBody, &document) != nil { // Decode the body
+		return // Not JSON after all
+	}
+
+	var walkJSON func(any)       // Define a recursive function to visit every value
+	walkJSON = func(value any) { // The implementation of the recursive walk
+		switch typedValue := value.(type) {
+		case string: // Strings may be URLs
+			collector.add(resolveLink(responseURL, typedValue)) // Harvest it if it points at a file
+		case []any: // Visit each element
+			for _, element := range typedValue { // Walk the list
+				walkJSON(element) // Visit the element
+			}
+		case map[string]any: // Visit each field
+			for _, field := range typedValue { // Walk the object
+				walkJSON(field) // Visit the field
+			}
+		}
+	}
+	walkJSON(document) // Begin with the whole document
+} // End of addFromJSON method
+
+// Starts collecting the URLs of PDFs and firmware the page requests or loads through XHR/fetch JSON APIs,
+// returning the collector and the action that enables the network events it needs
+func watchNetworkLinks(browserContext context.Context) (*networkLinkCollector, chromedp.Action) { // Function to harvest links from traffic
+	collector := &networkLinkCollector{links: make(map[string]bool), jsonResponses: make(map[network.RequestID]string)} // Empty collector
+	chromedp.ListenTarget(browserContext, func(event any) {                                                             // Watch every network event
+		switch networkEvent := event.(type) {
+		case *network.EventRequestWillBeSent: // A request is starting
+			collector.add(networkEvent.Request.URL) // Harvest its URL
+		case *network.EventResponseReceived: // Response headers arrived
+			isAPICall := networkEvent.Type == network.ResourceTypeXHR || networkEvent.Type == network.ResourceTypeFetch // Only script-initiated calls deliver file lists
+			if isAPICall && strings.Contains(networkEvent.Response.MimeType, "json") {                                  // Check for a JSON API response
+				collector.mutex.Lock()                                                      // Lock the pending responses
+				collector.jsonResponses[networkEvent.RequestID] = networkEvent.Response.URL // Read the body once it has loaded
+				collector.mutex.Unlock()                                                    // Unlock
+			}
+		case *network.EventLoadingFinished: // A response body finished loading
+			collector.mutex.Lock()                                                 // Lock the pending responses
+			responseURL, isJSON := collector.jsonResponses[networkEvent.RequestID] // Check if the body is wanted
+			delete(collector.jsonResponses, networkEvent.RequestID)                // It is handled now either way
+			isJSON = isJSON && !collector.closed                                   // Bodies finishing after the links were read are too late
+			if isJSON {                                                            // Count the body as pending before unlocking
+				collector.pending.Add(1) // Track the body
+			}
+			collector.mutex.Unlock() // Unlock
+			if !isJSON {             // Not a JSON API response
+				return // Nothing to read
+			}
+			go func() { // CDP commands cannot be sent from inside the event handler
+				defer collector.pending.Done()                                                                 // Mark the body as handled
+				targetContext := cdp.WithExecutor(browserContext, chromedp.FromContext(browserContext).Target) // Address the page's target
+				responseBody, bodyError := network.GetResponseBody(networkEvent.RequestID).Do(targetContext)   // Read the JSON body
+				if bodyError != nil {                                                                          // Check if the body is unavailable
+					return // The page may have navigated away; skip the body
+				}
+				collector.addFromJSON(responseURL, responseBody) // Harvest the file URLs it lists
+			}()
+		}
+	}) // End of event listener
+	return collector, network.Enable() // Network events are off until enabled
+} // End of watchNetworkLinks function
+
+// Resource types -block-resources makes the browser skip
+var heavyResourceTypes = []network.ResourceType{network.ResourceTypeImage, network.ResourceTypeFont, network.ResourceTypeMedia}
+
+// Returns an action that intercepts the page's requests via CDP: with -block-resources every image, font, and media
+// request fails, and the given headers are added to requests for the source page's host and its subdomains only, so
+// tokens configured for the source never reach the third-party hosts the page loads from
+func interceptRequests(browserContext context.Context, pageURL string, sourceHeaders map[string]string) chromedp.Action { // Function to filter and annotate requests
+	pageHost := ""                                                      // Host the headers are meant for
+	if parsedURL, parseError := url.Parse(pageURL); parseError == nil { // Find the host
+		pageHost = parsedURL.Hostname() // The source's host
+	}
+	chromedp.ListenTarget(browserContext, func(event any) { // Handle intercepted requests
+		pausedRequest, isPaused := event.(*fetch.EventRequestPaused) // Only paused requests matter
+		if !isPaused {                                               // Ignore every other event
+			return // Nothing to do
+		}
+		go func() { // CDP commands cannot be sent from inside the event handler
+			targetContext := cdp.WithExecutor(browserContext, chromedp.FromContext(browserContext).Target) // Address the page's target
+			var interceptError error                                                                       // Outcome of the CDP command
+			switch requestURL, _ := url.Parse(pausedRequest.Request.URL); {
+			case *blockResources && slices.Contains(heavyResourceTypes, pausedRequest.ResourceType): // A heavy resource
+				interceptError = fetch.FailRequest(pausedRequest.RequestID, network.ErrorReasonBlockedByClient).Do(targetContext) // Block the request
+			case len(sourceHeaders) > 0 && requestURL != nil && hostWithinDomain(requestURL.Hostname(), pageHost): // A request to the source itself
+				var headers []*fetch.HeaderEntry                                     // The request's headers with the source's added
+				for headerName, headerValue := range pausedRequest.Request.Headers { // Keep the browser's own headers
+					if _, replaced := sourceHeaders[http.CanonicalHeaderKey(headerName)]; !replaced { // Unless configured
+						headers = append(headers, &fetch.HeaderEntry{Name: headerName, Value: fmt.Sprint(headerValue)}) // Keep it
+					}
+				}
+				for headerName, headerValue := range sourceHeaders { // Add the configured headers
+					headers = append(headers, &fetch.HeaderEntry{Name: headerName, Value: headerValue}) // Add it
+				}
+				interceptError = fetch.ContinueRequest(pausedRequest.RequestID).WithHeaders(headers).Do(targetContext) // Send it with the headers
+			default: // Any other request goes out unchanged
+				interceptError = fetch.ContinueRequest(pausedRequest.RequestID).Do(targetContext) // Let it through
+			}
+			if interceptError != nil && browserContext.Err() == nil { // Check if the command failed while the browser is still running
+				logError(interceptError) // Log the error
+			}
+		}()
+	}) // End of event listener
+
+	var pausedPatterns []*fetch.RequestPattern // Only these requests are paused
+	if len(sourceHeaders) > 0 {                // Every request may need the headers
+		pausedPatterns = append(pausedPatterns, &fetch.RequestPattern{URLPattern: "*", RequestStage: fetch.RequestStageRequest}) // Pause every request
+	} else {
+		for _, resourceType := range heavyResourceTypes { // Heavy resource types
+			pausedPatterns = append(pausedPatterns, &fetch.RequestPattern{URLPattern: "*", ResourceType: resourceType, RequestStage: fetch.RequestStageRequest}) // Pause requests of this type
+		}
+	}
+	return fetch.Enable().WithPatterns(pausedPatterns) // Turn interception on
+} // End of interceptRequests function
+
+// Reports whether host is domain or one of its subdomains
+func hostWithinDomain(host string, domain string) bool { // Function to compare hosts
+	host, domain = strings.ToLower(strings.TrimSuffix(host, ".")), strings.ToLower(strings.TrimSuffix(domain, ".")) // Compare normalized names
+	return domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))                                  // The domain or a subdomain
+} // End of hostWithinDomain function
+
+// Removes duplicate strings from a slice
+func removeDuplicatesFromSlice(slice []string) []string { // Function to filter a string slice for uniqueness
+	check := make(map[string]bool) // Create a map to track which strings have already been seen
+	var newReturnSlice []string    // Initialize a new slice to store unique strings
+
+	for _, content := range slice { // Loop through each string in the input slice
+		if !check[content] { // If the string hasn't been seen before
+			check[content] = true                            // Mark this string as seen in the map
+			newReturnSlice = append(newReturnSlice, content) // Add it to the result slice
+		}
+	}
+
+	return newReturnSlice // Return the slice containing only unique strings
+} // End of removeDuplicatesFromSlice function
+
+// Query parameters that only track where a visitor came from or defeat caches, and never select a different file
+var trackingParameters = []string{"fbclid", "gclid", "dclid", "gbraid", "wbraid", "msclkid", "yclid", "igshid", "mc_cid", "mc_eid", "_ga", "_gl", "_hsenc", "_hsmi", "_", "cb", "cachebust", "cache_bust", "nocache"}
+
+// Returns the canonical form of a download link, so the same document is not archived under several URLs: the scheme
+// and host in lower case without a default port, percent-encodings of the path normalized as RFC 3986 describes, no
+// fragment, and no utm_* or other tracking and cache-busting parameters, including the "?v=1712345678" Shopify
+// appends to CDN files whenever the store is republished. Parameters named in -keep-params are never removed, and the
+// query of a link with an expiring signature is left alone, since the signature may cover it.
+func canonicalLinkURL(link string) string { // Function to normalize download links
+	parsedLink, parseError := url.Parse(link) // Parse the link
+	if parseError != nil {                    // Check if the link is malformed
+		return link // Leave it as it is
+	}
+	if parsedLink.Scheme != "http" && parsedLink.Scheme != "https" { // url.Parse already lowercases the scheme
+		return link // Only web links have a canonical form here
+	}
+	parsedLink.Host = strings.ToLower(parsedLink.Host)                                                                               // Host names are case-insensitive
+	if port := parsedLink.Port(); (parsedLink.Scheme == "http" && port == "80") || (parsedLink.Scheme == "https" && port == "443") { // Check for the default port
+		parsedLink.Host = strings.TrimSuffix(parsedLink.Host, ":"+port) // Drop it
+	}
+	parsedLink.RawPath = normalizePercentEncoding(parsedLink.EscapedPath()) // Same path, one spelling
+	parsedLink.Fragment, parsedLink.RawFragment = "", ""                    // Anchors never reach the server
+
+	if parsedLink.RawQuery == "" || hasExpiringSignature(link) { // Check if there is a query to clean up
+		return parsedLink.String() // Return the canonical link
+	}
+	keptParameters := strings.Split(*keepParameters, ",")                                                                        // Parameters that must stay
+	shopifyCDN := strings.EqualFold(parsedLink.Hostname(), "cdn.shopify.com") || strings.Contains(parsedLink.Path, "/cdn/shop/") // Shopify's CDN, on its own host or the store's
+	query := parsedLink.Query()                                                                                                  // The link's parameters
+	removed := false                                                                                                             // Whether any parameter was dropped
+	for parameterName := range query {                                                                                           // Check each parameter
+		lowerName := strings.ToLower(parameterName)                                                                                           // Names are compared case-insensitively
+		if slices.ContainsFunc(keptParameters, func(kept string) bool { return strings.EqualFold(strings.TrimSpace(kept), parameterName) }) { // Check the keep-list
+			continue // Keep it
+		}
+		if strings.HasPrefix(lowerName, "utm_") || slices.Contains(trackingParameters, lowerName) || (shopifyCDN && lowerName == "v") { // Other hosts may use "v" for something else
+			query.Del(parameterName) // Drop the parameter
+			removed = true           // Rebuild the query below
+		}
+	}
+	if removed { // Leave untouched queries in their original order
+		parsedLink.RawQuery = query.Encode() // Rebuild the query
+	}
+	return parsedLink.String() // Return the canonical link
+} // End of canonicalLinkURL function
+
+// Decodes percent-encoded unreserved characters (letters, digits, "-", ".", "_" and "~") and upper-cases the
+// hexadecimal digits of the remaining percent-encodings, which leaves the decoded path unchanged
+func normalizePercentEncoding(escapedPath string) string { // Function to normalize percent-encodings
+	var normalized strings.Builder                      // The normalized path
+	for index := 0; index < len(escapedPath); index++ { // Copy the path byte by byte
+		if escapedPath[index] != '%' || index+2 >= len(escapedPath) { // Only complete percent-encodings are rewritten
+			normalized.WriteByte(escapedPath[index]) // Copy the byte
+			continue                                 // Next byte
+		}
+		decoded, decodeError := hex.DecodeString(escapedPath[index+1 : index+3]) // The encoded byte
+		if decodeError != nil {                                                  // Check if the encoding is malformed
+			normalized.WriteByte(escapedPath[index]) // Copy it as it is
+			continue                                 // Next byte
+		}
+		if character := decoded[0]; ('a' <= character && character <= 'z') || ('A' <= character && character <= 'Z') || ('0' <= character && character <= '9') || strings.IndexByte("-._~", character) >= 0 { // Unreserved characters need no encoding
+			normalized.WriteByte(character) // Write it as it is
+		} else {
+			normalized.WriteString("%" + strings.ToUpper(escapedPath[index+1:index+3])) // Upper-case hexadecimal digits
+		}
+		index += 2 // Skip the encoded digits
+	}
+	return normalized.String() // Return the normalized path
+} // End of normalizePercentEncoding function
+
+// Replaces the http:// links of a download queue with https:// when their host serves the file over HTTPS, checked
+// once per host with a HEAD request for its first link. Source pages carry over, catalog entries of the plain links
+// move to the upgraded ones so their files are not downloaded again, and upgrades maps each upgraded link to its
+// original. Hosts that fail the TLS handshake, answer with an error, or redirect back to http:// keep plain links.
+func upgradeQueueToHTTPS(queue []string, linkSources map[string]string, upgrades map[string]string) []string { // Function to upgrade a download queue
+	hostSupportsHTTPS := make(map[string]bool)                                                     // Result of each host's check
+	httpClient := &http.Client{Timeout: 15 * time.Second, CheckRedirect: refuseDisallowedRedirect} // Only the headers are read
+	upgradedQueue := make([]string, 0, len(queue))                                                 // Links in queue order
+	for _, link := range queue {                                                                   // Upgrade each link
+		parsedLink, parseError := url.Parse(link)             // Parse the link
+		if parseError != nil || parsedLink.Scheme != "http" { // Only plaintext links need upgrading
+			upgradedQueue = append(upgradedQueue, link) // Keep the link
+			continue                                    // Next link
+		}
+		parsedLink.Scheme = "https"    // The same file over TLS
+		if parsedLink.Port() == "80" { // The plaintext port does not speak TLS
+			parsedLink.Host = parsedLink.Hostname() // Use the default HTTPS port instead
+		}
+		httpsLink := parsedLink.String() // The upgraded link
+
+		supported, checked := hostSupportsHTTPS[parsedLink.Host] // Result of an earlier check
+		if !checked {                                            // Check each host once
+			if headRequest, requestError := newDownloadRequest(httpsLink); requestError == nil { // Same headers as the download
+				headRequest.Method = http.MethodHead                                         // Ask for the headers only
+				if headResponse, sendError := httpClient.Do(headRequest); sendError == nil { // A failed handshake means no HTTPS
+					headResponse.Body.Close()                                                                                 // HEAD responses have no body
+					supported = headResponse.StatusCode < http.StatusBadRequest && headResponse.Request.URL.Scheme == "https" // Servers redirecting back to http:// do not really support it
+				}
+			}
+			hostSupportsHTTPS[parsedLink.Host] = supported // Remember the result
+			if !supported {                                // Explain why files from the host stay on plaintext
+				logWarningf("%s does not serve HTTPS; downloading its files over plain HTTP", parsedLink.Host) // Log the result
+			}
+		}
+		if !supported { // Check if the host lacks HTTPS
+			upgradedQueue = append(upgradedQueue, link) // Keep the plain link
+			continue                                    // Next link
+		}
+
+		if _, known := linkSources[httpsLink]; !known && linkSources[link] != "" { // Keep the first source page found
+			linkSources[httpsLink] = linkSources[link] // Carry the source page over
+		}
+		if entry, found := archiveCatalog.Entries[link]; found { // Files downloaded over plaintext in earlier runs
+			if _, upgraded := archiveCatalog.Entries[httpsLink]; !upgraded { // Keep an entry already stored under the HTTPS link
+				delete(archiveCatalog.Entries, link)      // Drop the plain key
+				entry.URL = httpsLink                     // Update the entry's URL
+				archiveCatalog.Entries[httpsLink] = entry // Store it under the HTTPS link
+			}
+		}
+		upgrades[httpsLink] = link                       // Remember the original link
+		upgradedQueue = append(upgradedQueue, httpsLink) // Queue the upgraded link
+		log.Printf("Upgraded %s to HTTPS", link)         // Log the upgrade
+	}
+	return removeDuplicatesFromSlice(upgradedQueue) // Plain and HTTPS links of one file collapse
+} // End of upgradeQueueToHTTPS function
+
+// Canonicalizes every link in a download queue and removes the duplicates that leaves, carrying each link's
+// source page over to its canonical form
+func canonicalizeQueue(queue []string, linkSources map[string]string) []string { // Function to dedupe a download queue
+	canonicalQueue := make([]string, 0, len(queue)) // Canonical links in queue order
+	for _, link := range queue {                    // Canonicalize each link
+		canonicalLink := canonicalLinkURL(link)                                        // The link without its tracking and cache-busting parameters
+		if _, known := linkSources[canonicalLink]; !known && linkSources[link] != "" { // Keep the first source page found
+			linkSources[canonicalLink] = linkSources[link] // Carry the source page over
+		}
+		canonicalQueue = append(canonicalQueue, canonicalLink) // Queue the canonical link
+	}
+	return removeDuplicatesFromSlice(canonicalQueue) // Return each file once
+} // End of canonicalizeQueue function
+
+// Checks whether a given directory exists
+func directoryExists(path string) bool { // Function to check if a path exists and is a directory
+	directory, err := os.Stat(path) // Get info for the path
+	if err != nil {                 // Check if os.Stat returned an error (e.g., file/dir doesn't exist)
+		return false // Return false if error occurs
+	}
+	return directory.IsDir() // Return true if it's a directory
+} // End of directoryExists function
+
+// Creates a directory at given path with provided permissions
+func createDirectory(path string, permission os.FileMode) { // Function to create a directory
+	err := os.Mkdir(path, permission) // Attempt to create directory
+	if err != nil {                   // Check for creation errors
+		logError(err) // Log error if creation fails
+	}
+} // End of createDirectory function
+
+// Verifies whether a string is a valid URL format
+func isUrlValid(uri string) bool { // Function to perform basic URL format validation
+	_, err := url.ParseRequestURI(uri) // Try parsing the URL
+	return err == nil                  // Return true if valid (parsing was successful, err is nil)
+} // End of isUrlValid function
+
+// Checks if a file exists at the specified path
+func fileExists(filename string) bool { // Function to check if a file exists (and is not a directory)
+	info, err := os.Stat(filename) // Try to get file information
+	if err != nil {                // If an error occurs, it likely means the file does not exist
+		return false // Return false because os.Stat couldn't find the file
+	}
+	return !info.IsDir() // Return true only if the path exists and is not a directory
+} // End of fileExists function
+
+// Converts a raw URL into a sanitized filename safe for filesystem
+func urlToFilename(rawURL string) string { // Function to create a clean filename from a URL
+	lower := strings.ToLower(rawURL)     // Convert the input URL to lowercase for consistency
+	lower = strings.Split(lower, "?")[0] // Remove URL query parameters
+
+	lower = getFilename(lower) // Extract just the filename part from the URL
+
+	// Get the file extension from the extracted filename
+	ext := getFileExtension(lower) // Get the original file extension (e.g., ".pdf" or ".zip")
+
+	reNonAlnum := regexp.MustCompile(`[^a-z0-9]`)   // Create a regex to match any non-alphanumeric characters
+	safe := reNonAlnum.ReplaceAllString(lower, "_") // Replace all non-alphanumeric characters with underscores
+
+	safe = regexp.MustCompile(`_+`).ReplaceAllString(safe, "_") // Replace multiple consecutive underscores with a single underscore
+	safe = strings.Trim(safe, "_")                              // Remove leading and trailing underscores from the filename
+
+	var invalidSubstrings = []string{ // Define a list of unwanted substrings to clean from the filename
+		"_pdf",      // Common redundant suffix
+		"_zip",      // Common redundant suffix
+		"_txt",      // Common redundant suffix
+		"_exe",      // Common redundant suffix of installers
+		"_msi",      // Common redundant suffix of installers
+		"_dmg",      // Common redundant suffix of disk images
+		"_pkg",      // Common redundant suffix of macOS packages
+		"_appimage", // Common redundant suffix of AppImages
+	} // End of invalid substrings slice
+
+	for _, invalidPre := range invalidSubstrings { // Iterate over the unwanted substrings
+		safe = removeSubstring(safe, invalidPre) // Remove each unwanted substring from the filename
+	} // End of substring removal loop
+
+	if getFileExtension(safe) == "" { // Check if the sanitized filename has no extension
+		safe = safe + ext // Append the original file extension (e.g., .pdf) to ensure completeness
+	}
+
+	safe = truncateFilenameWithHash(safe, rawURL) // Shorten overly long names while keeping them unique
+
+	return safe // Return the sanitized, safe filename
+} // End of urlToFilename function
+
+// Truncates a filename longer than maxFilenameLength and appends a short hash of the source URL
+func truncateFilenameWithHash(filename string, rawURL string) string { // Function to keep filenames within filesystem limits
+	if len(filename) <= maxFilenameLength { // Check if the filename already fits
+		return filename // Return the filename unchanged
+	}
+
+	ext := getFileExtension(filename)                                   // Keep the extension so the file type stays recognizable
+	base := strings.TrimSuffix(filename, ext)                           // Strip the extension from the name
+	urlHash := sha256.Sum256([]byte(rawURL))                            // Hash the full source URL so different URLs stay distinct
+	suffix := "_" + hex.EncodeToString(urlHash[:])[:filenameHashLength] // Build the short hash suffix
+
+	if len(ext) > maxFilenameLength-len(suffix)-1 { // Guard against absurdly long extensions
+		ext = ext[:maxFilenameLength-len(suffix)-1] // Cut the extension so the name still fits
+	}
+	keep := min(maxFilenameLength-len(ext)-len(suffix), len(base)) // Keep what fits, but no more than the base name has
+	base = strings.TrimRight(base[:keep], "_")                     // Cut the base name and drop any dangling underscores
+
+	return base + suffix + ext // Return the truncated name with hash suffix and extension
+} // End of truncateFilenameWithHash function
+
+// Builds the local path for a downloaded URL according to the selected layout mode
+func outputPathForURL(rawURL string, outputDirectory string) string { // Function to map a URL to a file path on disk
+	nameSource := rawURL                                  // Where the filename comes from
+	if hosted, found := lookupHostedFile(rawURL); found { // Share links carry no filename in the URL
+		nameSource = hosted.Filename // Use the name the file host reported
+	}
+	safeFilename := strings.ToLower(urlToFilename(nameSource))                               // Generate a sanitized, lowercase filename
+	if !pathWithinDirectory(outputDirectory, filepath.Join(outputDirectory, safeFilename)) { // Names from file hosts must not climb out either
+		logErrorf("Refusing to save %s outside %s", rawURL, outputDirectory) // Log the refusal
+		return ""                                                            // Return an empty path to signal failure
+	}
+
+	releaseDirectory := githubReleaseDirectory(rawURL)   // Release assets of -github-repos are filed by repository and tag, whatever the layout
+	if *layoutMode == "flat" && releaseDirectory == "" { // Flat layout keeps every file directly in the output directory
+		return filepath.Join(outputDirectory, safeFilename) // Return the flat file path
+	}
+
+	targetDirectory := filepath.Join(outputDirectory, mirrorDirectoryForURL(rawURL)) // Directory mirroring the remote path
+	if releaseDirectory != "" {                                                      // Check if the file is a release asset
+		targetDirectory = filepath.Join(outputDirectory, releaseDirectory) // One directory per tag
+	} else if *layoutMode == "model" { // Model layout files downloads by what they are for
+		if entry, found := archiveCatalog.Entries[rawURL]; found && entry.Path != "" && filepath.Dir(filepath.FromSlash(entry.Path)) != filepath.Clean(outputDirectory) && pathWithinDirectory(outputDirectory, filepath.FromSlash(entry.Path)) { // Keep files where an earlier run filed them, even if the signals changed
+			return filepath.FromSlash(entry.Path) // The cataloged path
+		}
+		model, _ := classifyDownload(rawURL)                                    // Classify the download from what is known before fetching it
+		targetDirectory = filepath.Join(outputDirectory, modelDirectory(model)) // One directory per model
+	}
+	if !pathWithinDirectory(outputDirectory, targetDirectory) { // Directories derived from the URL or model must stay inside
+		logErrorf("Refusing to save %s outside %s", rawURL, outputDirectory) // Log the refusal
+		return ""                                                            // Return an empty path to signal failure
+	}
+	if !directoryExists(targetDirectory) { // Check if the mirrored directory exists
+		if err := os.MkdirAll(targetDirectory, 0o755); err != nil { // Create the full directory tree
+			logError(err) // Log error if creation fails
+			return ""     // Return an empty path to signal failure
+		}
+	}
+
+	return filepath.Join(targetDirectory, safeFilename) // Return the mirrored file path
+} // End of outputPathForURL function
+
+// Reports whether a path stays inside a directory once cleaned, so names built from URLs, file hosts or other archives'
+// catalogs can never escape it
+func pathWithinDirectory(directory string, candidatePath string) bool { // Function to check path containment
+	relativePath, relError := filepath.Rel(directory, candidatePath) // The path as seen from the directory
+	return relError == nil && filepath.IsLocal(relativePath)         // No "..", absolute paths or reserved names
+} // End of pathWithinDirectory function
+
+// Directories archive runs store downloads in, relative to the working directory; files merged or synced from another
+// archive must land in one of them
+var archiveRoots = []string{"PDFs", "Firmware", "Software", "Blog"}
+
+// Files the archiver writes into the output directory itself, with their signatures and timestamps, which files
+// from another archive may never replace
+var bookkeepingFilenames = []string{catalogFilename, runHistoryFilename, brokenLinksFilename, updateTimelineFilename, syncStateFilename, linkCheckFilename, checksumsFilename}
+
+// Reports whether a path from another archive's catalog names a downloaded file: inside one of the archive roots, not
+// hidden, and neither one of the archiver's bookkeeping files nor a provenance statement
+func isArchivedFilePath(localPath string) bool { // Function to check paths of merged and synced files
+	localPath = filepath.Clean(localPath)                                     // Compare cleaned paths
+	for _, segment := range strings.Split(filepath.ToSlash(localPath), "/") { // Hidden files and directories such as .git
+		if strings.HasPrefix(segment, ".") { // Check if the segment is hidden
+			return false // Never written from elsewhere
+		}
+	}
+	for _, root := range archiveRoots { // Find the root the path is in
+		if localPath == root || !pathWithinDirectory(root, localPath) { // Only files inside it
+			continue // Try the next root
+		}
+		if pathWithinDirectory(filepath.Join(root, provenanceDirectory), localPath) { // Statements are written by runs only
+			return false // Not a downloaded file
+		}
+		if filepath.Dir(localPath) == root && slices.ContainsFunc(bookkeepingFilenames, func(bookkeepingFilename string) bool { // The output directory's own files
+			return strings.HasPrefix(filepath.Base(localPath), bookkeepingFilename) // Including manifest.json.minisig, SHA256SUMS.tsr and the like
+		}) {
+			return false // Not a downloaded file
+		}
+		return true // A downloaded file
+	}
+	return false // Outside the archive roots
+} // End of isArchivedFilePath function
+
+// Marks requests whose URL came from a scraped page or the config, whose connections must not reach internal addresses
+type publicOnlyKey struct{}
+
+// Address ranges that are not reachable from the internet but not classified by netip's predicates
+var internalPrefixes = []netip.Prefix{netip.MustParsePrefix("100.64.0.0/10"), netip.MustParsePrefix("192.0.0.0/24"), netip.MustParsePrefix("198.18.0.0/15"), netip.MustParsePrefix("0.0.0.0/8")}
+
+// Reports whether an address is a public unicast address, not loopback, private, link-local, CGNAT or the like
+func isPublicAddress(address netip.Addr) bool { // Function to classify an address
+	address = address.Unmap()                              // IPv4-mapped IPv6 addresses are IPv4 addresses
+	if !address.IsGlobalUnicast() || address.IsPrivate() { // Loopback, link-local, multicast and unspecified addresses are not global unicast
+		return false // Internal
+	}
+	for _, internalPrefix := range internalPrefixes { // Check the remaining internal ranges
+		if internalPrefix.Contains(address) { // Check if the address is in the range
+			return false // Internal
+		}
+	}
+	return true // Public
+} // End of isPublicAddress function
+
+// Resolves a URL's host and returns an error if any of its addresses is internal, unless -allow-private-addresses is set
+func checkPublicDestination(rawURL string) error { // Function to refuse internal destinations
+	if *allowPrivateAddresses { // The operator allowed internal destinations
+		return nil // Nothing to check
+	}
+	parsedURL, parseError := url.Parse(rawURL) // Parse the URL
+	if parseError != nil {                     // Check if the URL is malformed
+		return parseError // Return the error
+	}
+	addresses, lookupError := lookupPublicAddresses(context.Background(), parsedURL.Hostname()) // Resolve and classify the host
+	if lookupError != nil || len(addresses) == 0 {                                              // Check if the host is internal or unknown
+		return fmt.Errorf("refusing %s: %v", rawURL, cmp.Or(lookupError, fmt.Errorf("no address"))) // Return a clear message
+	}
+	return nil // Public
+} // End of checkPublicDestination function
+
+// Resolves a host name, or takes an address literal, and returns its addresses, or an error if any of them is internal
+func lookupPublicAddresses(ctx context.Context, host string) ([]netip.Addr, error) { // Function to resolve public addresses
+	var addresses []netip.Addr                                                  // Addresses of the host
+	if literalAddress, parseError := netip.ParseAddr(host); parseError == nil { // Address literals need no lookup
+		addresses = []netip.Addr{literalAddress} // The address itself
+	} else {
+		resolvedAddresses, lookupError := net.DefaultResolver.LookupNetIP(ctx, "ip", host) // Resolve the name
+		if lookupError != nil {                                                            // Check if resolving failed
+			return nil, lookupError // Return the error
+		}
+		addresses = resolvedAddresses // The resolved addresses
+	}
+	for _, address := range addresses { // Check every address, since any of them may be dialed
+		if !isPublicAddress(address) { // Check for internal addresses
+			return nil, fmt.Errorf("%s points to the internal address %s (see -allow-private-addresses)", host, address) // Refuse the host
+		}
+	}
+	return addresses, nil // Every address is public
+} // End of lookupPublicAddresses function
+
+// Hosts and ports of the proxies configured in the environment, which connections of guarded requests go to instead
+var environmentProxies = sync.OnceValue(func() map[string]bool { // Computed on first use
+	proxyAddresses := make(map[string]bool)                                                           // Proxy host:port pairs
+	for _, variableName := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"} { // Variables http.ProxyFromEnvironment reads
+		if proxyURL, parseError := url.Parse(os.Getenv(variableName)); parseError == nil && proxyURL.Host != "" { // Skip unset and malformed values
+			proxyPort := cmp.Or(proxyURL.Port(), map[string]string{"https": "443", "socks5": "1080"}[proxyURL.Scheme], "80") // Default port of the proxy's scheme
+			proxyAddresses[net.JoinHostPort(proxyURL.Hostname(), proxyPort)] = true                                          // Allow connections to it
+		}
+	}
+	return proxyAddresses // The proxies
+}) // End of environmentProxies
+
+// Wraps a transport's dial function so connections for guarded requests only go to public addresses: the host is
+// resolved once, checked, and the checked address dialed, so a DNS answer that changes in between cannot point the
+// connection elsewhere. Redirects carry the request's context and are checked the same way; proxies are trusted.
+func publicOnlyDialer(next func(ctx context.Context, network string, address string) (net.Conn, error)) func(ctx context.Context, network string, address string) (net.Conn, error) { // Function to guard connections
+	if next == nil { // Transports without a dial function use a plain dialer
+		next = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext // Same settings as http.DefaultTransport
+	}
+	return func(ctx context.Context, network string, address string) (net.Conn, error) { // The guarded dial function
+		if *allowPrivateAddresses || ctx.Value(publicOnlyKey{}) == nil || environmentProxies()[address] { // Only guarded requests to their destination are checked
+			return next(ctx, network, address) // Dial as usual
+		}
+		host, port, splitError := net.SplitHostPort(address) // Split the address
+		if splitError != nil {                               // Check if the address is malformed
+			return nil, splitError // Return the error
+		}
+		addresses, lookupError := lookupPublicAddresses(ctx, host) // Resolve and classify the host
+		if lookupError != nil {                                    // Check if the host is internal or unknown
+			return nil, lookupError // Refuse the connection
+		}
+		var dialError error                 // Error of the last attempt
+		for _, address := range addresses { // Try each checked address in turn
+			connection, attemptError := next(ctx, network, net.JoinHostPort(address.String(), port)) // Dial the checked address itself
+			if attemptError == nil {                                                                 // Check if the connection succeeded
+				return connection, nil // Connected
+			}
+			dialError = attemptError // Remember the error and try the next address
+		}
+		return nil, dialError // Every address failed
+	} // End of guarded dial function
+} // End of publicOnlyDialer function
+
+// Converts the directory part of a URL path into sanitized relative directories (e.g. "/cdn/shop/files/a.pdf" → "cdn/shop/files")
+func mirrorDirectoryForURL(rawURL string) string { // Function to derive a mirrored directory from a URL
+	parsedURL, parseError := url.Parse(rawURL) // Parse the URL to access its path
+	if parseError != nil {                     // Check if parsing failed
+		logError(parseError) // Log the parsing error
+		return ""            // Fall back to the output directory root
+	}
+
+	reNonAlnum := regexp.MustCompile(`[^a-z0-9]+`) // Regex matching runs of characters not allowed in directory names
+	var segments []string                          // Sanitized directory segments
+
+	pathSegments := strings.Split(parsedURL.Path, "/")           // Split the URL path into its segments
+	for _, segment := range pathSegments[:len(pathSegments)-1] { // Skip the final segment, which is the filename
+		segment = reNonAlnum.ReplaceAllString(strings.ToLower(segment), "_") // Replace unsafe characters with underscores
+		segment = strings.Trim(segment, "_")                                 // Remove leading and trailing underscores
+		if segment != "" {                                                   // Ignore empty segments (including "." and "..")
+			segments = append(segments, segment) // Keep the sanitized segment
+		}
+	}
+
+	return filepath.Join(segments...) // Join the segments with the OS path separator
+} // End of mirrorDirectoryForURL function
+
+// Gets the file extension from a given file path
+func getFileExtension(path string) string { // Function to extract the file extension
+	return filepath.Ext(path) // Use filepath.Ext to extract and return the file extension
+} // End of getFileExtension function
+
+// Removes all instances of a specific substring from input string
+func removeSubstring(input string, toRemove string) string { // Function to remove all occurrences of a substring
+	result := strings.ReplaceAll(input, toRemove, "") // Replace every occurrence of 'toRemove' with an empty string
+	return result                                     // Return the cleaned string after removal
+} // End of removeSubstring function
+
+// Extracts filename from full path (e.g. "/dir/file.pdf" → "file.pdf")
+func getFilename(path string) string { // Function to get only the base filename
+	return filepath.Base(path) // Use Base function to get file name only
+} // End of getFilename function
+
+// Extracts all links to PDF files from the given HTML string
+func extractPDFUrls(pageURL string, htmlContent string) []string { // Function to find links ending in ".pdf"
+	return extractLinks(pageURL, htmlContent, isPDFLink) // Keep only links that point at PDFs
+} // End of extractPDFUrls function
+
+// Extracts all links to firmware packages from the given HTML string
+func extractFirmwareUrls(pageURL string, htmlContent string) []string { // Function to find links to firmware files
+	return extractLinks(pageURL, htmlContent, isFirmwareLink) // Keep only links that point at firmware packages
+} // End of extractFirmwareUrls function
+
+// Extracts all links to desktop software and driver installers from the given HTML string
+func extractSoftwareUrls(pageURL string, htmlContent string) []string { // Function to find links to software files
+	return extractLinks(pageURL, htmlContent, isSoftwareLink) // Keep only links that point at installers
+} // End of extractSoftwareUrls function
+
+// Reports whether a link points at a PDF
+func isPDFLink(link string) bool { // Function to recognize PDF links
+	return strings.Contains(strings.ToLower(link), ".pdf") // Check if the link contains ".pdf" (case-insensitive)
+} // End of isPDFLink function
+
+// Reports whether a link points at a firmware package (e.g. ".zip", ".bin", ".hex")
+func isFirmwareLink(link string) bool { // Function to recognize firmware links
+	parsedLink, parseError := url.Parse(link) // Parse the link to look at its path only
+	if parseError != nil {                    // Check if parsing failed
+		return false // Unparseable links are not downloadable
+	}
+	switch strings.ToLower(getFileExtension(parsedLink.Path)) { // Check the file extension of the path
+	case ".zip", ".bin", ".hex", ".frk", ".elrs": // Firmware archives and images published by RadioMaster and ExpressLRS
+		return true // The link is a firmware package
+	}
+	return false // Anything else is not firmware
+} // End of isFirmwareLink function
+
+// Reports whether a link points at companion desktop software or a driver (e.g. ".exe", ".dmg", ".AppImage")
+func isSoftwareLink(link string) bool { // Function to recognize software links
+	parsedLink, parseError := url.Parse(link) // Parse the link to look at its path only
+	if parseError != nil {                    // Check if parsing failed
+		return false // Unparseable links are not downloadable
+	}
+	_, known := softwareSignatures[strings.ToLower(getFileExtension(parsedLink.Path))] // Check the file extension of the path
+	return known                                                                       // Installers and disk images for Windows, macOS and Linux
+} // End of isSoftwareLink function
+
+// Extracts the href of every <a> tag in the given HTML string that satisfies the match function; pageURL is the page
+// the HTML came from, against which published checksums are filed
+func extractLinks(pageURL string, htmlContent string, match func(string) bool) []string { // Function to find matching links
+	var matchedLinks []string // Slice to store all matching links
+
+	parsedHTML, parseError := html.Parse(strings.NewReader(htmlContent)) // Parse the input HTML content
+	if parseError != nil {                                               // Check if HTML parsing failed
+		logError(parseError) // Log the parsing error
+		return nil           // Return nil since parsing failed
+	}
+
+	var exploreHTML func(*html.Node) // Define a recursive function to explore HTML nodes
+
+	exploreHTML = func(currentNode *html.Node) { // The implementation of the recursive traversal function
+		if currentNode.Type == html.ElementNode && currentNode.Data == "a" { // Check if the node is an <a> tag
+			for _, attribute := range currentNode.Attr { // Iterate over the <a> tag's attributes
+				if attribute.Key == "href" { // Look for the href attribute
+					link := strings.TrimSpace(attribute.Val) // Get the href value and trim spaces
+					if match(link) {                         // Check if the link is wanted
+						matchedLinks = append(matchedLinks, link)                        // Add the link to the matchedLinks slice
+						recordLinkText(link, currentNode)                                // Remember what the link says, which helps classify the file
+						recordPublishedChecksum(resolveLink(pageURL, link), currentNode) // Remember any checksum the page lists for the file
+					}
+				}
+			}
+		}
+
+		for childNode := currentNode.FirstChild; childNode != nil; childNode = childNode.NextSibling { // Recursively traverse child nodes
+			exploreHTML(childNode)
+		}
+	}
+
+	exploreHTML(parsedHTML) // Begin traversal from the root node
+	return matchedLinks     // Return all matching links
+} // End of extractLinks function
+
+// Content types accepted for PDF downloads
+var pdfContentTypes = []string{"binary/octet-stream", "application/pdf"}
+
+// Content types accepted for desktop software and driver downloads
+var softwareContentTypes = []string{"binary/octet-stream", "application/octet-stream", "application/x-msdownload", "application/x-msdos-program", "application/vnd.microsoft.portable-executable", "application/x-msi", "application/x-ms-installer", "application/x-apple-diskimage", "application/x-newton-compatible-pkg", "application/vnd.appimage", "application/x-executable", "application/vnd.debian.binary-package", "application/x-debian-package"}
+
+// Content types accepted for firmware downloads
+var firmwareContentTypes = []string{"binary/octet-stream", "application/octet-stream", "application/zip", "application/x-zip-compressed"}
+
+// Skips a download whose file is already on disk, recording that its link is still live
+func skipExistingFile(fullFilePath string, fileURL string) bool { // Function to check for files downloaded in earlier runs
+	if !fileExists(fullFilePath) { // Check if the file is missing
+		return false // The file still needs downloading
+	}
+
+	if entry, found := archiveCatalog.Entries[fileURL]; found && entry.Changed != "" { // Check if -check-only flagged the file
+		log.Printf("File changed on the server (%s), downloading it again: %s", entry.Changed, fullFilePath) // Log the refresh
+		return false                                                                                         // Download the new version over the old one
+	}
+	log.Printf("File already exists, skipping: %s", fullFilePath) // Log the skip message
+	if entry, found := archiveCatalog.Entries[fileURL]; found {   // Check if the file is cataloged
+		entry.LastSeen = time.Now().UTC().Format(time.RFC3339) // Record that the link is still live
+	}
+	return true // The download can be skipped
+} // End of skipExistingFile function
+
+// Fetches a URL and returns its response headers, body, and the hex content hash computed while streaming (see -hash),
+// or a nil body if the request failed, returned a non-200 status, had an unexpected content type, or was empty
+func fetchDownload(fileURL string, acceptedContentTypes []string) (http.Header, []byte, string) { // Function to fetch a file into memory
+	httpClient := &http.Client{Timeout: 15 * time.Minute, CheckRedirect: refuseDisallowedRedirect} // Create an HTTP client with a 15-minute timeout
+
+	downloadRequest, requestError := newDownloadRequest(fileURL) // Build the GET request with the configured headers
+	if requestError != nil {                                     // Check if the request could not be built
+		logErrorf("Failed to download %s %v", fileURL, requestError) // Log the error
+		return nil, nil, ""                                          // Return nothing on failure
+	}
+	if !downloadHostAllowed(downloadRequest.URL.String()) { // Mirrors and refreshed links are checked here too
+		logWarningf("Not downloading %s: %s is not an allowed host (see -allowed-hosts)", fileURL, downloadRequest.URL.Hostname()) // Log the refusal
+		return nil, nil, ""                                                                                                        // Return nothing on refusal
+	}
+	recordDownloadStatus(fileURL, 0)                             // Forget why an earlier attempt failed
+	waitForHostPause(downloadRequest.URL.Hostname())             // Respect a Retry-After the host sent earlier
+	httpResponse, requestError := httpClient.Do(downloadRequest) // Send an HTTP GET request
+	if requestError != nil {                                     // Check for request errors
+		logErrorf("Failed to download %s %v", fileURL, requestError) // Log the error
+		return nil, nil, ""                                          // Return nothing on failure
+	}
+	defer httpResponse.Body.Close() // Ensure the response body is closed
+
+	if httpResponse.StatusCode == http.StatusTooManyRequests || httpResponse.StatusCode == http.StatusServiceUnavailable { // Check for rate limiting
+		pauseHost(downloadRequest.URL.Hostname(), parseRetryAfter(httpResponse.Header.Get("Retry-After"))) // Stop requesting from the host for a while
+	}
+	if httpResponse.StatusCode != http.StatusOK { // Verify that the HTTP status is 200 OK
+		logErrorf("Download failed for %s %s", fileURL, httpResponse.Status) // Log the non-OK status
+		recordDownloadStatus(fileURL, httpResponse.StatusCode)               // Remember why, e.g. to renew expired signed links
+		return nil, nil, ""                                                  // Return nothing on non-200 status
+	}
+
+	contentType := httpResponse.Header.Get("Content-Type") // Get the content type of the response
+
+	if isDropboxLink(fileURL) { // Dropbox labels files with generic types; the body is checked below instead
+		acceptedContentTypes = append(acceptedContentTypes[:len(acceptedContentTypes):len(acceptedContentTypes)], dropboxContentTypes...) // Accept them too
+	}
+	if !contentTypeAccepted(contentType, acceptedContentTypes) { // Validate that the response has an expected content type
+		logErrorf("Invalid content type for %s %s (expected %s)", fileURL, contentType, strings.Join(acceptedContentTypes, " or ")) // Log the invalid content type
+		return nil, nil, ""                                                                                                         // Return nothing if content type is incorrect
+	}
+
+	transfer := dashboard.startTransfer(1, fileURL, httpResponse.ContentLength) // Show the download on the dashboard (one worker for now)
+	defer dashboard.finishTransfer(1)                                           // Clear it when the download ends
+
+	if *downloadChunks > 1 && httpResponse.ContentLength >= *chunkThreshold && httpResponse.Header.Get("Accept-Ranges") == "bytes" { // Large files from servers that support ranges are fetched in parallel
+		chunkedData, chunkError := fetchInChunks(httpClient, fileURL, httpResponse, transfer, *downloadChunks) // Fetch the ranges
+		if chunkError != nil {                                                                                 // Check if any range failed
+			logErrorf("Failed to download %s in chunks %v", fileURL, chunkError) // Log the failure
+			return nil, nil, ""                                                  // Return nothing on failure
+		}
+		contentHasher := newContentHasher()                                                 // Chunks arrive out of order, so hash the assembled file
+		contentHasher.Write(chunkedData)                                                    // Hash the content; writes to a hash never fail
+		return httpResponse.Header, chunkedData, hex.EncodeToString(contentHasher.Sum(nil)) // Return the headers, the downloaded data, and its hash
+	}
+
+	var responseBuffer bytes.Buffer                                                                              // Buffer to store the downloaded data
+	contentHasher := newContentHasher()                                                                          // Hash the bytes as they stream past instead of re-reading them
+	hashingReader := io.TeeReader(&progressReader{reader: httpResponse.Body, transfer: transfer}, contentHasher) // Count progress and feed the hasher on every read
+	bytesWritten, copyError := io.Copy(&responseBuffer, hashingReader)                                           // Copy data from response body into buffer
+	if copyError != nil {                                                                                        // Check for read errors
+		logErrorf("Failed to read data from %s %v", fileURL, copyError) // Log the read failure
+		return nil, nil, ""                                             // Return nothing on read error
+	}
+	if bytesWritten == 0 { // Handle empty downloads
+		logWarningf("Downloaded 0 bytes for %s; not creating file", fileURL) // Log empty download
+		return nil, nil, ""                                                  // Return nothing if no data was downloaded
+	}
+	if !slices.Contains(acceptedContentTypes, "text/html") && looksLikeHTML(responseBuffer.Bytes()) { // A page behind a file's content type, e.g. a block page or a deleted Dropbox file
+		logWarningf("%s returned an HTML page instead of the file; retrying through Chrome", fileURL) // Log the bad response
+		chromeData := fetchFileWithChrome(fileURL)                                                    // Browsers get past block pages
+		if chromeData == nil || looksLikeHTML(chromeData) {                                           // Check if Chrome got no file either
+			logErrorf("No file behind the page at %s; not saving it", fileURL)                   // Log the failure
+			quarantineDownload(fileURL, responseBuffer.Bytes(), "HTML page instead of the file") // Keep the page for inspection
+			return nil, nil, ""                                                                  // Return nothing instead of saving the page
+		}
+		contentHasher := newContentHasher()                                          // Hash the file Chrome saved
+		contentHasher.Write(chromeData)                                              // Hash the content; writes to a hash never fail
+		return http.Header{}, chromeData, hex.EncodeToString(contentHasher.Sum(nil)) // Chrome's response headers are not available
+	}
+
+	return httpResponse.Header, responseBuffer.Bytes(), hex.EncodeToString(contentHasher.Sum(nil)) // Return the headers, the downloaded data, and its hash
+} // End of fetchDownload function
+
+var mirrorPrefixes map[string][]string // Fallback URL prefixes from the config file, keyed by the primary URL prefix
+
+// Returns the fallback URLs configured for a file, built by swapping the longest matching primary prefix for each mirror prefix
+func mirrorURLs(fileURL string) []string { // Function to list a file's mirrors
+	matchedPrefix := ""                         // Best matching prefix so far
+	for primaryPrefix := range mirrorPrefixes { // Check each configured prefix
+		if strings.HasPrefix(fileURL, primaryPrefix) && len(primaryPrefix) > len(matchedPrefix) { // Prefer the most specific prefix
+			matchedPrefix = primaryPrefix // Remember the better match
+		}
+	}
+	if matchedPrefix == "" { // No mirrors apply
+		return nil // Nothing to fall back to
+	}
+	var fallbackURLs []string                                    // Mirrors in the configured order
+	for _, mirrorPrefix := range mirrorPrefixes[matchedPrefix] { // Build each mirror's URL
+		fallbackURLs = append(fallbackURLs, mirrorPrefix+strings.TrimPrefix(fileURL, matchedPrefix)) // Keep the rest of the path
+	}
+	return fallbackURLs // The mirrors
+} // End of mirrorURLs function
+
+// Domains downloads may always come from: the vendor's store and Shopify's CDN. File hosts such as Google Drive,
+// Dropbox and GitHub serve anyone's uploads, so they are only allowed through -allowed-hosts, or for GitHub through
+// the release downloads of the -github-repos repositories.
+var builtinDownloadDomains = []string{"radiomasterrc.com", "cdn.shopify.com"}
+
+// Hosts GitHub release downloads redirect to for the file itself
+var githubAssetHosts = []string{"objects.githubusercontent.com", "release-assets.githubusercontent.com"}
+
+// Reports whether a link's host is on the download allow-list: the built-in domains, the hosts of the source pages and
+// of the configured mirrors, and the -allowed-hosts domains, each including its subdomains, as well as release
+// downloads of the -github-repos repositories and the hosts GitHub serves them from
+func downloadHostAllowed(link string) bool { // Function to check the allow-list
+	parsedLink, parseError := url.Parse(link) // Parse the link
+	if parseError != nil {                    // Check if the link is malformed
+		return false // Unknown hosts are refused
+	}
+	host := strings.ToLower(strings.TrimSuffix(parsedLink.Hostname(), ".")) // The host as compared
+	if githubReleaseDirectory(link) != "" {                                 // A release asset of a configured repository
+		return true // Allowed
+	}
+	if len(configuredGitHubRepositories()) > 0 && slices.Contains(githubAssetHosts, host) { // Where those downloads redirect to
+		return true // Allowed
+	}
+	allowedDomains := slices.Clone(builtinDownloadDomains)          // Always allowed
+	for _, allowedHost := range strings.Split(*allowedHosts, ",") { // Domains from the flag
+		if allowedHost = strings.TrimSpace(allowedHost); allowedHost == "*" { // Check for the wildcard
+			return true // Every host is allowed
+		}
+		allowedDomains = append(allowedDomains, allowedHost) // Allow the domain
+	}
+	allowedPrefixes := slices.Clone(sourceURLs)                   // The archive's own sources
+	for primaryPrefix, fallbackPrefixes := range mirrorPrefixes { // The configured mirrors
+		allowedPrefixes = append(append(allowedPrefixes, primaryPrefix), fallbackPrefixes...) // Both sides of each mirror
+	}
+	for _, allowedPrefix := range allowedPrefixes { // Allow each of their hosts
+		if parsedPrefix, prefixError := url.Parse(allowedPrefix); prefixError == nil { // Skip malformed prefixes
+			allowedDomains = append(allowedDomains, parsedPrefix.Hostname()) // Allow the host
+		}
+	}
+	for _, allowedDomain := range allowedDomains { // Compare with each allowed domain
+		allowedDomain = strings.ToLower(strings.TrimPrefix(allowedDomain, "."))                           // Accept ".example.org" too
+		if allowedDomain != "" && (host == allowedDomain || strings.HasSuffix(host, "."+allowedDomain)) { // The domain or a subdomain
+			return true // Allowed
+		}
+	}
+	return false // Not on the allow-list
+} // End of downloadHostAllowed function
+
+// Stops a download that redirects to a host off the allow-list, so an allowed link cannot bounce to an arbitrary server
+func refuseDisallowedRedirect(redirectRequest *http.Request, via []*http.Request) error { // Function for http.Client.CheckRedirect
+	if len(via) >= 10 { // Same limit as the default policy
+		return fmt.Errorf("stopped after 10 redirects") // Refuse endless redirects
+	}
+	if !downloadHostAllowed(redirectRequest.URL.String()) { // Check the redirect target
+		return fmt.Errorf("redirect to %s is not an allowed host (see -allowed-hosts)", redirectRequest.URL.Hostname()) // Refuse it
+	}
+	if !hostWithinDomain(redirectRequest.URL.Hostname(), via[0].URL.Hostname()) { // The client copies every header to the new host
+		for _, headerName := range configuredHeaderNames() { // Configured headers may hold tokens for the original host
+			redirectRequest.Header.Del(headerName) // Keep them from the other host
+		}
+	}
+	return nil // Follow the redirect
+} // End of refuseDisallowedRedirect function
+
+// Returns the names of the extra headers configured for all requests or for any source
+func configuredHeaderNames() []string { // Function to list configured header names
+	headerNames := slices.Collect(maps.Keys(downloadHeaders)) // The config's headers
+	for _, settings := range sourceSettingsByURL {            // Each source's headers
+		headerNames = append(headerNames, slices.Collect(maps.Keys(settings.Headers))...) // Add their names
+	}
+	return headerNames // Return the names
+} // End of configuredHeaderNames function
+
+// Returns a redirect policy for clients of a server named on the command line, such as a sync primary, that follows
+// redirects within that server's host and otherwise applies refuseDisallowedRedirect
+func refuseRedirectsOffHost(host string) func(*http.Request, []*http.Request) error { // Function building a CheckRedirect policy
+	return func(redirectRequest *http.Request, via []*http.Request) error { // The policy
+		if len(via) < 10 && strings.EqualFold(redirectRequest.URL.Host, host) { // Check if the redirect stays on the server
+			return nil // Follow it
+		}
+		return refuseDisallowedRedirect(redirectRequest, via) // Anything else must be an allowed host
+	}
+} // End of refuseRedirectsOffHost function
+
+// Returns the queue without links to hosts off the allow-list, logging each dropped link
+func restrictToAllowedHosts(queue []string) []string { // Function to enforce the allow-list on a queue
+	allowedQueue := make([]string, 0, len(queue)) // Allowed links in queue order
+	for _, link := range queue {                  // Check each link
+		if downloadHostAllowed(hostedDownloadURL(link)) { // Check where the link is really fetched from
+			allowedQueue = append(allowedQueue, link) // Keep it
+			continue                                  // Next link
+		}
+		logWarningf("Not downloading %s: its host is not on the allow-list (see -allowed-hosts)", link)     // Log the refusal
+		emitEvent("error", map[string]any{"stage": "allow-list", "url": link, "error": "host not allowed"}) // Notify the webhook
+	}
+	return allowedQueue // The links that may be downloaded
+} // End of restrictToAllowedHosts function
+
+// Reports whether a Content-Type header names one of the accepted content types
+func contentTypeAccepted(contentType string, acceptedContentTypes []string) bool { // Function to check a content type
+	for _, acceptedType := range acceptedContentTypes { // Check each accepted content type
+		if strings.Contains(contentType, acceptedType) { // Check if the response matches it
+			return true // The content type is fine
+		}
+	}
+	return false // Not a type we expect
+} // End of contentTypeAccepted function
+
+// Sends a HEAD request, a few at a time, for each queued link whose file is not on disk yet, and returns the queue
+// without the links the server already shows are not real files: 404 or 410, an empty body, or a content type other
+// than the accepted ones. Rejected links count as failed downloads and toward broken-links.json. Answers that prove
+// nothing, such as servers refusing HEAD, rate limiting or a missing Content-Type, keep the link, as do links with
+// mirrors to fall back on.
+func prevalidateQueue(queue []string, directory string, acceptedContentTypes []string, linkSources map[string]string) []string { // Function to filter a download queue
+	rejections := make(map[string]string) // Why each rejected link was dropped
+	var rejectionsMutex sync.Mutex        // Guards rejections while workers add to it
+	linkQueue := make(chan string)        // Links waiting for a HEAD request
+	var workers sync.WaitGroup            // Running workers
+	for range 8 {                         // A few requests at a time
+		workers.Add(1) // Track the worker
+		go func() {    // Check links until the queue is empty
+			defer workers.Done()                                                                           // Mark the worker as finished
+			httpClient := &http.Client{Timeout: 30 * time.Second, CheckRedirect: refuseDisallowedRedirect} // HEAD requests are quick
+			for link := range linkQueue {                                                                  // Check each link
+				headRequest, requestError := newDownloadRequest(link) // Same headers as the download
+				if requestError != nil {                              // Check if the URL is unusable
+					continue // The download reports it
+				}
+				headRequest.Method = http.MethodHead                  // Ask for the headers only
+				waitForHostPause(headRequest.URL.Hostname())          // Respect a Retry-After the host sent earlier
+				headResponse, sendError := httpClient.Do(headRequest) // Send the request
+				if sendError != nil {                                 // Check if the request failed
+					continue // The download tries again and reports it
+				}
+				headResponse.Body.Close() // HEAD responses have no body
+
+				acceptedTypes := acceptedContentTypes // Content types the download would accept
+				if isDropboxLink(link) {              // Dropbox labels files with generic types
+					acceptedTypes = append(acceptedTypes[:len(acceptedTypes):len(acceptedTypes)], dropboxContentTypes...) // Accept them too
+				}
+				rejection := "" // Why the link is not a real file, if it is not
+				switch contentType := headResponse.Header.Get("Content-Type"); {
+				case headResponse.StatusCode == http.StatusNotFound || headResponse.StatusCode == http.StatusGone: // The file is gone
+					rejection = headResponse.Status                     // Report the status
+					recordDownloadStatus(link, headResponse.StatusCode) // Remember why, for broken-links.json
+				case headResponse.StatusCode != http.StatusOK: // Refused HEAD, rate limited or busy; the download finds out
+					if headResponse.StatusCode == http.StatusTooManyRequests || headResponse.StatusCode == http.StatusServiceUnavailable { // Check for rate limiting
+						pauseHost(headRequest.URL.Hostname(), parseRetryAfter(headResponse.Header.Get("Retry-After"))) // Stop requesting from the host for a while
+					}
+				case headResponse.ContentLength == 0: // An empty file
+					rejection = "empty response" // Report it
+				case contentType != "" && !contentTypeAccepted(contentType, acceptedTypes): // A page or another kind of file
+					rejection = "content type " + contentType // Report it
+				}
+				if rejection != "" && len(mirrorURLs(link)) == 0 { // Links with mirrors still get their fallback
+					rejectionsMutex.Lock()       // Lock the rejections
+					rejections[link] = rejection // Drop the link
+					rejectionsMutex.Unlock()     // Unlock
+				}
+			}
+		}()
+	}
+	for _, link := range queue { // Queue the links the download phase would fetch
+		entry, cataloged := archiveCatalog.Entries[link]                                                                   // Changed files are downloaded again
+		if isQuarantined(link) || (fileExists(outputPathForURL(link, directory)) && !(cataloged && entry.Changed != "")) { // Skipped by the download phase anyway
+			continue // Nothing to check
+		}
+		linkQueue <- link // Hand it to a worker
+	}
+	close(linkQueue) // No more links
+	workers.Wait()   // Wait for the last requests
+
+	validQueue := make([]string, 0, len(queue)) // Links that still look like real files, in queue order
+	for _, link := range queue {                // Keep or drop each link
+		rejection, rejected := rejections[link] // Why the link was dropped, if it was
+		if !rejected {                          // Check if the link looks fine
+			validQueue = append(validQueue, link) // Keep it
+			continue                              // Next link
+		}
+		logWarningf("Not downloading %s: %s", link, rejection)                                      // Log the rejection
+		runStatistics.add(&runStatistics.Failed, 1)                                                 // Count it as a failed download
+		emitEvent("error", map[string]any{"stage": "prevalidate", "url": link, "error": rejection}) // Notify the webhook
+		recordLinkOutcome(link, linkSources[link], false)                                           // Track the failure across runs
+	}
+	return validQueue // The links worth downloading
+} // End of prevalidateQueue function
+
+// Fetches a file like fetchDownload, trying the configured mirrors in order when the URL itself fails. The last result
+// is the mirror the file came from, or "" when the URL itself worked.
+func fetchDownloadWithMirrors(fileURL string, acceptedContentTypes []string) (http.Header, []byte, string, string) { // Function to fetch a file with fallbacks
+	responseHeaders, fileData, fileHash := fetchDownload(fileURL, acceptedContentTypes) // Try the URL itself
+	if fileData != nil {                                                                // Check if it worked
+		return responseHeaders, fileData, fileHash, "" // No mirror needed
+	}
+	for _, mirrorURL := range mirrorURLs(fileURL) { // Try each mirror in order
+		log.Printf("Trying mirror %s for %s", mirrorURL, fileURL)                            // Log the fallback
+		responseHeaders, fileData, fileHash = fetchDownload(mirrorURL, acceptedContentTypes) // Fetch from the mirror
+		if fileData != nil {                                                                 // Check if the mirror had the file
+			return responseHeaders, fileData, fileHash, mirrorURL // Remember where it came from
+		}
+	}
+	return nil, nil, "", "" // Every source failed
+} // End of fetchDownloadWithMirrors function
+
+// Sends a HEAD request for every cataloged URL, a few at a time, and flags entries whose size, ETag, or Last-Modified
+// no longer match the download, so a refresh takes seconds and only the next full run downloads anything
+func refreshCatalogHeaders() { // Function implementing -check-only
+	var catalogMutex sync.Mutex            // Guards the entries while workers update them
+	entryQueue := make(chan *catalogEntry) // Entries waiting for a HEAD request
+	var workers sync.WaitGroup             // Running workers
+	changedCount, missingCount := 0, 0     // Results for the summary
+	for range 8 {                          // A few requests at a time
+		workers.Add(1) // Track the worker
+		go func() {    // Check entries until the queue is empty
+			defer workers.Done()                                                                           // Mark the worker as finished
+			httpClient := &http.Client{Timeout: 30 * time.Second, CheckRedirect: refuseDisallowedRedirect} // HEAD requests are quick
+			for entry := range entryQueue {                                                                // Check each entry
+				headRequest, requestError := newDownloadRequest(entry.URL) // Same headers as the download
+				if requestError != nil {                                   // Check if the URL is unusable
+					logErrorf("Failed to check %s %v", entry.URL, requestError) // Log the error
+					continue                                                    // Try the next entry
+				}
+				headRequest.Method = http.MethodHead                  // Ask for the headers only
+				waitForHostPause(headRequest.URL.Hostname())          // Respect a Retry-After the host sent earlier
+				headResponse, sendError := httpClient.Do(headRequest) // Send the request
+				if sendError != nil {                                 // Check if the request failed
+					logErrorf("Failed to check %s %v", entry.URL, sendError) // Log the error
+					continue                                                 // Try the next entry
+				}
+				headResponse.Body.Close()          // HEAD responses have no body
+				pauseRateLimitedHost(headResponse) // Back off like downloads do when the host is busy
+
+				if lastModified := headResponse.Header.Get("Last-Modified"); lastModified != "" { // Date the file on its product's timeline
+					catalogMutex.Lock()                     // Lock the catalog
+					recordLastModified(entry, lastModified) // Record the date, if new
+					catalogMutex.Unlock()                   // Unlock
+				}
+				switch {
+				case headResponse.StatusCode == http.StatusNotFound || headResponse.StatusCode == http.StatusGone: // The file was taken down
+					logWarningf("No longer on the server (%s): %s", headResponse.Status, entry.URL) // Report it; the archived copy stays
+					catalogMutex.Lock()                                                             // Lock the counters
+					missingCount++                                                                  // Count it
+					catalogMutex.Unlock()                                                           // Unlock
+					continue                                                                        // Nothing to download again
+				case headResponse.StatusCode != http.StatusOK: // Servers that refuse HEAD or are busy say nothing about the file
+					logWarningf("Could not check %s: %s", entry.URL, headResponse.Status) // Log the status
+					continue                                                              // Try the next entry
+				}
+				changes := headerChanges(entry, headResponse.ContentLength, headResponse.Header) // What differs from the download
+				if len(changes) == 0 {                                                           // Check if the file is unchanged
+					continue // Nothing to flag
+				}
+				catalogMutex.Lock()                                                    // Lock the entries
+				entry.Changed = strings.Join(changes, ", ")                            // Flag the entry for the next run
+				changedCount++                                                         // Count it
+				catalogMutex.Unlock()                                                  // Unlock
+				log.Printf("Changed on the server (%s): %s", entry.Changed, entry.URL) // Report the change
+			}
+		}()
+	}
+	for _, entry := range archiveCatalog.Entries { // Queue every cataloged file
+		entryQueue <- entry // Hand it to a worker
+	}
+	close(entryQueue)                                                                                                                 // No more entries
+	workers.Wait()                                                                                                                    // Wait for the last requests
+	log.Printf("Checked %d file(s): %d changed, %d no longer on the server", len(archiveCatalog.Entries), changedCount, missingCount) // Summary
+} // End of refreshCatalogHeaders function
+
+// Lists how a server's answer for a cataloged file differs from its download: the size (-1 when unknown), ETag and
+// Last-Modified. Headers the server or the catalog lacks are not compared.
+func headerChanges(entry *catalogEntry, contentLength int64, header http.Header) []string { // Function to compare a file's headers
+	var changes []string                                     // What differs from the download
+	downloadSize := cmp.Or(entry.DownloadSize, entry.Size)   // Rewritten files are compared by what the server sent
+	if contentLength >= 0 && contentLength != downloadSize { // Compare the size
+		changes = append(changes, fmt.Sprintf("size %d → %d", downloadSize, contentLength)) // The size changed
+	}
+	if etag := header.Get("ETag"); etag != "" && entry.ETag != "" && etag != entry.ETag { // Compare the ETag
+		changes = append(changes, fmt.Sprintf("ETag %s → %s", entry.ETag, etag)) // The ETag changed
+	}
+	if lastModified := header.Get("Last-Modified"); lastModified != "" && entry.LastModified != "" && lastModified != entry.LastModified { // Compare the modification time
+		changes = append(changes, fmt.Sprintf("Last-Modified %s → %s", entry.LastModified, lastModified)) // The file was modified
+	}
+	return changes // Empty when nothing differs
+} // End of headerChanges function
+
+// Outcome of checking one link with the linkcheck subcommand
+type linkCheckResult struct { // Fields stored for each checked link
+	URL        string `json:"url"`                   // Link that was checked
+	Kind       string `json:"kind"`                  // "file" for cataloged downloads, "page" for scraped pages, "external" for external assets
+	Status     string `json:"status"`                // "ok", "dead", "moved", "changed" or "error"
+	HTTPStatus int    `json:"http_status,omitempty"` // Status of the final response, when the server answered
+	FinalURL   string `json:"final_url,omitempty"`   // Where the link redirects to, for moved links
+	Detail     string `json:"detail,omitempty"`      // What changed, or why the check failed
+} // End of linkCheckResult struct
+
+// Sends a HEAD request for every link in the catalog (cataloged files, scraped pages and external assets), falling
+// back to a GET of the first byte for servers that refuse HEAD, so no content is downloaded. Links that are gone,
+// redirect elsewhere, or whose size, ETag or Last-Modified changed are printed, and every result is written to
+// linkcheck.json in the output directory. The catalog is left untouched; like runCheck, nothing is printed when
+// every link works, so the command can run from cron.
+func runLinkCheck(outputDirectory string) { // Function implementing the linkcheck subcommand
+	linkKinds := make(map[string]string)        // Links to check, with what they are
+	for link := range archiveCatalog.External { // External assets
+		linkKinds[link] = "external" // Record the kind
+	}
+	for link := range archiveCatalog.Products { // Product pages
+		linkKinds[link] = "page" // Record the kind
+	}
+	for link := range archiveCatalog.Pages { // Other scraped pages
+		linkKinds[link] = "page" // Record the kind
+	}
+	for link := range archiveCatalog.Entries { // Downloads win over pages of the same URL
+		linkKinds[link] = "file" // Record the kind
+	}
+
+	var resultsMutex sync.Mutex    // Guards results while workers add to it
+	var results []*linkCheckResult // Outcome of every check
+	linkQueue := make(chan string) // Links waiting for a request
+	var workers sync.WaitGroup     // Running workers
+	for range 8 {                  // A few requests at a time
+		workers.Add(1) // Track the worker
+		go func() {    // Check links until the queue is empty
+			defer workers.Done()                                                                            // Mark the worker as finished
+			httpClient := &http.Client{Timeout: *linkCheckTimeout, CheckRedirect: refuseDisallowedRedirect} // Only the headers are read
+			for link := range linkQueue {                                                                   // Check each link
+				result := checkLink(httpClient, link, linkKinds[link]) // Ask the server
+				resultsMutex.Lock()                                    // Lock the results
+				results = append(results, result)                      // Keep the result
+				resultsMutex.Unlock()                                  // Unlock
+			}
+		}()
+	}
+	for link := range linkKinds { // Queue every link
+		linkQueue <- link // Hand it to a worker
+	}
+	close(linkQueue) // No more links
+	workers.Wait()   // Wait for the last requests
+
+	slices.SortFunc(results, func(first, second *linkCheckResult) int { return strings.Compare(first.URL, second.URL) }) // Sort for stable output
+	statusCounts := make(map[string]int)                                                                                 // Results by status, for the summary
+	for _, result := range results {                                                                                     // Print each problem
+		statusCounts[result.Status]++ // Count it
+		if result.Status == "ok" {    // Working links are only recorded in the report
+			continue // Nothing to print
+		}
+		fmt.Println(strings.TrimSpace(fmt.Sprintf("%-8s %s %s", result.Status, result.URL, cmp.Or(result.FinalURL, result.Detail)))) // One line per problem
+	}
+	if len(results) > statusCounts["ok"] { // Summarize only when something is wrong
+		fmt.Printf("%d checked: %d dead, %d moved, %d changed, %d error(s)\n", len(results), statusCounts["dead"], statusCounts["moved"], statusCounts["changed"], statusCounts["error"]) // Print the summary
+	}
+
+	transferredBytes, _ := runStatistics.transfers()                                                                                                                                         // The catalog is left untouched, so the bandwidth goes in the report
+	reportJSON, marshalError := json.MarshalIndent(map[string]any{"checked_at": time.Now().UTC().Format(time.RFC3339), "bytes_transferred": transferredBytes, "results": results}, "", "  ") // Encode the report
+	if marshalError != nil {                                                                                                                                                                 // Check if encoding failed
+		logError(marshalError) // Log the error
+		return                 // Nothing to write
+	}
+	if writeError := writeArchiveFile(filepath.Join(outputDirectory, linkCheckFilename), append(reportJSON, '\n'), 0o644); writeError != nil { // Save the report
+		logError(writeError) // Log the error
+	}
+} // End of runLinkCheck function
+
+// Checks one link with a HEAD request, or a GET of its first byte when the server refuses HEAD
+func checkLink(httpClient *http.Client, link string, kind string) *linkCheckResult { // Function to check a link
+	result := &linkCheckResult{URL: link, Kind: kind}      // Filled in below
+	checkRequest, requestError := newDownloadRequest(link) // Same headers as the download
+	if requestError != nil {                               // Check if the URL is unusable
+		result.Status, result.Detail = "error", requestError.Error() // Report it
+		return result                                                // Done
+	}
+	checkRequest.Method = http.MethodHead                                                                                                                                // Ask for the headers only
+	waitForHostPause(checkRequest.URL.Hostname())                                                                                                                        // Respect a Retry-After the host sent earlier
+	checkResponse, sendError := httpClient.Do(checkRequest)                                                                                                              // Send the request
+	if sendError == nil && checkResponse.StatusCode != http.StatusOK && checkResponse.StatusCode != http.StatusNotFound && checkResponse.StatusCode != http.StatusGone { // Many servers refuse or mishandle HEAD
+		checkResponse.Body.Close()                             // Done with the HEAD response
+		checkRequest.Method = http.MethodGet                   // Ask for the content instead
+		checkRequest.Header.Set("Range", "bytes=0-0")          // But only its first byte
+		pauseRateLimitedHost(checkResponse)                    // A busy host may have asked for a pause
+		waitForHostPause(checkRequest.URL.Hostname())          // Respect it
+		checkResponse, sendError = httpClient.Do(checkRequest) // Send the request again
+	}
+	if sendError != nil && checkResponse != nil { // The server answered with a redirect the allow-list refuses
+		result.Status, result.Detail = "error", sendError.Error() // Report it
+		return result                                             // Done
+	}
+	if sendError != nil { // Check if the server is unreachable
+		result.Status, result.Detail = "dead", sendError.Error() // Unreachable hosts count as dead
+		return result                                            // Done
+	}
+	checkResponse.Body.Close()          // Never read the content
+	pauseRateLimitedHost(checkResponse) // Back off like downloads do when the host is busy
+
+	result.HTTPStatus = checkResponse.StatusCode // Final status
+	switch {
+	case checkResponse.StatusCode == http.StatusNotFound || checkResponse.StatusCode == http.StatusGone: // Taken down
+		result.Status, result.Detail = "dead", checkResponse.Status // Report it
+		return result                                               // Done
+	case checkResponse.StatusCode != http.StatusOK && checkResponse.StatusCode != http.StatusPartialContent: // Refused, rate-limited or broken
+		result.Status, result.Detail = "error", checkResponse.Status // Report it
+		return result                                                // Done
+	}
+	if finalURL := checkResponse.Request.URL.String(); finalURL != checkRequest.URL.String() { // The client followed redirects
+		result.Status, result.FinalURL = "moved", finalURL // Report where the link leads now
+		return result                                      // Done
+	}
+
+	result.Status = "ok"                                             // Working unless the file changed
+	if entry, cataloged := archiveCatalog.Entries[link]; cataloged { // Compare downloads with their catalog entry
+		contentLength := checkResponse.ContentLength               // Size of a HEAD or full GET response
+		if checkResponse.StatusCode == http.StatusPartialContent { // A range response only carries the total size in Content-Range
+			contentLength = -1                                                                             // Unknown unless stated
+			if _, totalSize, found := strings.Cut(checkResponse.Header.Get("Content-Range"), "/"); found { // "bytes 0-0/<total>"
+				if parsedSize, parseError := strconv.ParseInt(totalSize, 10, 64); parseError == nil { // "*" means unknown
+					contentLength = parsedSize // The file's size
+				}
+			}
+		}
+		if changes := headerChanges(entry, contentLength, checkResponse.Header); len(changes) > 0 { // Check if the file changed
+			result.Status, result.Detail = "changed", strings.Join(changes, ", ") // Report what changed
+		}
+	}
+	return result // Done
+} // End of checkLink function
+
+// Query parameters that mark a URL as carrying an expiring CDN signature
+var expiringSignatureParameters = []string{"expires", "x-amz-signature", "x-amz-expires", "x-goog-signature", "x-goog-expires", "signature", "key-pair-id", "hdnts", "token", "exp"}
+
+// Reports whether a URL carries a CDN signature that expires
+func hasExpiringSignature(fileURL string) bool { // Function to recognize signed URLs
+	parsedURL, parseError := url.Parse(fileURL) // Parse the URL
+	if parseError != nil {                      // Check if the URL is malformed
+		return false // Unknown URLs are not treated as signed
+	}
+	for parameterName := range parsedURL.Query() { // Check each query parameter
+		for _, signatureParameter := range expiringSignatureParameters { // Compare against the known signature parameters
+			if strings.EqualFold(parameterName, signatureParameter) { // Parameter names vary in case between CDNs
+				return true // The URL is signed
+			}
+		}
+	}
+	return false // No signature found
+} // End of hasExpiringSignature function
+
+// Status codes of failed downloads, by URL
+var downloadStatuses = struct {
+	sync.Mutex                 // Guards statuses
+	statuses   map[string]int  // Last non-200 status by URL
+	refreshed  map[string]bool // Links obtained by refreshing an expired one, which are not refreshed again
+	retries    map[string]int  // Number of retries after rate limiting, by URL
+}{statuses: make(map[string]int), refreshed: make(map[string]bool), retries: make(map[string]int)}
+
+// Forgets the failures recorded during an earlier run
+func resetDownloadStatuses() { // Function to start a run with clean statuses
+	downloadStatuses.Lock()                            // Lock the statuses
+	defer downloadStatuses.Unlock()                    // Unlock when done
+	downloadStatuses.statuses = make(map[string]int)   // No failures yet
+	downloadStatuses.refreshed = make(map[string]bool) // No refreshed links yet
+	downloadStatuses.retries = make(map[string]int)    // No retries yet
+} // End of resetDownloadStatuses function
+
+// Reports whether a failed download was turned away by rate limiting (429 or 503) and should be retried once its
+// host's pause ends; the download then no longer counts as failed
+func retryAfterRateLimit(fileURL string) bool { // Function to decide on rate-limit retries
+	downloadStatuses.Lock()                                                                      // Lock the statuses
+	defer downloadStatuses.Unlock()                                                              // Unlock when done
+	statusCode := downloadStatuses.statuses[fileURL]                                             // Why the download failed
+	if statusCode != http.StatusTooManyRequests && statusCode != http.StatusServiceUnavailable { // Only rate limiting is retried
+		return false // The failure stands
+	}
+	if downloadStatuses.retries[fileURL] >= maxRateLimitRetries { // Check if the host keeps refusing
+		return false // Give up on the file
+	}
+	downloadStatuses.retries[fileURL]++          // Count the retry
+	runStatistics.add(&runStatistics.Failed, -1) // The retry decides whether the file failed
+	return true                                  // Retry the download
+} // End of retryAfterRateLimit function
+
+// Time until which each host asked not to be sent requests
+var hostPauses = struct {
+	sync.Mutex                      // Guards until
+	until      map[string]time.Time // End of the pause by host name
+}{until: make(map[string]time.Time)}
+
+// Reads a Retry-After header, given in seconds or as an HTTP date, falling back to defaultRetryAfter when it is
+// missing or malformed and capping it at maxRetryAfter
+func parseRetryAfter(headerValue string) time.Duration { // Function to read Retry-After
+	retryAfter := defaultRetryAfter                                                                             // Used when the header says nothing useful
+	if seconds, parseError := strconv.Atoi(strings.TrimSpace(headerValue)); parseError == nil && seconds >= 0 { // Delay in seconds
+		retryAfter = time.Duration(seconds) * time.Second // Use the delay
+	} else if retryDate, dateError := http.ParseTime(headerValue); dateError == nil { // Date to retry at
+		retryAfter = time.Until(retryDate) // Wait until then
+	}
+	return min(max(retryAfter, 0), maxRetryAfter) // Never wait a negative or unreasonable time
+} // End of parseRetryAfter function
+
+// Pauses requests to a host after it answered with a rate limit
+func pauseHost(hostName string, pause time.Duration) { // Function to back off from a host
+	hostPauses.Lock()                                  // Lock the pauses
+	defer hostPauses.Unlock()                          // Unlock when done
+	pausedUntil := time.Now().Add(pause)               // When requests may resume
+	if pausedUntil.After(hostPauses.until[hostName]) { // Never shorten a longer pause
+		hostPauses.until[hostName] = pausedUntil // Record the pause
+	}
+	logWarningf("%s is rate limiting requests; pausing it for %s", hostName, pause.Round(time.Second)) // Log the pause
+} // End of pauseHost function
+
+// Pauses the host that sent a response when it answered 429 Too Many Requests or 503 Service Unavailable
+func pauseRateLimitedHost(response *http.Response) { // Function to back off from a busy host
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable { // Check for rate limiting
+		pauseHost(response.Request.URL.Hostname(), parseRetryAfter(response.Header.Get("Retry-After"))) // Stop requesting from the host for a while
+	}
+} // End of pauseRateLimitedHost function
+
+// Waits until a paused host may be sent requests again
+func waitForHostPause(hostName string) { // Function to respect a host's pause
+	hostPauses.Lock()                         // Lock the pauses
+	pausedUntil := hostPauses.until[hostName] // When requests may resume
+	hostPauses.Unlock()                       // Unlock before sleeping
+	time.Sleep(time.Until(pausedUntil))       // Sleep out the rest of the pause; negative durations return immediately
+} // End of waitForHostPause function
+
+// Records the status code of a failed download
+func recordDownloadStatus(fileURL string, statusCode int) { // Function to remember why a download failed
+	downloadStatuses.Lock()                         // Lock the statuses
+	downloadStatuses.statuses[fileURL] = statusCode // Remember the status
+	downloadStatuses.Unlock()                       // Unlock
+} // End of recordDownloadStatus function
+
+// When a signed link failed with 403 Forbidden, its signature has most likely expired: re-scrapes the page the link
+// was found on and returns the link there with the same path, or "" when there is no fresh link to retry with
+func refreshExpiredLink(staleURL string, linkSources map[string]string) string { // Function to renew an expired signed link
+	downloadStatuses.Lock()                                  // Lock the statuses
+	statusCode := downloadStatuses.statuses[staleURL]        // Why the download failed
+	alreadyRefreshed := downloadStatuses.refreshed[staleURL] // Whether this link is itself a refresh
+	downloadStatuses.Unlock()                                // Unlock
+	if alreadyRefreshed {                                    // A fresh link that fails too means the problem is not the signature
+		return "" // Stop retrying
+	}
+	sourcePage := linkSources[staleURL]                                                            // Page to re-scrape
+	if statusCode != http.StatusForbidden || sourcePage == "" || !hasExpiringSignature(staleURL) { // Only expired signatures can be renewed
+		return "" // Nothing to retry
+	}
+
+	staleParsed, parseError := url.Parse(staleURL) // Parse the stale link to compare paths
+	if parseError != nil {                         // Check if the link is malformed
+		emitEvent("error", map[string]any{"stage": "download", "url": staleURL, "error": "download failed"}) // No retry follows
+		return ""                                                                                            // Nothing to retry
+	}
+	logWarningf("Signed link %s was rejected; re-scraping %s for a fresh one", staleURL, sourcePage)                                                                 // Log the refresh
+	pageHTML := scopeToSelectors(sourcePage, scrapePage(sourcePage))                                                                                                 // Scrape the page again
+	for _, link := range slices.Concat(extractPDFUrls(sourcePage, pageHTML), extractFirmwareUrls(sourcePage, pageHTML), extractSoftwareUrls(sourcePage, pageHTML)) { // Look for the same file
+		freshURL := resolveLink(sourcePage, link)      // Absolute form of the link
+		freshParsed, freshError := url.Parse(freshURL) // Parse it to compare paths
+		if freshError != nil || freshURL == staleURL { // The same signature would fail again
+			continue // Check the next link
+		}
+		if freshParsed.Host == staleParsed.Host && freshParsed.Path == staleParsed.Path { // Same file, new signature
+			linkSources[freshURL] = sourcePage          // The fresh link comes from the same page
+			downloadStatuses.Lock()                     // Lock the statuses
+			downloadStatuses.refreshed[freshURL] = true // Never refresh the fresh link again
+			downloadStatuses.Unlock()                   // Unlock
+			return freshURL                             // Retry with it
+		}
+	}
+	logErrorf("No fresh link for %s found on %s", staleURL, sourcePage)                                  // Log the failed refresh
+	emitEvent("error", map[string]any{"stage": "download", "url": staleURL, "error": "download failed"}) // The failure reported now that no retry follows
+	return ""                                                                                            // Nothing to retry
+} // End of refreshExpiredLink function
+
+// Sends the "error" event of a failed download, unless the download queue will try it again: after its host's rate
+// limit, up to maxRateLimitRetries times, or once with a fresh signature, which refreshExpiredLink reports on failure
+func reportDownloadFailure(fileURL string) { // Function to report final download failures
+	downloadStatuses.Lock()                          // Lock the statuses
+	statusCode := downloadStatuses.statuses[fileURL] // Why the download failed
+	retryPending := false                            // Whether another attempt follows
+	switch statusCode {                              // Match the retries of the download queues
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable: // Rate limited
+		retryPending = downloadStatuses.retries[fileURL] < maxRateLimitRetries // Retried while retries are left
+	case http.StatusForbidden: // Possibly an expired signature
+		retryPending = !downloadStatuses.refreshed[fileURL] && hasExpiringSignature(fileURL) // Refreshed once
+	}
+	downloadStatuses.Unlock()                                                                                       // Unlock
+	downloadSourcePages.Lock()                                                                                      // Lock the record
+	retryPending = retryPending && (statusCode != http.StatusForbidden || downloadSourcePages.pages[fileURL] != "") // Refreshing needs the page the link came from
+	downloadSourcePages.Unlock()                                                                                    // Unlock the record
+	if !retryPending {                                                                                              // Check if this attempt was the last
+		emitEvent("error", map[string]any{"stage": "download", "url": fileURL, "error": "download failed"}) // Notify the webhook
+	}
+} // End of reportDownloadFailure function
+
+// A share link on a file host, resolved into the URL that serves the file and the file's real name
+type hostedFile struct {
+	DownloadURL string // URL serving the file itself; empty when the file is already archived
+	Filename    string // Name of the file as reported by the host
+} // End of hostedFile struct
+
+// Share links resolved during the current run
+var hostedFiles = struct {
+	sync.Mutex                       // Guards files
+	files      map[string]hostedFile // Resolved files by share URL
+}{files: make(map[string]hostedFile)}
+
+// Returns the resolved file behind a share link, if it was resolved
+func lookupHostedFile(shareURL string) (hostedFile, bool) { // Function to look up a resolved share link
+	hostedFiles.Lock()                            // Lock the resolved links
+	defer hostedFiles.Unlock()                    // Unlock when done
+	hosted, found := hostedFiles.files[shareURL]  // Look the link up
+	return hosted, found && hosted.Filename != "" // Only links with a known file count
+} // End of lookupHostedFile function
+
+// Returns the URL to request for a download: the direct URL for resolved share links, the URL itself otherwise
+func hostedDownloadURL(fileURL string) string { // Function to map share links to their files
+	if hosted, found := lookupHostedFile(fileURL); found && hosted.DownloadURL != "" { // Check for a resolved share link
+		return hosted.DownloadURL // Request the file itself
+	}
+	if isDropboxLink(fileURL) { // Dropbox share links name the file but serve a preview page
+		return dropboxDirectURL(fileURL) // Request the file itself
+	}
+	return fileURL // Ordinary links are requested as they are
+} // End of hostedDownloadURL function
+
+// Content types Dropbox labels direct downloads with, whatever the file
+var dropboxContentTypes = []string{"application/binary", "application/octet-stream"}
+
+// Reports whether a link points at a file shared on Dropbox
+func isDropboxLink(link string) bool { // Function to recognize Dropbox links
+	parsedLink, parseError := url.Parse(link) // Parse the link
+	if parseError != nil {                    // Check if the link is malformed
+		return false // Not a Dropbox link
+	}
+	switch strings.ToLower(parsedLink.Hostname()) { // Check the host
+	case "dropbox.com", "www.dropbox.com", "dl.dropbox.com", "dl.dropboxusercontent.com": // Share and download hosts
+		return true // A Dropbox link
+	}
+	return false // Any other host
+} // End of isDropboxLink function
+
+// Rewrites a Dropbox share link ("?dl=0") into its direct-download form ("?dl=1"), keeping parameters such as rlkey
+func dropboxDirectURL(shareURL string) string { // Function to build Dropbox direct downloads
+	parsedLink, parseError := url.Parse(shareURL) // Parse the link
+	if parseError != nil {                        // Check if the link is malformed
+		return shareURL // Leave it as it is
+	}
+	query := parsedLink.Query()          // The link's parameters
+	query.Del("raw")                     // "raw=1" renders the file inline instead of downloading it
+	query.Set("dl", "1")                 // Ask for the file instead of the preview page
+	parsedLink.RawQuery = query.Encode() // Rebuild the query
+	return parsedLink.String()           // Return the direct link
+} // End of dropboxDirectURL function
+
+// Reports whether a link is a share link on a file host that needs resolving before it can be downloaded
+func isHostedFileLink(link string) bool { // Function to recognize share links
+	return googleDriveFileID(link) != "" // Google Drive file links
+} // End of isHostedFileLink function
+
+// Matches the path of Google Drive file links such as "/file/d/<id>/view"
+var googleDriveFilePath = regexp.MustCompile(`^/file/d/([A-Za-z0-9_-]+)`)
+
+// Extracts the file ID from a Google Drive link ("/file/d/<id>/view", "/open?id=<id>", "/uc?id=<id>"), or "" for other links
+func googleDriveFileID(link string) string { // Function to parse Google Drive links
+	parsedLink, parseError := url.Parse(link) // Parse the link
+	if parseError != nil {                    // Check if the link is malformed
+		return "" // Not a Drive link
+	}
+	switch strings.ToLower(parsedLink.Hostname()) { // Only Google's file hosts
+	case "drive.google.com", "docs.google.com", "drive.usercontent.google.com": // Share, legacy, and download hosts
+	default:
+		return "" // Not a Drive link
+	}
+	if match := googleDriveFilePath.FindStringSubmatch(parsedLink.Path); match != nil { // Check for the share page form
+		return match[1] // Return the file ID
+	}
+	switch parsedLink.Path { // Check for the query forms
+	case "/open", "/uc", "/download": // Links with the ID in the query
+		return parsedLink.Query().Get("id") // Return the file ID, if any
+	}
+	return "" // Folders and other Drive pages are not files
+} // End of googleDriveFileID function
+
+// Resolves share links into direct downloads and sorts them by the type of file they serve. Links whose file is
+// already archived are not requested again; the catalog remembers their filename.
+func resolveHostedLinks(shareLinks []string) ([]string, []string, []string) { // Function to resolve share links
+	var pdfLinks []string      // Share links serving manuals
+	var firmwareLinks []string // Share links serving firmware
+	var softwareLinks []string // Share links serving installers and drivers
+
+	for _, shareURL := range shareLinks { // Resolve each link
+		var hosted hostedFile                                                                                      // The file behind the link
+		if entry, found := archiveCatalog.Entries[shareURL]; found && fileExists(filepath.FromSlash(entry.Path)) { // Check if the file was archived before
+			hosted = hostedFile{Filename: filepath.Base(filepath.FromSlash(entry.Path))} // Reuse its name
+		} else {
+			resolved, resolveError := resolveGoogleDriveLink(shareURL) // Ask the host for the file
+			if resolveError != nil {                                   // Check if the link could not be resolved
+				logErrorf("Failed to resolve %s %v", shareURL, resolveError)                                           // Log the error
+				runStatistics.add(&runStatistics.Failed, 1)                                                            // Count the failed download
+				emitEvent("error", map[string]any{"stage": "resolve", "url": shareURL, "error": resolveError.Error()}) // Notify the webhook
+				continue                                                                                               // Move on to the next link
+			}
+			hosted = resolved // Use the resolved file
+		}
+
+		switch { // Sort the link by the file it serves
+		case isPDFLink(hosted.Filename): // Shared manual
+			pdfLinks = append(pdfLinks, shareURL) // Queue it with the PDFs
+		case isFirmwareLink(hosted.Filename): // Shared firmware
+			firmwareLinks = append(firmwareLinks, shareURL) // Queue it with the firmware
+		case isSoftwareLink(hosted.Filename): // Shared installer or driver
+			softwareLinks = append(softwareLinks, shareURL) // Queue it with the software
+		default:
+			logWarningf("Skipping %s: %s is not a manual, firmware or software", shareURL, hosted.Filename) // Log the skip
+			continue                                                                                        // Do not remember the link
+		}
+		hostedFiles.Lock()                   // Lock the resolved links
+		hostedFiles.files[shareURL] = hosted // Remember the file for the download
+		hostedFiles.Unlock()                 // Unlock
+	}
+	return pdfLinks, firmwareLinks, softwareLinks // Return the sorted links
+} // End of resolveHostedLinks function
+
+// Base URL of the GitHub REST API
+const githubAPIURL = "https://api.github.com"
+
+// Returns the -github-repos repositories as lowercase "owner/repo" names, skipping malformed entries
+func configuredGitHubRepositories() []string { // Function to parse -github-repos
+	var repositories []string                                            // Well-formed repositories
+	for _, repository := range strings.Split(*githubRepositories, ",") { // Check each entry
+		repository = strings.Trim(strings.TrimSpace(repository), "/")           // Tolerate spaces and stray slashes
+		owner, name, found := strings.Cut(repository, "/")                      // Split "owner/repo"
+		if !found || owner == "" || name == "" || strings.Contains(name, "/") { // Check the form
+			continue // Not a repository
+		}
+		repositories = append(repositories, strings.ToLower(repository)) // GitHub names are case-insensitive
+	}
+	return repositories // Return the repositories
+} // End of configuredGitHubRepositories function
+
+// One release as listed by the GitHub REST API
+type githubRelease struct { // Fields read from each release
+	TagName    string `json:"tag_name"`   // Git tag the release was made from (e.g. "v2.10.1")
+	HTMLURL    string `json:"html_url"`   // Release page, recorded as the assets' source page
+	Draft      bool   `json:"draft"`      // Unpublished releases
+	Prerelease bool   `json:"prerelease"` // Nightlies and release candidates
+	Assets     []struct {
+		Name               string `json:"name"`                 // Filename of the asset
+		BrowserDownloadURL string `json:"browser_download_url"` // Public download link, under github.com/<owner>/<repo>/releases/download/<tag>/
+		Digest             string `json:"digest"`               // "sha256:<hex>" computed by GitHub, on assets uploaded since mid-2025
+	} `json:"assets"` // Files attached to the release
+} // End of githubRelease struct
+
+// Lists the assets of the newest -github-releases published releases of each repository ("owner/repo"), sorted into
+// firmware and software links, with each release page recorded as its assets' source and each digest GitHub publishes
+// recorded like a checksum printed on a page. Assets that are neither (source archives, checksum lists) are skipped.
+func listGitHubReleaseAssets(repositories []string, linkSources map[string]string) ([]string, []string) { // Function to list release assets
+	var firmwareLinks []string                       // Release assets that are firmware
+	var softwareLinks []string                       // Release assets that are installers
+	httpClient := &http.Client{Timeout: time.Minute} // Listing only needs small JSON responses
+
+	for _, repository := range repositories { // List each repository
+		owner, name, _ := strings.Cut(repository, "/")                                           // Split "owner/repo"
+		releases, listError := fetchGitHubReleases(httpClient, owner, name, *githubReleaseCount) // Ask the API for the releases
+		if listError != nil {                                                                    // Check if the listing failed
+			logErrorf("Failed to list releases of %s %v", repository, listError)                                 // Log the error
+			runStatistics.add(&runStatistics.Failed, 1)                                                          // Count the failure
+			emitEvent("error", map[string]any{"stage": "github", "url": repository, "error": listError.Error()}) // Notify the webhook
+			continue                                                                                             // Move on to the next repository
+		}
+
+		mirrored := 0                      // Published releases taken so far
+		queuedAssets := 0                  // Assets of those releases queued for download
+		for _, release := range releases { // The API lists the newest first
+			if release.Draft || release.Prerelease { // Only published, stable releases
+				continue // Skip it
+			}
+			if mirrored >= *githubReleaseCount { // Check if enough releases were taken
+				break // Older releases are left alone
+			}
+			mirrored++                             // Count the release
+			for _, asset := range release.Assets { // Sort each asset
+				switch { // By its filename
+				case isFirmwareLink(asset.BrowserDownloadURL): // Firmware images and archives
+					firmwareLinks = append(firmwareLinks, asset.BrowserDownloadURL) // Queue it with the firmware
+				case isSoftwareLink(asset.BrowserDownloadURL): // Companion installers and disk images
+					softwareLinks = append(softwareLinks, asset.BrowserDownloadURL) // Queue it with the software
+				default:
+					continue // Not something the archive keeps
+				}
+				queuedAssets++                                                                                                                   // Count it
+				linkSources[asset.BrowserDownloadURL] = release.HTMLURL                                                                          // Record the release page as the source
+				algorithm, digest, _ := strings.Cut(strings.ToLower(asset.Digest), ":")                                                          // Split "sha256:<hex>"
+				if _, decodeError := hex.DecodeString(digest); decodeError == nil && digest != "" && len(digest) == checksumLengths[algorithm] { // Check the digest is usable
+					publishedChecksums.Lock()                                                         // Lock the checksums
+					publishedChecksums.checksums[asset.BrowserDownloadURL] = algorithm + ":" + digest // Verify the download against it
+					publishedChecksums.Unlock()                                                       // Unlock the checksums
+				}
+			}
+		}
+		if queuedAssets == 0 { // Nothing to archive, e.g. a misspelled repository with no releases or only source archives
+			logWarningf("Found no firmware or software assets in the %d stable release(s) of %s on GitHub", mirrored, repository) // Warn about it
+			continue                                                                                                              // Move on to the next repository
+		}
+		log.Printf("Found %d assets in %d releases of %s on GitHub", queuedAssets, mirrored, repository) // Report the listing
+	}
+	return firmwareLinks, softwareLinks // Return the sorted links
+} // End of listGitHubReleaseAssets function
+
+// Fetches the newest releases of a repository from the GitHub REST API, newest first, following the Link header's
+// pages until wanted stable releases are listed or the pages run out; requests authenticate with GITHUB_TOKEN when it
+// is set
+func fetchGitHubReleases(httpClient *http.Client, owner string, name string, wanted int) ([]githubRelease, error) { // Function to list releases
+	var releases []githubRelease                                                                                                  // Releases listed so far
+	releasesURL := fmt.Sprintf("%s/repos/%s/%s/releases?per_page=100", githubAPIURL, url.PathEscape(owner), url.PathEscape(name)) // First page
+	for releasesURL != "" {                                                                                                       // Until the last page
+		pageReleases, nextURL, pageError := fetchGitHubReleasePage(httpClient, releasesURL) // Fetch one page
+		if pageError != nil {                                                               // Check if the page failed
+			return nil, pageError // Return the error
+		}
+		releases = append(releases, pageReleases...) // Keep its releases
+		stableReleases := 0                          // Published, stable releases listed so far
+		for _, release := range releases {           // Count them
+			if !release.Draft && !release.Prerelease { // Only these are archived
+				stableReleases++ // Count it
+			}
+		}
+		if stableReleases >= wanted { // Check if enough releases were listed
+			break // Older pages are not needed
+		}
+		releasesURL = nextURL // Continue with the next page
+	}
+	return releases, nil // Return the releases
+} // End of fetchGitHubReleases function
+
+// Matches the next page's URL in a GitHub Link header such as `<https://api.github.com/...&page=2>; rel="next"`
+var githubNextPagePattern = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// Fetches one page of a GitHub release listing and returns its releases and the next page's URL, "" on the last page
+func fetchGitHubReleasePage(httpClient *http.Client, releasesURL string) ([]githubRelease, string, error) { // Function to list one page of releases
+	releasesRequest, requestError := newDownloadRequest(releasesURL) // Build the request with the configured headers
+	if requestError != nil {                                         // Check if the request could not be built
+		return nil, "", requestError // Return the error
+	}
+	releasesRequest.Header.Set("Accept", "application/vnd.github+json") // The REST API's media type
+	releasesRequest.Header.Set("X-GitHub-Api-Version", "2022-11-28")    // Pin the API version
+	if githubToken := os.Getenv("GITHUB_TOKEN"); githubToken != "" {    // Authenticated requests get a far higher rate limit
+		releasesRequest.Header.Set("Authorization", "Bearer "+githubToken) // Send the token
+	}
+	httpResponse, requestError := httpClient.Do(releasesRequest) // Send the request
+	if requestError != nil {                                     // Check for request errors
+		return nil, "", requestError // Return the error
+	}
+	defer httpResponse.Body.Close()               // Close the response when done
+	if httpResponse.StatusCode != http.StatusOK { // Check for missing repositories and exhausted rate limits
+		if httpResponse.Header.Get("X-RateLimit-Remaining") == "0" { // Check if the rate limit ran out
+			return nil, "", fmt.Errorf("%s: API rate limit exceeded; set GITHUB_TOKEN", httpResponse.Status) // Explain the failure
+		}
+		return nil, "", fmt.Errorf("%s", httpResponse.Status) // Return the status
+	}
+	var releases []githubRelease                                                                                         // Decoded releases
+	if decodeError := json.NewDecoder(io.LimitReader(httpResponse.Body, 32<<20)).Decode(&releases); decodeError != nil { // Decode the listing
+		return nil, "", decodeError // Return the error
+	}
+	nextURL := ""                                                                                                 // No next page unless the header names one
+	if nextMatch := githubNextPagePattern.FindStringSubmatch(httpResponse.Header.Get("Link")); nextMatch != nil { // Check for a next page
+		nextURL = nextMatch[1] // Its URL
+	}
+	return releases, nextURL, nil // Return the page
+} // End of fetchGitHubReleasePage function
+
+// Returns the directory, relative to the firmware or software directory, a release asset of a -github-repos repository
+// is filed in ("<owner>/<repo>/<tag>", lowercased like the filenames), or "" for any other URL
+func githubReleaseDirectory(rawURL string) string { // Function to derive a release asset's directory
+	parsedURL, parseError := url.Parse(rawURL)                                       // Parse the URL
+	if parseError != nil || !strings.EqualFold(parsedURL.Hostname(), "github.com") { // Only github.com release links
+		return "" // Not a release asset
+	}
+	segments := strings.Split(strings.Trim(parsedURL.EscapedPath(), "/"), "/")        // owner, repo, "releases", "download", tag, name
+	if len(segments) != 6 || segments[2] != "releases" || segments[3] != "download" { // Check the shape of the path
+		return "" // Not a release asset
+	}
+	if !slices.Contains(configuredGitHubRepositories(), strings.ToLower(segments[0]+"/"+segments[1])) { // Only the configured repositories are mirrored by tag
+		return "" // Treat the link like any other
+	}
+	var directories []string                                                  // owner, repo and tag
+	for _, segment := range []string{segments[0], segments[1], segments[4]} { // Each becomes one directory
+		directory, unescapeError := url.PathUnescape(segment)                                 // Tags may be escaped
+		if unescapeError != nil || directory == "" || directory == "." || directory == ".." { // Check if the segment is usable
+			return "" // Treat the link like any other
+		}
+		directories = append(directories, strings.NewReplacer("/", "_", "\\", "_").Replace(strings.ToLower(directory))) // Always one directory each
+	}
+	return filepath.Join(directories...) // Return the relative directory
+} // End of githubReleaseDirectory function
+
+// Resolves a Google Drive link into a direct download. Drive serves small files straight away, but answers large
+// ones with a page warning that it cannot scan them for viruses; its confirmation form leads to the file.
+func resolveGoogleDriveLink(shareURL string) (hostedFile, error) { // Function to resolve Google Drive links
+	downloadURL := "https://drive.google.com/uc?export=download&id=" + url.QueryEscape(googleDriveFileID(shareURL)) // Drive's download endpoint
+	httpClient := &http.Client{Timeout: time.Minute, CheckRedirect: refuseDisallowedRedirect}                       // Resolving only needs the headers
+
+	for attempt := 0; attempt < 2; attempt++ { // The virus-scan confirmation takes one extra request
+		downloadRequest, requestError := newDownloadRequest(downloadURL) // Build the request with the configured headers
+		if requestError != nil {                                         // Check if the request could not be built
+			return hostedFile{}, requestError // Return the error
+		}
+		httpResponse, requestError := httpClient.Do(downloadRequest) // Send the request
+		if requestError != nil {                                     // Check for request errors
+			return hostedFile{}, requestError // Return the error
+		}
+		if httpResponse.StatusCode != http.StatusOK { // Check for missing or private files
+			httpResponse.Body.Close()                                  // Discard the response
+			return hostedFile{}, fmt.Errorf("%s", httpResponse.Status) // Return the status
+		}
+
+		if !strings.Contains(httpResponse.Header.Get("Content-Type"), "text/html") { // The file itself
+			httpResponse.Body.Close()                                   // Only the headers were needed; the download fetches the body
+			filename := contentDispositionFilename(httpResponse.Header) // Name the host gives the file
+			if filename == "" {                                         // Check if the host did not name it
+				return hostedFile{}, fmt.Errorf("no filename in the response") // Return the error
+			}
+			return hostedFile{DownloadURL: downloadURL, Filename: filename}, nil // Return the resolved file
+		}
+
+		pageHTML, readError := io.ReadAll(io.LimitReader(httpResponse.Body, 1<<20)) // Read the warning page
+		httpResponse.Body.Close()                                                   // Close the response
+		if readError != nil {                                                       // Check for read errors
+			return hostedFile{}, readError // Return the error
+		}
+		confirmURL := googleDriveConfirmURL(httpResponse.Request.URL, string(pageHTML)) // Where the confirmation leads
+		if confirmURL == "" {                                                           // Check if the page is not the warning
+			return hostedFile{}, fmt.Errorf("Google Drive returned a page instead of the file; it may not be shared publicly") // Return the error
+		}
+		downloadURL = confirmURL // Confirm the download
+	}
+	return hostedFile{}, fmt.Errorf("Google Drive did not accept the download confirmation") // Return the error
+} // End of resolveGoogleDriveLink function
+
+// Finds where the confirmation on Google Drive's virus-scan warning page leads: the download form with its hidden
+// inputs, or on older pages a link carrying a confirm token. Returns "" when the page has neither.
+func googleDriveConfirmURL(pageURL *url.URL, pageHTML string) string { // Function to read Drive's warning page
+	parsedHTML, parseError := html.Parse(strings.NewReader(pageHTML)) // Parse the page
+	if parseError != nil {                                            // Check if parsing failed
+		return "" // No confirmation to follow
+	}
+
+	confirmURL := ""                      // Where the confirmation leads
+	var findConfirmation func(*html.Node) // Define a recursive function to search the page
+	findConfirmation = func(currentNode *html.Node) {
+		if confirmURL != "" { // Stop once found
+			return
+		}
+		if currentNode.Type == html.ElementNode && currentNode.Data == "form" && nodeAttribute(currentNode, "action") != "" { // The download form
+			actionURL, actionError := pageURL.Parse(nodeAttribute(currentNode, "action")) // Resolve the form's target
+			if actionError != nil {                                                       // Check if the target is malformed
+				return
+			}
+			formValues := url.Values{}         // The form's inputs
+			var collectInputs func(*html.Node) // Define a recursive function to read the inputs
+			collectInputs = func(formNode *html.Node) {
+				if formNode.Type == html.ElementNode && formNode.Data == "input" && nodeAttribute(formNode, "name") != "" { // A named input
+					formValues.Set(nodeAttribute(formNode, "name"), nodeAttribute(formNode, "value")) // Submit it as the browser would
+				}
+				for childNode := formNode.FirstChild; childNode != nil; childNode = childNode.NextSibling { // Recursively traverse child nodes
+					collectInputs(childNode)
+				}
+			}
+			collectInputs(currentNode)               // Read the inputs
+			actionURL.RawQuery = formValues.Encode() // The form is submitted with GET
+			confirmURL = actionURL.String()          // Follow the form
+			return
+		}
+		if currentNode.Type == html.ElementNode && currentNode.Data == "a" && strings.Contains(nodeAttribute(currentNode, "href"), "confirm=") { // An older confirmation link
+			if linkURL, linkError := pageURL.Parse(nodeAttribute(currentNode, "href")); linkError == nil { // Resolve the link
+				confirmURL = linkURL.String() // Follow the link
+			}
+			return
+		}
+		for childNode := currentNode.FirstChild; childNode != nil; childNode = childNode.NextSibling { // Recursively traverse child nodes
+			findConfirmation(childNode)
+		}
+	}
+	findConfirmation(parsedHTML) // Begin traversal from the root node
+	return confirmURL            // Return what was found
+} // End of googleDriveConfirmURL function
+
+// Returns the filename a response offers in its Content-Disposition header, or "" if there is none
+func contentDispositionFilename(responseHeaders http.Header) string { // Function to read the offered filename
+	_, parameters, parseError := mime.ParseMediaType(responseHeaders.Get("Content-Disposition")) // Parse the header; filename* is decoded too
+	if parseError != nil {                                                                       // Check if the header is missing or malformed
+		return "" // No filename
+	}
+	if parameters["filename"] == "" { // Check if the header names no file
+		return "" // No filename
+	}
+	return filepath.Base(filepath.FromSlash(parameters["filename"])) // Never let the name escape the output directory
+} // End of contentDispositionFilename function
+
+// Returns the value of an HTML element's attribute, or "" if it is not set
+func nodeAttribute(node *html.Node, key string) string { // Function to read an attribute
+	for _, attribute := range node.Attr { // Check each attribute
+		if attribute.Key == key { // Found it
+			return attribute.Val // Return its value
+		}
+	}
+	return "" // The attribute is not set
+} // End of nodeAttribute function
+
+// Downloads a file of known size as chunkCount byte ranges fetched in parallel. The first range is read from the
+// already open response; the others are requested with If-Range so a file replaced mid-download is detected. Chunks are
+// streamed into a temporary file, so memory is only spent on bytes that actually arrived, never on the announced size.
+func fetchInChunks(httpClient *http.Client, fileURL string, openResponse *http.Response, transfer *transferProgress, chunkCount int) ([]byte, error) { // Function for parallel ranged downloads
+	chunkFile, createError := os.CreateTemp("", "archiver-chunks-*") // Chunks are written straight into their place
+	if createError != nil {                                          // Check if the file could not be created
+		return nil, createError // Return the error
+	}
+	defer os.Remove(chunkFile.Name()) // The data is returned in memory, so the file is only temporary
+	defer chunkFile.Close()           // Close the file when done
+
+	totalBytes := openResponse.ContentLength                              // Size announced by the server
+	chunkSize := (totalBytes + int64(chunkCount) - 1) / int64(chunkCount) // Bytes per chunk, the last one possibly shorter
+	validator := openResponse.Header.Get("ETag")                          // Identifies the exact file version
+	if validator == "" {                                                  // Fall back to the modification date
+		validator = openResponse.Header.Get("Last-Modified") // Weaker, but still detects replacements
+	}
+
+	var waitGroup sync.WaitGroup                                 // Waits for every chunk
+	chunkErrors := make([]error, chunkCount)                     // Error of each chunk, if any
+	for chunkIndex := 0; chunkIndex < chunkCount; chunkIndex++ { // Start one goroutine per chunk
+		chunkStart := int64(chunkIndex) * chunkSize       // First byte of the chunk
+		chunkEnd := min(chunkStart+chunkSize, totalBytes) // One past the last byte of the chunk
+		if chunkStart >= chunkEnd {                       // Tiny files can leave trailing chunks empty
+			continue // Nothing to fetch
+		}
+		waitGroup.Add(1)                                            // Track the chunk
+		go func(chunkIndex int, chunkStart int64, chunkEnd int64) { // Fetch the chunk in the background
+			defer waitGroup.Done() // Mark the chunk as finished
+
+			chunkBody := io.Reader(openResponse.Body) // The first chunk comes from the open response
+			if chunkIndex > 0 {                       // Other chunks need their own ranged request
+				rangeRequest, requestError := newDownloadRequest(fileURL) // Build the ranged request with the configured headers
+				if requestError != nil {                                  // Check if the request could not be built
+					chunkErrors[chunkIndex] = requestError // Record the error
+					return                                 // Give up on the chunk
+				}
+				rangeRequest.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", chunkStart, chunkEnd-1)) // Ask for just this chunk
+				if validator != "" {                                                                 // Only accept the same file version
+					rangeRequest.Header.Set("If-Range", validator) // A changed file answers with the full body instead
+				}
+				rangeResponse, rangeError := httpClient.Do(rangeRequest) // Send the request
+				if rangeError != nil {                                   // Check for request errors
+					chunkErrors[chunkIndex] = rangeError // Record the error
+					return                               // Give up on the chunk
+				}
+				defer rangeResponse.Body.Close()                           // Ensure the response body is closed
+				if rangeResponse.StatusCode != http.StatusPartialContent { // A 200 means the range was ignored or the file changed
+					chunkErrors[chunkIndex] = fmt.Errorf("range %d-%d: %s", chunkStart, chunkEnd-1, rangeResponse.Status) // Record the error
+					return                                                                                                // Give up on the chunk
+				}
+				chunkBody = rangeResponse.Body // Read the chunk from the ranged response
+			}
+
+			chunkReader := io.LimitReader(&progressReader{reader: chunkBody, transfer: transfer}, chunkEnd-chunkStart) // Only the chunk's bytes
+			copiedBytes, copyError := io.Copy(io.NewOffsetWriter(chunkFile, chunkStart), chunkReader)                  // Fill the chunk's part of the file
+			if copyError == nil && copiedBytes != chunkEnd-chunkStart {                                                // Check for a short read
+				copyError = io.ErrUnexpectedEOF // The server sent less than announced
+			}
+			chunkErrors[chunkIndex] = copyError // Record any error
+		}(chunkIndex, chunkStart, chunkEnd) // Pass the chunk bounds
+	}
+	waitGroup.Wait() // Wait for every chunk
+
+	for _, chunkError := range chunkErrors { // Report the first failed chunk
+		if chunkError != nil { // Check if the chunk failed
+			return nil, chunkError // The file is incomplete
+		}
+	}
+	return os.ReadFile(chunkFile.Name()) // Return the assembled file
+} // End of fetchInChunks function
+
+// Writes downloaded data to the given path
+func saveDownload(fullFilePath string, fileURL string, fileData []byte) bool { // Function to save a download to disk
+	if writeError := writeArchiveFile(fullFilePath, fileData, 0o644); writeError != nil { // Create the output file and write the data
+		logErrorf("Failed to write file for %s %v", fileURL, writeError) // Log the write failure
+		return false                                                     // Return false on write error
+	}
+	return true // The file was saved
+} // End of saveDownload function
+
+// Downloads a PDF from the given URL and saves it in the specified directory
+func downloadPDF(pdfURL, outputDirectory string) bool { // Function to download and save a PDF file
+	fullFilePath := outputPathForURL(pdfURL, outputDirectory) // Build the complete file path for saving
+	if fullFilePath == "" {                                   // Check if the path could not be prepared
+		return false // Return false since there is nowhere to save the file
+	}
+
+	if skipExistingFile(fullFilePath, pdfURL) { // Skip download if the file already exists
+		runStatistics.add(&runStatistics.Skipped, 1)                                                         // Count the skipped file
+		emitEvent("download_skipped", map[string]any{"url": pdfURL, "path": fullFilePath, "kind": "manual"}) // Notify listeners
+		return false                                                                                         // Return false since no download occurred
+	}
+
+	emitEvent("download_started", map[string]any{"url": pdfURL, "kind": "manual"}) // Notify listeners
+
+	responseHeaders, pdfData, pdfHash, mirrorURL := fetchDownloadWithMirrors(pdfURL, pdfContentTypes) // Fetch the PDF into memory
+	if pdfData == nil {                                                                               // Check if the fetch failed
+		runStatistics.add(&runStatistics.Failed, 1) // Count the failed download
+		reportDownloadFailure(pdfURL)               // Notify the webhook unless the download is retried
+		return false                                // Return false on failure
+	}
+	bytesWritten := int64(len(pdfData)) // Number of bytes downloaded
+
+	sha256Hash, blake3Hash := contentHashFields(pdfHash) // File the hash computed during the download
+	encrypted := isPDFEncrypted(pdfData)                 // Check for password protection or DRM
+	if encrypted {                                       // Warn about files later processing steps cannot handle
+		logWarningf("Encrypted PDF (password-protected or DRM'd): %s", pdfURL) // Log the encrypted file
+	}
+
+	if !saveDownload(fullFilePath, pdfURL, pdfData) { // Write the PDF to disk
+		return false // Return false on write error
+	}
+
+	xmpStamped := false          // Whether provenance was embedded into the PDF
+	if *stampXMP && !encrypted { // Only stamp when requested and the PDF can be rewritten
+		xmpStamped = stampPDFProvenance(fullFilePath, pdfURL, time.Now().UTC()) // Embed the source URL and retrieval date
+	}
+
+	linearized := false               // Whether the PDF was rewritten for fast web view
+	if *linearizePDFs && !encrypted { // Only linearize when requested, and after stamping since incremental updates undo linearization
+		linearized = linearizePDF(fullFilePath) // Rewrite the PDF with its first page up front
+	}
+	downloadSize := int64(0)      // Bytes the server sent, kept only when the file was rewritten afterwards
+	if xmpStamped || linearized { // The rewrites changed the bytes on disk, so the download's hash no longer describes the file
+		if fileSHA256, fileBLAKE3, fileSize, hashError := hashArchivedFile(fullFilePath); hashError != nil { // Hash the file as stored
+			logErrorf("Failed to hash %s after rewriting it %v", fullFilePath, hashError) // Log the error
+		} else {
+			downloadSize = bytesWritten                                             // What -check-only compares with Content-Length
+			sha256Hash, blake3Hash, bytesWritten = fileSHA256, fileBLAKE3, fileSize // Describe the file as stored
+		}
+	}
+
+	product, version := detectManualVersion(filepath.Base(fullFilePath)) // Detect the product and revision from the filename
+	versionSource := "filename"                                          // Where the revision was found
+	if version == "" && !encrypted {                                     // Fall back to the first page when the filename has no revision
+		version = detectVersionInText(firstPageText(fullFilePath)) // Look for a revision on the first page
+		versionSource = "first-page"                               // Remember that the revision came from the content
+	}
+	if version == "" { // No revision anywhere
+		versionSource = "" // Nothing to attribute
+	}
+	model, modelSource := classifyDownload(pdfURL) // Classify the manual from its URL, link, and page
+	if model == "" && !encrypted {                 // Fall back to the first page when nothing else names the model
+		if model = classifyFirstPage(firstPageText(fullFilePath)); model != "" { // Look for a model on the first page
+			modelSource = "content" // Remember that the model came from the content
+		}
+	}
+	if *layoutMode == "model" && modelSource == "content" { // The file was filed as unclassified before its content was read
+		filedPath := filepath.Join(outputDirectory, modelDirectory(model), filepath.Base(fullFilePath)) // Where the file belongs
+		if mkdirError := os.MkdirAll(filepath.Dir(filedPath), 0o755); mkdirError != nil {               // Create the model's directory
+			logError(mkdirError) // Log the error and leave the file where it is
+		} else if renameError := renameArchiveFile(fullFilePath, filedPath); renameError != nil { // File it under its model
+			logError(renameError) // Log the error and leave the file where it is
+		} else {
+			log.Printf("Filed %s under %s after reading its first page", filepath.Base(fullFilePath), model) // Log the move
+			fullFilePath = filedPath                                                                         // The file's new home
+		}
+	}
+	retrievedAt := time.Now().UTC().Format(time.RFC3339) // When the file was retrieved
+	writeSidecarMetadata(fullFilePath, downloadMetadata{ // Describe the file in a sidecar next to it
+		SourceURL:  pdfURL,                       // Where the file came from
+		Headers:    responseHeaders,              // Response headers returned by the server
+		SHA256:     sha256Hash,                   // Content hash of the saved file
+		BLAKE3:     blake3Hash,                   // Content hash of the saved file
+		Size:       bytesWritten,                 // Number of bytes saved
+		ScrapedAt:  retrievedAt,                  // When the file was retrieved
+		Product:    product,                      // Detected product key
+		Version:    version,                      // Detected revision, if any
+		Language:   detectManualLanguage(pdfURL), // Detected manual language, if any
+		XMPStamped: xmpStamped,                   // Whether provenance was embedded into the PDF
+		Linearized: linearized,                   // Whether the PDF was linearized for fast web view
+		Encrypted:  encrypted,                    // Whether the PDF is password-protected or DRM'd
+	}) // End of sidecar metadata
+
+	recordCatalogEntry(&catalogEntry{ // Add the file to the catalog
+		URL:           pdfURL,                               // Where the file came from
+		Kind:          "manual",                             // PDFs are manuals
+		Path:          filepath.ToSlash(fullFilePath),       // Where the file is stored
+		SHA256:        sha256Hash,                           // Content hash of the download
+		BLAKE3:        blake3Hash,                           // Content hash of the download
+		Size:          bytesWritten,                         // Number of bytes saved
+		DownloadSize:  downloadSize,                         // Bytes the server sent, when the file was rewritten
+		Product:       product,                              // Detected product key
+		Version:       version,                              // Detected revision, if any
+		VersionSource: versionSource,                        // Where the revision was found
+		Model:         model,                                // Classified model, if any
+		ModelSource:   modelSource,                          // Where the model was found
+		ETag:          responseHeaders.Get("ETag"),          // Validator for -check-only
+		LastModified:  responseHeaders.Get("Last-Modified"), // Validator for -check-only
+		Language:      detectManualLanguage(pdfURL),         // Detected manual language, if any
+		Encrypted:     encrypted,                            // Whether the PDF is password-protected or DRM'd
+		MirrorURL:     mirrorURL,                            // Mirror used when the URL itself failed
+		FirstSeen:     retrievedAt,                          // First time the file was downloaded
+		LastSeen:      retrievedAt,                          // Last time the link was seen live
+	}) // End of catalog entry
+
+	runStatistics.add(&runStatistics.Downloaded, 1)                                                                              // Count the completed download
+	emitEvent("download_completed", map[string]any{"url": pdfURL, "path": fullFilePath, "size": bytesWritten, "kind": "manual"}) // Notify the webhook
+	log.Printf("Successfully downloaded %d bytes: %s → %s", bytesWritten, pdfURL, fullFilePath)                                  // Log success message
+	return true                                                                                                                  // Indicate successful download
+} // End of downloadPDF function
+
+// Downloads each unique link of a firmware or software queue into its directory with downloadPackage, retrying
+// rate-limited and expired links, and returns the links that were attempted. queuedAfter is the number of links
+// waiting in later queues, for the dashboard.
+func downloadPackageQueue(queue []string, directory string, kind string, linkSources map[string]string, queuedAfter int) []string { // Function to download a package queue
+	if len(queue) > 0 && !directoryExists(directory) { // Only create the directory when there is something to save
+		createDirectory(directory, 0o755) // Create the directory with full read, write, and execute permissions (rwxr-xr-x)
+	}
+	uniqueLinks := removeDuplicatesFromSlice(queue) // Each link only needs downloading once
+	var attemptedLinks []string                     // Links tried this run
+	for linkIndex, link := range uniqueLinks {      // Download each unique link
+		if runStopped() { // Check if the run stopped
+			break // Leave the rest of the queue
+		}
+		dashboard.setQueueDepth(len(uniqueLinks) - linkIndex - 1 + queuedAfter) // Show how much work is left
+		if isQuarantined(link) {                                                // Links that keep failing are only re-checked now and then
+			logWarningf("Skipping quarantined link: %s", link) // Log the skip
+			runStatistics.add(&runStatistics.Skipped, 1)       // Count the skipped file
+			continue                                           // Move on to the next link
+		}
+		attemptedLinks = append(attemptedLinks, link)        // Remember the attempt
+		waitForSourceRateLimit(linkSources[link])            // Respect the rate limit of the page the link was found on
+		downloaded := downloadPackage(link, directory, kind) // Save the package into its directory
+		for !downloaded && retryAfterRateLimit(link) {       // Rate-limited downloads wait for their host's pause and try again
+			downloaded = downloadPackage(link, directory, kind) // Try again
+		}
+		if !downloaded { // Check if the package could not be saved
+			if freshURL := refreshExpiredLink(link, linkSources); freshURL != "" { // Expired signed links get one retry with a fresh signature
+				runStatistics.add(&runStatistics.Failed, -1)            // The retry decides whether the file failed
+				attemptedLinks[len(attemptedLinks)-1] = freshURL        // Its outcome is recorded under the link actually downloaded
+				downloaded = downloadPackage(freshURL, directory, kind) // Download with the fresh link
+				for !downloaded && retryAfterRateLimit(freshURL) {      // The fresh link is rate limited like any other
+					downloaded = downloadPackage(freshURL, directory, kind) // Try again
+				}
+				if !downloaded { // Check if the fresh link failed too
+					logWarningf("Fresh link %s for %s failed too", freshURL, link) // Log the failed retry
+				}
+			}
+		}
+	}
+	return attemptedLinks // The links tried this run
+} // End of downloadPackageQueue function
+
+// Downloads a firmware package ("firmware", which feeds the firmware timeline) or desktop software ("software") from
+// the given URL and saves it in the specified directory, checking it with the kind's content types and sanity checks
+func downloadPackage(packageURL, packageDirectory string, kind string) bool { // Function to download and save a package
+	fullFilePath := outputPathForURL(packageURL, packageDirectory) // Build the complete file path for saving
+	if fullFilePath == "" {                                        // Check if the path could not be prepared
+		return false // Return false since there is nowhere to save the file
+	}
+
+	if skipExistingFile(fullFilePath, packageURL) { // Skip download if the file already exists
+		runStatistics.add(&runStatistics.Skipped, 1)                                                         // Count the skipped file
+		emitEvent("download_skipped", map[string]any{"url": packageURL, "path": fullFilePath, "kind": kind}) // Notify listeners
+		return false                                                                                         // Return false since no download occurred
+	}
+
+	emitEvent("download_started", map[string]any{"url": packageURL, "kind": kind}) // Notify listeners
+
+	acceptedContentTypes, suspiciousContent := firmwareContentTypes, suspiciousFirmware // Rules for firmware
+	if kind == "software" {                                                             // Installers have their own rules
+		acceptedContentTypes, suspiciousContent = softwareContentTypes, suspiciousSoftware // Rules for software
+	}
+	responseHeaders, packageData, packageHash, mirrorURL := fetchDownloadWithMirrors(packageURL, acceptedContentTypes) // Fetch the package into memory
+	if packageData == nil {                                                                                            // Check if the fetch failed
+		runStatistics.add(&runStatistics.Failed, 1) // Count the failed download
+		reportDownloadFailure(packageURL)           // Notify the webhook unless the download is retried
+		return false                                // Return false on failure
+	}
+	if suspicion := suspiciousContent(fullFilePath, packageData); suspicion != "" { // Check the content before it enters the archive
+		logWarningf("Suspicious %s from %s: %s", kind, packageURL, suspicion)                          // Log the problem
+		quarantineDownload(packageURL, packageData, suspicion)                                         // Keep it for inspection instead
+		runStatistics.add(&runStatistics.Failed, 1)                                                    // Count the failed download
+		emitEvent("error", map[string]any{"stage": "validate", "url": packageURL, "error": suspicion}) // Notify the webhook
+		return false                                                                                   // Nothing was archived
+	}
+	publishedChecksum := publishedChecksumFor(packageURL) // Checksum the page lists for the package, if any
+	checksumStatus := ""                                  // Not verified unless the page published a checksum
+	if publishedChecksum != "" {                          // Check the download against what the vendor published
+		algorithm, _, _ := strings.Cut(publishedChecksum, ":")                                               // Which hash the page used
+		if computed := algorithm + ":" + checksumOf(algorithm, packageData); computed != publishedChecksum { // Compare the digests
+			reason := fmt.Sprintf("published checksum %s does not match the download's %s", publishedChecksum, computed) // Describe the mismatch
+			logErrorf("Checksum mismatch for %s from %s: %s", kind, packageURL, reason)                                  // Log the problem
+			quarantineDownload(packageURL, packageData, reason)                                                          // Keep it for inspection instead
+			runStatistics.add(&runStatistics.Failed, 1)                                                                  // Count the failed download
+			emitEvent("error", map[string]any{"stage": "checksum", "url": packageURL, "error": reason})                  // Notify the webhook
+			return false                                                                                                 // Nothing was archived
+		}
+		checksumStatus = "verified" // The download is what the vendor published
+	}
+	threat, scanError := scanDownload(packageData) // Scan the package before it enters the archive
+	if scanError != nil {                          // Check if the scanner could not be used
+		logErrorf("Failed to scan %s; not archiving it unscanned %v", packageURL, scanError)               // Log the error
+		runStatistics.add(&runStatistics.Failed, 1)                                                        // Count the failed download
+		emitEvent("error", map[string]any{"stage": "scan", "url": packageURL, "error": scanError.Error()}) // Notify the webhook
+		return false                                                                                       // Nothing was archived
+	}
+	if threat != "" { // Check if the scanner flagged the file
+		logWarningf("Scanner flagged %s from %s: %s", kind, packageURL, threat)                 // Log the detection
+		quarantineDownload(packageURL, packageData, "flagged by virus scan: "+threat)           // Keep it away from the archive
+		runStatistics.add(&runStatistics.Failed, 1)                                             // Count the failed download
+		emitEvent("error", map[string]any{"stage": "scan", "url": packageURL, "error": threat}) // Notify the webhook
+		return false                                                                            // Nothing was archived
+	}
+	if !saveDownload(fullFilePath, packageURL, packageData) { // Write the package to disk
+		return false // Return false on write error
+	}
+
+	sha256Hash, blake3Hash := contentHashFields(packageHash)             // File the hash computed during the download
+	product, version := detectManualVersion(filepath.Base(fullFilePath)) // Detect the product and package version from the filename
+	model, modelSource := classifyDownload(packageURL)                   // Classify the package from its URL, link, and page
+	retrievedAt := time.Now().UTC().Format(time.RFC3339)                 // When the file was retrieved
+
+	writeSidecarMetadata(fullFilePath, downloadMetadata{ // Describe the file in a sidecar next to it
+		SourceURL: packageURL,              // Where the file came from
+		Headers:   responseHeaders,         // Response headers returned by the server
+		SHA256:    sha256Hash,              // Content hash of the saved file
+		BLAKE3:    blake3Hash,              // Content hash of the saved file
+		Size:      int64(len(packageData)), // Number of bytes saved
+		ScrapedAt: retrievedAt,             // When the file was retrieved
+		Product:   product,                 // Detected product key
+		Version:   version,                 // Detected package version, if any
+	}) // End of sidecar metadata
+
+	recordCatalogEntry(&catalogEntry{ // Add the file to the catalog
+		URL:               packageURL,                           // Where the file came from
+		Kind:              kind,                                 // "firmware" feeds the firmware timeline; "software" does not
+		Path:              filepath.ToSlash(fullFilePath),       // Where the file is stored
+		SHA256:            sha256Hash,                           // Content hash of the download
+		BLAKE3:            blake3Hash,                           // Content hash of the download
+		Size:              int64(len(packageData)),              // Number of bytes saved
+		Product:           product,                              // Detected product key
+		Version:           version,                              // Detected package version, if any
+		VersionSource:     "filename",                           // Package versions always come from the filename
+		Model:             model,                                // Classified model, if any
+		ModelSource:       modelSource,                          // Where the model was found
+		ETag:              responseHeaders.Get("ETag"),          // Validator for -check-only
+		LastModified:      responseHeaders.Get("Last-Modified"), // Validator for -check-only
+		MirrorURL:         mirrorURL,                            // Mirror used when the URL itself failed
+		PublishedChecksum: publishedChecksum,                    // Checksum the page listed next to the link, if any
+		ChecksumStatus:    checksumStatus,                       // Whether the download matched it
+		FirstSeen:         retrievedAt,                          // First time the file was downloaded
+		LastSeen:          retrievedAt,                          // Last time the link was seen live
+	}) // End of catalog entry
+
+	runStatistics.add(&runStatistics.Downloaded, 1)                                                                                  // Count the completed download
+	emitEvent("download_completed", map[string]any{"url": packageURL, "path": fullFilePath, "size": len(packageData), "kind": kind}) // Notify the webhook
+	log.Printf("Successfully downloaded %s %d bytes: %s → %s", kind, len(packageData), packageURL, fullFilePath)                     // Log success message
+	return true                                                                                                                      // Indicate successful download
+} // End of downloadPackage function
+
+// Splits a sanitized filename into a product key and a revision string (e.g. "gx12_1_4.pdf" → "gx12", "1.4")
+func detectManualVersion(filename string) (string, string) { // Function to detect the manual revision in a filename
+	base := strings.TrimSuffix(filename, getFileExtension(filename)) // Drop the extension before matching
+
+	revisionMatch := regexp.MustCompile(`^(.+?)_rev_?([a-z]|\d+)$`).FindStringSubmatch(base) // Look for "Rev C" style revisions
+	if revisionMatch != nil {                                                                // Check if a "Rev" revision was found
+		return revisionMatch[1], "Rev " + strings.ToUpper(revisionMatch[2]) // Return the product key and the revision
+	}
+
+	numericMatch := regexp.MustCompile(`^(.+?)_v?(\d+(?:_\d+)*)$`).FindStringSubmatch(base) // Look for "V1.4" style versions
+	if numericMatch != nil {                                                                // Check if a numeric version was found
+		return numericMatch[1], strings.ReplaceAll(numericMatch[2], "_", ".") // Return the product key and dotted version
+	}
+
+	return base, "" // No revision detected, the whole name is the product key
+} // End of detectManualVersion function
+
+// Converts a revision string into comparable numbers (e.g. "1.4" → [1 4], "Rev C" → [3])
+func manualVersionParts(version string) []int { // Function to turn a revision into a sortable list of numbers
+	version = strings.TrimPrefix(version, "Rev ") // Remove the "Rev " prefix used for lettered revisions
+	var parts []int                               // Numeric parts of the revision
+
+	for _, piece := range strings.Split(version, ".") { // Walk each dot-separated piece
+		if number, err := strconv.Atoi(piece); err == nil { // Check if the piece is a number
+			parts = append(parts, number) // Keep the numeric piece
+		} else if len(piece) == 1 { // Single letters such as "C" are lettered revisions
+			parts = append(parts, int(piece[0]-'A')+1) // Map A→1, B→2, and so on
+		}
+	}
+
+	return parts // Return the comparable parts
+} // End of manualVersionParts function
+
+// Compares two revision strings, returning -1, 0, or 1 like strings.Compare
+func compareManualVersions(first string, second string) int { // Function to order two manual revisions
+	firstParts := manualVersionParts(first)   // Numeric parts of the first revision
+	secondParts := manualVersionParts(second) // Numeric parts of the second revision
+
+	for index := 0; index < len(firstParts) || index < len(secondParts); index++ { // Walk both revisions part by part
+		firstValue, secondValue := 0, 0 // Missing parts count as zero (so "1" equals "1.0")
+		if index < len(firstParts) {    // Check if the first revision has this part
+			firstValue = firstParts[index] // Use the first revision's part
+		}
+		if index < len(secondParts) { // Check if the second revision has this part
+			secondValue = secondParts[index] // Use the second revision's part
+		}
+		if firstValue != secondValue { // Stop at the first differing part
+			if firstValue < secondValue { // Check which revision is older
+				return -1 // First revision is older
+			}
+			return 1 // First revision is newer
+		}
+	}
+
+	return 0 // Revisions are equal
+} // End of compareManualVersions function
+
+// Maintains a "<product>_latest" link in each directory for products with more than one detected revision
+func updateLatestLinks(outputDirectory string) { // Function to keep per-product latest links up to date
+	type revisionGroup struct { // Revisions of one product within one directory
+		newestFile    string // Filename of the newest revision seen so far
+		newestVersion string // Revision string of the newest file
+		count         int    // Number of revisions found
+	}
+	groups := make(map[string]*revisionGroup) // Groups keyed by directory and product
+
+	walkError := filepath.WalkDir(outputDirectory, func(path string, entry os.DirEntry, err error) error { // Walk the whole output tree
+		if err != nil { // Check for errors reading this entry
+			logError(err) // Log the error
+			return nil    // Keep walking the rest of the tree
+		}
+		if !entry.Type().IsRegular() { // Skip directories and existing symlinks
+			return nil // Continue with the next entry
+		}
+
+		product, version := detectManualVersion(entry.Name()) // Detect the product and revision from the filename
+		if version == "" {                                    // Files without a revision cannot be ordered
+			return nil // Continue with the next entry
+		}
+
+		key := filepath.Join(filepath.Dir(path), product+getFileExtension(entry.Name())) // Group by directory, product, and file type
+		group, found := groups[key]                                                      // Look up the existing group
+		if !found {                                                                      // Create the group on first sight
+			group = &revisionGroup{} // Start an empty group
+			groups[key] = group      // Remember it
+		}
+		group.count++                                                                          // Count this revision
+		if group.newestFile == "" || compareManualVersions(version, group.newestVersion) > 0 { // Check if this revision is newer
+			group.newestFile = entry.Name() // Remember the newest filename
+			group.newestVersion = version   // Remember the newest revision
+		}
+		return nil // Continue walking
+	}) // End of directory walk
+	if walkError != nil { // Check if the walk failed
+		logError(walkError) // Log the error
+		return              // Nothing else can be done
+	}
+
+	for key, group := range groups { // Visit each product group
+		if group.count < 2 { // Only products with several revisions get a latest link
+			continue // Skip single-revision products
+		}
+
+		ext := getFileExtension(key)                                     // File type of the group
+		linkPath := strings.TrimSuffix(key, ext) + "_latest" + ext       // Path of the latest link
+		targetPath := filepath.Join(filepath.Dir(key), group.newestFile) // Path of the newest revision
+
+		if runtime.GOOS == "windows" { // Symlinks need special privileges on Windows, so copy instead
+			if sameFileContent(targetPath, linkPath) { // Check if the copy is already current
+				continue // Nothing to update
+			}
+			if copyError := copyFile(targetPath, linkPath); copyError != nil { // Copy the newest revision over the latest file
+				logError(copyError) // Log the copy failure
+			}
+			continue // Move on to the next product
+		}
+
+		if existingTarget, readError := os.Readlink(linkPath); readError == nil && existingTarget == group.newestFile { // Check if the link is already correct
+			continue // Nothing to update
+		}
+		_ = removeArchiveFile(linkPath)                                                                 // Remove any stale link so it can be recreated
+		linkError := os.Symlink(group.newestFile, linkPath)                                             // Create a relative symlink to the newest revision
+		recordAudit(auditEntry{Action: "symlink", Path: linkPath, Target: group.newestFile}, linkError) // Audit the link
+		if linkError != nil {                                                                           // Check if the link could not be created
+			logError(linkError) // Log the link failure
+			continue            // Move on to the next product
+		}
+		log.Printf("Latest revision of %s is %s → %s", filepath.Base(linkPath), group.newestVersion, group.newestFile) // Log the update
+	}
+} // End of updateLatestLinks function
+
+// Copies a file from one path to another, replacing the destination
+func copyFile(sourcePath string, destinationPath string) error { // Function to copy file contents
+	sourceFile, openError := os.Open(sourcePath) // Open the source file
+	if openError != nil {                        // Check if opening failed
+		return openError // Return the open error
+	}
+	defer sourceFile.Close() // Ensure the source file is closed
+
+	destinationFile, createError := os.Create(destinationPath) // Create or truncate the destination file
+	if createError != nil {                                    // Check if creation failed
+		return createError // Return the creation error
+	}
+	defer destinationFile.Close() // Ensure the destination file is closed
+
+	copiedBytes, copyError := io.Copy(destinationFile, sourceFile)                                // Copy all bytes across
+	recordAudit(auditEntry{Action: "write", Path: destinationPath, Size: copiedBytes}, copyError) // Audit the copy
+	return copyError                                                                              // Return any copy error
+} // End of copyFile function
+
+// Reports whether two files hold the same bytes, comparing sizes before hashing
+func sameFileContent(firstPath string, secondPath string) bool { // Function to compare two files
+	firstInfo, firstError := os.Stat(firstPath)                                           // Size of the first file
+	secondInfo, secondError := os.Stat(secondPath)                                        // Size of the second file
+	if firstError != nil || secondError != nil || firstInfo.Size() != secondInfo.Size() { // Check if either is missing or the sizes differ
+		return false // Different
+	}
+	firstHash, firstError := sha256File(firstPath)                            // Hash the first file
+	secondHash, secondError := sha256File(secondPath)                         // Hash the second file
+	return firstError == nil && secondError == nil && firstHash == secondHash // Same bytes
+} // End of sameFileContent function
+
+// Describes a downloaded file in its ".json" sidecar so the archive stays self-describing
+type downloadMetadata struct { // Fields written to each sidecar file
+	SourceURL  string      `json:"source_url"`            // URL the file was downloaded from
+	Headers    http.Header `json:"headers"`               // Response headers returned by the server
+	SHA256     string      `json:"sha256,omitempty"`      // Hex-encoded SHA-256 of the file as stored, after any -stamp-xmp or -linearize rewrite, with -hash=sha256
+	BLAKE3     string      `json:"blake3,omitempty"`      // Hex-encoded BLAKE3 of the file as stored, after any -stamp-xmp or -linearize rewrite, with -hash=blake3
+	Size       int64       `json:"size"`                  // File size in bytes, as stored
+	ScrapedAt  string      `json:"scraped_at"`            // RFC 3339 timestamp of the download
+	Product    string      `json:"product"`               // Product key detected from the filename
+	Version    string      `json:"version,omitempty"`     // Manual revision detected from the filename
+	Language   string      `json:"language,omitempty"`    // ISO 639-1 language code detected from the URL
+	XMPStamped bool        `json:"xmp_stamped,omitempty"` // Whether the source URL was embedded into the PDF's XMP metadata
+	Linearized bool        `json:"linearized,omitempty"`  // Whether the PDF was linearized for fast web view
+	Encrypted  bool        `json:"encrypted,omitempty"`   // Whether the PDF is password-protected or DRM'd
+} // End of downloadMetadata struct
+
+// Writes the metadata of a downloaded file to "<file>.json" next to it
+func writeSidecarMetadata(filePath string, metadata downloadMetadata) { // Function to save a sidecar metadata file
+	sidecarJSON, marshalError := json.MarshalIndent(metadata, "", "  ") // Encode the metadata as indented JSON
+	if marshalError != nil {                                            // Check if encoding failed
+		logError(marshalError) // Log the encoding error
+		return                 // Nothing to write
+	}
+
+	if writeError := writeArchiveFile(filePath+".json", append(sidecarJSON, '\n'), 0o644); writeError != nil { // Save the sidecar next to the file
+		logErrorf("Failed to write metadata for %s %v", filePath, writeError) // Log the write failure
+	}
+} // End of writeSidecarMetadata function
+
+// Guesses the language of a manual from language words or codes in its URL (e.g. "_cn", "english")
+func detectManualLanguage(rawURL string) string { // Function to detect a manual's language
+	languageTokens := map[string]string{ // Tokens that identify a language, mapped to ISO 639-1 codes
+		"en": "en", "eng": "en", "english": "en", // English
+		"cn": "zh", "zh": "zh", "chinese": "zh", // Chinese
+		"de": "de", "german": "de", "deutsch": "de", // German
+		"fr": "fr", "french": "fr", "francais": "fr", // French
+		"es": "es", "spanish": "es", "espanol": "es", // Spanish
+		"it": "it", "italian": "it", "italiano": "it", // Italian
+		"jp": "ja", "ja": "ja", "japanese": "ja", // Japanese
+		"ru": "ru", "russian": "ru", // Russian
+	} // End of language token map
+
+	filename := strings.TrimSuffix(getFilename(strings.Split(strings.ToLower(rawURL), "?")[0]), ".pdf") // Filename without query or extension
+	tokens := regexp.MustCompile(`[^a-z]+`).Split(filename, -1)                                         // Split the filename into alphabetic words
+
+	for _, token := range tokens { // Check every word in the filename
+		if language, found := languageTokens[token]; found { // Check if the word names a language
+			return language // Return the detected language code
+		}
+	}
+
+	return "" // No language detected
+} // End of detectManualLanguage function
+
+// Embeds the source URL and retrieval date into a PDF's XMP metadata using exiftool.
+// exiftool writes PDF changes as an incremental update, so the content pages are left untouched.
+func stampPDFProvenance(pdfPath string, sourceURL string, retrievedAt time.Time) bool { // Function to stamp provenance into a PDF
+	exiftoolPath, lookupError := exec.LookPath("exiftool") // Find exiftool on the PATH
+	if lookupError != nil {                                // Check if exiftool is installed
+		logWarningf("Cannot stamp XMP metadata for %s: exiftool not found", pdfPath) // Log the missing tool
+		return false                                                                 // Report that nothing was stamped
+	}
+
+	stampCommand := exec.Command(exiftoolPath, // Build the exiftool command
+		"-overwrite_original",       // Update the file in place without leaving a backup copy
+		"-XMP-dc:Source="+sourceURL, // Record where the file came from
+		"-XMP-xmp:MetadataDate="+retrievedAt.Format("2006:01:02 15:04:05Z"), // Record when the file was retrieved
+		pdfPath, // File to stamp
+	) // End of exiftool command
+	if output, runError := stampCommand.CombinedOutput(); runError != nil { // Run exiftool and capture its output
+		logErrorf("Failed to stamp XMP metadata for %s %v: %s", pdfPath, runError, strings.TrimSpace(string(output))) // Log the failure with exiftool's message
+		return false                                                                                                  // Report that nothing was stamped
+	}
+
+	recordAudit(auditEntry{Action: "modify", Path: pdfPath}, nil) // Audit the in-place rewrite
+	return true                                                   // Provenance was stamped successfully
+} // End of stampPDFProvenance function
+
+// Produces a PDF/A-2b copy under archivalDirectory for every PDF in outputDirectory that does not have one yet
+func convertArchiveToPDFA(outputDirectory string, archivalDirectory string) { // Function to build the PDF/A archival tree
+	buildGhostscriptTree(outputDirectory, archivalDirectory, "PDF/A", []string{ // Convert every PDF with Ghostscript's PDF/A settings
+		"-dPDFA=2",                      // Produce PDF/A-2 output
+		"-dPDFACompatibilityPolicy=1",   // Drop features PDF/A does not allow instead of failing
+		"-sColorConversionStrategy=RGB", // PDF/A needs a single output intent colour space
+		"-dNOOUTERSAVE",                 // Recommended by Ghostscript for PDF/A output
+	}, false) // Always keep the converted copy
+} // End of convertArchiveToPDFA function
+
+// Produces a size-reduced copy under compressedDirectory for every PDF in outputDirectory that does not have one yet
+func compressArchivePDFs(outputDirectory string, compressedDirectory string) { // Function to build the compressed tree
+	buildGhostscriptTree(outputDirectory, compressedDirectory, "compressed", []string{ // Re-encode every PDF with Ghostscript's size-reduction settings
+		"-dPDFSETTINGS=/ebook",         // Downsample images to 150 dpi and recompress streams
+		"-dCompatibilityLevel=1.5",     // Allow object streams for smaller files
+		"-dDetectDuplicateImages=true", // Store repeated images only once
+	}, true) // Keep the original when re-encoding does not help
+} // End of compressArchivePDFs function
+
+// Runs Ghostscript over every PDF in outputDirectory, writing results to the same relative path under derivedDirectory.
+// PDFs that already have a derived copy are skipped. With keepSmaller, the original is copied instead whenever the
+// Ghostscript output turns out larger than its source.
+func buildGhostscriptTree(outputDirectory string, derivedDirectory string, description string, ghostscriptArguments []string, keepSmaller bool) { // Function to build a derived PDF tree
+	ghostscriptPath, lookupError := exec.LookPath("gs") // Find Ghostscript on the PATH
+	if lookupError != nil {                             // Check if Ghostscript is installed
+		logWarningf("Cannot produce %s copies: Ghostscript (gs) not found", description) // Log the missing tool
+		return                                                                           // Nothing can be converted
+	}
+
+	walkError := filepath.WalkDir(outputDirectory, func(path string, entry os.DirEntry, err error) error { // Walk the whole output tree
+		if err != nil { // Check for errors reading this entry
+			logError(err) // Log the error
+			return nil    // Keep walking the rest of the tree
+		}
+		if !entry.Type().IsRegular() || strings.ToLower(getFileExtension(path)) != ".pdf" { // Only regular PDF files are converted
+			return nil // Continue with the next entry
+		}
+		if isPDFFileEncrypted(path) { // Ghostscript cannot convert encrypted PDFs
+			return nil // Skip it; encrypted files are listed in the end-of-run report
+		}
+
+		relativePath, relError := filepath.Rel(outputDirectory, path) // Path of the PDF inside the output directory
+		if relError != nil {                                          // Check if the relative path could not be computed
+			logError(relError) // Log the error
+			return nil         // Continue with the next entry
+		}
+		derivedPath := filepath.Join(derivedDirectory, relativePath) // Matching path inside the derived tree
+		if fileExists(derivedPath) {                                 // Skip PDFs that were already converted
+			return nil // Continue with the next entry
+		}
+		if mkdirError := os.MkdirAll(filepath.Dir(derivedPath), 0o755); mkdirError != nil { // Create the derived directory tree
+			logError(mkdirError) // Log the error
+			return nil           // Continue with the next entry
+		}
+
+		commandArguments := append([]string{ // Arguments shared by every conversion
+			"-sDEVICE=pdfwrite",               // Write PDF output
+			"-dBATCH", "-dNOPAUSE", "-dQUIET", // Run non-interactively and quietly
+		}, ghostscriptArguments...) // Followed by the conversion-specific settings
+		commandArguments = append(commandArguments, "-sOutputFile="+derivedPath, path) // Finish with the output and source paths
+
+		if output, runError := exec.Command(ghostscriptPath, commandArguments...).CombinedOutput(); runError != nil { // Run Ghostscript and capture its output
+			logErrorf("Failed to produce %s copy of %s %v: %s", description, path, runError, strings.TrimSpace(string(output))) // Log the failure with Ghostscript's message
+			_ = removeArchiveFile(derivedPath)                                                                                  // Remove any partial output so the next run retries
+			return nil                                                                                                          // Continue with the next entry
+		}
+
+		if keepSmaller { // Check whether the result must beat the original
+			sourceInfo, sourceError := os.Stat(path)                                                  // Size of the original
+			derivedInfo, derivedError := os.Stat(derivedPath)                                         // Size of the derived copy
+			if sourceError == nil && derivedError == nil && derivedInfo.Size() >= sourceInfo.Size() { // Check if re-encoding made the file bigger
+				if copyError := copyFile(path, derivedPath); copyError != nil { // Use the original instead
+					logError(copyError) // Log the copy failure
+				}
+				log.Printf("Kept original for %s copy of %s (Ghostscript output was not smaller)", description, path) // Log the fallback
+				return nil                                                                                            // Continue walking
+			}
+		}
+
+		recordAudit(auditEntry{Action: "write", Path: derivedPath}, nil)       // Audit Ghostscript's output
+		log.Printf("Created %s copy: %s → %s", description, path, derivedPath) // Log success message
+		return nil                                                             // Continue walking
+	}) // End of directory walk
+	if walkError != nil { // Check if the walk failed
+		logError(walkError) // Log the error
+	}
+} // End of buildGhostscriptTree function
+
+var startxrefPattern = regexp.MustCompile(`^startxref\s+(\d+)`) // Offset after the last startxref keyword
+
+var xrefStreamPattern = regexp.MustCompile(`^\d+\s+\d+\s+obj`) // Object header of a cross-reference stream
+
+// Checks that a saved PDF is structurally complete: a "%PDF-" header, a trailing "%%EOF" marker,
+// and a "startxref" offset that points at a cross-reference table or stream inside the file
+func validatePDFFile(pdfPath string) error { // Function to detect truncated or corrupt PDFs
+	pdfData, readError := os.ReadFile(pdfPath) // Read the whole file into memory
+	if readError != nil {                      // Check if the file could not be read
+		return readError // Return the read error
+	}
+
+	headerWindow := pdfData[:min(len(pdfData), 1024)]   // PDF readers accept the header anywhere in the first kilobyte
+	if !bytes.Contains(headerWindow, []byte("%PDF-")) { // Check for the PDF header
+		return fmt.Errorf("missing %%PDF- header") // The file is not a PDF at all
+	}
+
+	trailerWindow := pdfData[max(0, len(pdfData)-1024):] // The end-of-file marker lives in the last kilobyte
+	if !bytes.Contains(trailerWindow, []byte("%%EOF")) { // Check for the end-of-file marker
+		return fmt.Errorf("missing %%%%EOF marker, file is probably truncated") // The download stopped early
+	}
+
+	startxrefIndex := bytes.LastIndex(pdfData, []byte("startxref")) // Find the last cross-reference pointer
+	if startxrefIndex < 0 {                                         // Check that the pointer exists
+		return fmt.Errorf("missing startxref") // The trailer is damaged
+	}
+	offsetMatch := startxrefPattern.FindSubmatch(pdfData[startxrefIndex:]) // Read the offset after the keyword
+	if offsetMatch == nil {                                                // Check that an offset follows the keyword
+		return fmt.Errorf("startxref has no offset") // The trailer is damaged
+	}
+	xrefOffset, convertError := strconv.Atoi(string(offsetMatch[1])) // Convert the offset to a number
+	if convertError != nil || xrefOffset >= len(pdfData) {           // Check that the offset lies inside the file
+		return fmt.Errorf("startxref offset %s is outside the file", offsetMatch[1]) // The file is truncated or damaged
+	}
+
+	xrefStart := bytes.TrimLeft(pdfData[xrefOffset:min(len(pdfData), xrefOffset+64)], " \t\r\n") // Bytes at the cross-reference offset
+	isXrefTable := bytes.HasPrefix(xrefStart, []byte("xref"))                                    // Classic cross-reference table
+	isXrefStream := xrefStreamPattern.Match(xrefStart)                                           // Cross-reference stream object (PDF 1.5+)
+	if !isXrefTable && !isXrefStream {                                                           // Check that the offset points at a cross-reference section
+		return fmt.Errorf("startxref offset %d does not point at a cross-reference section", xrefOffset) // The file is damaged
+	}
+
+	return nil // The PDF looks structurally complete
+} // End of validatePDFFile function
+
+// Priorities of system log entries, as defined by syslog and used by the journal
+const (
+	syslogPriorityCritical = 2 // The program stops
+	syslogPriorityError    = 3 // Something failed
+	syslogPriorityWarning  = 4 // Something looks wrong but the run continues
+	syslogPriorityInfo     = 6 // Progress
+)
+
+// Tags logFatal, logError and logWarning put in front of their messages; untagged lines are progress
+var logLevelTags = []struct {
+	tag      string // Start of the message
+	priority int    // Priority it stands for
+}{{"FATAL: ", syslogPriorityCritical}, {"ERROR: ", syslogPriorityError}, {"WARNING: ", syslogPriorityWarning}}
+
+var logTimestampPattern = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} )?(\d{2}:\d{2}:\d{2}(\.\d+)? )?`) // Date and time the log package writes before the message
+
+// Returns the system log priority of a log line from the level tag its message starts with
+func logMessagePriority(message string) int { // Function to classify a log line
+	message = strings.TrimPrefix(message, logTimestampPattern.FindString(message)) // The tag follows the timestamp, if any
+	for _, level := range logLevelTags {                                           // Check each tag
+		if strings.HasPrefix(message, level.tag) { // Check if the line carries it
+			return level.priority // The tagged level
+		}
+	}
+	return syslogPriorityInfo // Everything else is progress
+} // End of logMessagePriority function
+
+// Logs its operands like log.Println at warning priority
+func logWarning(values ...any) { // Function to log a warning
+	log.Output(2, "WARNING: "+fmt.Sprintln(values...)) // Tag the line
+} // End of logWarning function
+
+// Logs a formatted line like log.Printf at warning priority
+func logWarningf(format string, values ...any) { // Function to log a formatted warning
+	log.Output(2, "WARNING: "+fmt.Sprintf(format, values...)) // Tag the line
+} // End of logWarningf function
+
+// Logs its operands like log.Println at error priority
+func logError(values ...any) { // Function to log an error
+	log.Output(2, "ERROR: "+fmt.Sprintln(values...)) // Tag the line
+} // End of logError function
+
+// Logs a formatted line like log.Printf at error priority
+func logErrorf(format string, values ...any) { // Function to log a formatted error
+	log.Output(2, "ERROR: "+fmt.Sprintf(format, values...)) // Tag the line
+} // End of logErrorf function
+
+// Logs its operands like log.Fatalln, at a priority no -log-level filters, and exits
+func logFatal(values ...any) { // Function to log why the program stops
+	log.Output(2, "FATAL: "+fmt.Sprintln(values...)) // Tag the line
+	os.Exit(1)                                       // Stop like log.Fatalln
+} // End of logFatal function
+
+// Logs a formatted line like log.Fatalf, at a priority no -log-level filters, and exits
+func logFatalf(format string, values ...any) { // Function to log why the program stops
+	log.Output(2, "FATAL: "+fmt.Sprintf(format, values...)) // Tag the line
+	os.Exit(1)                                              // Stop like log.Fatalf
+} // End of logFatalf function
+
+// Least severe priority shown for each -log-level
+var logLevelPriorities = map[string]int{"info": syslogPriorityInfo, "warning": syslogPriorityWarning, "error": syslogPriorityError}
+
+// ANSI color of log lines by priority; progress lines keep the terminal's color
+var logPriorityColors = map[int]string{syslogPriorityCritical: "\x1b[1;31m", syslogPriorityError: "\x1b[31m", syslogPriorityWarning: "\x1b[33m"}
+
+var logLineURLPattern = regexp.MustCompile(`https?://[^\s"']+`) // First URL in a log line, which names the group it belongs to
+
+// Writer between the log package and its destination that drops lines below -log-level and, on a terminal, colors
+// warnings and errors and puts a header above each run of lines about the same URL
+type leveledLogWriter struct { // State of the leveled log
+	mutex           sync.Mutex // Guards the group while goroutines log concurrently
+	next            io.Writer  // Where lines that pass go
+	minimumPriority int        // Least severe priority shown
+	colorize        bool       // Whether to color and group lines
+	groupURL        string     // URL of the lines printed last
+} // End of leveledLogWriter struct
+
+// Filters, colors and groups one log line
+func (logWriter *leveledLogWriter) Write(logOutput []byte) (int, error) { // Method implementing io.Writer for the log package
+	lineLength := len(logOutput)                      // Bytes the log package handed over
+	priority := logMessagePriority(string(logOutput)) // Severity of the line
+	if priority > logWriter.minimumPriority {         // Check if the line is below the log level
+		return lineLength, nil // Drop it
+	}
+	logOutput = []byte(redactBrowserToken(string(logOutput))) // Errors from a remote browser can quote its address
+	if !logWriter.colorize {                                  // Check if the line goes somewhere without colors
+		if _, writeError := logWriter.next.Write(logOutput); writeError != nil { // Pass it on uncolored
+			return 0, writeError // Return the error
+		}
+		return lineLength, nil // The whole line was handled
+	}
+
+	logWriter.mutex.Lock()                                                                 // Lock the group
+	defer logWriter.mutex.Unlock()                                                         // Unlock when done
+	var styledLine strings.Builder                                                         // The line as printed
+	lineURL := strings.TrimRight(logLineURLPattern.FindString(string(logOutput)), ".,:;)") // URL the line is about, without the punctuation after it
+	if lineURL != "" && lineURL != logWriter.groupURL {                                    // Check if a new group starts
+		styledLine.WriteString("\x1b[1m" + lineURL + "\x1b[0m\n") // Header naming the URL
+	}
+	logWriter.groupURL = lineURL // Lines without a URL end the group
+	if lineURL != "" {           // Check if the line belongs to a group
+		styledLine.WriteString("  ") // Indent it under the header
+	}
+	if color, colored := logPriorityColors[priority]; colored { // Check if the level has a color
+		styledLine.WriteString(color + strings.TrimRight(string(logOutput), "\n") + "\x1b[0m\n") // Color the line
+	} else {
+		styledLine.Write(logOutput) // Keep the terminal's color
+	}
+	if _, writeError := io.WriteString(logWriter.next, styledLine.String()); writeError != nil { // Print the line
+		return 0, writeError // Return the error
+	}
+	return lineLength, nil // The whole line was handled
+} // End of Write method
+
+// Reports whether console log lines should be colored, following -color, NO_COLOR and whether stderr is a terminal
+func useConsoleColor() bool { // Function to decide about colors
+	switch *logColor { // Follow the flag first
+	case "always":
+		return true // Always color
+	case "never":
+		return false // Never color
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" { // Check if the user or terminal asks for no colors
+		return false // Plain output
+	}
+	stderrInfo, statError := os.Stderr.Stat()                           // Inspect stderr
+	return statError == nil && stderrInfo.Mode()&os.ModeCharDevice != 0 // Color only a terminal
+} // End of useConsoleColor function
+
+// Log file that rotates itself: once it would grow past -log-max-size or is older than -log-rotate-every it is renamed
+// with a timestamp suffix and a new one is started, and rotated copies beyond -log-max-backups or older than -log-max-age are deleted
+type rotatingLogFile struct { // State of the log file
+	mutex sync.Mutex // Guards the fields while goroutines log concurrently
+	path  string     // Absolute path of the current log file
+	file  *os.File   // Open current log file
+	size  int64      // Bytes in the current log file
+	begun time.Time  // When the current log file was started
+} // End of rotatingLogFile struct
+
+// Opens the log file for appending, resolving its path first so changing directory later does not move it
+func openRotatingLogFile(logPath string) (*rotatingLogFile, error) { // Function to open the log file
+	absolutePath, absError := filepath.Abs(logPath) // Resolve the path
+	if absError != nil {                            // Check if the path cannot be resolved
+		return nil, absError // Return the error
+	}
+	logFile := &rotatingLogFile{path: absolutePath} // The log file
+	return logFile, logFile.open()                  // Open it
+} // End of openRotatingLogFile function
+
+// Opens the current log file and reads its size
+func (logFile *rotatingLogFile) open() error { // Method to open the current file
+	openedFile, openError := os.OpenFile(logFile.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644) // Open for appending
+	if openError != nil {                                                                          // Check if the file could not be opened
+		return openError // Return the error
+	}
+	fileInfo, statError := openedFile.Stat() // Read the existing size
+	if statError != nil {                    // Check if the file cannot be inspected
+		openedFile.Close() // Close the file
+		return statError   // Return the error
+	}
+	logFile.file = openedFile      // Use the file
+	logFile.size = fileInfo.Size() // Continue counting from its size
+	logFile.begun = time.Now()     // A new file starts now
+	if logFile.size > 0 {          // Check if an earlier run left the file
+		logFile.begun = fileInfo.ModTime() // Age it from its last write, the closest record of its start that survives
+	}
+	return nil // The file is ready
+} // End of open method
+
+// Writes log output, rotating the file first when the output would take it past -log-max-size or the file is older than
+// -log-rotate-every
+func (logFile *rotatingLogFile) Write(logOutput []byte) (int, error) { // Method implementing io.Writer for the log package
+	logFile.mutex.Lock()         // Lock the file
+	defer logFile.mutex.Unlock() // Unlock when done
+
+	maxBytes := int64(*logMaxSize) << 20                                                // Rotation size in bytes
+	tooBig := maxBytes > 0 && logFile.size+int64(len(logOutput)) > maxBytes             // The output would not fit
+	tooOld := *logRotateInterval > 0 && time.Since(logFile.begun) >= *logRotateInterval // The file has been written long enough
+	if logFile.size > 0 && (tooBig || tooOld) {                                         // Check if a new file is due
+		if rotateError := logFile.rotate(); rotateError != nil { // Start a new file
+			fmt.Fprintln(os.Stderr, "Failed to rotate log file:", rotateError) // The log itself cannot report it
+		}
+	}
+	if logFile.file == nil { // Check if reopening after a rotation failed
+		return os.Stderr.Write(logOutput) // Fall back to stderr rather than losing the output
+	}
+	byteCount, writeError := logFile.file.Write(logOutput) // Write the output
+	logFile.size += int64(byteCount)                       // Count it
+	return byteCount, writeError                           // Pass the result on
+} // End of Write method
+
+// Renames the current file with a timestamp suffix, starts a new one, and prunes old copies. Callers hold the mutex.
+func (logFile *rotatingLogFile) rotate() error { // Method to rotate the log file
+	logFile.file.Close()                                                                      // Close the current file
+	logFile.file = nil                                                                        // Until a new one is open
+	rotatedPath := logFile.path + "." + time.Now().UTC().Format("20060102T150405.000000000Z") // Sortable, unique suffix
+	if renameError := os.Rename(logFile.path, rotatedPath); renameError != nil {              // Move the current file aside
+		if openError := logFile.open(); openError != nil { // Keep appending to it
+			return fmt.Errorf("%w; reopening it failed too, logging to stderr: %w", renameError, openError) // Write falls back to stderr
+		}
+		return renameError // Return the error
+	}
+	if openError := logFile.open(); openError != nil { // Start a new file
+		return openError // Return the error
+	}
+
+	directoryEntries, readError := os.ReadDir(filepath.Dir(logFile.path)) // Look for rotated copies beside the file
+	if readError != nil {                                                 // Check if the directory cannot be read
+		return readError // Return the error
+	}
+	var rotatedPaths []string                          // Every rotated copy
+	rotatedPrefix := filepath.Base(logFile.path) + "." // Rotated copies share the name plus a suffix
+	for _, directoryEntry := range directoryEntries {  // Check each entry
+		if !directoryEntry.IsDir() && strings.HasPrefix(directoryEntry.Name(), rotatedPrefix) { // Check if it is a rotated copy
+			rotatedPaths = append(rotatedPaths, filepath.Join(filepath.Dir(logFile.path), directoryEntry.Name())) // Keep it
+		}
+	}
+	sort.Strings(rotatedPaths)                         // Oldest first, thanks to the timestamp suffix
+	for pathIndex, rotatedPath := range rotatedPaths { // Decide about each copy
+		tooMany := *logMaxBackups > 0 && pathIndex < len(rotatedPaths)-*logMaxBackups               // Beyond the number kept
+		fileInfo, statError := os.Stat(rotatedPath)                                                 // Age of the copy
+		tooOld := *logMaxAge > 0 && statError == nil && time.Since(fileInfo.ModTime()) > *logMaxAge // Beyond the age kept
+		if tooMany || tooOld {                                                                      // Check if the copy should go
+			os.Remove(rotatedPath) // Delete it; a failure leaves it for the next rotation
+		}
+	}
+	return nil // Rotated
+} // End of rotate method
+
+// One line of the audit log
+type auditEntry struct { // Fields written for each audited action
+	Time   string `json:"time"`             // RFC 3339 timestamp with nanoseconds
+	Actor  string `json:"actor"`            // user@host running the archiver
+	PID    int    `json:"pid"`              // Process ID, telling concurrent archivers apart
+	Action string `json:"action"`           // "request", "write", "append", "modify", "rename", "symlink", or "delete"
+	Method string `json:"method,omitempty"` // HTTP method of a request
+	URL    string `json:"url,omitempty"`    // URL of a request, without any password
+	Status int    `json:"status,omitempty"` // HTTP status of a request
+	Path   string `json:"path,omitempty"`   // Absolute path of the file changed
+	Target string `json:"target,omitempty"` // New path of a renamed file, or the target of a symlink
+	Size   int64  `json:"size,omitempty"`   // Bytes written
+	Error  string `json:"error,omitempty"`  // Why the action failed, if it did
+} // End of auditEntry struct
+
+var auditLogMutex sync.Mutex // Keeps audit lines from interleaving
+
+// user@host running the archiver, for the audit log
+var auditActor = func() string {
+	userName := "unknown"                                           // Fallback when the user cannot be determined
+	if currentUser, userError := user.Current(); userError == nil { // Look the user up
+		userName = currentUser.Username // Use the login name
+	}
+	hostName, _ := os.Hostname() // Name of the machine
+	return userName + "@" + hostName
+}()
+
+// Appends an action to the -audit-log file, if one is configured. The file is only ever opened for appending.
+func recordAudit(entry auditEntry, actionError error) { // Function to audit an action
+	if *auditLogPath == "" { // Check if auditing is enabled
+		return // Nothing to record
+	}
+	entry.Time = time.Now().UTC().Format(time.RFC3339Nano) // When it happened
+	entry.Actor = auditActor                               // Who did it
+	entry.PID = os.Getpid()                                // Which process did it
+	if entry.Path != "" {                                  // Record paths unambiguously, whatever the working directory
+		if absolutePath, absError := filepath.Abs(entry.Path); absError == nil { // Resolve the path
+			entry.Path = absolutePath // Use the absolute path
+		}
+	}
+	if actionError != nil { // Record failures too
+		entry.Error = actionError.Error() // Why the action failed
+	}
+	entryJSON, marshalError := json.Marshal(entry) // Encode the entry as one JSON line
+	if marshalError != nil {                       // Check if encoding failed
+		logError(marshalError) // Log the encoding error
+		return                 // Nothing to write
+	}
+
+	auditLogMutex.Lock()                                                                           // One line at a time
+	defer auditLogMutex.Unlock()                                                                   // Unlock when done
+	auditFile, openError := os.OpenFile(*auditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644) // Open the log for appending only
+	if openError != nil {                                                                          // Check if the log could not be opened
+		logError(openError) // Log the error
+		return              // Nothing can be written
+	}
+	defer auditFile.Close()                                                           // Close the log when done
+	if _, writeError := auditFile.Write(append(entryJSON, '\n')); writeError != nil { // Append the line
+		logError(writeError) // Log the write failure
+	}
+} // End of recordAudit function
+
+// http.RoundTripper keeping GET responses in a disk cache. Fresh responses (Cache-Control max-age, Expires, or
+// -http-cache-ttl unless the server said no-cache) are answered from disk; stale ones are revalidated with If-None-Match/If-Modified-Since. Responses
+// are keyed by the URL and the request headers in cacheKeyHeaders. Requests carrying credentials, responses marked
+// no-store or private or varying on other headers, partial responses, and bodies larger than -http-cache-max-size are
+// never stored.
+type cachingTransport struct { // Wraps the transport doing the work
+	next      http.RoundTripper // Transport sending the requests
+	directory string            // Absolute path of the cache directory
+} // End of cachingTransport struct
+
+// Answers the request from the cache when possible and stores cacheable responses
+func (transport *cachingTransport) RoundTrip(request *http.Request) (*http.Response, error) { // Method implementing http.RoundTripper
+	if request.Method != http.MethodGet || request.Header.Get("Range") != "" { // Only whole GET responses are cached
+		return transport.next.RoundTrip(request) // Pass the request on
+	}
+	if request.Header.Get("Authorization") != "" || request.Header.Get("Cookie") != "" || request.URL.User != nil { // Responses to credentialed requests are meant for that user only
+		return transport.next.RoundTrip(request) // Pass the request on
+	}
+	keyMaterial := request.URL.String()          // One file per URL and variant
+	for _, headerName := range cacheKeyHeaders { // Add the headers responses commonly vary on
+		keyMaterial += "\n" + headerName + ": " + request.Header.Get(headerName) // Distinguish the variants
+	}
+	cacheKey := sha256.Sum256([]byte(keyMaterial))                                   // One file per variant
+	cachePath := filepath.Join(transport.directory, hex.EncodeToString(cacheKey[:])) // Where the response is kept
+
+	cachedResponse, storedAt := transport.load(cachePath, request)              // Read the cached response, if any
+	if cachedResponse != nil && cacheIsFresh(cachedResponse.Header, storedAt) { // Check if the cached response can be used as is
+		return cachedResponse, nil // Answer from the cache
+	}
+
+	forwardedRequest := request // Request sent to the server
+	if cachedResponse != nil {  // Ask the server whether the cached response is still current
+		forwardedRequest = request.Clone(request.Context())        // Leave the caller's request untouched
+		if etag := cachedResponse.Header.Get("ETag"); etag != "" { // Revalidate by ETag
+			forwardedRequest.Header.Set("If-None-Match", etag) // Ask for 304 if unchanged
+		}
+		if lastModified := cachedResponse.Header.Get("Last-Modified"); lastModified != "" { // Revalidate by date
+			forwardedRequest.Header.Set("If-Modified-Since", lastModified) // Ask for 304 if unchanged
+		}
+	}
+	response, requestError := transport.next.RoundTrip(forwardedRequest) // Send the request
+	if requestError != nil {                                             // Check if the request failed
+		if cachedResponse != nil { // The cached response is all there is
+			cachedResponse.Body.Close() // Release it
+		}
+		return nil, requestError // Return the error
+	}
+	if response.StatusCode == http.StatusNotModified && cachedResponse != nil { // Check if the cached response is still current
+		response.Body.Close()           // The 304 has no body
+		now := time.Now()               // Restart the freshness lifetime
+		os.Chtimes(cachePath, now, now) // The modification time records when the response was validated
+		return cachedResponse, nil      // Answer from the cache
+	}
+	if cachedResponse != nil { // The server sent a new response
+		cachedResponse.Body.Close() // Release the old one
+	}
+	cacheControl := strings.ToLower(response.Header.Get("Cache-Control"))                                                                                                                                                      // The server's caching rules
+	if response.StatusCode != http.StatusOK || strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private") || !cacheKeyCoversVary(response.Header) || response.ContentLength > *httpCacheMaxSize { // Check if the response may be stored
+		return response, nil // Pass it on uncached
+	}
+
+	bodyData, readError := io.ReadAll(io.LimitReader(response.Body, *httpCacheMaxSize+1)) // Read the body, up to the limit
+	if readError != nil || int64(len(bodyData)) > *httpCacheMaxSize {                     // Check if the body is too large or broken
+		response.Body = struct { // Hand the caller what was read followed by the rest
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(bodyData), response.Body), response.Body}
+		return response, nil // Pass it on uncached
+	}
+	response.Body.Close()                                             // The body is in memory
+	response.Body = io.NopCloser(bytes.NewReader(bodyData))           // Serialize the response from memory
+	var serialized bytes.Buffer                                       // The response as sent on the wire
+	if writeError := response.Write(&serialized); writeError == nil { // Serialize it
+		if saveError := os.WriteFile(cachePath, serialized.Bytes(), 0o644); saveError != nil { // Store it; the cache is not part of the archive, so it is not audited
+			logErrorf("Failed to cache %s %v", request.URL.Redacted(), saveError) // Log the failure
+		}
+	}
+	response.Body = io.NopCloser(bytes.NewReader(bodyData)) // Give the caller a fresh reader
+	return response, nil                                    // Pass the response on
+} // End of RoundTrip method
+
+// Reads a cached response and when it was stored or last validated, or nil if it is not cached
+func (transport *cachingTransport) load(cachePath string, request *http.Request) (*http.Response, time.Time) { // Method to read the cache
+	cacheFile, openError := os.Open(cachePath) // Open the cached response
+	if openError != nil {                      // Check if nothing is cached
+		return nil, time.Time{} // Not cached
+	}
+	fileInfo, statError := cacheFile.Stat()        // When it was stored
+	cachedData, readError := io.ReadAll(cacheFile) // Read it whole so the file can be closed
+	cacheFile.Close()                              // Close the file
+	if statError != nil || readError != nil {      // Check if the file is unreadable
+		return nil, time.Time{} // Treat it as not cached
+	}
+	cachedResponse, parseError := http.ReadResponse(bufio.NewReader(bytes.NewReader(cachedData)), request) // Parse the stored response
+	if parseError != nil {                                                                                 // Check if the file is corrupt
+		return nil, time.Time{} // Treat it as not cached
+	}
+	return cachedResponse, fileInfo.ModTime() // The cached response
+} // End of load method
+
+// Request headers cached responses are keyed by besides the URL
+var cacheKeyHeaders = []string{"Accept", "Accept-Language"}
+
+// Reports whether every request header a response's Vary names is part of the cache key; Accept-Encoding is set by the
+// transport itself and so never differs
+func cacheKeyCoversVary(responseHeader http.Header) bool { // Function to check whether a response can be keyed
+	for _, varyValue := range responseHeader.Values("Vary") { // Each Vary header
+		for _, headerName := range strings.Split(varyValue, ",") { // Each header it names
+			headerName = http.CanonicalHeaderKey(strings.TrimSpace(headerName))                                       // Compare canonical names
+			if headerName != "" && headerName != "Accept-Encoding" && !slices.Contains(cacheKeyHeaders, headerName) { // "*" and any other header cannot be keyed
+				return false // Not storable
+			}
+		}
+	}
+	return true // Storable
+} // End of cacheKeyCoversVary function
+
+var cacheMaxAgePattern = regexp.MustCompile(`max-age=(\d+)`) // Lifetime in a Cache-Control header
+
+// Reports whether a response stored at storedAt may still be used without asking the server
+func cacheIsFresh(responseHeader http.Header, storedAt time.Time) bool { // Function to apply the freshness rules
+	cacheControl := strings.ToLower(responseHeader.Get("Cache-Control"))                          // The server's caching rules
+	if strings.Contains(cacheControl, "no-cache") || strings.Contains(cacheControl, "no-store") { // Check if every use must be validated, whatever -http-cache-ttl says
+		return false // Revalidate
+	}
+	age := time.Since(storedAt) // How long ago the response was stored or validated
+	if age < *httpCacheTTL {    // The configured minimum wins over the server's lifetime
+		return true // Fresh
+	}
+	if maxAgeMatch := cacheMaxAgePattern.FindStringSubmatch(cacheControl); maxAgeMatch != nil { // Check for a lifetime
+		maxAge, _ := strconv.Atoi(maxAgeMatch[1])      // The digits always parse
+		return age < time.Duration(maxAge)*time.Second // Fresh for max-age seconds
+	}
+	if expires, parseError := http.ParseTime(responseHeader.Get("Expires")); parseError == nil { // Check for an expiry date
+		return time.Now().Before(expires) // Fresh until then
+	}
+	return false // Without freshness information, revalidate
+} // End of cacheIsFresh function
+
+// http.RoundTripper counting the response bytes of every request towards the current run's transfer totals
+type meteringTransport struct { // Wraps the transport doing the work
+	next http.RoundTripper // Transport sending the requests
+} // End of meteringTransport struct
+
+// Sends the request and meters its response body as it is read
+func (transport *meteringTransport) RoundTrip(request *http.Request) (*http.Response, error) { // Method implementing http.RoundTripper
+	response, requestError := transport.next.RoundTrip(request) // Send the request
+	if response != nil && response.Body != nil {                // Meter the body
+		response.Body = &meteredBody{ReadCloser: response.Body, host: request.URL.Hostname()} // Count bytes as they arrive
+	}
+	return response, requestError // Pass the result on
+} // End of RoundTrip method
+
+// Response body counting the bytes read from it
+type meteredBody struct { // Wraps the response body
+	io.ReadCloser        // The real body
+	host          string // Host the bytes come from
+} // End of meteredBody struct
+
+// Reads from the body and counts what arrived
+func (body *meteredBody) Read(buffer []byte) (int, error) { // Method implementing io.Reader
+	byteCount, readError := body.ReadCloser.Read(buffer) // Read from the real body
+	if byteCount > 0 && runStatistics != nil {           // Only runs are accounted for
+		runStatistics.addTransfer(body.host, int64(byteCount)) // Count the bytes
+	}
+	return byteCount, readError // Pass the result on
+} // End of Read method
+
+// Formats a byte count with binary units, e.g. "12.3 MiB"
+func formatByteCount(byteCount int64) string { // Function to format sizes for people
+	const unit = 1024     // Binary units
+	if byteCount < unit { // Small counts stay in bytes
+		return fmt.Sprintf("%d B", byteCount) // Plain bytes
+	}
+	divisor, exponent := int64(unit), 0                                    // Find the largest fitting unit
+	for quotient := byteCount / unit; quotient >= unit; quotient /= unit { // Step up while the value is large
+		divisor *= unit // Next unit
+		exponent++      // Next prefix
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(byteCount)/float64(divisor), "KMGTPE"[exponent]) // Scaled value
+} // End of formatByteCount function
+
+// Adds the run's transfers to the catalog's running totals and logs them
+func recordRunTransfers() { // Function to account for the run's bandwidth
+	runBytes, hostBytes := runStatistics.transfers() // The run's totals
+	if archiveCatalog.Transfer == nil {              // First accounted run
+		archiveCatalog.Transfer = &transferTotals{} // Start the totals
+	}
+	if archiveCatalog.Transfer.HostBytes == nil { // First accounted host
+		archiveCatalog.Transfer.HostBytes = make(map[string]int64) // Start the per-host totals
+	}
+	archiveCatalog.Transfer.TotalBytes += runBytes  // Add the run
+	archiveCatalog.Transfer.Runs++                  // Count the run
+	archiveCatalog.Transfer.LastRunBytes = runBytes // Remember the latest run
+	hosts := slices.Sorted(maps.Keys(hostBytes))    // Hosts in a stable order
+	var hostSummaries []string                      // One "host size" item per host
+	for _, host := range hosts {                    // Add and describe each host
+		archiveCatalog.Transfer.HostBytes[host] += hostBytes[host]                       // Add the host's bytes
+		hostSummaries = append(hostSummaries, host+" "+formatByteCount(hostBytes[host])) // Describe them
+	}
+	log.Printf("Transferred %s this run (%s); %s over %d run(s) in total", formatByteCount(runBytes), strings.Join(hostSummaries, ", "), formatByteCount(archiveCatalog.Transfer.TotalBytes), archiveCatalog.Transfer.Runs) // Report the bandwidth
+} // End of recordRunTransfers function
+
+// http.RoundTripper recording every request in the audit log
+type auditingTransport struct { // Wraps the transport doing the work
+	next http.RoundTripper // Transport sending the requests
+} // End of auditingTransport struct
+
+// Sends the request and records it in the audit log
+func (transport *auditingTransport) RoundTrip(request *http.Request) (*http.Response, error) { // Method implementing http.RoundTripper
+	response, requestError := transport.next.RoundTrip(request)                                                     // Send the request
+	entry := auditEntry{Action: "request", Method: request.Method, URL: redactBrowserToken(request.URL.Redacted())} // Describe it, without passwords or the remote browser's token
+	if response != nil {                                                                                            // Record the answer
+		entry.Status = response.StatusCode // The response status
+	}
+	recordAudit(entry, requestError) // Audit the request
+	return response, requestError    // Pass the result on
+} // End of RoundTrip method
+
+// Writes a file like os.WriteFile and records the write in the audit log
+func writeArchiveFile(filePath string, fileData []byte, permission os.FileMode) error { // Function to write a file
+	writeError := os.WriteFile(filePath, fileData, permission)                                       // Write the file
+	recordAudit(auditEntry{Action: "write", Path: filePath, Size: int64(len(fileData))}, writeError) // Audit the write
+	return writeError                                                                                // Return any error
+} // End of writeArchiveFile function
+
+// Removes a file like os.Remove and records the deletion in the audit log; files that are already gone are not recorded
+func removeArchiveFile(filePath string) error { // Function to delete a file
+	removeError := os.Remove(filePath) // Remove the file
+	if os.IsNotExist(removeError) {    // Nothing was deleted
+		return removeError // Return the error for callers that check it
+	}
+	recordAudit(auditEntry{Action: "delete", Path: filePath}, removeError) // Audit the deletion
+	return removeError                                                     // Return any error
+} // End of removeArchiveFile function
+
+// Renames a file like os.Rename and records the move in the audit log
+func renameArchiveFile(oldPath string, newPath string) error { // Function to move a file
+	renameError := os.Rename(oldPath, newPath)                                                    // Move the file
+	absoluteTarget, _ := filepath.Abs(newPath)                                                    // Record the destination unambiguously
+	recordAudit(auditEntry{Action: "rename", Path: oldPath, Target: absoluteTarget}, renameError) // Audit the move
+	return renameError                                                                            // Return any error
+} // End of renameArchiveFile function
+
+// Describes why a file was quarantined, stored as "<file>.json" next to it
+type quarantineRecord struct { // Fields written next to each quarantined file
+	SourceURL     string `json:"source_url"`     // URL the file was downloaded from
+	Reason        string `json:"reason"`         // Why the file failed validation
+	Size          int64  `json:"size"`           // File size in bytes
+	QuarantinedAt string `json:"quarantined_at"` // RFC 3339 timestamp of the quarantine
+} // End of quarantineRecord struct
+
+// Returns the reason downloaded firmware looks wrong (too small, or a ZIP without the ZIP signature), or "" if it looks fine
+func suspiciousFirmware(filePath string, firmwareData []byte) string { // Function to sanity-check firmware
+	if len(firmwareData) < minFirmwareSize { // Real firmware is never this small
+		return fmt.Sprintf("only %d bytes", len(firmwareData)) // Describe the problem
+	}
+	if strings.EqualFold(getFileExtension(filePath), ".zip") && !bytes.HasPrefix(firmwareData, []byte("PK\x03\x04")) { // ZIP archives start with a local file header
+		return "missing ZIP signature" // Describe the problem
+	}
+	return "" // Nothing suspicious
+} // End of suspiciousFirmware function
+
+// File signatures of the desktop software formats archived under Software/, by extension; "" skips the check
+var softwareSignatures = map[string]string{".exe": "MZ", ".msi": "\xd0\xcf\x11\xe0", ".dmg": "", ".pkg": "xar!", ".appimage": "\x7fELF", ".deb": "!<arch>"}
+
+// Returns the reason downloaded software looks wrong (content without its format's signature), or "" if it looks fine
+func suspiciousSoftware(filePath string, softwareData []byte) string { // Function to sanity-check software
+	extension := strings.ToLower(getFileExtension(filePath))                                                  // The format the file claims
+	if extension == ".dmg" && !bytes.Contains(softwareData[max(0, len(softwareData)-512):], []byte("koly")) { // Disk images end with a "koly" trailer
+		return "missing disk image trailer" // Describe the problem
+	}
+	if signature := softwareSignatures[extension]; !bytes.HasPrefix(softwareData, []byte(signature)) { // Executables and packages start with a magic number
+		return "missing " + strings.TrimPrefix(extension, ".") + " signature" // Describe the problem
+	}
+	return "" // Nothing suspicious
+} // End of suspiciousSoftware function
+
+// Scans downloaded data with -scan-clamd and -scan-command, when set, and returns what was found, or "" if the data
+// is clean or no scanner is configured; an error means a scanner could not be used
+func scanDownload(fileData []byte) (string, error) { // Function to virus-scan a download
+	if *clamdAddress != "" { // Scan with clamd
+		if threat, scanError := scanWithClamd(*clamdAddress, fileData); scanError != nil || threat != "" { // Check for a detection or an error
+			return threat, scanError // Report it
+		}
+	}
+	if *scanCommand != "" { // Scan with the external command
+		return scanWithCommand(*scanCommand, fileData) // Report its verdict
+	}
+	return "", nil // Clean
+} // End of scanDownload function
+
+// Streams data to clamd with the INSTREAM command and returns the signature it reports, or "" if the data is clean
+func scanWithClamd(address string, fileData []byte) (string, error) { // Function to scan with clamd
+	socketType := "tcp"                 // host:port addresses
+	if strings.Contains(address, "/") { // Paths are Unix sockets
+		socketType = "unix" // Connect to the socket
+	}
+	connection, dialError := net.DialTimeout(socketType, address, 10*time.Second) // Connect to clamd
+	if dialError != nil {                                                         // Check if clamd is unreachable
+		return "", dialError // Return the error
+	}
+	defer connection.Close()                                // Close the connection when done
+	connection.SetDeadline(time.Now().Add(5 * time.Minute)) // Never hang on a stuck scanner
+
+	if _, writeError := connection.Write([]byte("zINSTREAM\x00")); writeError != nil { // Start the stream
+		return "", writeError // Return the error
+	}
+	const chunkSize = 64 << 10                                     // clamd's default StreamMaxLength is far larger than one chunk
+	for offset := 0; offset < len(fileData); offset += chunkSize { // Send the data in length-prefixed chunks
+		chunk := fileData[offset:min(offset+chunkSize, len(fileData))]                                                  // The next chunk
+		lengthPrefix := []byte{byte(len(chunk) >> 24), byte(len(chunk) >> 16), byte(len(chunk) >> 8), byte(len(chunk))} // Big-endian chunk length
+		if _, writeError := connection.Write(append(lengthPrefix, chunk...)); writeError != nil {                       // Send the chunk
+			return "", writeError // Return the error
+		}
+	}
+	if _, writeError := connection.Write([]byte{0, 0, 0, 0}); writeError != nil { // A zero length ends the stream
+		return "", writeError // Return the error
+	}
+
+	reply, readError := io.ReadAll(connection) // clamd answers once and closes the connection
+	if readError != nil {                      // Check if the reply could not be read
+		return "", readError // Return the error
+	}
+	verdict := strings.TrimSpace(strings.TrimRight(string(reply), "\x00")) // e.g. "stream: OK" or "stream: Eicar-Signature FOUND"
+	switch {
+	case strings.HasSuffix(verdict, " OK"): // Clean
+		return "", nil // Nothing found
+	case strings.HasSuffix(verdict, " FOUND"): // Detection
+		return strings.TrimSuffix(strings.TrimPrefix(verdict, "stream: "), " FOUND"), nil // Return the signature name
+	}
+	return "", fmt.Errorf("clamd: %s", verdict) // Errors such as "INSTREAM size limit exceeded"
+} // End of scanWithClamd function
+
+// Runs the scan command on a temporary copy of the data; exit status 1 means infected, as with clamscan
+func scanWithCommand(command string, fileData []byte) (string, error) { // Function to scan with an external command
+	commandFields := strings.Fields(command) // The program and its arguments; validateFlags rejects quoting
+	if len(commandFields) == 0 {             // Check for a blank command
+		return "", fmt.Errorf("-scan-command is blank") // Return the error
+	}
+	temporaryFile, createError := os.CreateTemp("", "archiver-scan-*") // Scanners read files
+	if createError != nil {                                            // Check if the file could not be created
+		return "", createError // Return the error
+	}
+	defer os.Remove(temporaryFile.Name())                                  // Remove the copy when done
+	if _, writeError := temporaryFile.Write(fileData); writeError != nil { // Write the data
+		temporaryFile.Close() // Close the file
+		return "", writeError // Return the error
+	}
+	if closeError := temporaryFile.Close(); closeError != nil { // Flush the data
+		return "", closeError // Return the error
+	}
+
+	scanOutput, runError := exec.Command(commandFields[0], append(commandFields[1:], temporaryFile.Name())...).CombinedOutput() // Run the scanner
+	if runError == nil {                                                                                                        // Exit status 0 means clean
+		return "", nil // Nothing found
+	}
+	if exitError, isExit := runError.(*exec.ExitError); isExit && exitError.ExitCode() == 1 { // Exit status 1 means infected
+		report := strings.TrimSpace(strings.ReplaceAll(string(scanOutput), temporaryFile.Name(), "file")) // The scanner's report
+		if report == "" {                                                                                 // Some scanners only set the status
+			report = "exit status 1" // Still report a detection
+		}
+		return report, nil // Return the report
+	}
+	return "", fmt.Errorf("%s: %v: %s", commandFields[0], runError, strings.TrimSpace(string(scanOutput))) // Any other status is an error
+} // End of scanWithCommand function
+
+// Number of files quarantined by this process, keeping names unique when several land within the same instant
+var quarantineSequence atomic.Int64
+
+// Prepares the quarantine path for a file from fileURL; names start with a timestamp and a sequence number so repeated
+// failures are all kept
+func quarantinePath(fileURL string) string { // Function to name a quarantined file
+	if !directoryExists(quarantineDirectory) { // Create the directory on first use
+		createDirectory(quarantineDirectory, 0o755) // Create the directory (rwxr-xr-x)
+	}
+	uniquePrefix := fmt.Sprintf("%s_%d", time.Now().UTC().Format("20060102T150405.000000000Z"), quarantineSequence.Add(1)) // Sortable and unique within the process
+	return filepath.Join(quarantineDirectory, uniquePrefix+"_"+urlToFilename(fileURL))                                     // Timestamped, sanitized name
+} // End of quarantinePath function
+
+// Writes the record explaining why a file was quarantined
+func writeQuarantineRecord(filePath string, fileURL string, reason string, size int64) { // Function to document a quarantined file
+	recordJSON, marshalError := json.MarshalIndent(quarantineRecord{ // Encode the record as indented JSON
+		SourceURL:     fileURL,                               // Where the file came from
+		Reason:        reason,                                // Why it was quarantined
+		Size:          size,                                  // How big it is
+		QuarantinedAt: time.Now().UTC().Format(time.RFC3339), // When it was quarantined
+	}, "", "  ") // End of quarantine record
+	if marshalError != nil { // Check if encoding failed
+		logError(marshalError) // Log the encoding error
+		return                 // Nothing to write
+	}
+	if writeError := writeArchiveFile(filePath+".json", append(recordJSON, '\n'), 0o644); writeError != nil { // Save the record next to the file
+		logErrorf("Failed to write quarantine record for %s %v", filePath, writeError) // Log the write failure
+	}
+} // End of writeQuarantineRecord function
+
+// Stores downloaded data that failed validation under quarantine/ instead of discarding it
+func quarantineDownload(fileURL string, fileData []byte, reason string) { // Function to quarantine downloaded data
+	filePath := quarantinePath(fileURL)                                               // Where to keep the data
+	if writeError := writeArchiveFile(filePath, fileData, 0o644); writeError != nil { // Save the data
+		logErrorf("Failed to quarantine %s %v", fileURL, writeError) // Log the write failure
+		return                                                       // Nothing to document
+	}
+	writeQuarantineRecord(filePath, fileURL, reason, int64(len(fileData))) // Document why
+	logWarningf("Quarantined %s → %s (%s)", fileURL, filePath, reason)     // Log the quarantine
+} // End of quarantineDownload function
+
+// Moves a saved file that failed validation into quarantine/, dropping its sidecar metadata
+func quarantineFile(savedPath string, fileURL string, reason string) { // Function to quarantine a saved file
+	fileInfo, statError := os.Stat(savedPath) // Read the file's size
+	if statError != nil {                     // Check if the file is gone
+		logError(statError) // Log the error
+		return              // Nothing to quarantine
+	}
+	filePath := quarantinePath(fileURL)                                            // Where to keep the file
+	if renameError := renameArchiveFile(savedPath, filePath); renameError != nil { // Move the file
+		logErrorf("Failed to quarantine %s %v", savedPath, renameError) // Log the failure
+		removeDownloadedFile(savedPath)                                 // Discard the file so it can be fetched again
+		return                                                          // Nothing to document
+	}
+	removeDownloadedFile(savedPath)                                      // Drop the sidecar, which describes a file no longer archived
+	writeQuarantineRecord(filePath, fileURL, reason, fileInfo.Size())    // Document why
+	logWarningf("Quarantined %s → %s (%s)", savedPath, filePath, reason) // Log the quarantine
+} // End of quarantineFile function
+
+// Removes a downloaded file together with its sidecar metadata
+func removeDownloadedFile(filePath string) { // Function to discard a bad download
+	for _, path := range []string{filePath, filePath + ".json"} { // The file and its sidecar
+		if removeError := removeArchiveFile(path); removeError != nil && !os.IsNotExist(removeError) { // Remove it, ignoring files that are already gone
+			logError(removeError) // Log the removal failure
+		}
+	}
+} // End of removeDownloadedFile function
+
+// Rewrites a PDF in place as a linearized ("fast web view") file using qpdf
+func linearizePDF(pdfPath string) bool { // Function to linearize a PDF
+	qpdfPath, lookupError := exec.LookPath("qpdf") // Find qpdf on the PATH
+	if lookupError != nil {                        // Check if qpdf is installed
+		logWarningf("Cannot linearize %s: qpdf not found", pdfPath) // Log the missing tool
+		return false                                                // Report that nothing was changed
+	}
+
+	temporaryPath := pdfPath + ".linearized"                                          // qpdf cannot write over its own input, so write beside it first
+	linearizeCommand := exec.Command(qpdfPath, "--linearize", pdfPath, temporaryPath) // Build the qpdf command
+	if output, runError := linearizeCommand.CombinedOutput(); runError != nil {       // Run qpdf and capture its output
+		logErrorf("Failed to linearize %s %v: %s", pdfPath, runError, strings.TrimSpace(string(output))) // Log the failure with qpdf's message
+		_ = removeArchiveFile(temporaryPath)                                                             // Remove any partial output
+		return false                                                                                     // Report that nothing was changed
+	}
+
+	if renameError := renameArchiveFile(temporaryPath, pdfPath); renameError != nil { // Replace the original with the linearized copy
+		logError(renameError)                // Log the rename failure
+		_ = removeArchiveFile(temporaryPath) // Remove the leftover copy
+		return false                         // Report that nothing was changed
+	}
+
+	return true // The PDF was linearized successfully
+} // End of linearizePDF function
+
+var pdfEncryptPattern = regexp.MustCompile(`/Encrypt\s*(?:\d+\s+\d+\s+R|<<)`) // Indirect or inline /Encrypt entry
+
+// Reports whether PDF data declares an /Encrypt dictionary in its trailer, which means it is password-protected or DRM'd
+func isPDFEncrypted(pdfData []byte) bool { // Function to detect encrypted PDF data
+	return pdfEncryptPattern.Match(pdfData) // Look for an indirect or inline /Encrypt entry
+} // End of isPDFEncrypted function
+
+// Reports whether the PDF file at the given path is encrypted
+func isPDFFileEncrypted(pdfPath string) bool { // Function to detect encrypted PDF files
+	pdfData, readError := os.ReadFile(pdfPath) // Read the whole file into memory
+	if readError != nil {                      // Check if the file could not be read
+		logError(readError) // Log the read error
+		return false        // Treat unreadable files as unencrypted; other steps will report them
+	}
+	return isPDFEncrypted(pdfData) // Check the file contents
+} // End of isPDFFileEncrypted function
+
+// Logs every encrypted PDF in the output directory as a separate list at the end of a run
+func reportEncryptedPDFs(outputDirectory string) { // Function to report encrypted PDFs
+	var encryptedPaths []string // Encrypted PDFs found in the archive
+
+	walkError := filepath.WalkDir(outputDirectory, func(path string, entry os.DirEntry, err error) error { // Walk the whole output tree
+		if err != nil { // Check for errors reading this entry
+			logError(err) // Log the error
+			return nil    // Keep walking the rest of the tree
+		}
+		if entry.Type().IsRegular() && strings.ToLower(getFileExtension(path)) == ".pdf" && isPDFFileEncrypted(path) { // Check regular PDF files for encryption
+			encryptedPaths = append(encryptedPaths, path) // Remember the encrypted file
+		}
+		return nil // Continue walking
+	}) // End of directory walk
+	if walkError != nil { // Check if the walk failed
+		logError(walkError) // Log the error
+	}
+
+	if len(encryptedPaths) == 0 { // Nothing to report
+		return // Every PDF is unencrypted
+	}
+	logWarningf("%d encrypted PDF(s) cannot be text-extracted, merged, or converted:", len(encryptedPaths)) // Report header
+	for _, path := range encryptedPaths {                                                                   // List each encrypted file
+		logWarningf("  encrypted: %s", path) // Report the encrypted file
+	}
+} // End of reportEncryptedPDFs function
+
+// Catalog of the archive, persisted as manifest.json in the output directory
+type catalog struct { // Top-level catalog document
+	Entries          map[string]*catalogEntry        `json:"entries"`                     // Downloaded files keyed by source URL
+	FirmwareTimeline map[string]*firmwareTimeline    `json:"firmware_timeline,omitempty"` // Firmware releases per product, oldest first
+	Products         map[string]*productRecord       `json:"products,omitempty"`          // Product pages and their specifications, keyed by page URL
+	Pages            map[string]*pageRecord          `json:"pages,omitempty"`             // OpenGraph metadata of scraped pages, keyed by page URL
+	External         map[string]*externalAsset       `json:"external,omitempty"`          // Linked files the archiver cannot download itself, keyed by URL
+	Transfer         *transferTotals                 `json:"transfer,omitempty"`          // Bandwidth used by all runs so far
+	PublicArchives   map[string]*publicArchiveRecord `json:"public_archives,omitempty"`   // Submissions of URLs to public web archives, keyed by URL
+	UpdateTimeline   map[string][]*documentUpdate    `json:"update_timeline,omitempty"`   // Last-Modified dates seen across runs, per product, oldest first
+	Removed          map[string]string               `json:"removed,omitempty"`           // RFC 3339 timestamp of the save that found each entry gone (deleted, quarantined or re-keyed), keyed by URL, so replicas drop it too
+} // End of catalog struct
+
+// One download of a cataloged URL
+type fetchRecord struct { // Fields stored for each download
+	FetchedAt string `json:"fetched_at"`       // RFC 3339 timestamp of the download
+	SHA256    string `json:"sha256,omitempty"` // Hex-encoded SHA-256 of the content, with -hash=sha256
+	BLAKE3    string `json:"blake3,omitempty"` // Hex-encoded BLAKE3 of the content, with -hash=blake3
+	Size      int64  `json:"size"`             // Size of the content in bytes
+} // End of fetchRecord struct
+
+// One Last-Modified date a server reported for a file, which dates an update the vendor does not announce
+type documentUpdate struct { // Fields stored for each observed modification
+	URL          string `json:"url"`               // File the date belongs to
+	Kind         string `json:"kind,omitempty"`    // "manual", "firmware" or "software"
+	Version      string `json:"version,omitempty"` // Revision cataloged when the date was first seen
+	LastModified string `json:"last_modified"`     // RFC 3339 form of the Last-Modified header
+	ObservedAt   string `json:"observed_at"`       // RFC 3339 timestamp of the run that first saw the date
+} // End of documentUpdate struct
+
+// Submissions of one URL to public web archives
+type publicArchiveRecord struct { // Fields stored for each submitted URL
+	WaybackSubmitted string `json:"wayback_submitted,omitempty"` // RFC 3339 timestamp of the Wayback Machine submission
+	WaybackSnapshot  string `json:"wayback_snapshot,omitempty"`  // Snapshot URL, when archive.org reported one
+	WaybackJob       string `json:"wayback_job,omitempty"`       // Save Page Now job ID, for authenticated submissions
+
+	ArchiveTodaySubmitted string `json:"archive_today_submitted,omitempty"` // RFC 3339 timestamp of the archive.today submission
+	ArchiveTodaySnapshot  string `json:"archive_today_snapshot,omitempty"`  // Snapshot URL, or the in-progress URL it will appear at
+} // End of publicArchiveRecord struct
+
+// Bandwidth used by the archive's runs, for budgeting refreshes on metered connections
+type transferTotals struct { // Fields stored for the bandwidth account
+	TotalBytes   int64            `json:"total_bytes"`          // Response bytes received by every run
+	Runs         int              `json:"runs"`                 // Runs accounted for
+	LastRunBytes int64            `json:"last_run_bytes"`       // Response bytes received by the latest run
+	HostBytes    map[string]int64 `json:"host_bytes,omitempty"` // Response bytes received by every run, by host
+} // End of transferTotals struct
+
+// Firmware history of one product
+type firmwareTimeline struct { // Fields stored for each product's firmware timeline
+	LatestVersion string            `json:"latest_version"` // Newest firmware version known
+	LatestSeen    string            `json:"latest_seen"`    // When the newest firmware version was first downloaded
+	Releases      []firmwareRelease `json:"releases"`       // Every known firmware release, oldest version first
+} // End of firmwareTimeline struct
+
+// One product page and the specifications scraped from it
+type productRecord struct { // Fields stored for each product page
+	URL       string            `json:"url"`              // Product page URL
+	Name      string            `json:"name"`             // Canonical product name from JSON-LD, or the page heading when there is none
+	SKU       string            `json:"sku,omitempty"`    // Stock keeping unit from JSON-LD
+	Images    []string          `json:"images,omitempty"` // Product image URLs from JSON-LD
+	Specs     map[string]string `json:"specs"`            // Specification table rows (e.g. "Channels" → "16")
+	ScrapedAt string            `json:"scraped_at"`       // RFC 3339 timestamp of the last scrape
+} // End of productRecord struct
+
+// One firmware release in a product's timeline
+type firmwareRelease struct { // Fields stored for each firmware release
+	Version   string `json:"version"`    // Firmware version (e.g. "2.10.1")
+	URL       string `json:"url"`        // Where the release was downloaded from
+	FirstSeen string `json:"first_seen"` // When the release was first downloaded
+} // End of firmwareRelease struct
+
+// One downloaded file in the catalog
+type catalogEntry struct { // Fields stored for each cataloged file
+	URL               string        `json:"url"`                          // URL the file was downloaded from
+	Kind              string        `json:"kind,omitempty"`               // "manual" for PDFs, "firmware" for firmware packages or "software" for desktop software and drivers
+	Path              string        `json:"path"`                         // Where the file is stored, relative to the working directory
+	SHA256            string        `json:"sha256,omitempty"`             // Hex-encoded SHA-256 of the file as stored, after any -stamp-xmp or -linearize rewrite, with -hash=sha256
+	BLAKE3            string        `json:"blake3,omitempty"`             // Hex-encoded BLAKE3 of the file as stored, after any -stamp-xmp or -linearize rewrite, with -hash=blake3
+	Size              int64         `json:"size"`                         // File size in bytes, as stored
+	DownloadSize      int64         `json:"download_size,omitempty"`      // Bytes the server sent, when -stamp-xmp or -linearize rewrote the file afterwards
+	Product           string        `json:"product"`                      // Product key detected from the filename
+	Version           string        `json:"version,omitempty"`            // Manual revision (e.g. "1.4" or "Rev C")
+	VersionSource     string        `json:"version_source,omitempty"`     // Where the revision was found: "filename" or "first-page"
+	Language          string        `json:"language,omitempty"`           // ISO 639-1 language code detected from the URL
+	Encrypted         bool          `json:"encrypted,omitempty"`          // Whether the PDF is password-protected or DRM'd
+	ReuploadOf        string        `json:"reupload_of,omitempty"`        // URL of an earlier file with the same product and revision
+	SourcePage        string        `json:"source_page,omitempty"`        // Page the link was last found on
+	MirrorURL         string        `json:"mirror_url,omitempty"`         // Fallback mirror the file was actually downloaded from, when the URL itself failed
+	UpgradedFrom      string        `json:"upgraded_from,omitempty"`      // http:// link the page listed, when the file was downloaded over HTTPS instead
+	PublishedChecksum string        `json:"published_checksum,omitempty"` // Checksum the page listed next to the link, as "<algorithm>:<hex>" (e.g. "sha256:9f86…")
+	ChecksumStatus    string        `json:"checksum_status,omitempty"`    // "verified" when the download matched the published checksum; mismatches are quarantined instead
+	ETag              string        `json:"etag,omitempty"`               // ETag the server sent with the download
+	LastModified      string        `json:"last_modified,omitempty"`      // Last-Modified the server sent with the download
+	Changed           string        `json:"changed,omitempty"`            // Why -check-only thinks the file changed on the server; the next run downloads it again
+	Model             string        `json:"model,omitempty"`              // Radio or accessory family the file is for (e.g. "TX16S", "Modules")
+	ModelSource       string        `json:"model_source,omitempty"`       // Where the model was found: "url", "link-text", "page" or "content"
+	SharedWith        []string      `json:"shared_with,omitempty"`        // URLs of byte-identical files cataloged under other products, e.g. for hardware revisions
+	History           []fetchRecord `json:"history,omitempty"`            // Every download of the URL, oldest first, so content changes can be dated
+	FirstSeen         string        `json:"first_seen"`                   // RFC 3339 timestamp of the first download
+	LastSeen          string        `json:"last_seen"`                    // RFC 3339 timestamp of the last run that found the link
+	Modified          string        `json:"modified,omitempty"`           // RFC 3339 timestamp of the last save that changed the entry in any way; replicas sync what changed since their last sync
+} // End of catalogEntry struct
+
+// A link whose download failed in one or more consecutive runs
+type brokenLink struct { // Fields stored for each entry of broken-links.json
+	URL              string `json:"url"`                         // Link that fails to download
+	SourcePage       string `json:"source_page,omitempty"`       // Page the link was last found on
+	Failures         int    `json:"failures"`                    // Consecutive runs in which the download failed
+	LastStatus       int    `json:"last_status,omitempty"`       // HTTP status of the last failure, when the server answered with one
+	FirstFailed      string `json:"first_failed"`                // RFC 3339 timestamp of the first failure in the streak
+	LastFailed       string `json:"last_failed"`                 // RFC 3339 timestamp of the latest failure
+	QuarantinedUntil string `json:"quarantined_until,omitempty"` // RFC 3339 timestamp until which the link is skipped, once quarantined
+} // End of brokenLink struct
+
+var brokenLinks = make(map[string]*brokenLink) // Links failing across runs, keyed by URL
+
+// Loads the list of links failing across runs, starting empty if it does not exist yet
+func loadBrokenLinks(brokenLinksPath string) { // Function to read broken-links.json
+	brokenLinks = make(map[string]*brokenLink) // Start from an empty list so repeated runs do not mix state
+
+	listJSON, readError := os.ReadFile(brokenLinksPath) // Read the list
+	if readError != nil {                               // Check if the file could not be read
+		if !os.IsNotExist(readError) { // A missing list is normal until something fails
+			logError(readError) // Log any other read error
+		}
+		return // Keep the empty list
+	}
+	var storedLinks []*brokenLink                                                        // Entries as stored
+	if unmarshalError := json.Unmarshal(listJSON, &storedLinks); unmarshalError != nil { // Decode the list
+		logErrorf("Failed to parse %s %v", brokenLinksPath, unmarshalError) // Log the decoding error
+		return                                                              // Keep the empty list
+	}
+	for _, link := range storedLinks { // Index the entries by URL
+		brokenLinks[link.URL] = link // Store the entry
+	}
+} // End of loadBrokenLinks function
+
+// Writes the list of links failing across runs, sorted by URL, removing the file once nothing fails
+func saveBrokenLinks(brokenLinksPath string) { // Function to write broken-links.json
+	if len(brokenLinks) == 0 { // Check if every link works again
+		if removeError := removeArchiveFile(brokenLinksPath); removeError != nil && !os.IsNotExist(removeError) { // Remove the stale list
+			logError(removeError) // Log the removal error
+		}
+		return // Nothing to report
+	}
+	sortedLinks := make([]*brokenLink, 0, len(brokenLinks)) // Entries in a stable order
+	for _, link := range brokenLinks {                      // Collect every entry
+		sortedLinks = append(sortedLinks, link) // Keep the entry
+	}
+	sort.Slice(sortedLinks, func(first, second int) bool { return sortedLinks[first].URL < sortedLinks[second].URL }) // Sort by URL
+
+	listJSON, marshalError := json.MarshalIndent(sortedLinks, "", "  ") // Encode the list as indented JSON
+	if marshalError != nil {                                            // Check if encoding failed
+		logError(marshalError) // Log the encoding error
+		return                 // Nothing to write
+	}
+	if writeError := writeArchiveFile(brokenLinksPath, append(listJSON, '\n'), 0o644); writeError != nil { // Save the list
+		logErrorf("Failed to write %s %v", brokenLinksPath, writeError) // Log the write failure
+	}
+} // End of saveBrokenLinks function
+
+// Reports whether a link is quarantined: it failed in -quarantine-after consecutive runs and is not due for a re-check
+func isQuarantined(link string) bool { // Function to check the quarantine
+	entry, found := brokenLinks[link]                                         // Look the link up
+	if !found || *quarantineAfter <= 0 || entry.Failures < *quarantineAfter { // Only links failing often enough
+		return false // The link is tried
+	}
+	quarantinedUntil, parseError := time.Parse(time.RFC3339, entry.QuarantinedUntil) // When the link is due for a re-check
+	return parseError == nil && time.Now().Before(quarantinedUntil)                  // Skip it until then
+} // End of isQuarantined function
+
+// Records whether a link tried this run succeeded: successes leave the list, failures extend the link's streak and
+// quarantine it once the streak reaches -quarantine-after
+func recordLinkOutcome(link string, sourcePage string, succeeded bool) { // Function to track failures across runs
+	if succeeded { // A working link is no longer broken
+		if _, found := brokenLinks[link]; found { // Check if it had been failing
+			log.Printf("Previously failing link works again: %s", link) // Log the recovery
+			delete(brokenLinks, link)                                   // Forget the failures
+		}
+		return
+	}
+
+	now := time.Now().UTC()           // When the failure was recorded
+	entry, found := brokenLinks[link] // Look the link up
+	if !found {                       // First failure of a streak
+		entry = &brokenLink{URL: link, FirstFailed: now.Format(time.RFC3339)} // Start the streak
+		brokenLinks[link] = entry                                             // Store the entry
+	}
+	entry.SourcePage = sourcePage                                   // Remember where the link was found
+	entry.Failures++                                                // Extend the streak
+	entry.LastFailed = now.Format(time.RFC3339)                     // Record the failure
+	downloadStatuses.Lock()                                         // Lock the statuses
+	entry.LastStatus = downloadStatuses.statuses[link]              // Why the download failed, if the server said
+	downloadStatuses.Unlock()                                       // Unlock
+	if *quarantineAfter > 0 && entry.Failures >= *quarantineAfter { // Check if the streak is long enough
+		entry.QuarantinedUntil = now.Add(*quarantineRecheck).Format(time.RFC3339)                                                 // Skip the link until the next re-check
+		logWarningf("Quarantining %s after %d failed runs; next re-check after %s", link, entry.Failures, entry.QuarantinedUntil) // Log the quarantine
+	}
+} // End of recordLinkOutcome function
+
+// Loads the catalog from disk, starting empty if it does not exist yet
+func loadCatalog(catalogPath string) { // Function to read the catalog
+	archiveCatalog = &catalog{Entries: make(map[string]*catalogEntry)} // Start from an empty catalog so repeated runs do not mix state
+	loadedEntryFingerprints = make(map[string]string)                  // Nothing loaded yet
+
+	catalogJSON, readError := os.ReadFile(catalogPath) // Read the catalog file
+	if readError != nil {                              // Check if the file could not be read
+		if !os.IsNotExist(readError) { // A missing catalog is normal on the first run
+			logError(readError) // Log any other read error
+		}
+		return // Keep the empty catalog
+	}
+
+	if unmarshalError := json.Unmarshal(catalogJSON, archiveCatalog); unmarshalError != nil { // Decode the catalog
+		logErrorf("Failed to parse catalog %s %v", catalogPath, unmarshalError) // Log the decoding error
+	}
+	if archiveCatalog.Entries == nil { // Guard against an empty "entries" value
+		archiveCatalog.Entries = make(map[string]*catalogEntry) // Start with an empty map
+	}
+	loadedEntryFingerprints = entryFingerprints()         // Remember the entries as stored, before any key is migrated
+	for entryURL, entry := range archiveCatalog.Entries { // Older catalogs keyed files with tracking and cache-busting parameters
+		if canonicalURL := canonicalLinkURL(entryURL); canonicalURL != entryURL { // Check if the key needs canonicalizing
+			delete(archiveCatalog.Entries, entryURL)                      // Drop the old key
+			if _, found := archiveCatalog.Entries[canonicalURL]; !found { // Keep an entry already stored under the canonical key
+				entry.URL = canonicalURL                     // Update the entry's URL
+				archiveCatalog.Entries[canonicalURL] = entry // Store it under the canonical key
+			}
+		}
+	}
+} // End of loadCatalog function
+
+// Writes the catalog to disk as indented JSON
+func saveCatalog(catalogPath string) { // Function to persist the catalog
+	rebuildFirmwareTimeline()       // Refresh the derived firmware timeline before writing
+	rebuildCrossProductDuplicates() // Link files that several products share
+	stampCatalogChanges()           // Date what changed, last, so the derived fields count too
+
+	catalogJSON, marshalError := json.MarshalIndent(archiveCatalog, "", "  ") // Encode the catalog as indented JSON
+	if marshalError != nil {                                                  // Check if encoding failed
+		logError(marshalError) // Log the encoding error
+		return                 // Nothing to write
+	}
+
+	if writeError := writeArchiveFile(catalogPath, append(catalogJSON, '\n'), 0o644); writeError != nil { // Save the catalog
+		logErrorf("Failed to write catalog %s %v", catalogPath, writeError) // Log the write failure
+	}
+} // End of saveCatalog function
+
+// Returns each catalog entry's JSON without its modification time, by URL, for noticing changes of any field
+func entryFingerprints() map[string]string { // Function to capture the entries' state
+	fingerprints := make(map[string]string, len(archiveCatalog.Entries)) // Fingerprints by URL
+	for entryURL, entry := range archiveCatalog.Entries {                // Capture each entry
+		unstamped := *entry                        // Copy the entry
+		unstamped.Modified = ""                    // Its date is not part of its content
+		entryJSON, _ := json.Marshal(unstamped)    // Entries always encode
+		fingerprints[entryURL] = string(entryJSON) // Remember the encoding
+	}
+	return fingerprints // Return the fingerprints
+} // End of entryFingerprints function
+
+// Dates every entry that is new or changed since the catalog was loaded or last saved, and records when each entry that
+// left the catalog was found gone, which is what replicas sync from
+func stampCatalogChanges() { // Function to date catalog mutations
+	now := time.Now().UTC().Format(time.RFC3339)          // When the changes are saved
+	currentFingerprints := entryFingerprints()            // The entries as they are now
+	for entryURL, entry := range archiveCatalog.Entries { // Date the changed entries
+		if loadedFingerprint, found := loadedEntryFingerprints[entryURL]; !found || entry.Modified == "" || loadedFingerprint != currentFingerprints[entryURL] { // New, undated or changed
+			entry.Modified = now // Date the change
+		}
+		delete(archiveCatalog.Removed, entryURL) // Entries that came back are no longer removed
+	}
+	for entryURL := range loadedEntryFingerprints { // Record the entries that left
+		if _, found := archiveCatalog.Entries[entryURL]; found { // Check if the entry is still there
+			continue // Not removed
+		}
+		if archiveCatalog.Removed == nil { // Create the tombstones on first use
+			archiveCatalog.Removed = make(map[string]string) // Tombstones by URL
+		}
+		archiveCatalog.Removed[entryURL] = now // Record the removal
+	}
+	loadedEntryFingerprints = currentFingerprints // Later saves compare against this one
+} // End of stampCatalogChanges function
+
+// Adds a freshly downloaded file to the catalog, deciding whether it is a new edition or a re-upload of a known
+// revision. Downloading a cataloged URL again only updates its entry: editions are told apart by their URL.
+func recordCatalogEntry(newEntry *catalogEntry) { // Function to catalog a download
+	if previous, found := archiveCatalog.Entries[newEntry.URL]; found { // A changed file re-fetched under its known URL
+		newEntry.ReuploadOf = previous.ReuploadOf // Keep what its first download established
+		storeCatalogEntry(newEntry, previous)     // Update the entry without announcing it again
+		return                                    // Neither a new edition nor a new manual
+	}
+	for _, existing := range archiveCatalog.Entries { // Compare against every cataloged file
+		if existing.Product != newEntry.Product { // Only other files of the same product matter
+			continue // Skip unrelated entries
+		}
+		if newEntry.Version != "" && existing.Version != "" && compareManualVersions(newEntry.Version, existing.Version) == 0 { // Same product and same revision
+			newEntry.ReuploadOf = existing.URL   // Link the re-upload to the earlier file
+			if sameContent(existing, newEntry) { // Check if the bytes are identical too
+				log.Printf("Re-upload of %s %s under a new URL (identical content): %s", newEntry.Product, newEntry.Version, newEntry.URL) // Log the identical re-upload
+			} else {
+				log.Printf("Re-upload of %s %s with changed content but the same revision: %s", newEntry.Product, newEntry.Version, newEntry.URL) // Log the silent revision change
+			}
+			break // One match is enough
+		}
+	}
+
+	if newEntry.ReuploadOf == "" && newEntry.Version != "" { // Anything with a revision that is not a re-upload is a new edition
+		log.Printf("New edition of %s: %s (%s)", newEntry.Product, newEntry.Version, newEntry.URL) // Log the new edition
+	}
+	if newEntry.Kind == "manual" && newEntry.ReuploadOf == "" { // Every manual that is not a re-upload is new to the archive
+		emitEvent("new_manual_found", map[string]any{"url": newEntry.URL, "path": newEntry.Path, "product": newEntry.Product, "version": newEntry.Version}) // Notify the webhook
+	}
+	storeCatalogEntry(newEntry, nil) // Catalog the new file
+} // End of recordCatalogEntry function
+
+// Stores a download's catalog entry, carrying over the download history of the entry it replaces, if any
+func storeCatalogEntry(newEntry *catalogEntry, previous *catalogEntry) { // Function to store a catalog entry
+	if previous != nil { // Keep the URL's download history
+		newEntry.History = previous.History // Earlier downloads
+		if len(newEntry.History) == 0 {     // Catalogs from before the history only know the last download
+			newEntry.History = []fetchRecord{{FetchedAt: previous.FirstSeen, SHA256: previous.SHA256, BLAKE3: previous.BLAKE3, Size: previous.Size}} // Start from it
+		}
+	}
+	newEntry.History = append(newEntry.History, fetchRecord{FetchedAt: newEntry.FirstSeen, SHA256: newEntry.SHA256, BLAKE3: newEntry.BLAKE3, Size: newEntry.Size}) // Record this download
+	archiveCatalog.Entries[newEntry.URL] = newEntry                                                                                                                // Store the entry
+	recordLastModified(newEntry, newEntry.LastModified)                                                                                                            // Date the update on the product's timeline
+} // End of storeCatalogEntry function
+
+// Adds a Last-Modified header seen for a cataloged file to its product's update timeline, unless that date is
+// already recorded for the file
+func recordLastModified(entry *catalogEntry, lastModifiedHeader string) { // Function to extend the update timeline
+	modifiedTime, parseError := http.ParseTime(lastModifiedHeader) // Servers send HTTP dates
+	if parseError != nil {                                         // Check if the header is missing or malformed
+		return // Nothing to date
+	}
+	lastModified := modifiedTime.UTC().Format(time.RFC3339) // Comparable, sortable form
+	if archiveCatalog.UpdateTimeline == nil {               // Create the timeline on first use
+		archiveCatalog.UpdateTimeline = make(map[string][]*documentUpdate) // Timelines keyed by product
+	}
+	productUpdates := archiveCatalog.UpdateTimeline[entry.Product] // The product's updates so far
+	for _, update := range productUpdates {                        // Check whether the date is known
+		if update.URL == entry.URL && update.LastModified == lastModified { // Same file, same modification
+			return // Already on the timeline
+		}
+	}
+	productUpdates = append(productUpdates, &documentUpdate{URL: entry.URL, Kind: entry.Kind, Version: entry.Version, LastModified: lastModified, ObservedAt: time.Now().UTC().Format(time.RFC3339)}) // Add the update
+	sort.SliceStable(productUpdates, func(first, second int) bool {
+		return productUpdates[first].LastModified < productUpdates[second].LastModified
+	}) // Oldest first
+	archiveCatalog.UpdateTimeline[entry.Product] = productUpdates // Store the timeline
+} // End of recordLastModified function
+
+var updateTimelineTemplate = template.Must(template.New("timeline").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>RadioMaster documentation updates</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 1.5rem; max-width: 70rem; }
+section { margin-bottom: 2.5rem; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .3rem .6rem; border-bottom: 1px solid #ddd; }
+</style>
+</head>
+<body>
+<h1>RadioMaster documentation updates</h1>
+<p>When each file last changed on the vendor's servers, from the Last-Modified dates seen by every run.{{with .Updated}} Updated {{.}}.{{end}}</p>
+{{range .Products}}<section>
+<h2>{{or .Product "Other files"}}</h2>
+<table>
+<tr><th>Modified</th><th>Kind</th><th>Version</th><th>File</th><th>First seen</th></tr>
+{{range .Updates}}<tr><td>{{.LastModified}}</td><td>{{.Kind}}</td><td>{{.Version}}</td><td><a href="{{.URL}}">{{.URL}}</a></td><td>{{.ObservedAt}}</td></tr>
+{{end}}</table>
+</section>
+{{end}}</body>
+</html>
+`))
+
+// Writes the update timeline as JSON and as an HTML page, newest updates first, into the output directory
+func writeUpdateTimeline(outputDirectory string) { // Function to publish the update timeline
+	if len(archiveCatalog.UpdateTimeline) == 0 { // Check if any dates were seen
+		return // Nothing to publish
+	}
+	timelineJSON, marshalError := json.MarshalIndent(archiveCatalog.UpdateTimeline, "", "  ") // Encode the timeline as indented JSON
+	if marshalError != nil {                                                                  // Check if encoding failed
+		logError(marshalError) // Log the encoding error
+		return                 // Nothing to write
+	}
+	jsonPath := filepath.Join(outputDirectory, updateTimelineFilename+".json")                          // Where the JSON goes
+	if writeError := writeArchiveFile(jsonPath, append(timelineJSON, '\n'), 0o644); writeError != nil { // Save the JSON
+		logErrorf("Failed to write %s %v", jsonPath, writeError) // Log the write failure
+	}
+
+	type productSection struct { // One product's part of the page
+		Product string            // Product key
+		Updates []*documentUpdate // Its updates, newest first
+	}
+	var sections []productSection                                                     // Sections in a stable order
+	newestObservation := ""                                                           // When the newest update was seen, so unchanged timelines render identically
+	for _, product := range slices.Sorted(maps.Keys(archiveCatalog.UpdateTimeline)) { // Visit each product alphabetically
+		for _, update := range archiveCatalog.UpdateTimeline[product] { // Find the newest observation
+			newestObservation = max(newestObservation, update.ObservedAt) // RFC 3339 timestamps sort as text
+		}
+		newestFirst := slices.Clone(archiveCatalog.UpdateTimeline[product])                 // Leave the stored order alone
+		slices.Reverse(newestFirst)                                                         // Newest first
+		sections = append(sections, productSection{Product: product, Updates: newestFirst}) // Add the section
+	}
+	var pageHTML bytes.Buffer                                                // Rendered page
+	renderError := updateTimelineTemplate.Execute(&pageHTML, map[string]any{ // Render the page
+		"Updated":  strings.SplitN(newestObservation, "T", 2)[0], // Date the newest update was seen; empty omits the line
+		"Products": sections,                                     // Products to list
+	}) // End of template data
+	if renderError != nil { // Check if rendering failed
+		logError(renderError) // Log the error
+		return                // Nothing to write
+	}
+	htmlPath := filepath.Join(outputDirectory, updateTimelineFilename+".html")                // Where the page goes
+	if writeError := writeArchiveFile(htmlPath, pageHTML.Bytes(), 0o644); writeError != nil { // Save the page
+		logErrorf("Failed to write %s %v", htmlPath, writeError) // Log the write failure
+	}
+} // End of writeUpdateTimeline function
+
+// Writes every cataloged file's SHA-256 in sha256sum format, with the catalog's paths, so "sha256sum -c PDFs/SHA256SUMS"
+// verifies the archive from its root. Files hashed with BLAKE3 (-hash=blake3) are hashed again with SHA-256 here.
+func writeChecksums(checksumsPath string) { // Function to write SHA256SUMS
+	var checksumLines []string                     // One "<hash>  <path>" line per file
+	for _, entry := range archiveCatalog.Entries { // Visit every cataloged file
+		filePath := filepath.FromSlash(entry.Path) // Where the file is stored
+		if !fileExists(filePath) {                 // Check if the file was removed since
+			continue // Only list files that are present
+		}
+		sha256Hash := entry.SHA256 // Hash recorded at download time
+		if sha256Hash == "" {      // Check if the file was hashed with BLAKE3 instead
+			fileHash, hashError := sha256File(filePath) // Hash the file now
+			if hashError != nil {                       // Check if the file could not be read
+				logError(hashError) // Log the error
+				continue            // Leave the file out
+			}
+			sha256Hash = fileHash // Use the fresh hash
+		}
+		checksumLines = append(checksumLines, sha256Hash+"  "+entry.Path) // Two spaces mark binary-safe text mode for sha256sum
+	}
+	sort.Strings(checksumLines) // Stable order for diffs and signatures
+
+	var checksumData strings.Builder     // The file's contents
+	for _, line := range checksumLines { // Every line ends with a newline
+		checksumData.WriteString(line + "\n") // Add the line
+	}
+	if writeError := writeArchiveFile(checksumsPath, []byte(checksumData.String()), 0o644); writeError != nil { // Save the list
+		logErrorf("Failed to write %s %v", checksumsPath, writeError) // Log the write failure
+	}
+} // End of writeChecksums function
+
+// Returns the content hash fields (see -hash) and size of a file as stored, for files rewritten after their download
+func hashArchivedFile(filePath string) (string, string, int64, error) { // Function to hash a stored file
+	openedFile, openError := os.Open(filePath) // Open the file
+	if openError != nil {                      // Check if the file could not be opened
+		return "", "", 0, openError // Return the error
+	}
+	defer openedFile.Close() // Close the file when done
+
+	contentHasher := newContentHasher()                       // Hash with the archive's algorithm
+	fileSize, copyError := io.Copy(contentHasher, openedFile) // Hash the contents
+	if copyError != nil {                                     // Check if the file could not be read
+		return "", "", 0, copyError // Return the error
+	}
+	sha256Hash, blake3Hash := contentHashFields(hex.EncodeToString(contentHasher.Sum(nil))) // File the hash
+	return sha256Hash, blake3Hash, fileSize, nil                                            // Return the hash and size
+} // End of hashArchivedFile function
+
+// Returns the hex SHA-256 of a file's contents
+func sha256File(filePath string) (string, error) { // Function to hash a file
+	openedFile, openError := os.Open(filePath) // Open the file
+	if openError != nil {                      // Check if the file could not be opened
+		return "", openError // Return the error
+	}
+	defer openedFile.Close() // Close the file when done
+
+	fileHasher := sha256.New()                                             // SHA-256 regardless of -hash
+	if _, copyError := io.Copy(fileHasher, openedFile); copyError != nil { // Hash the contents
+		return "", copyError // Return the error
+	}
+	return hex.EncodeToString(fileHasher.Sum(nil)), nil // Return the hex digest
+} // End of sha256File function
+
+// Signs each file with -minisign-key ("<file>.minisig") and -gpg-key ("<file>.asc"), when set, so consumers of the
+// mirror can verify it was not tampered with
+func signArchiveFiles(filePaths ...string) { // Function to sign the manifest and checksums
+	for _, filePath := range filePaths { // Sign each file
+		if *minisignKey != "" { // Sign with minisign
+			signCommand := exec.Command("minisign", "-S", "-s", *minisignKey, "-m", filePath, "-x", filePath+".minisig") // Detached signature next to the file
+			if keyPassword := os.Getenv("MINISIGN_PASSWORD"); keyPassword != "" {                                        // Encrypted keys need their password
+				signCommand.Stdin = strings.NewReader(keyPassword + "\n") // minisign reads the password from stdin when it is not a terminal
+			}
+			signOutput, signError := signCommand.CombinedOutput()                            // Run minisign
+			recordAudit(auditEntry{Action: "write", Path: filePath + ".minisig"}, signError) // Audit the signature
+			if signError != nil {                                                            // Check if signing failed
+				logErrorf("Failed to sign %s with minisign %v: %s", filePath, signError, strings.TrimSpace(string(signOutput))) // Log the failure
+			}
+		}
+		if *gpgKey != "" { // Sign with GnuPG
+			signCommand := exec.Command("gpg", "--batch", "--yes", "--armor", "--local-user", *gpgKey, "--output", filePath+".asc", "--detach-sign", filePath) // Detached, armored signature next to the file
+			signOutput, signError := signCommand.CombinedOutput()                                                                                              // Run gpg
+			recordAudit(auditEntry{Action: "write", Path: filePath + ".asc"}, signError)                                                                       // Audit the signature
+			if signError != nil {                                                                                                                              // Check if signing failed
+				logErrorf("Failed to sign %s with gpg %v: %s", filePath, signError, strings.TrimSpace(string(signOutput))) // Log the failure
+			}
+		}
+	}
+} // End of signArchiveFiles function
+
+// Extracts the text of a PDF's first page using pdftotext, returning "" if it is unavailable
+func firstPageText(pdfPath string) string { // Function to read the first page of a PDF
+	pdftotextPath, lookupError := exec.LookPath("pdftotext") // Find pdftotext (poppler-utils) on the PATH
+	if lookupError != nil {                                  // Check if pdftotext is installed
+		return "" // First-page detection is optional
+	}
+
+	output, runError := exec.Command(pdftotextPath, "-f", "1", "-l", "1", "-layout", pdfPath, "-").Output() // Extract page one to stdout
+	if runError != nil {                                                                                    // Check if extraction failed
+		logErrorf("Failed to extract first page of %s %v", pdfPath, runError) // Log the failure
+		return ""                                                             // Return no text
+	}
+
+	return string(output) // Return the first page text
+} // End of firstPageText function
+
+// Extracts the text of every page of a PDF using pdftotext, one string per page, or nil if it is unavailable
+func pdfPageTexts(pdfPath string) []string { // Function to read a whole PDF
+	pdftotextPath, lookupError := exec.LookPath("pdftotext") // Find pdftotext (poppler-utils) on the PATH
+	if lookupError != nil {                                  // Check if pdftotext is installed
+		return nil // Text extraction is optional
+	}
+
+	output, runError := exec.Command(pdftotextPath, pdfPath, "-").Output() // Extract every page to stdout, in reading order
+	if runError != nil {                                                   // Check if extraction failed
+		logErrorf("Failed to extract text of %s %v", pdfPath, runError) // Log the failure
+		return nil                                                      // Return no text
+	}
+	return strings.Split(strings.TrimRight(string(output), "\f"), "\f") // pdftotext ends each page with a form feed
+} // End of pdfPageTexts function
+
+const translationChunkSize = 4000 // Most characters sent in one translation request, below common backend limits
+
+// Translates each cataloged manual that has no translation yet into every target language, writing Markdown with one
+// section per page next to the PDF (e.g. "tx16s.pdf" → "tx16s.de.md")
+func translateManuals(endpointURL string, targetLanguages []string) { // Function to translate the manuals
+	for _, entry := range archiveCatalog.Entries { // Consider every manual
+		if entry.Kind != "manual" || entry.Encrypted { // Only readable manuals have text
+			continue // Skip it
+		}
+		var pageTexts []string                           // Extracted once per manual, on first need
+		for _, targetLanguage := range targetLanguages { // Translate into each language
+			targetLanguage = strings.TrimSpace(targetLanguage)                                                         // Allow "de, fr"
+			translationPath := strings.TrimSuffix(entry.Path, filepath.Ext(entry.Path)) + "." + targetLanguage + ".md" // Next to the original
+			if targetLanguage == "" || targetLanguage == entry.Language || fileExists(translationPath) {               // Nothing to do
+				continue // Skip the language
+			}
+			if pageTexts == nil { // Extract the text on first need
+				if pageTexts = pdfPageTexts(entry.Path); pageTexts == nil { // Check if the text could not be extracted
+					break // Nothing to translate
+				}
+			}
+
+			var translation strings.Builder                                                                                                                                                                               // The translated document
+			fmt.Fprintf(&translation, "# %s (%s)\n\nMachine translation of [%s](%s).\n", filepath.Base(entry.Path), targetLanguage, filepath.Base(entry.Path), (&url.URL{Path: filepath.Base(entry.Path)}).EscapedPath()) // Title and source
+			translated := true                                                                                                                                                                                            // Whether every page was translated
+			for pageIndex, pageText := range pageTexts {                                                                                                                                                                  // Translate each page
+				translatedPage, translateError := translateText(endpointURL, pageText, entry.Language, targetLanguage) // Send the page to the backend
+				if translateError != nil {                                                                             // Check if the backend failed
+					logErrorf("Failed to translate %s into %s %v", entry.Path, targetLanguage, translateError) // Log the failure
+					translated = false                                                                         // Leave the language for the next run
+					break                                                                                      // Stop translating this language
+				}
+				fmt.Fprintf(&translation, "\n## Page %d\n\n%s\n", pageIndex+1, strings.TrimSpace(translatedPage)) // Add the page
+			}
+			if !translated { // Check if a page failed
+				continue // Try the next language
+			}
+			if writeError := writeArchiveFile(translationPath, []byte(translation.String()), 0o644); writeError != nil { // Save the translation
+				logErrorf("Failed to write translation %s %v", translationPath, writeError) // Log the write failure
+				continue                                                                    // Try the next language
+			}
+			log.Printf("Translated %s into %s → %s", entry.Path, targetLanguage, translationPath) // Log success message
+		}
+	}
+} // End of translateManuals function
+
+// Translates text through a LibreTranslate-compatible backend, in paragraph-aligned chunks small enough for one request
+func translateText(endpointURL string, text string, sourceLanguage string, targetLanguage string) (string, error) { // Function to call the translation backend
+	if sourceLanguage == "" { // The URL did not reveal the manual's language
+		sourceLanguage = "auto" // Let the backend detect it
+	}
+	var chunks []string                                          // Text split for the backend
+	var chunk strings.Builder                                    // Chunk being filled
+	for _, paragraph := range strings.SplitAfter(text, "\n\n") { // Keep paragraphs together
+		if chunk.Len() > 0 && chunk.Len()+len(paragraph) > translationChunkSize { // Check if the paragraph does not fit
+			chunks = append(chunks, chunk.String()) // Close the chunk
+			chunk.Reset()                           // Start the next one
+		}
+		chunk.WriteString(paragraph) // Add the paragraph; a single oversized paragraph is sent whole
+	}
+	if strings.TrimSpace(chunk.String()) != "" { // Keep the last chunk
+		chunks = append(chunks, chunk.String()) // Close it
+	}
+
+	httpClient := &http.Client{Timeout: 2 * time.Minute} // Translation can take a while
+	var translated strings.Builder                       // The translated text
+	for _, chunkText := range chunks {                   // Translate each chunk
+		requestBody, _ := json.Marshal(map[string]string{ // Encode the request; strings always encode
+			"q":       chunkText,                      // Text to translate
+			"source":  sourceLanguage,                 // Language of the manual
+			"target":  targetLanguage,                 // Language wanted
+			"format":  "text",                         // Plain text, not HTML
+			"api_key": os.Getenv("TRANSLATE_API_KEY"), // Key of hosted backends; ignored by open instances
+		})
+		translateResponse, postError := httpClient.Post(endpointURL, "application/json", bytes.NewReader(requestBody)) // Send the chunk
+		if postError != nil {                                                                                          // Check if the request failed
+			return "", postError // Return the error
+		}
+		var reply struct { // LibreTranslate reply
+			TranslatedText string `json:"translatedText"` // The translation
+			Error          string `json:"error"`          // Reason a request was refused
+		}
+		decodeError := json.NewDecoder(io.LimitReader(translateResponse.Body, 1<<20)).Decode(&reply) // Decode the reply
+		translateResponse.Body.Close()                                                               // Close the response body
+		if translateResponse.StatusCode != http.StatusOK {                                           // Check if the backend refused the chunk
+			return "", fmt.Errorf("%s: %s", translateResponse.Status, reply.Error) // Return the refusal
+		}
+		if decodeError != nil { // Check if the reply was not JSON
+			return "", decodeError // Return the error
+		}
+		translated.WriteString(reply.TranslatedText) // Add the translated chunk
+	}
+	return translated.String(), nil // The translated text
+} // End of translateText function
+
+var textRevisionPattern = regexp.MustCompile(`(?i)\brev(?:ision)?\.?\s*([A-Z]\b|\d+(?:\.\d+)*)`) // "Rev C" style revisions in free text
+
+var textVersionPattern = regexp.MustCompile(`(?i)\b(?:v|ver\.?|version)\s*(\d+(?:\.\d+)+)`) // "V1.4" style versions in free text
+
+// Finds a revision string such as "V1.4", "Version 2.0", or "Rev C" in free text
+func detectVersionInText(text string) string { // Function to detect a manual revision in text
+	revisionMatch := textRevisionPattern.FindStringSubmatch(text) // Look for "Rev C" style revisions
+	if revisionMatch != nil {                                     // Check if a "Rev" revision was found
+		return "Rev " + strings.ToUpper(revisionMatch[1]) // Return the lettered revision
+	}
+
+	versionMatch := textVersionPattern.FindStringSubmatch(text) // Look for "V1.4" style versions
+	if versionMatch != nil {                                    // Check if a numeric version was found
+		return versionMatch[1] // Return the dotted version
+	}
+
+	return "" // No revision found
+} // End of detectVersionInText function
+
+// Rebuilds the per-product firmware timeline from the cataloged firmware downloads
+func rebuildFirmwareTimeline() { // Function to derive firmware timelines from catalog entries
+	timelines := make(map[string]*firmwareTimeline) // Timelines keyed by product
+
+	for _, entry := range archiveCatalog.Entries { // Visit every cataloged file
+		if entry.Kind != "firmware" || entry.Version == "" { // Only versioned firmware belongs on a timeline
+			continue // Skip manuals and unversioned files
+		}
+		timeline, found := timelines[entry.Product] // Look up the product's timeline
+		if !found {                                 // Create it on first sight
+			timeline = &firmwareTimeline{}      // Start an empty timeline
+			timelines[entry.Product] = timeline // Remember it
+		}
+		timeline.Releases = append(timeline.Releases, firmwareRelease{Version: entry.Version, URL: entry.URL, FirstSeen: entry.FirstSeen}) // Add the release
+	}
+
+	for _, timeline := range timelines { // Order each timeline and find its newest release
+		sort.Slice(timeline.Releases, func(first, second int) bool { // Sort releases by version
+			return compareManualVersions(timeline.Releases[first].Version, timeline.Releases[second].Version) < 0 // Oldest version first
+		}) // End of release sort
+		newest := timeline.Releases[len(timeline.Releases)-1] // The last release is the newest
+		timeline.LatestVersion = newest.Version               // Record the newest version
+		timeline.LatestSeen = newest.FirstSeen                // Record when it appeared
+	}
+
+	archiveCatalog.FirmwareTimeline = timelines // Replace the stored timelines
+} // End of rebuildFirmwareTimeline function
+
+// Headings that introduce release notes or changelogs on product and firmware pages
+var releaseNoteHeading = regexp.MustCompile(`(?i)release\s*notes?|change\s*log|what'?s\s+new|update\s+log`)
+
+// Extracts release-note sections from the given HTML string as Markdown. A section starts at a heading
+// matching releaseNoteHeading and runs until the next heading of the same or a higher level.
+func extractReleaseNotes(htmlContent string) string { // Function to find release notes in a page
+	parsedHTML, parseError := html.Parse(strings.NewReader(htmlContent)) // Parse the input HTML content
+	if parseError != nil {                                               // Check if HTML parsing failed
+		logError(parseError) // Log the parsing error
+		return ""            // Return no notes since parsing failed
+	}
+
+	var sections []string // Markdown for each release-note section found
+
+	var exploreHTML func(*html.Node) // Define a recursive function to explore HTML nodes
+
+	exploreHTML = func(currentNode *html.Node) { // The implementation of the recursive traversal function
+		level := headingLevel(currentNode)                                      // Heading level of this node, or 0
+		if level > 0 && releaseNoteHeading.MatchString(nodeText(currentNode)) { // Check if this heading introduces release notes
+			var section strings.Builder                                                             // Markdown for this section
+			section.WriteString(nodeToMarkdown(currentNode))                                        // Start with the heading itself
+			for sibling := currentNode.NextSibling; sibling != nil; sibling = sibling.NextSibling { // Collect everything after the heading
+				if siblingLevel := headingLevel(sibling); siblingLevel > 0 && siblingLevel <= level { // Stop at the next heading of the same or higher level
+					break // The section is complete
+				}
+				section.WriteString(nodeToMarkdown(sibling)) // Add the sibling's content
+			}
+			sections = append(sections, strings.TrimSpace(section.String())) // Keep the finished section
+			return                                                           // The section's content has been consumed
+		}
+
+		for childNode := currentNode.FirstChild; childNode != nil; childNode = childNode.NextSibling { // Recursively traverse child nodes
+			exploreHTML(childNode)
+		}
+	}
+
+	exploreHTML(parsedHTML)               // Begin traversal from the root node
+	return strings.Join(sections, "\n\n") // Return all sections separated by blank lines
+} // End of extractReleaseNotes function
+
+// Returns 1–6 for <h1>–<h6> elements and 0 for anything else
+func headingLevel(node *html.Node) int { // Function to read a heading's level
+	if node.Type != html.ElementNode || len(node.Data) != 2 || node.Data[0] != 'h' || node.Data[1] < '1' || node.Data[1] > '6' { // Check for an <h1>–<h6> tag
+		return 0 // Not a heading
+	}
+	return int(node.Data[1] - '0') // Return the heading level
+} // End of headingLevel function
+
+// One entry of the model taxonomy
+type modelPattern struct { // Fields of a model
+	model   string         // Model name used in the catalog and as directory name
+	pattern *regexp.Regexp // Text that names the model
+} // End of modelPattern struct
+
+// Models downloads are classified into. Accessories come first, since their manuals usually name the radios they fit.
+var modelTaxonomy = []modelPattern{
+	{"Gimbals", regexp.MustCompile(`(?i)gimbal|(?:^|[^a-z0-9])ag0\d(?:[^a-z0-9]|$)|hall[\s_-]?sensor`)},                                           // Gimbals and gimbal kits
+	{"Modules", regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(?:modules?|ranger|nomad|bandit|4[\s_-]?in[\s_-]?1)(?:[^a-z0-9]|$)|multi[\s_-]?protocol`)}, // External RF modules
+	{"TX16S", regexp.MustCompile(`(?i)(?:^|[^a-z0-9])tx[\s_-]?16[\s_-]?s`)},                                                                       // TX16S and its Mark II
+	{"TX12", regexp.MustCompile(`(?i)(?:^|[^a-z0-9])tx[\s_-]?12`)},                                                                                // TX12 and its Mark II
+	{"MT12", regexp.MustCompile(`(?i)(?:^|[^a-z0-9])mt[\s_-]?12`)},                                                                                // MT12 surface radio
+	{"GX12", regexp.MustCompile(`(?i)(?:^|[^a-z0-9])gx[\s_-]?12`)},                                                                                // GX12
+	{"Zorro", regexp.MustCompile(`(?i)zorro`)},                                                                                                    // Zorro
+	{"Boxer", regexp.MustCompile(`(?i)boxer`)},                                                                                                    // Boxer
+	{"Pocket", regexp.MustCompile(`(?i)pocket`)},                                                                                                  // Pocket
+}
+
+// Returns the first model of the taxonomy the text names, or "" when it names none
+func classifyModelText(text string) string { // Function to classify text
+	for _, candidate := range modelTaxonomy { // Check each model in order
+		if candidate.pattern.MatchString(text) { // Check if the text names it
+			return candidate.model // The model
+		}
+	}
+	return "" // Unclassified
+} // End of classifyModelText function
+
+// Classifies a download from its URL, then the text of the link to it, then the heading of the page it was found on,
+// returning the model and where it was found
+func classifyDownload(fileURL string) (string, string) { // Function to classify a download before fetching it
+	if model := classifyModelText(urlToFilename(fileURL)); model != "" { // The filename usually names the model
+		return model, "url" // Found in the URL
+	}
+	downloadSourcePages.Lock()                                                     // Lock the record
+	sourcePage := downloadSourcePages.pages[fileURL]                               // Page the link was found on
+	downloadSourcePages.Unlock()                                                   // Unlock the record
+	if model := classifyModelText(linkTextFor(fileURL, sourcePage)); model != "" { // Link text such as "TX16S MKII User Manual"
+		return model, "link-text" // Found in the link text
+	}
+	var pageHeadings []string                                         // Headings of the source page
+	if product, found := archiveCatalog.Products[sourcePage]; found { // Product pages have a canonical name
+		pageHeadings = append(pageHeadings, product.Name) // The product name
+	}
+	pageMetadataMutex.Lock()                                    // Pages are recorded while other pages are scraped
+	if page, found := archiveCatalog.Pages[sourcePage]; found { // Scraped pages have a title
+		pageHeadings = append(pageHeadings, page.Title) // The page title
+	}
+	pageMetadataMutex.Unlock()                                                    // Unlock the pages
+	if model := classifyModelText(strings.Join(pageHeadings, " ")); model != "" { // Pages dedicated to one radio name it
+		return model, "page" // Found on the page
+	}
+	return "", "" // Unclassified until the content is read
+} // End of classifyDownload function
+
+// Classifies a manual from its first page, trusting the title lines at the top over the rest of the page, which often
+// lists compatible radios
+func classifyFirstPage(pageText string) string { // Function to classify a first page
+	var titleLines []string                              // The first lines with text
+	for _, line := range strings.Split(pageText, "\n") { // Walk the page from the top
+		if line = strings.TrimSpace(line); line != "" { // Skip blank lines
+			titleLines = append(titleLines, line) // Keep the line
+		}
+		if len(titleLines) == 5 { // The title fits in the first few lines
+			break // Enough
+		}
+	}
+	if model := classifyModelText(strings.Join(titleLines, " ")); model != "" { // Check the title first
+		return model // The model the title names
+	}
+	return classifyModelText(pageText) // Fall back to the whole page
+} // End of classifyFirstPage function
+
+// Returns the directory name of a model, with unclassified files kept together
+func modelDirectory(model string) string { // Function to name a model's directory
+	if model == "" { // Check if the file is unclassified
+		return "unclassified" // Files no signal names a model for
+	}
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(strings.ToLower(model)) // Lowercase like the filenames, and always one directory
+} // End of modelDirectory function
+
+// Link texts by href as found on the pages, guarded for parallel scraping
+var linkTexts = struct {
+	sync.Mutex                   // Guards texts
+	texts      map[string]string // Link text by raw href
+}{texts: make(map[string]string)}
+
+// Records the text of a link, falling back to its title attribute for links that wrap only an icon
+func recordLinkText(link string, anchorNode *html.Node) { // Function to remember a link's text
+	text := nodeText(anchorNode) // The visible text
+	if text == "" {              // Icon-only links
+		text = nodeAttribute(anchorNode, "title") // Their tooltip
+	}
+	if text == "" { // Nothing to remember
+		return // Skip it
+	}
+	linkTexts.Lock()             // Lock the texts
+	linkTexts.texts[link] = text // Remember the text
+	linkTexts.Unlock()           // Unlock the texts
+} // End of recordLinkText function
+
+// Returns the text of the link that led to a file, matching hrefs as resolved against the page the file was found on
+func linkTextFor(fileURL string, sourcePage string) string { // Function to find a file's link text
+	linkTexts.Lock()                                    // Lock the texts
+	defer linkTexts.Unlock()                            // Unlock when done
+	if text, found := linkTexts.texts[fileURL]; found { // Absolute links match directly
+		return text // The link text
+	}
+	if sourcePage == "" { // Relative links need the page to resolve against
+		return "" // Unknown
+	}
+	for link, text := range linkTexts.texts { // Resolve relative links against the source page
+		if resolvedLink := resolveLink(sourcePage, link); resolvedLink == fileURL || canonicalLinkURL(resolvedLink) == fileURL { // Check if the link leads to the file, canonical or not
+			return text // The link text
+		}
+	}
+	return "" // Unknown
+} // End of linkTextFor function
+
+// Checksums by link URL as listed next to the links on the pages, guarded for parallel scraping
+var publishedChecksums = struct {
+	sync.Mutex                   // Guards checksums
+	checksums  map[string]string // "<algorithm>:<hex>" by absolute link URL
+}{checksums: make(map[string]string)}
+
+// Labelled digests as pages print them, e.g. "SHA256: 9f86…", "SHA256SUM: 9f86…" or "MD5 checksum - d41d…"; digests
+// without an algorithm label are never taken, since their length alone does not say which algorithm made them
+var labelledChecksumPattern = regexp.MustCompile(`(?i)\b(md5|sha-?1|sha-?256|sha-?512)(?:sums?)?\b[^0-9a-z]{0,3}(?:checksum|hash|sum)?[^0-9a-z]{0,3}\b([0-9a-f]{32,128})\b`)
+
+// Digest lengths in hex characters, by algorithm
+var checksumLengths = map[string]int{"md5": 32, "sha1": 40, "sha256": 64, "sha512": 128}
+
+// Records the checksum a page prints next to a link: the nearest enclosing element (up to a few levels out) that holds
+// no other link is searched, so a digest is never attributed to the wrong file in a list of downloads
+func recordPublishedChecksum(link string, anchorNode *html.Node) { // Function to remember a link's published checksum
+	for containerNode, level := anchorNode.Parent, 0; containerNode != nil && level < 3; containerNode, level = containerNode.Parent, level+1 { // Walk outwards from the link
+		if countLinks(containerNode) > 1 { // Other links make the digest ambiguous
+			return // Give up rather than guess
+		}
+		if checksum := findPublishedChecksum(nodeText(containerNode)); checksum != "" { // Check if the container lists a digest
+			publishedChecksums.Lock()                     // Lock the checksums
+			publishedChecksums.checksums[link] = checksum // Remember the checksum
+			publishedChecksums.Unlock()                   // Unlock the checksums
+			return                                        // The nearest digest wins
+		}
+	}
+} // End of recordPublishedChecksum function
+
+// Counts the <a href> elements in a node and its descendants
+func countLinks(node *html.Node) int { // Function to count the links inside a node
+	links := 0                                                                                  // Links found so far
+	if node.Type == html.ElementNode && node.Data == "a" && nodeAttribute(node, "href") != "" { // Check if the node is a link
+		links++ // Count it
+	}
+	for childNode := node.FirstChild; childNode != nil; childNode = childNode.NextSibling { // Recursively visit child nodes
+		links += countLinks(childNode) // Count the links below
+	}
+	return links // Return the count
+} // End of countLinks function
+
+// Returns the strongest checksum in a text as "<algorithm>:<lowercase hex>", or "" when it lists none
+func findPublishedChecksum(text string) string { // Function to find a checksum in page text
+	found := make(map[string]string)                                                        // Digests by algorithm
+	for _, labelledMatch := range labelledChecksumPattern.FindAllStringSubmatch(text, -1) { // Digests with their algorithm named
+		algorithm := strings.ReplaceAll(strings.ToLower(labelledMatch[1]), "-", "") // "SHA-256" → "sha256"
+		if len(labelledMatch[2]) == checksumLengths[algorithm] {                    // The label must fit the digest
+			found[algorithm] = strings.ToLower(labelledMatch[2]) // Keep the digest
+		}
+	}
+	for _, algorithm := range []string{"sha512", "sha256", "sha1", "md5"} { // Strongest first
+		if digest, ok := found[algorithm]; ok { // Check if the page listed this one
+			return algorithm + ":" + digest // The checksum to verify against
+		}
+	}
+	return "" // No checksum listed
+} // End of findPublishedChecksum function
+
+// Returns the checksum a page listed for the link that led to a file, whether the file is known by the link or its
+// canonical form
+func publishedChecksumFor(fileURL string) string { // Function to find a file's published checksum
+	publishedChecksums.Lock()                                            // Lock the checksums
+	defer publishedChecksums.Unlock()                                    // Unlock when done
+	if checksum, found := publishedChecksums.checksums[fileURL]; found { // The link itself matches directly
+		return checksum // The published checksum
+	}
+	for link, checksum := range publishedChecksums.checksums { // Links with tracking parameters
+		if canonicalLinkURL(link) == fileURL { // Check if the link leads to the file
+			return checksum // The published checksum
+		}
+	}
+	return "" // Unknown
+} // End of publishedChecksumFor function
+
+// Returns the hex digest of data under one of the published checksum algorithms
+func checksumOf(algorithm string, data []byte) string { // Function to hash data like the vendor did
+	var hasher hash.Hash // The algorithm's hasher
+	switch algorithm {   // Pick the algorithm
+	case "md5":
+		hasher = md5.New() // MD5
+	case "sha1":
+		hasher = sha1.New() // SHA-1
+	case "sha512":
+		hasher = sha512.New() // SHA-512
+	default:
+		hasher = sha256.New() // SHA-256
+	}
+	hasher.Write(data)                         // Hash the data
+	return hex.EncodeToString(hasher.Sum(nil)) // Return the digest
+} // End of checksumOf function
+
+// Returns the whitespace-collapsed text content of a node and its descendants
+func nodeText(node *html.Node) string { // Function to read the text inside a node
+	var text strings.Builder // Collected text
+
+	var collectText func(*html.Node)             // Define a recursive function to gather text nodes
+	collectText = func(currentNode *html.Node) { // The implementation of the recursive text collector
+		if currentNode.Type == html.TextNode { // Check if this is a text node
+			text.WriteString(currentNode.Data + " ") // Keep its text, separated from its neighbours
+		}
+		for childNode := currentNode.FirstChild; childNode != nil; childNode = childNode.NextSibling { // Recursively visit child nodes
+			collectText(childNode)
+		}
+	}
+	collectText(node) // Start with the given node
+
+	return strings.Join(strings.Fields(text.String()), " ") // Collapse runs of whitespace
+} // End of nodeText function
+
+// Converts a node into simple Markdown: headings, list items, and paragraphs
+func nodeToMarkdown(node *html.Node) string { // Function to render a node as Markdown
+	switch { // Pick the rendering for this node
+	case node.Type == html.TextNode: // Loose text between elements
+		if text := strings.Join(strings.Fields(node.Data), " "); text != "" { // Check if the text has content
+			return text + "\n\n" // Render it as its own paragraph
+		}
+		return "" // Ignore whitespace-only text
+	case node.Type != html.ElementNode: // Comments, doctypes, and the like
+		return "" // Nothing to render
+	case headingLevel(node) > 0: // <h1>–<h6>
+		return strings.Repeat("#", headingLevel(node)) + " " + nodeText(node) + "\n\n" // Render a Markdown heading
+	case node.Data == "li": // List items
+		return "- " + nodeText(node) + "\n" // Render a bullet
+	case node.Data == "p": // Paragraphs
+		if text := nodeText(node); text != "" { // Check if the paragraph has content
+			return text + "\n\n" // Render the paragraph
+		}
+		return "" // Ignore empty paragraphs
+	case node.Data == "script" || node.Data == "style": // Never render code or styles
+		return "" // Nothing to render
+	}
+
+	var markdown strings.Builder                                                            // Markdown of the node's children
+	for childNode := node.FirstChild; childNode != nil; childNode = childNode.NextSibling { // Render each child in turn
+		markdown.WriteString(nodeToMarkdown(childNode)) // Add the child's Markdown
+	}
+	if node.Data == "ul" || node.Data == "ol" { // Lists end with a blank line
+		markdown.WriteString("\n") // Separate the list from what follows
+	}
+	return markdown.String() // Return the children's Markdown
+} // End of nodeToMarkdown function
+
+// Saves release notes scraped from a page as "<page>_release_notes.md" in the firmware directory, rewriting it only when the notes change
+func saveReleaseNotes(pageURL string, releaseNotes string, firmwareDirectory string) { // Function to store release notes
+	if !directoryExists(firmwareDirectory) { // Check if the firmware directory exists yet
+		createDirectory(firmwareDirectory, 0o755) // Create the directory with full read, write, and execute permissions (rwxr-xr-x)
+	}
+
+	pageName := strings.TrimSuffix(urlToFilename(pageURL), getFileExtension(urlToFilename(pageURL))) // Sanitized page name without extension
+	notesPath := filepath.Join(firmwareDirectory, pageName+"_release_notes.md")                      // Where the notes are stored
+	notesMarkdown := "<!-- Source: " + pageURL + " -->\n\n" + releaseNotes + "\n"                    // Record the source page above the notes
+
+	if existingNotes, readError := os.ReadFile(notesPath); readError == nil && string(existingNotes) == notesMarkdown { // Check if the notes are unchanged
+		return // Nothing to update
+	}
+	if writeError := writeArchiveFile(notesPath, []byte(notesMarkdown), 0o644); writeError != nil { // Save the notes
+		logErrorf("Failed to write release notes for %s %v", pageURL, writeError) // Log the write failure
+		return                                                                    // Nothing else to do
+	}
+	log.Printf("Saved release notes: %s → %s", pageURL, notesPath) // Log success message
+} // End of saveReleaseNotes function
+
+// Words in a blog post that suggest it announces new firmware or documentation
+var updateAnnouncement = regexp.MustCompile(`(?i)\b(?:firmware|manuals?|user\s+guides?|quick\s+start)\b`)
+
+// Archives every blog post linked from the listing page that has not been archived yet. Each post is saved as an
+// HTML snapshot in blogDirectory; PDF and firmware links found in the posts are returned for downloading, together
+// with the posts whose text mentions firmware or manual updates.
+func archiveBlogPosts(listingURL string, blogDirectory string) ([]string, []string, []string) { // Function to archive the blog
+	listingHTML := scrapePage(listingURL) // Render the blog listing
+	if listingHTML == "" {                // Check if the listing could not be scraped
+		return nil, nil, nil // Nothing to archive
+	}
+	if !directoryExists(blogDirectory) { // Check if the blog directory exists yet
+		createDirectory(blogDirectory, 0o755) // Create the directory with full read, write, and execute permissions (rwxr-xr-x)
+	}
+
+	listingPath := mustParseURL(listingURL).Path                                // Path prefix shared by every post (e.g. "/blogs/news")
+	postLinks := extractLinks(listingURL, listingHTML, func(link string) bool { // Find links to individual posts
+		return strings.Contains(link, listingPath+"/") && !strings.Contains(link, "/tagged/") // Posts live below the listing path; tag filters do not
+	}) // End of post link extraction
+
+	var pdfUrls, firmwareUrls, flaggedPosts []string // Attachments and flagged posts across every post
+
+	for _, postLink := range removeDuplicatesFromSlice(postLinks) { // Visit each unique post
+		postURL := resolveLink(listingURL, postLink)                                 // Turn relative post links into absolute URLs
+		snapshotPath := filepath.Join(blogDirectory, urlToFilename(postURL)+".html") // Where the snapshot is stored
+		if fileExists(snapshotPath) {                                                // Skip posts archived in earlier runs
+			continue // Move on to the next post
+		}
+
+		postHTML := scrapePage(postURL) // Render the post
+		if postHTML == "" {             // Check if the post could not be scraped
+			continue // Try again next run
+		}
+		if writeError := writeArchiveFile(snapshotPath, []byte(postHTML), 0o644); writeError != nil { // Save the HTML snapshot
+			logErrorf("Failed to write blog snapshot for %s %v", postURL, writeError) // Log the write failure
+			continue                                                                  // Move on to the next post
+		}
+		log.Printf("Archived blog post: %s → %s", postURL, snapshotPath) // Log success message
+
+		for _, link := range extractPDFUrls(postURL, postHTML) { // Collect PDFs attached to the post
+			pdfUrls = append(pdfUrls, resolveLink(postURL, link)) // Queue the absolute PDF URL
+		}
+		for _, link := range extractFirmwareUrls(postURL, postHTML) { // Collect firmware attached to the post
+			firmwareUrls = append(firmwareUrls, resolveLink(postURL, link)) // Queue the absolute firmware URL
+		}
+
+		parsedPost, parseError := html.Parse(strings.NewReader(postHTML))              // Parse the post to read its text
+		if parseError == nil && updateAnnouncement.MatchString(nodeText(parsedPost)) { // Check if the post talks about firmware or manuals
+			flaggedPosts = append(flaggedPosts, postURL) // Flag the post for the run report
+		}
+	}
+
+	return pdfUrls, firmwareUrls, flaggedPosts // Return the attachments and flagged posts
+} // End of archiveBlogPosts function
+
+// Resolves a possibly relative link against the URL of the page it was found on
+func resolveLink(pageURL string, link string) string { // Function to turn links into absolute URLs
+	baseURL, baseError := url.Parse(pageURL) // Parse the page URL
+	if baseError != nil {                    // Check if the page URL is invalid
+		return link // Return the link unchanged
+	}
+	linkURL, linkError := url.Parse(link) // Parse the link
+	if linkError != nil {                 // Check if the link is invalid
+		return link // Return the link unchanged
+	}
+	return baseURL.ResolveReference(linkURL).String() // Return the absolute URL
+} // End of resolveLink function
+
+// Parses a URL that is known to be valid, such as a constant
+func mustParseURL(rawURL string) *url.URL { // Function to parse trusted URLs
+	parsedURL, parseError := url.Parse(rawURL) // Parse the URL
+	if parseError != nil {                     // Check if parsing failed
+		logFatal(parseError) // A broken constant is a programming error
+	}
+	return parsedURL // Return the parsed URL
+} // End of mustParseURL function
+
+// Script clicking every tab-like control whose label mentions downloads, support, manuals, or firmware.
+// Product pages render these tabs client-side, so their links only enter the DOM once the tab is opened.
+const clickDownloadTabsScript = `(() => {
+	const labels = /download|support|manual|firmware|resources/i;
+	const controls = document.querySelectorAll('[role="tab"], button, summary, a[href^="#"], .tab, .tabs li, [data-tab]');
+	let clicked = 0;
+	for (const control of controls) {
+		if (labels.test(control.textContent || '') && (control.textContent || '').trim().length < 40) {
+			control.click();
+			clicked++;
+		}
+	}
+	return clicked;
+})()`
+
+// Script that scrolls to the bottom of the page and returns the page height
+const scrollToBottomScript = `(() => {
+	window.scrollTo(0, document.documentElement.scrollHeight);
+	return document.documentElement.scrollHeight;
+})()`
+
+const maxScrollSteps = 20 // Most scroll steps per page, so infinite feeds cannot hold a scrape forever
+
+// Builds the Chrome action that scrolls to the bottom repeatedly, waiting after each step, until the page stops growing
+func scrollToBottom() chromedp.Action { // Function to trigger lazy loading
+	return chromedp.ActionFunc(func(browserContext context.Context) error { // Run the scrolling as one action
+		previousHeight := -1                                             // Page height after the previous step
+		for scrollStep := 0; scrollStep < maxScrollSteps; scrollStep++ { // Scroll in steps
+			var pageHeight int                                                                                                  // Page height after this step
+			if evaluateError := chromedp.Evaluate(scrollToBottomScript, &pageHeight).Do(browserContext); evaluateError != nil { // Scroll to the bottom
+				logError(evaluateError) // Log the script failure
+				return nil              // Capture the page as it is rather than failing the scrape
+			}
+			if pageHeight == previousHeight { // Nothing new was loaded by the last step
+				break // The page is fully loaded
+			}
+			previousHeight = pageHeight                                                          // Remember the height
+			if sleepError := chromedp.Sleep(time.Second).Do(browserContext); sleepError != nil { // Give lazy content time to load
+				return sleepError // The browser was stopped
+			}
+		}
+		return chromedp.Evaluate(`window.scrollTo(0, 0)`, nil).Do(browserContext) // Return to the top so tab clicks behave as usual
+	}) // End of scrolling action
+} // End of scrollToBottom function
+
+// Held while an operator solves a challenge, so other page scrapes wait at the gate in scrapePageAttempt and only one
+// challenge is presented at a time
+var operatorPause sync.RWMutex
+
+// Builds the Chrome action that, when the page is a challenge or block page, enlarges the window, asks the operator to
+// solve the challenge there, and polls until the page no longer looks like one and shows waitFor (when set), or until
+// the timeout passes; the page is then captured as usual, and still counts as blocked if the challenge remains.
+// pageStatus points at the HTTP status the page was served with, known once the action runs, and is updated to the
+// status of the document showing at the end.
+func awaitChallengeSolved(pageURL string, waitFor string, timeout time.Duration, pageStatus *int) chromedp.Action { // Function to hand a challenge to the operator
+	pageReady := func(browserContext context.Context) (string, error) { // Returns the page's challenge marker, or "" once the content is there
+		var pageHTML string                                                                          // Current page
+		if htmlError := chromedp.OuterHTML("html", &pageHTML).Do(browserContext); htmlError != nil { // Capture the page
+			return "", htmlError // The browser was stopped
+		}
+		var documentStatus int                                                                                                                                                  // Status of the document now showing, which changes once the challenge lets the browser through
+		if evaluateError := chromedp.Evaluate(`performance.getEntriesByType("navigation")[0]?.responseStatus ?? 0`, &documentStatus).Do(browserContext); evaluateError != nil { // Read it from the navigation timing
+			return "", evaluateError // The browser was stopped
+		}
+		if documentStatus > 0 { // Older browsers do not report it
+			*pageStatus = documentStatus // Judge the page, and the final capture, by the current document
+		}
+		if marker := blockMarkerIn(pageHTML, *pageStatus); marker != "" { // Check if the challenge is still showing
+			return marker, nil // Not yet
+		}
+		if waitFor != "" { // The source names the element the real page has
+			var contentShown bool                                                                                                                                 // Whether the element exists
+			if evaluateError := chromedp.Evaluate(fmt.Sprintf("!!document.querySelector(%q)", waitFor), &contentShown).Do(browserContext); evaluateError != nil { // Look for it
+				return "", evaluateError // The browser was stopped
+			}
+			if !contentShown { // The page is still loading after the challenge
+				return "waiting for " + waitFor, nil // Not yet
+			}
+		}
+		return "", nil // The content is there
+	} // End of readiness check
+
+	return chromedp.ActionFunc(func(browserContext context.Context) error { // Run the hand-off as one action
+		marker, readyError := pageReady(browserContext) // Check the page as loaded
+		if readyError != nil || marker == "" {          // Check if there is anything to solve
+			return readyError // Carry on with the scrape
+		}
+
+		operatorPause.Lock()                                                                                 // Pause other page scrapes and queue behind other challenges
+		defer operatorPause.Unlock()                                                                         // Resume them when done
+		if windowID, _, windowError := browser.GetWindowForTarget().Do(browserContext); windowError == nil { // Find the tab's window
+			browser.SetWindowBounds(windowID, &browser.Bounds{WindowState: browser.WindowStateNormal}).Do(browserContext) // Restore it first; the state cannot change with the size
+			browser.SetWindowBounds(windowID, &browser.Bounds{Width: 1280, Height: 900}).Do(browserContext)               // Make it large enough to work in
+		}
+		logWarningf("%s shows an interactive challenge (%s): solve it in the Chrome window; waiting up to %s", pageURL, marker, timeout) // Ask the operator
+		emitEvent("challenge_waiting", map[string]any{"url": pageURL, "marker": marker, "timeout": timeout.String()})                    // Notify listeners, e.g. to page someone
+
+		deadline := time.Now().Add(timeout) // When to give up
+		for time.Now().Before(deadline) {   // Poll until solved or out of time
+			if sleepError := chromedp.Sleep(2 * time.Second).Do(browserContext); sleepError != nil { // Give the operator time
+				return sleepError // The browser was stopped
+			}
+			if marker, readyError = pageReady(browserContext); readyError != nil { // Check the page again
+				return readyError // The browser was stopped
+			}
+			if marker == "" { // The real page is showing
+				log.Printf("Challenge on %s solved; continuing", pageURL) // Report it
+				return nil                                                // Carry on with the scrape
+			}
+		}
+		logErrorf("Nobody solved the challenge on %s within %s", pageURL, timeout) // Report the timeout
+		return nil                                                                 // Capture the page; it is then treated as blocked
+	}) // End of hand-off action
+} // End of awaitChallengeSolved function
+
+// Returns a random duration between half of maxDelay and maxDelay, so pauses vary without ever being instant
+func jitterDuration(maxDelay time.Duration) time.Duration { // Function to randomize a delay
+	halfDelay := int64(maxDelay / 2) // The fixed part of the pause
+	if halfDelay <= 0 {              // Check if there is anything to randomize
+		return maxDelay // Too short to split
+	}
+	randomPart, randomError := rand.Int(rand.Reader, big.NewInt(halfDelay)) // The random part of the pause
+	if randomError != nil {                                                 // The system's random source failed
+		return maxDelay // Fall back to the longest pause
+	}
+	return time.Duration(halfDelay + randomPart.Int64()) // Combine both parts
+} // End of jitterDuration function
+
+// Returns a random integer in [0, limit)
+func randomBelow(limit int64) int64 { // Function to pick random coordinates and distances
+	if limit <= 0 { // Check if there is a range to pick from
+		return 0 // Nothing to pick
+	}
+	randomValue, randomError := rand.Int(rand.Reader, big.NewInt(limit)) // Pick the value
+	if randomError != nil {                                              // The system's random source failed
+		return limit / 2 // Fall back to the middle
+	}
+	return randomValue.Int64() // Return the value
+} // End of randomBelow function
+
+// Builds the Chrome action that moves the mouse along short paths to random points of the window and scrolls by
+// small random amounts, pausing for up to maxDelay between steps
+func simulateHumanActivity(steps int, maxDelay time.Duration) chromedp.Action { // Function to imitate a reader
+	return chromedp.ActionFunc(func(browserContext context.Context) error { // Run the activity as one action
+		var viewport struct{ Width, Height int64 }                                                                                                // Size of the visible area
+		if evaluateError := chromedp.Evaluate(`({Width: innerWidth, Height: innerHeight})`, &viewport).Do(browserContext); evaluateError != nil { // Measure the window
+			logError(evaluateError) // Log the script failure
+			return nil              // Capture the page as it is rather than failing the scrape
+		}
+		mouseX, mouseY := float64(viewport.Width)/2, float64(viewport.Height)/2 // Start in the middle of the window
+		for step := 0; step < steps; step++ {                                   // Perform each interaction
+			if sleepError := chromedp.Sleep(jitterDuration(maxDelay)).Do(browserContext); sleepError != nil { // Pause like a reader
+				return sleepError // The browser was stopped
+			}
+			if step%3 == 2 { // Scroll every third step
+				scrollDistance := float64(100 + randomBelow(300))                                                                                                // A flick of the wheel
+				if scrollError := input.DispatchMouseEvent(input.MouseWheel, mouseX, mouseY).WithDeltaY(scrollDistance).Do(browserContext); scrollError != nil { // Scroll down a little
+					return scrollError // The browser was stopped
+				}
+				continue // Done with this step
+			}
+			targetX, targetY := float64(randomBelow(viewport.Width)), float64(randomBelow(viewport.Height)) // Where the mouse heads
+			for moveStep := 1; moveStep <= 5; moveStep++ {                                                  // Glide there instead of jumping
+				pointX := mouseX + (targetX-mouseX)*float64(moveStep)/5                                                           // Point along the path
+				pointY := mouseY + (targetY-mouseY)*float64(moveStep)/5                                                           // Point along the path
+				if moveError := input.DispatchMouseEvent(input.MouseMoved, pointX, pointY).Do(browserContext); moveError != nil { // Move the mouse
+					return moveError // The browser was stopped
+				}
+				if sleepError := chromedp.Sleep(time.Duration(20+randomBelow(40)) * time.Millisecond).Do(browserContext); sleepError != nil { // Hand speed, not script speed
+					return sleepError // The browser was stopped
+				}
+			}
+			mouseX, mouseY = targetX, targetY // The mouse is now there
+		}
+		return nil // The activity is done
+	}) // End of activity action
+} // End of simulateHumanActivity function
+
+// Script that opens every <details>, clicks every collapsed accordion or tab control plus the controls matched by
+// the extra selectors passed as its argument, and returns how many elements it opened
+const expandCollapsedSectionsScript = `((extraSelectors) => {
+	let opened = 0;
+	for (const details of document.querySelectorAll('details:not([open])')) {
+		details.open = true;
+		opened++;
+	}
+	const controls = ['[aria-expanded="false"]', '[role="tab"][aria-selected="false"]', ...extraSelectors];
+	for (const control of document.querySelectorAll(controls.join(', '))) {
+		control.click();
+		opened++;
+	}
+	return opened;
+})`
+
+// Builds the Chrome action that expands collapsed sections and tabs, then waits for their content to render
+func expandCollapsedSections(extraSelectors []string) chromedp.Action { // Function to reveal hidden content
+	return chromedp.ActionFunc(func(browserContext context.Context) error { // Run the expansion as one action
+		selectorsJSON, _ := json.Marshal(append([]string{}, extraSelectors...))                                      // Pass the selectors as a JSON array, never nil
+		var openedCount int                                                                                          // Number of elements opened
+		expandScript := expandCollapsedSectionsScript + "(" + string(selectorsJSON) + ")"                            // Call the script with the selectors
+		if evaluateError := chromedp.Evaluate(expandScript, &openedCount).Do(browserContext); evaluateError != nil { // Expand everything
+			logError(evaluateError) // Log the script failure, e.g. an invalid selector
+			return nil              // Capture the page as it is rather than failing the scrape
+		}
+		if openedCount > 0 { // Only wait when something was opened
+			return chromedp.Sleep(2 * time.Second).Do(browserContext) // Give the revealed content time to render
+		}
+		return nil // Nothing to wait for
+	}) // End of expansion action
+} // End of expandCollapsedSections function
+
+// Builds the Chrome actions that open Downloads/Support tabs and wait for their content to render
+func clickDownloadTabs() chromedp.Action { // Function to open client-side download tabs
+	return chromedp.ActionFunc(func(browserContext context.Context) error { // Run the clicks as one action
+		var clickedCount int                                                                                                     // Number of tabs clicked
+		if evaluateError := chromedp.Evaluate(clickDownloadTabsScript, &clickedCount).Do(browserContext); evaluateError != nil { // Click the matching tabs
+			logError(evaluateError) // Log the script failure
+			return nil              // Capture the page as it is rather than failing the scrape
+		}
+		if clickedCount > 0 { // Only wait when something was opened
+			return chromedp.Sleep(2 * time.Second).Do(browserContext) // Give the tab content time to render
+		}
+		return nil // Nothing to wait for
+	}) // End of tab-clicking action
+} // End of clickDownloadTabs function
+
+// Reports whether a link points at a Shopify product page
+func isProductLink(link string) bool { // Function to recognize product page links
+	return strings.Contains(link, "/products/") // Shopify serves every product below /products/
+} // End of isProductLink function
+
+// Strips the query string and fragment from a product URL so variant links collapse to one page
+func canonicalProductURL(productURL string) string { // Function to normalize product page URLs
+	parsedURL, parseError := url.Parse(productURL) // Parse the product URL
+	if parseError != nil {                         // Check if parsing failed
+		return productURL // Return the URL unchanged
+	}
+	parsedURL.RawQuery = ""   // Drop "?variant=…" and similar parameters
+	parsedURL.Fragment = ""   // Drop any "#section" anchor
+	return parsedURL.String() // Return the canonical URL
+} // End of canonicalProductURL function
+
+// Parses the specification table of a product page and stores it in the catalog
+func recordProductSpecs(productURL string, productHTML string) { // Function to catalog a product's specifications
+	parsedHTML, parseError := html.Parse(strings.NewReader(productHTML)) // Parse the product page
+	if parseError != nil {                                               // Check if HTML parsing failed
+		logError(parseError) // Log the parsing error
+		return               // Nothing to record
+	}
+
+	specs := make(map[string]string)    // Specification rows found on the page
+	productName := ""                   // Product name from the first <h1>
+	var structuredProduct jsonLDProduct // Product data from the page's JSON-LD
+	foundStructuredProduct := false     // Whether the page has a JSON-LD Product
+
+	var exploreHTML func(*html.Node) // Define a recursive function to explore HTML nodes
+
+	exploreHTML = func(currentNode *html.Node) { // The implementation of the recursive traversal function
+		if currentNode.Type == html.ElementNode { // Only elements carry specifications
+			switch currentNode.Data { // Pick the handling for this element
+			case "h1": // The product title
+				if productName == "" { // Keep the first heading only
+					productName = nodeText(currentNode) // Remember the product name
+				}
+			case "script": // Structured data lives in JSON-LD scripts
+				for _, attribute := range currentNode.Attr { // Look for the script type
+					if attribute.Key == "type" && attribute.Val == "application/ld+json" && !foundStructuredProduct && currentNode.FirstChild != nil { // Only the first JSON-LD Product counts
+						structuredProduct, foundStructuredProduct = parseJSONLDProduct(currentNode.FirstChild.Data) // Read the product data
+					}
+				}
+				return // Scripts have no visible content
+			case "tr": // Table rows hold "name | value" pairs
+				var cells []string                                                                         // Text of each cell in the row
+				for cellNode := currentNode.FirstChild; cellNode != nil; cellNode = cellNode.NextSibling { // Visit each cell
+					if cellNode.Type == html.ElementNode && (cellNode.Data == "td" || cellNode.Data == "th") { // Only table cells count
+						cells = append(cells, nodeText(cellNode)) // Keep the cell text
+					}
+				}
+				if len(cells) == 2 && cells[0] != "" && cells[1] != "" { // Two-column rows are specification entries
+					specs[strings.TrimSuffix(cells[0], ":")] = cells[1] // Store the specification
+				}
+				return // Rows have been fully handled
+			case "li": // Bullet lists often read "Channels: 16"
+				if name, value, found := strings.Cut(nodeText(currentNode), ":"); found && len(name) <= 40 && strings.TrimSpace(value) != "" { // Check for a short "name: value" bullet
+					specs[strings.TrimSpace(name)] = strings.TrimSpace(value) // Store the specification
+				}
+				return // List items have been fully handled
+			}
+		}
+
+		for childNode := currentNode.FirstChild; childNode != nil; childNode = childNode.NextSibling { // Recursively traverse child nodes
+			exploreHTML(childNode)
+		}
+	}
+
+	exploreHTML(parsedHTML) // Begin traversal from the root node
+
+	if foundStructuredProduct && structuredProduct.Name != "" { // Structured data beats the page heading
+		productName = structuredProduct.Name // Use the canonical name
+	}
+
+	if archiveCatalog.Products == nil { // Create the products map on first use
+		archiveCatalog.Products = make(map[string]*productRecord) // Start an empty map
+	}
+	archiveCatalog.Products[productURL] = &productRecord{ // Store or replace the product record
+		URL:       productURL,                               // Product page URL
+		Name:      productName,                              // Product name
+		SKU:       structuredProduct.SKU,                    // SKU from JSON-LD
+		Images:    jsonLDImageURLs(structuredProduct.Image), // Images from JSON-LD
+		Specs:     specs,                                    // Specification rows
+		ScrapedAt: time.Now().UTC().Format(time.RFC3339),    // When the page was scraped
+	} // End of product record
+	log.Printf("Recorded %d specification(s) for %s", len(specs), productURL) // Log success message
+} // End of recordProductSpecs function
+
+const waybackSaveEndpoint = "https://web.archive.org/save/" // Save Page Now endpoint of the Wayback Machine
+
+// Returns the public archive record of a URL, creating it on first use
+func publicArchiveRecordFor(pageURL string) *publicArchiveRecord { // Function to find a URL's submissions
+	if archiveCatalog.PublicArchives == nil { // Create the map on first use
+		archiveCatalog.PublicArchives = make(map[string]*publicArchiveRecord) // Start an empty map
+	}
+	record, found := archiveCatalog.PublicArchives[pageURL] // Look the URL up
+	if !found {                                             // Check if the URL was never submitted
+		record = &publicArchiveRecord{}                 // Start a record
+		archiveCatalog.PublicArchives[pageURL] = record // Store it
+	}
+	return record // The record
+} // End of publicArchiveRecordFor function
+
+// Asks the Wayback Machine's Save Page Now to capture each URL that was not submitted before, recording the submission
+// in the catalog. Submissions are authenticated with archive.org keys from WAYBACK_ACCESS_KEY and WAYBACK_SECRET_KEY when
+// set, which raises the rate limit; when archive.org rate-limits anyway the remaining URLs wait for the next run.
+func submitToWayback(pageURLs []string) { // Function to submit URLs to the Wayback Machine
+	accessKey, secretKey := os.Getenv("WAYBACK_ACCESS_KEY"), os.Getenv("WAYBACK_SECRET_KEY") // Optional archive.org keys
+	httpClient := &http.Client{Timeout: 2 * time.Minute}                                     // Captures can take a while
+	submitted := 0                                                                           // URLs submitted this run
+	for _, pageURL := range pageURLs {                                                       // Submit each URL once
+		if archiveCatalog.PublicArchives[pageURL] != nil && archiveCatalog.PublicArchives[pageURL].WaybackSubmitted != "" { // Check if it was submitted before
+			continue // Already preserved
+		}
+		if submitted > 0 { // Space the submissions out
+			time.Sleep(*waybackDelay) // Respect archive.org's rate limit
+		}
+
+		var saveRequest *http.Request           // The submission
+		var requestError error                  // Error building it
+		if accessKey != "" && secretKey != "" { // Authenticated submissions use Save Page Now 2
+			saveRequest, requestError = http.NewRequest(http.MethodPost, waybackSaveEndpoint, strings.NewReader(url.Values{"url": {pageURL}}.Encode())) // Form with the URL
+			if requestError == nil {                                                                                                                    // Add the credentials
+				saveRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded") // Declare the form
+				saveRequest.Header.Set("Accept", "application/json")                        // Ask for the job ID
+				saveRequest.Header.Set("Authorization", "LOW "+accessKey+":"+secretKey)     // archive.org S3-style keys
+			}
+		} else {
+			saveRequest, requestError = http.NewRequest(http.MethodGet, waybackSaveEndpoint+pageURL, nil) // Anonymous capture
+		}
+		if requestError != nil { // Check if the request could not be built
+			logErrorf("Failed to submit %s to the Wayback Machine %v", pageURL, requestError) // Log the error
+			continue                                                                          // Try the next URL
+		}
+
+		saveResponse, sendError := httpClient.Do(saveRequest) // Submit the URL
+		submitted++                                           // Count the attempt for spacing
+		if sendError != nil {                                 // Check if the submission failed
+			logErrorf("Failed to submit %s to the Wayback Machine %v", pageURL, sendError) // Log the error
+			continue                                                                       // Try the next URL
+		}
+		var saveReply struct { // Save Page Now 2 reply
+			JobID   string `json:"job_id"`  // Capture job
+			Message string `json:"message"` // Reason a capture was refused
+		}
+		if strings.Contains(saveResponse.Header.Get("Content-Type"), "json") { // Only Save Page Now 2 answers in JSON
+			json.NewDecoder(io.LimitReader(saveResponse.Body, 1<<16)).Decode(&saveReply) // A reply that does not decode leaves the fields empty
+		}
+		saveResponse.Body.Close() // Close the response body
+
+		if saveResponse.StatusCode == http.StatusTooManyRequests { // Check if archive.org is rate-limiting
+			logWarningf("The Wayback Machine is rate-limiting submissions; %s and the rest wait for the next run", pageURL) // Log the pause
+			return                                                                                                          // Stop submitting this run
+		}
+		if saveResponse.StatusCode != http.StatusOK || (accessKey != "" && secretKey != "" && saveReply.JobID == "") { // Check if the capture was refused
+			logErrorf("The Wayback Machine refused %s: %s %s", pageURL, saveResponse.Status, saveReply.Message) // Log the refusal
+			continue                                                                                            // Try the next URL
+		}
+
+		record := publicArchiveRecordFor(pageURL)                                            // Record the submission
+		record.WaybackSubmitted = time.Now().UTC().Format(time.RFC3339)                      // When it was submitted
+		record.WaybackJob = saveReply.JobID                                                  // Job of authenticated captures
+		if snapshotPath := saveResponse.Header.Get("Content-Location"); snapshotPath != "" { // Anonymous captures name the snapshot
+			record.WaybackSnapshot = "https://web.archive.org" + snapshotPath // Absolute snapshot URL
+		}
+		log.Printf("Submitted to the Wayback Machine: %s", pageURL) // Log success message
+	}
+} // End of submitToWayback function
+
+const archiveTodayEndpoint = "https://archive.ph/" // Front page of archive.today, whose form submits snapshots
+
+// Asks archive.today to snapshot each page that was not submitted before, recording the submission in the catalog.
+// The submission form carries a per-visit token, so the front page is read first. archive.today answers bursts of
+// submissions with a CAPTCHA, in which case the remaining pages wait for the next run.
+func submitToArchiveToday(pageURLs []string) { // Function to submit pages to archive.today
+	httpClient := &http.Client{ // Do not follow redirects, which point at the snapshot
+		Timeout:       2 * time.Minute,                                                               // Submissions can take a while
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }, // Keep the redirect itself
+	}
+	submitted := 0                     // Pages submitted this run
+	for _, pageURL := range pageURLs { // Submit each page once
+		if archiveCatalog.PublicArchives[pageURL] != nil && archiveCatalog.PublicArchives[pageURL].ArchiveTodaySubmitted != "" { // Check if it was submitted before
+			continue // Already preserved
+		}
+		if submitted > 0 { // Space the submissions out
+			time.Sleep(*archiveTodayDelay) // Respect archive.today's rate limit
+		}
+		submitted++ // Count the attempt for spacing
+
+		frontPage, fetchError := httpClient.Get(archiveTodayEndpoint) // Read the form for its token
+		if fetchError != nil {                                        // Check if archive.today is unreachable
+			logErrorf("Failed to reach archive.today %v", fetchError) // Log the error
+			return                                                    // Try again next run
+		}
+		frontPageDocument, parseError := html.Parse(io.LimitReader(frontPage.Body, 1<<20)) // Parse the front page
+		frontPage.Body.Close()                                                             // Close the response body
+		if frontPage.StatusCode != http.StatusOK || parseError != nil {                    // Check if archive.today is blocking the archiver
+			logWarningf("archive.today is not accepting submissions (%s); the remaining pages wait for the next run", frontPage.Status) // Log the pause
+			return                                                                                                                      // Stop submitting this run
+		}
+		submitID := ""                                                                                                          // Token of the submission form
+		if tokenField := cascadia.Query(frontPageDocument, cascadia.MustCompile(`input[name="submitid"]`)); tokenField != nil { // Look for the token field
+			submitID = nodeAttribute(tokenField, "value") // Keep it
+		}
+
+		submitForm := url.Values{"url": {pageURL}} // The page to snapshot
+		if submitID != "" {                        // Pass the token back when the form had one
+			submitForm.Set("submitid", submitID) // The form's token
+		}
+		submitResponse, submitError := httpClient.PostForm(archiveTodayEndpoint+"submit/", submitForm) // Submit the page
+		if submitError != nil {                                                                        // Check if the submission failed
+			logErrorf("Failed to submit %s to archive.today %v", pageURL, submitError) // Log the error
+			continue                                                                   // Try the next page
+		}
+		submitResponse.Body.Close() // The snapshot location is in the headers
+
+		snapshotURL := submitResponse.Header.Get("Location")                                          // Existing snapshots redirect to themselves
+		if _, refreshURL, found := strings.Cut(submitResponse.Header.Get("Refresh"), "url="); found { // New snapshots refresh to their in-progress page
+			snapshotURL = refreshURL // Where the snapshot will appear
+		}
+		if snapshotURL == "" { // Check if archive.today did not take the page, e.g. because it wants a CAPTCHA solved
+			logWarningf("archive.today did not accept %s (%s); the remaining pages wait for the next run", pageURL, submitResponse.Status) // Log the refusal
+			return                                                                                                                         // Stop submitting this run
+		}
+
+		record := publicArchiveRecordFor(pageURL)                               // Record the submission
+		record.ArchiveTodaySubmitted = time.Now().UTC().Format(time.RFC3339)    // When it was submitted
+		record.ArchiveTodaySnapshot = snapshotURL                               // Where the snapshot is
+		log.Printf("Submitted to archive.today: %s → %s", pageURL, snapshotURL) // Log success message
+	}
+} // End of submitToArchiveToday function
+
+// A linked file kept on a host the archiver cannot download from, such as Mega, whose files are end-to-end
+// encrypted and need Mega's own client
+type externalAsset struct { // Fields stored for each external asset
+	URL        string `json:"url"`         // Link to the file
+	Host       string `json:"host"`        // Host the file is kept on
+	SourcePage string `json:"source_page"` // Page the link was last found on
+	FirstSeen  string `json:"first_seen"`  // RFC 3339 timestamp of the first run that found the link
+	LastSeen   string `json:"last_seen"`   // RFC 3339 timestamp of the last run that found the link
+} // End of externalAsset struct
+
+// Reports whether a link points at a file on Mega (e.g. "mega.nz/file/<id>#<key>" or the older "mega.nz/#!<id>!<key>")
+func isMegaLink(link string) bool { // Function to recognize Mega links
+	parsedLink, parseError := url.Parse(link) // Parse the link
+	if parseError != nil {                    // Check if the link is malformed
+		return false // Not a Mega link
+	}
+	switch strings.ToLower(parsedLink.Hostname()) { // Check the host
+	case "mega.nz", "www.mega.nz", "mega.io", "mega.co.nz", "www.mega.co.nz": // Current and legacy hosts
+		return strings.HasPrefix(parsedLink.Path, "/file/") || strings.HasPrefix(parsedLink.Fragment, "!") // Files, not folders or pages
+	}
+	return false // Any other host
+} // End of isMegaLink function
+
+// Records a link to an external asset in the catalog, so the archive at least knows the file exists
+func recordExternalAsset(assetURL string, sourcePage string) { // Function to catalog an external asset
+	if archiveCatalog.External == nil { // Create the map on first use
+		archiveCatalog.External = make(map[string]*externalAsset) // Start an empty map
+	}
+	parsedURL, parseError := url.Parse(assetURL) // Parse the link to read its host
+	if parseError != nil {                       // Check if the link is malformed
+		logError(parseError) // Log the parsing error
+		return               // Nothing to record
+	}
+	now := time.Now().UTC().Format(time.RFC3339)                  // When the link was seen
+	if asset, found := archiveCatalog.External[assetURL]; found { // Check if the link was seen before
+		asset.SourcePage = sourcePage // Remember where it was found this time
+		asset.LastSeen = now          // Record that the link is still live
+		return
+	}
+	log.Printf("External asset on %s, not downloaded: %s", parsedURL.Hostname(), assetURL) // Log the new asset
+	archiveCatalog.External[assetURL] = &externalAsset{                                    // Store the asset
+		URL:        assetURL,             // Link to the file
+		Host:       parsedURL.Hostname(), // Host the file is kept on
+		SourcePage: sourcePage,           // Page the link was found on
+		FirstSeen:  now,                  // First time the link was found
+		LastSeen:   now,                  // Last time the link was found
+	} // End of external asset
+} // End of recordExternalAsset function
+
+// Metadata of a scraped page
+type pageRecord struct { // Fields stored for each scraped page
+	URL         string `json:"url"`                   // Page URL
+	Title       string `json:"title,omitempty"`       // og:title, or the <title> when there is none
+	Description string `json:"description,omitempty"` // og:description
+	Image       string `json:"image,omitempty"`       // og:image
+	ScrapedAt   string `json:"scraped_at"`            // RFC 3339 timestamp of the last scrape
+} // End of pageRecord struct
+
+var pageMetadataMutex sync.Mutex // Guards archiveCatalog.Pages while pages are scraped in parallel
+
+// Stores a page's OpenGraph title, description, and image in the catalog
+func recordPageMetadata(pageURL string, pageHTML string) { // Function to catalog page metadata
+	parsedHTML, parseError := html.Parse(strings.NewReader(pageHTML)) // Parse the page
+	if parseError != nil {                                            // Check if parsing failed
+		logError(parseError) // Log the parsing error
+		return               // Nothing to record
+	}
+
+	page := &pageRecord{URL: pageURL, ScrapedAt: time.Now().UTC().Format(time.RFC3339)} // The page's record
+	documentTitle := ""                                                                 // Contents of <title>, the fallback title
+
+	var exploreHTML func(*html.Node) // Define a recursive function to explore HTML nodes
+
+	exploreHTML = func(currentNode *html.Node) { // The implementation of the recursive traversal function
+		if currentNode.Type == html.ElementNode && currentNode.Data == "title" && documentTitle == "" { // The document title
+			documentTitle = nodeText(currentNode) // Remember it
+		}
+		if currentNode.Type == html.ElementNode && currentNode.Data == "meta" { // OpenGraph tags are <meta property="og:…" content="…">
+			property, content := "", ""                  // Attributes of the tag
+			for _, attribute := range currentNode.Attr { // Read the attributes
+				switch attribute.Key {
+				case "property": // OpenGraph uses property
+					property = attribute.Val // Remember the property
+				case "content": // The value
+					content = strings.TrimSpace(attribute.Val) // Remember the value
+				}
+			}
+			switch property {
+			case "og:title": // Page title
+				page.Title = content // Store the title
+			case "og:description": // Page summary
+				page.Description = content // Store the description
+			case "og:image": // Preview image
+				if page.Image == "" { // Keep the first image only
+					page.Image = resolveLink(pageURL, content) // Store the absolute image URL
+				}
+			}
+		}
+
+		for childNode := currentNode.FirstChild; childNode != nil; childNode = childNode.NextSibling { // Recursively traverse child nodes
+			exploreHTML(childNode)
+		}
+	}
+
+	exploreHTML(parsedHTML) // Begin traversal from the root node
+
+	if page.Title == "" { // Fall back to the document title
+		page.Title = documentTitle // Use <title>
+	}
+	pageMetadataMutex.Lock()         // Pages are scraped in parallel
+	defer pageMetadataMutex.Unlock() // Unlock when done
+	if archiveCatalog.Pages == nil { // Create the pages map on first use
+		archiveCatalog.Pages = make(map[string]*pageRecord) // Start an empty map
+	}
+	archiveCatalog.Pages[pageURL] = page // Store or replace the page record
+} // End of recordPageMetadata function
+
+// HTML of the static index site
+var indexSiteTemplate = template.Must(template.New("index").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>RadioMaster documentation archive</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 1.5rem; max-width: 70rem; }
+section { margin-bottom: 2.5rem; }
+header { display: flex; gap: 1rem; align-items: center; }
+header img { width: 8rem; height: auto; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .3rem .6rem; border-bottom: 1px solid #ddd; }
+</style>
+</head>
+<body>
+<h1>RadioMaster documentation archive</h1>
+<p>Updated {{.Updated}}</p>
+{{range .Sections}}<section>
+<header>
+{{with .Page.Image}}<img src="{{.}}" alt="">{{end}}
+<div>
+<h2>{{if .Page.URL}}<a href="{{.Page.URL}}">{{or .Page.Title .Page.URL}}</a>{{else}}Other files{{end}}</h2>
+{{with .Page.Description}}<p>{{.}}</p>{{end}}
+</div>
+</header>
+<table>
+<tr><th>Product</th><th>Version</th><th>Kind</th><th>File</th></tr>
+{{range .Files}}<tr><td>{{.Product}}</td><td>{{.Version}}</td><td>{{.Kind}}</td><td><a href="{{.Link}}">{{.Name}}</a></td></tr>
+{{end}}</table>
+</section>
+{{end}}</body>
+</html>
+`))
+
+// One source page and the files found on it, as shown on the index site
+type indexSection struct { // Fields of an index site section
+	Page  pageRecord  // Metadata of the source page; empty for files without a known source
+	Files []indexFile // Files found on the page
+} // End of indexSection struct
+
+// One file listed on the index site
+type indexFile struct { // Fields of an index site row
+	Product  string // Detected product
+	Version  string // Detected version
+	Kind     string // "manual", "firmware" or "software"
+	Name     string // File name
+	Link     string // Path of the file relative to the site directory
+	Modified string // Date the file was first downloaded (YYYY-MM-DD)
+} // End of indexFile struct
+
+// Returns a readable title for a manual from its file name, e.g. "TX16S MKII User Manual EN" for TX16S_MKII_User_Manual_EN.pdf
+func manualTitle(entry *catalogEntry) string { // Function to title a manual
+	baseName := strings.TrimSuffix(path.Base(entry.Path), path.Ext(entry.Path))                           // File name without its extension
+	title := strings.Join(strings.Fields(strings.NewReplacer("_", " ", "-", " ").Replace(baseName)), " ") // Separators become single spaces
+	if entry.Version != "" && !strings.Contains(strings.ToLower(title), strings.ToLower(entry.Version)) { // Name the revision when the file name does not
+		title += " " + entry.Version // Add the revision
+	}
+	return title // Return the title
+} // End of manualTitle function
+
+// Returns the Calibre tags of a manual: its product, its model when that differs, and "manual"
+func calibreTags(entry *catalogEntry) []string { // Function to tag a manual
+	tags := []string{"RadioMaster", "manual"} // Every manual is one
+	if entry.Product != "" {                  // Tag the product
+		tags = append(tags, entry.Product) // Add the product key
+	}
+	if entry.Model != "" && !strings.EqualFold(entry.Model, entry.Product) { // Tag the model family too
+		tags = append(tags, entry.Model) // Add the model
+	}
+	return tags // Return the tags
+} // End of calibreTags function
+
+// Reports whether the exported copy at bookPath holds the same bytes as the archived file at sourcePath: a hard link to
+// it, or a copy of the same size and content hash
+func calibreCopyCurrent(sourcePath string, bookPath string) bool { // Function to check an exported manual
+	sourceInfo, sourceError := os.Stat(sourcePath) // The archived file
+	bookInfo, bookError := os.Stat(bookPath)       // The exported copy
+	if sourceError != nil || bookError != nil {    // Check if either is missing
+		return false // Export it again
+	}
+	if os.SameFile(sourceInfo, bookInfo) { // A hard link is always current
+		return true // Nothing to do
+	}
+	if sourceInfo.Size() != bookInfo.Size() { // Different sizes cannot hold the same bytes
+		return false // Export it again
+	}
+	sourceSHA256, sourceBLAKE3, _, sourceHashError := hashArchivedFile(sourcePath)                                    // Hash the archived file
+	bookSHA256, bookBLAKE3, _, bookHashError := hashArchivedFile(bookPath)                                            // Hash the copy
+	return sourceHashError == nil && bookHashError == nil && sourceSHA256 == bookSHA256 && sourceBLAKE3 == bookBLAKE3 // Compare the contents
+} // End of calibreCopyCurrent function
+
+// Writes the manuals for Calibre: one folder per manual under calibreDirectory, named after the product and file, with
+// the PDF hard-linked (copied across file systems; manuals sharing a product and file name get a hash suffix) and a metadata.opf giving its title, tags, language, date, source URL
+// and content hash, plus calibre.csv listing the same metadata per file for scripts using calibredb
+func writeCalibreExport(calibreDirectory string) { // Function to export the catalog for Calibre
+	var manuals []*catalogEntry                    // Manuals on disk
+	for _, entry := range archiveCatalog.Entries { // Visit every cataloged file
+		if entry.Kind == "manual" && fileExists(filepath.FromSlash(entry.Path)) { // Firmware is not a book
+			manuals = append(manuals, entry) // Export the manual
+		}
+	}
+	if len(manuals) == 0 { // Check if there is anything to export
+		return // Leave the directory alone
+	}
+	slices.SortFunc(manuals, func(first, second *catalogEntry) int { return strings.Compare(first.Path, second.Path) }) // Stable order
+
+	csvRows := [][]string{{"file", "title", "authors", "publisher", "tags", "languages", "pubdate", "identifiers", "comments"}} // Header row
+	usedDirectories := make(map[string]bool)                                                                                    // Book folders taken so far
+	for _, entry := range manuals {                                                                                             // Export each manual
+		baseName := path.Base(entry.Path)                                                                  // File name of the manual
+		productDirectory := filepath.Join(calibreDirectory, cmp.Or(entry.Product, "other"))                // Books are grouped by product
+		bookDirectory := filepath.Join(productDirectory, strings.TrimSuffix(baseName, path.Ext(baseName))) // One folder per book
+		if usedDirectories[bookDirectory] {                                                                // Another manual of the product has the same file name
+			bookDirectory += "-" + cmp.Or(entry.SHA256, entry.BLAKE3, fmt.Sprintf("%x", sha256.Sum256([]byte(entry.Path))))[:8] // Tell the two apart by content
+		}
+		usedDirectories[bookDirectory] = true                                   // Claim the folder
+		if mkdirError := os.MkdirAll(bookDirectory, 0o755); mkdirError != nil { // Create the folder
+			logError(mkdirError) // Log the error
+			continue             // Try the next manual
+		}
+		bookPath := filepath.Join(bookDirectory, baseName)                 // Where Calibre picks the PDF up
+		if !calibreCopyCurrent(filepath.FromSlash(entry.Path), bookPath) { // Only place new or changed files
+			if removeError := removeArchiveFile(bookPath); removeError != nil && !os.IsNotExist(removeError) { // Replace an outdated copy
+				logError(removeError) // Log the error
+				continue              // Try the next manual
+			}
+			linkError := os.Link(filepath.FromSlash(entry.Path), bookPath)                        // Share the archived bytes
+			recordAudit(auditEntry{Action: "write", Path: bookPath, Size: entry.Size}, linkError) // Audit the link
+			if linkError != nil {                                                                 // Hard links fail across file systems
+				if copyError := copyFile(filepath.FromSlash(entry.Path), bookPath); copyError != nil { // Copy the file instead
+					logError(copyError) // Log the error
+					continue            // Try the next manual
+				}
+			}
+		}
+
+		title := manualTitle(entry)                    // Title shown in Calibre
+		tags := calibreTags(entry)                     // Tags shown in Calibre
+		fileHash, hashScheme := entry.SHA256, "sha256" // Content hash of the manual
+		if fileHash == "" {                            // Archives using -hash=blake3
+			fileHash, hashScheme = entry.BLAKE3, "blake3" // Use BLAKE3 instead
+		}
+		publishedDate := strings.SplitN(cmp.Or(entry.FirstSeen, entry.LastSeen), "T", 2)[0] // Date the archive first saw the manual
+		comments := "Downloaded from " + entry.URL                                          // Where the manual came from
+		if entry.SourcePage != "" {                                                         // Name the page it was linked from too
+			comments += " (linked from " + entry.SourcePage + ")" // Add the page
+		}
+
+		var opf strings.Builder                                                                                                                   // metadata.opf of the book
+		opf.WriteString(xml.Header + `<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="archive_id">` + "\n")        // OPF 2.0 as Calibre writes it
+		opf.WriteString(`  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">` + "\n")               // Dublin Core metadata
+		fmt.Fprintf(&opf, "    <dc:identifier id=\"archive_id\" opf:scheme=\"%s\">%s</dc:identifier>\n", hashScheme, html.EscapeString(fileHash)) // Content hash
+		fmt.Fprintf(&opf, "    <dc:title>%s</dc:title>\n", html.EscapeString(title))                                                              // Title
+		opf.WriteString("    <dc:creator opf:role=\"aut\">RadioMaster</dc:creator>\n    <dc:publisher>RadioMaster</dc:publisher>\n")              // The vendor wrote it
+		if entry.Language != "" {                                                                                                                 // Language, when detected
+			fmt.Fprintf(&opf, "    <dc:language>%s</dc:language>\n", html.EscapeString(entry.Language)) // ISO 639-1 code
+		}
+		if publishedDate != "" { // Date, when known
+			fmt.Fprintf(&opf, "    <dc:date>%s</dc:date>\n", html.EscapeString(publishedDate)) // YYYY-MM-DD
+		}
+		for _, tag := range tags { // Tags
+			fmt.Fprintf(&opf, "    <dc:subject>%s</dc:subject>\n", html.EscapeString(tag)) // One subject per tag
+		}
+		fmt.Fprintf(&opf, "    <dc:source>%s</dc:source>\n    <dc:description>%s</dc:description>\n", html.EscapeString(entry.URL), html.EscapeString(comments)) // Where it came from
+		opf.WriteString("  </metadata>\n</package>\n")                                                                                                           // Close the document
+		opfPath := filepath.Join(bookDirectory, "metadata.opf")                                                                                                  // Calibre reads this name
+		if writeError := writeArchiveFile(opfPath, []byte(opf.String()), 0o644); writeError != nil {                                                             // Save the metadata
+			logErrorf("Failed to write %s %v", opfPath, writeError) // Log the write failure
+		}
+
+		csvRows = append(csvRows, []string{bookPath, title, "RadioMaster", "RadioMaster", strings.Join(tags, ", "), entry.Language, publishedDate, hashScheme + ":" + fileHash, comments}) // Same metadata for calibredb
+	}
+
+	var csvData bytes.Buffer                                          // Rendered CSV
+	csvWriter := csv.NewWriter(&csvData)                              // Wrap the buffer in a CSV writer
+	if writeError := csvWriter.WriteAll(csvRows); writeError != nil { // Write every row and flush
+		logError(writeError) // Log the encoding failure
+		return               // Nothing to write
+	}
+	csvPath := filepath.Join(calibreDirectory, "calibre.csv")                               // Where the mapping goes
+	if writeError := writeArchiveFile(csvPath, csvData.Bytes(), 0o644); writeError != nil { // Save the mapping
+		logErrorf("Failed to write %s %v", csvPath, writeError) // Log the write failure
+	}
+	log.Printf("Exported %d manual(s) for Calibre to %s", len(manuals), calibreDirectory) // Report the export
+} // End of writeCalibreExport function
+
+// Writes a Markdown table of contents of the cataloged manuals: one section per product with each manual's revision,
+// size, and first-seen date, newest revision first, linked relative to the index so the links work on GitHub; nothing in
+// it depends on the run, so a Git mirror only sees a change when the manuals change
+func writeMarkdownIndex(indexPath string) { // Function to generate the Markdown index
+	absoluteIndexDirectory, _ := filepath.Abs(filepath.Dir(indexPath)) // Links are relative to the index's directory
+	manualsByProduct := make(map[string][]*catalogEntry)               // Manuals grouped by product
+	manualCount := 0                                                   // Manuals listed
+	newestManual := ""                                                 // When the newest manual joined the archive
+	for _, entry := range archiveCatalog.Entries {                     // Group every manual
+		if entry.Kind == "manual" { // Firmware is not listed
+			manualsByProduct[entry.Product] = append(manualsByProduct[entry.Product], entry) // Add the manual to its product
+			manualCount++                                                                    // Count it for the summary
+			newestManual = max(newestManual, entry.FirstSeen)                                // RFC 3339 timestamps sort as text
+		}
+	}
+
+	escapeCell := strings.NewReplacer("|", "\\|", "\n", " ")                                                           // Keep cell text from breaking the table
+	var index strings.Builder                                                                                          // The document being written
+	fmt.Fprintf(&index, "# RadioMaster manuals\n\n%d manual(s) for %d product(s)", manualCount, len(manualsByProduct)) // Title and summary
+	if newestManual != "" {                                                                                            // Date the index by its newest manual
+		fmt.Fprintf(&index, ", newest added %s", strings.SplitN(newestManual, "T", 2)[0]) // Add the date
+	}
+	index.WriteString(".\n")                                             // End the summary
+	for _, product := range slices.Sorted(maps.Keys(manualsByProduct)) { // One section per product, alphabetically
+		manuals := manualsByProduct[product]                             // The product's manuals
+		slices.SortFunc(manuals, func(first, second *catalogEntry) int { // Newest revision first, then by path
+			if order := compareManualVersions(second.Version, first.Version); order != 0 { // Compare the revisions
+				return order // Newer first
+			}
+			return strings.Compare(first.Path, second.Path) // Stable order for equal revisions
+		}) // End of manual sort
+
+		heading := product                                                           // Section heading
+		if manuals[0].Model != "" && !strings.EqualFold(manuals[0].Model, product) { // Name the model when it differs from the product key
+			heading += " (" + manuals[0].Model + ")" // Add the model
+		}
+		fmt.Fprintf(&index, "\n## %s\n\n| Manual | Version | Size | First seen |\n| --- | --- | --- | --- |\n", escapeCell.Replace(heading)) // Section heading and table header
+		for _, manual := range manuals {                                                                                                     // One row per manual
+			absoluteFile, _ := filepath.Abs(manual.Path)                                 // Absolute path of the file
+			relativeLink, relError := filepath.Rel(absoluteIndexDirectory, absoluteFile) // Link from the index to the file
+			if relError != nil {                                                         // Check if no relative path exists
+				logError(relError) // Log the error
+				continue           // Leave the file out
+			}
+			linkTarget := (&url.URL{Path: filepath.ToSlash(relativeLink)}).EscapedPath()                                                                                                                                                    // Escape spaces and the like for Markdown links
+			fmt.Fprintf(&index, "| [%s](%s) | %s | %s | %s |\n", escapeCell.Replace(filepath.Base(manual.Path)), linkTarget, escapeCell.Replace(manual.Version), formatByteCount(manual.Size), strings.SplitN(manual.FirstSeen, "T", 2)[0]) // The row; last-seen dates would change every run
+		}
+	}
+
+	if writeError := writeArchiveFile(indexPath, []byte(index.String()), 0o644); writeError != nil { // Save the index
+		logErrorf("Failed to write Markdown index %s %v", indexPath, writeError) // Log the write failure
+	}
+} // End of writeMarkdownIndex function
+
+// Writes index.html into siteDirectory, listing every cataloged file grouped by the page it was found on,
+// with each page's OpenGraph title, description, and image
+func writeIndexSite(siteDirectory string) { // Function to generate the static index site
+	if !directoryExists(siteDirectory) { // Create the site directory on first use
+		createDirectory(siteDirectory, 0o755) // Create the directory (rwxr-xr-x)
+	}
+
+	sectionsByPage := make(map[string]*indexSection) // Sections keyed by source page URL
+	for _, entry := range archiveCatalog.Entries {   // Place each file in its page's section
+		section, found := sectionsByPage[entry.SourcePage] // Look up the section
+		if !found {                                        // Create it on first use
+			section = &indexSection{Page: pageRecord{URL: entry.SourcePage}}  // Start with just the URL
+			if page, known := archiveCatalog.Pages[entry.SourcePage]; known { // Use the page's metadata when it was recorded
+				section.Page = *page // Copy the metadata
+			}
+			sectionsByPage[entry.SourcePage] = section // Remember the section
+		}
+
+		absoluteSite, _ := filepath.Abs(siteDirectory)                     // Resolve both paths so a relative and an absolute path can be compared
+		absoluteFile, _ := filepath.Abs(entry.Path)                        // Absolute path of the file
+		relativeLink, relError := filepath.Rel(absoluteSite, absoluteFile) // Link from the site to the file
+		if relError != nil {                                               // Check if no relative path exists
+			logError(relError) // Log the error
+			continue           // Leave the file out
+		}
+		section.Files = append(section.Files, indexFile{ // Add the file
+			Product:  entry.Product,                              // Detected product
+			Version:  entry.Version,                              // Detected version
+			Kind:     entry.Kind,                                 // File kind
+			Name:     filepath.Base(entry.Path),                  // File name
+			Link:     filepath.ToSlash(relativeLink),             // Link with forward slashes
+			Modified: strings.SplitN(entry.FirstSeen, "T", 2)[0], // Date part of the first download
+		}) // End of file row
+	}
+
+	var sections []*indexSection             // Sections in a stable order
+	for _, section := range sectionsByPage { // Collect every section
+		sort.Slice(section.Files, func(first, second int) bool { return section.Files[first].Link < section.Files[second].Link }) // Sort the files
+		sections = append(sections, section)                                                                                      // Keep the section
+	}
+	sort.Slice(sections, func(first, second int) bool { // Sort sections, with files of unknown origin last
+		if (sections[first].Page.URL == "") != (sections[second].Page.URL == "") { // Exactly one section is the catch-all
+			return sections[second].Page.URL == "" // The catch-all goes last
+		}
+		return sections[first].Page.URL < sections[second].Page.URL // Otherwise alphabetical by URL
+	}) // End of section sort
+
+	indexHTMLFile, createError := os.Create(filepath.Join(siteDirectory, "index.html"))                     // Create or truncate the index
+	recordAudit(auditEntry{Action: "write", Path: filepath.Join(siteDirectory, "index.html")}, createError) // Audit the write
+	if createError != nil {                                                                                 // Check if creation failed
+		logError(createError) // Log the error
+		return                // Nothing can be written
+	}
+	defer indexHTMLFile.Close() // Ensure the file is closed
+
+	renderError := indexSiteTemplate.Execute(indexHTMLFile, map[string]any{ // Render the index
+		"Updated":  time.Now().UTC().Format("2006-01-02"), // Date of this run
+		"Sections": sections,                              // Sections to list
+	}) // End of template data
+	if renderError != nil { // Check if rendering failed
+		logError(renderError) // Log the error
+	}
+
+	if *siteURL != "" { // A sitemap needs absolute URLs, so only write one when the public URL is known
+		writeSitemap(siteDirectory, *siteURL, sections) // Make the published archive indexable
+	}
+} // End of writeIndexSite function
+
+// One <url> element of a sitemap
+type sitemapURL struct { // Fields of a sitemap entry
+	Location     string `xml:"loc"`               // Absolute URL
+	LastModified string `xml:"lastmod,omitempty"` // Date of the last change (YYYY-MM-DD)
+} // End of sitemapURL struct
+
+// Writes sitemap.xml next to the index site, listing the index and every file served below the site directory
+func writeSitemap(siteDirectory string, publicURL string, sections []*indexSection) { // Function to generate the sitemap
+	baseURL := strings.TrimSuffix(publicURL, "/") + "/"                                                 // Base every location on the site root
+	locations := []sitemapURL{{Location: baseURL, LastModified: time.Now().UTC().Format("2006-01-02")}} // The index changes on every run
+	for _, section := range sections {                                                                  // Add each file
+		for _, file := range section.Files { // Visit the section's files
+			if strings.HasPrefix(file.Link, "../") { // Files outside the site directory are not published with it
+				continue // Leave the file out
+			}
+			locations = append(locations, sitemapURL{Location: baseURL + (&url.URL{Path: file.Link}).EscapedPath(), LastModified: file.Modified}) // Add the file
+		}
+	}
+
+	sitemapXML, marshalError := xml.MarshalIndent(struct { // Encode the sitemap
+		XMLName   xml.Name     `xml:"urlset"`     // Root element
+		Namespace string       `xml:"xmlns,attr"` // Sitemap schema namespace
+		URLs      []sitemapURL `xml:"url"`        // Every location
+	}{Namespace: "http://www.sitemaps.org/schemas/sitemap/0.9", URLs: locations}, "", "  ") // Sitemap protocol 0.9
+	if marshalError != nil { // Check if encoding failed
+		logError(marshalError) // Log the encoding error
+		return                 // Nothing to write
+	}
+	if writeError := writeArchiveFile(filepath.Join(siteDirectory, "sitemap.xml"), append([]byte(xml.Header), sitemapXML...), 0o644); writeError != nil { // Write the sitemap
+		logError(writeError) // Log the write failure
+	}
+} // End of writeSitemap function
+
+// Structured product data from a page's JSON-LD
+type jsonLDProduct struct { // Fields of a schema.org Product block
+	Name   string          `json:"name"`   // Canonical product name
+	SKU    string          `json:"sku"`    // Stock keeping unit
+	Image  json.RawMessage `json:"image"`  // A URL, a list of URLs, or ImageObjects
+	Offers json.RawMessage `json:"offers"` // An Offer or a list of Offers, which may carry the SKU instead
+} // End of jsonLDProduct struct
+
+// Finds the first schema.org Product in a JSON-LD script, which may hold one object, a list, or an @graph
+func parseJSONLDProduct(scriptText string) (jsonLDProduct, bool) { // Function to read a JSON-LD block
+	var rawBlock any                                          // Decoded JSON of any shape
+	if json.Unmarshal([]byte(scriptText), &rawBlock) != nil { // Decode the script
+		return jsonLDProduct{}, false // Not valid JSON
+	}
+
+	var candidates []any // Objects that may be the Product
+	switch block := rawBlock.(type) {
+	case []any: // A list of objects
+		candidates = block // Check each one
+	case map[string]any: // One object, possibly wrapping an @graph
+		candidates = []any{block}                             // Check the object itself
+		if graph, isList := block["@graph"].([]any); isList { // Check the graph too
+			candidates = append(candidates, graph...) // Add the graph's objects
+		}
+	}
+
+	for _, candidate := range candidates { // Look for the Product
+		object, isObject := candidate.(map[string]any)               // Only objects can be Products
+		if !isObject || !hasJSONLDType(object["@type"], "Product") { // Skip everything else
+			continue // Check the next object
+		}
+		objectJSON, _ := json.Marshal(object)            // Re-encode to decode into the typed struct
+		var product jsonLDProduct                        // The typed product
+		if json.Unmarshal(objectJSON, &product) != nil { // Decode the product
+			continue // Malformed product, check the next object
+		}
+		if product.SKU == "" { // Shopify often only puts the SKU on the offer
+			var offers []struct { // Offers carrying a SKU
+				SKU string `json:"sku"` // Offer SKU
+			}
+			var offer struct { // A single offer
+				SKU string `json:"sku"` // Offer SKU
+			}
+			if json.Unmarshal(product.Offers, &offers) == nil && len(offers) > 0 { // A list of offers
+				product.SKU = offers[0].SKU // Use the first offer's SKU
+			} else if json.Unmarshal(product.Offers, &offer) == nil { // A single offer
+				product.SKU = offer.SKU // Use its SKU
+			}
+		}
+		return product, true // Found the product
+	}
+	return jsonLDProduct{}, false // No product in this block
+} // End of parseJSONLDProduct function
+
+// Reports whether a JSON-LD @type, a string or a list of strings, includes typeName
+func hasJSONLDType(typeValue any, typeName string) bool { // Function to check a JSON-LD type
+	switch types := typeValue.(type) {
+	case string: // A single type
+		return types == typeName // Compare it
+	case []any: // Several types
+		for _, listedType := range types { // Compare each one
+			if listedType == typeName { // Found the type
+				return true // The object has the type
+			}
+		}
+	}
+	return false // The type is not listed
+} // End of hasJSONLDType function
+
+// Returns the image URLs of a JSON-LD image value, which may be a URL, an ImageObject, or a list of either
+func jsonLDImageURLs(imageJSON json.RawMessage) []string { // Function to normalize JSON-LD images
+	var imageValue any                                 // Decoded image value
+	if json.Unmarshal(imageJSON, &imageValue) != nil { // Decode the value
+		return nil // No images
+	}
+	imageValues := []any{imageValue}                     // Treat a single value as a list of one
+	if imageList, isList := imageValue.([]any); isList { // Use the list when there is one
+		imageValues = imageList // Every listed image
+	}
+
+	var imageURLs []string              // URLs found
+	for _, image := range imageValues { // Normalize each image
+		switch imageEntry := image.(type) {
+		case string: // A plain URL
+			imageURLs = append(imageURLs, imageEntry) // Keep the URL
+		case map[string]any: // An ImageObject
+			if imageURL, isString := imageEntry["url"].(string); isString { // Read its URL
+				imageURLs = append(imageURLs, imageURL) // Keep the URL
+			}
+		}
+	}
+	return imageURLs // Return the URLs
+} // End of jsonLDImageURLs function
+
+// Writes every cataloged product's specifications to a CSV file, one row per product and one column per specification name
+func writeProductSpecsCSV(csvPath string) { // Function to export specifications as CSV
+	if len(archiveCatalog.Products) == 0 { // Nothing to export
+		return // Leave any existing file alone
+	}
+
+	var productURLs []string                                   // Product URLs in a stable order
+	specColumns := make(map[string]bool)                       // Every specification name seen
+	for productURL, product := range archiveCatalog.Products { // Visit every product
+		productURLs = append(productURLs, productURL) // Remember the product
+		for specName := range product.Specs {         // Visit each specification
+			specColumns[specName] = true // Remember the column
+		}
+	}
+	sort.Strings(productURLs) // Sort products for stable output
+
+	var columnNames []string            // Specification columns in a stable order
+	for specName := range specColumns { // Collect every column
+		columnNames = append(columnNames, specName) // Keep the column name
+	}
+	sort.Strings(columnNames) // Sort columns for stable output
+
+	csvFile, createError := os.Create(csvPath)                           // Create or truncate the CSV file
+	recordAudit(auditEntry{Action: "write", Path: csvPath}, createError) // Audit the write
+	if createError != nil {                                              // Check if creation failed
+		logError(createError) // Log the creation failure
+		return                // Nothing can be written
+	}
+	defer csvFile.Close() // Ensure the file is closed
+
+	csvWriter := csv.NewWriter(csvFile)                                         // Wrap the file in a CSV writer
+	_ = csvWriter.Write(append([]string{"url", "name", "sku"}, columnNames...)) // Write the header row
+	for _, productURL := range productURLs {                                    // Write one row per product
+		product := archiveCatalog.Products[productURL]          // Look up the product
+		row := []string{product.URL, product.Name, product.SKU} // Start the row with the identifying columns
+		for _, specName := range columnNames {                  // Fill in each specification column
+			row = append(row, product.Specs[specName]) // Missing specifications stay empty
+		}
+		_ = csvWriter.Write(row) // Write the row
+	}
+	csvWriter.Flush()                                       // Flush buffered rows to the file
+	if flushError := csvWriter.Error(); flushError != nil { // Check for write errors
+		logError(flushError) // Log the write failure
+	}
+} // End of writeProductSpecsCSV function
+
+// Folds a folder of manually downloaded PDFs into the archive with importPDFFile, then saves the catalog
+func runImport(importDirectory string, outputDirectory string) error { // Function implementing the import subcommand
+	if importDirectory == "" { // The folder is required
+		return fmt.Errorf("usage: import <directory of PDFs>") // Return a clear message
+	}
+	catalogPath := filepath.Join(outputDirectory, catalogFilename)         // Where the catalog is stored
+	brokenLinksPath := filepath.Join(outputDirectory, brokenLinksFilename) // Where links failing across runs are listed
+	loadCatalog(catalogPath)                                               // Load the catalog to match against
+	loadBrokenLinks(brokenLinksPath)                                       // Failing links may be exactly what was downloaded by hand
+	knownURLsByName := knownURLsByFileName()                               // URLs to match file names against
+
+	outcomeCounts := make(map[string]int)                                                                               // Files per outcome
+	walkError := filepath.WalkDir(importDirectory, func(filePath string, dirEntry fs.DirEntry, walkError error) error { // Visit every file
+		if walkError != nil { // Check if the entry could not be read
+			return walkError // Stop the walk
+		}
+		if dirEntry.IsDir() || !strings.EqualFold(filepath.Ext(filePath), ".pdf") { // Only PDFs are imported
+			return nil // Skip the entry
+		}
+		outcome, importError := importPDFFile(filePath, outputDirectory, knownURLsByName) // Import the file
+		outcomeCounts[outcome]++                                                          // Count the outcome
+		return importError                                                                // Stop the walk on I/O errors
+	}) // End of walk
+
+	saveCatalog(catalogPath)                                                                                                                                               // Persist the imported entries
+	saveBrokenLinks(brokenLinksPath)                                                                                                                                       // Persist the recovered links
+	writeChecksums(filepath.Join(outputDirectory, checksumsFilename))                                                                                                      // List the new files' hashes
+	log.Printf("Imported %d file(s), restored %d, skipped %d", outcomeCounts["imported"], outcomeCounts["restored"], outcomeCounts["duplicate"]+outcomeCounts["rejected"]) // Summary
+	if walkError != nil {                                                                                                                                                  // Check if the walk stopped early; what was imported so far is saved
+		return fmt.Errorf("import %s: %w", importDirectory, walkError) // Return the error
+	}
+	return nil // Success
+} // End of runImport function
+
+// Returns the URLs the archive knows, from the catalog and the failing links, keyed by lower-case file name
+func knownURLsByFileName() map[string][]string { // Function to index known URLs for matching
+	knownURLsByName := make(map[string][]string)                                                                                    // Known URLs by lower-case file name
+	for _, knownURL := range append(slices.Collect(maps.Keys(archiveCatalog.Entries)), slices.Collect(maps.Keys(brokenLinks))...) { // Every URL the archive knows
+		if parsedURL, parseError := url.Parse(knownURL); parseError == nil { // Use the file name in the path
+			fileName := strings.ToLower(path.Base(parsedURL.Path))                  // Names are compared case-insensitively
+			knownURLsByName[fileName] = append(knownURLsByName[fileName], knownURL) // Remember the URL
+		}
+	}
+	return knownURLsByName // Return the index
+} // End of knownURLsByFileName function
+
+// Imports one PDF into the archive and returns what happened to it: "duplicate" when its content is already archived,
+// "restored" when it replaced the missing copy of a cataloged file, "imported" when it was filed and cataloged as if
+// downloaded from the known URL its file name matches (or the synthetic URL file:///imported/<name> when none does),
+// and "rejected" when it is not a valid PDF or would overwrite different content. Errors are I/O failures.
+func importPDFFile(filePath string, outputDirectory string, knownURLsByName map[string][]string) (string, error) { // Function to import one file
+	if validationError := validatePDFFile(filePath); validationError != nil { // Reject truncated or corrupt files
+		logWarningf("Not importing %s: %v", filePath, validationError) // Log the rejection
+		return "rejected", nil                                         // Leave the file alone
+	}
+	fileData, readError := os.ReadFile(filePath) // Read the PDF
+	if readError != nil {                        // Check if the file is unreadable
+		return "rejected", readError // Return the error
+	}
+	contentHasher := newContentHasher()                                                            // Hash with the archive's algorithm
+	contentHasher.Write(fileData)                                                                  // Writes to a hash never fail
+	sha256Hash, blake3Hash := contentHashFields(hex.EncodeToString(contentHasher.Sum(nil)))        // File the hash
+	candidate := &catalogEntry{SHA256: sha256Hash, BLAKE3: blake3Hash, Size: int64(len(fileData))} // For comparing content
+
+	for _, entry := range archiveCatalog.Entries { // Compare against every cataloged file
+		if !sameContent(entry, candidate) { // Only identical bytes matter
+			continue // Try the next entry
+		}
+		if fileExists(filepath.FromSlash(entry.Path)) { // Check if the archived copy is still there
+			log.Printf("Already archived as %s: %s", entry.Path, filePath) // Log the skip
+			return "duplicate", nil                                        // Nothing to do
+		}
+		if mkdirError := os.MkdirAll(filepath.Dir(filepath.FromSlash(entry.Path)), 0o755); mkdirError != nil { // Recreate its directory
+			return "rejected", mkdirError // Return the error
+		}
+		if copyError := copyFile(filePath, filepath.FromSlash(entry.Path)); copyError != nil { // Put the file back
+			return "rejected", copyError // Return the error
+		}
+		log.Printf("Restored %s from %s", entry.Path, filePath) // Log the restore
+		return "restored", nil                                  // Done with this file
+	}
+
+	sourceURL := "file:///imported/" + url.PathEscape(filepath.Base(filePath))                             // Origin of files no known URL matches
+	if matchingURLs := knownURLsByName[strings.ToLower(filepath.Base(filePath))]; len(matchingURLs) == 1 { // Only an unambiguous name identifies a URL
+		sourceURL = matchingURLs[0] // The file was downloaded from there
+	} else if len(matchingURLs) > 1 { // Several URLs share the name
+		logWarningf("%s matches %d known URLs by name; importing it without one", filePath, len(matchingURLs)) // Log the ambiguity
+	}
+	destinationPath := outputPathForURL(sourceURL, outputDirectory) // Where a download of the URL would be stored
+	if destinationPath == "" {                                      // Check if the path could not be prepared
+		return "rejected", nil // Leave the file alone
+	}
+	if fileExists(destinationPath) { // Never overwrite different content already in the archive
+		logWarningf("Not importing %s: %s already exists with different content", filePath, destinationPath) // Log the conflict
+		return "rejected", nil                                                                               // Leave the file alone
+	}
+	if copyError := copyFile(filePath, destinationPath); copyError != nil { // File the PDF
+		return "rejected", copyError // Return the error
+	}
+
+	product, version := detectManualVersion(filepath.Base(destinationPath)) // Detect the product and revision from the filename
+	versionSource := "filename"                                             // Where the revision was found
+	encrypted := isPDFEncrypted(fileData)                                   // Check for password protection or DRM
+	if version == "" && !encrypted {                                        // Fall back to the first page
+		version = detectVersionInText(firstPageText(destinationPath)) // Look for a revision on the first page
+		versionSource = "first-page"                                  // Remember that the revision came from the content
+	}
+	if version == "" { // No revision anywhere
+		versionSource = "" // Nothing to attribute
+	}
+	model, modelSource := classifyDownload(sourceURL) // Classify the manual from its URL
+	if model == "" && !encrypted {                    // Fall back to the first page
+		if model = classifyFirstPage(firstPageText(destinationPath)); model != "" { // Look for a model on the first page
+			modelSource = "content" // Remember that the model came from the content
+		}
+	}
+	importedAt := time.Now().UTC().Format(time.RFC3339) // When the file joined the archive
+	recordCatalogEntry(&catalogEntry{                   // Add the file to the catalog
+		URL:           sourceURL,                         // Where the file came from
+		Kind:          "manual",                          // PDFs are manuals
+		Path:          filepath.ToSlash(destinationPath), // Where the file is stored
+		SHA256:        sha256Hash,                        // Content hash
+		BLAKE3:        blake3Hash,                        // Content hash
+		Size:          int64(len(fileData)),              // Number of bytes imported
+		Product:       product,                           // Detected product key
+		Version:       version,                           // Detected revision, if any
+		VersionSource: versionSource,                     // Where the revision was found
+		Model:         model,                             // Classified model, if any
+		ModelSource:   modelSource,                       // Where the model was found
+		Language:      detectManualLanguage(sourceURL),   // Detected manual language, if any
+		Encrypted:     encrypted,                         // Whether the PDF is password-protected or DRM'd
+		FirstSeen:     importedAt,                        // First time the file was archived
+		LastSeen:      importedAt,                        // Last time the file was seen
+	}) // End of catalog entry
+	recordLinkOutcome(sourceURL, "", true)                                    // A failing link is archived now
+	log.Printf("Imported %s → %s (%s)", filePath, destinationPath, sourceURL) // Log the import
+	return "imported", nil                                                    // Done with this file
+} // End of importPDFFile function
+
+// Combines the archive in another working directory (e.g. a copy of the club machine's) into this one. Files are
+// matched by content hash: content already here is not copied again, files new to this archive are copied to the same
+// relative path with their sidecars, and a URL downloaded on both machines keeps the newer download. Entries for the
+// same URL are merged field by field so neither side's metadata is lost, and the update timelines, product records,
+// page metadata, external assets and public archive submissions are combined.
+func runMerge(otherRoot string, outputDirectory string) error { // Function implementing the merge subcommand
+	if otherRoot == "" { // The other archive is required
+		return fmt.Errorf("usage: merge <other archive's working directory>") // Return a clear message
+	}
+	otherCatalogPath := filepath.Join(otherRoot, outputDirectory, catalogFilename) // The other archive's catalog
+	if !fileExists(otherCatalogPath) {                                             // Check that it is an archive
+		return fmt.Errorf("merge: no catalog at %s", otherCatalogPath) // Return a clear message
+	}
+	otherCatalog := readCatalogFile(otherCatalogPath)              // The other archive's state
+	catalogPath := filepath.Join(outputDirectory, catalogFilename) // Where this archive's catalog is stored
+	loadCatalog(catalogPath)                                       // This archive's state
+
+	copiedCount, mergedCount, skippedCount, mergeError := mergeCatalogEntries(otherCatalog, func(otherEntry *catalogEntry, localPath string) error { // Copy files from the other working directory
+		otherFile := filepath.Join(otherRoot, filepath.FromSlash(path.Clean(otherEntry.Path))) // The other archive's copy
+		if copyError := copyFile(otherFile, localPath); copyError != nil {                     // Copy the file
+			return copyError // Return the error
+		}
+		if fileExists(otherFile + ".json") { // Bring the sidecar along
+			if copyError := copyFile(otherFile+".json", localPath+".json"); copyError != nil { // Copy it
+				logError(copyError) // Log the error; the file itself is merged
+			}
+		}
+		return nil // Copied
+	}) // End of file copier
+	if mergeError != nil { // Check if the archive could not be written
+		return fmt.Errorf("merge: %w", mergeError) // Return the error
+	}
+	mergeCatalogRecords(otherCatalog) // Combine everything besides the entries
+
+	saveCatalog(catalogPath)                                                                                                  // Persist the merged catalog
+	writeChecksums(filepath.Join(outputDirectory, checksumsFilename))                                                         // List the merged files' hashes
+	log.Printf("Merged %d entries from %s: %d file(s) copied, %d skipped", mergedCount, otherRoot, copiedCount, skippedCount) // Summary
+	return nil                                                                                                                // Success
+} // End of runMerge function
+
+// Merges another archive's catalog entries into the loaded catalog, calling fetchFile to bring a file this archive
+// lacks to its local path; see runMerge for the rules. Files that cannot be fetched are logged and skipped.
+func mergeCatalogEntries(otherCatalog *catalog, fetchFile func(otherEntry *catalogEntry, localPath string) error) (int, int, int, error) { // Function to merge catalog entries
+	copiedCount, mergedCount, skippedCount := 0, 0, 0                         // Summary counters
+	for _, otherURL := range slices.Sorted(maps.Keys(otherCatalog.Entries)) { // Merge each entry in a stable order
+		otherEntry := otherCatalog.Entries[otherURL]                 // The other archive's record
+		localPath := filepath.FromSlash(path.Clean(otherEntry.Path)) // Same relative path here
+		if otherEntry.Path == "" || !isArchivedFilePath(localPath) { // Never write outside the archive's download directories
+			logWarningf("Skipping %s: unsafe path %q", otherURL, otherEntry.Path) // Log the skip
+			skippedCount++                                                        // Count it
+			continue                                                              // Try the next entry
+		}
+
+		localEntry, known := archiveCatalog.Entries[otherURL] // This archive's record of the URL
+		if known && sameContent(localEntry, otherEntry) {     // Both machines downloaded the same bytes
+			mergeEntryMetadata(localEntry, otherEntry) // Combine what each side knows
+			mergedCount++                              // Count it
+			continue                                   // The file is already here
+		}
+		if known && otherEntry.FirstSeen <= localEntry.FirstSeen { // This archive has the newer download of the URL
+			mergeEntryMetadata(localEntry, otherEntry) // Keep the older download in the history
+			mergedCount++                              // Count it
+			continue                                   // Keep the local file
+		}
+
+		mergedEntry := *otherEntry                        // The other machine's record, adopted here
+		for _, existing := range archiveCatalog.Entries { // Look for the same content under another URL
+			if sameContent(existing, otherEntry) && fileExists(filepath.FromSlash(existing.Path)) { // Check if the bytes are already here
+				localPath = filepath.FromSlash(existing.Path) // Share the existing file instead of copying it again
+				break                                         // One copy is enough
+			}
+		}
+		if !fileExists(localPath) || (known && filepath.FromSlash(localEntry.Path) == localPath) { // Copy new content, or the newer download of a known URL
+			if mkdirError := os.MkdirAll(filepath.Dir(localPath), 0o755); mkdirError != nil { // Create the directory
+				return copiedCount, mergedCount, skippedCount, mkdirError // Return the error
+			}
+			if fetchError := fetchFile(otherEntry, localPath); fetchError != nil { // Bring the file here
+				logWarningf("Skipping %s: %v", otherURL, fetchError) // Log the skip
+				skippedCount++                                       // Count it
+				continue                                             // Try the next entry
+			}
+			copiedCount++ // Count it
+		} else if !slices.ContainsFunc(slices.Collect(maps.Values(archiveCatalog.Entries)), func(existing *catalogEntry) bool { // Only share a file cataloged with the same content
+			return existing.Path == filepath.ToSlash(localPath) && sameContent(existing, otherEntry) // Same file, same bytes
+		}) { // Never overwrite or adopt other content
+			logWarningf("Skipping %s: %s holds different content here", otherURL, localPath) // Log the conflict
+			skippedCount++                                                                   // Count it
+			continue                                                                         // Try the next entry
+		}
+		mergedEntry.Path = filepath.ToSlash(localPath) // Where the content is stored here
+		if known {                                     // Keep this archive's older download in the history
+			mergeEntryMetadata(&mergedEntry, localEntry) // Combine what each side knows
+		}
+		archiveCatalog.Entries[otherURL] = &mergedEntry // Store the entry
+		mergedCount++                                   // Count it
+	}
+	return copiedCount, mergedCount, skippedCount, nil // Summary counters
+} // End of mergeCatalogEntries function
+
+// Combines another archive's update timeline, product records, page metadata, external assets and public archive
+// submissions into the loaded catalog
+func mergeCatalogRecords(otherCatalog *catalog) { // Function to merge everything besides the entries
+	for product, updates := range otherCatalog.UpdateTimeline { // Combine the update timelines
+		for _, update := range updates { // Add each dated update this archive lacks
+			if modifiedTime, parseError := time.Parse(time.RFC3339, update.LastModified); parseError == nil { // Dates are stored in RFC 3339
+				recordLastModified(&catalogEntry{URL: update.URL, Kind: update.Kind, Version: update.Version, Product: product}, modifiedTime.Format(http.TimeFormat)) // Record it, if new
+			}
+		}
+	}
+	archiveCatalog.Products = mergeMissingKeys(archiveCatalog.Products, otherCatalog.Products)                   // Product pages only one side scraped
+	archiveCatalog.Pages = mergeMissingKeys(archiveCatalog.Pages, otherCatalog.Pages)                            // Page metadata only one side has
+	archiveCatalog.External = mergeMissingKeys(archiveCatalog.External, otherCatalog.External)                   // External assets only one side found
+	archiveCatalog.PublicArchives = mergeMissingKeys(archiveCatalog.PublicArchives, otherCatalog.PublicArchives) // Submissions only one side made
+} // End of mergeCatalogRecords function
+
+// Where a replica's last sync left off
+type syncState struct { // Fields stored in sync-state.json
+	Primary  string `json:"primary"`   // Base URL of the primary instance
+	SyncedTo string `json:"synced_to"` // Last-Modified of the primary's catalog at the last complete sync
+} // End of syncState struct
+
+// Makes this archive a replica of a primary instance running serve mode, e.g. an offsite copy: only catalog rows that
+// changed or were removed since the last complete sync are requested from "/api/catalog", removed rows are dropped
+// here too, and only files this archive lacks are downloaded from "/files/" and checked against the catalog's hash
+// before they are stored. Entries are combined as
+// by the merge subcommand, so a replica can also be a working archive of its own.
+func runSync(primaryURL string, outputDirectory string) error { // Function implementing the sync subcommand
+	if primaryURL == "" { // The primary is required
+		return fmt.Errorf("usage: sync <primary's serve URL>") // Return a clear message
+	}
+	primaryBase, parseError := url.Parse(strings.TrimSuffix(primaryURL, "/"))                                           // Base URL of the primary
+	if parseError != nil || (primaryBase.Scheme != "http" && primaryBase.Scheme != "https") || primaryBase.Host == "" { // Only web servers can be synced from
+		return fmt.Errorf("sync: %q is not an http:// or https:// URL", primaryURL) // Return a clear message
+	}
+	catalogPath := filepath.Join(outputDirectory, catalogFilename)     // Where this archive's catalog is stored
+	syncStatePath := filepath.Join(outputDirectory, syncStateFilename) // Where the last sync is recorded
+	loadCatalog(catalogPath)                                           // This archive's state
+
+	var lastSync syncState                                                    // Starts empty before the first sync
+	if stateData, readError := os.ReadFile(syncStatePath); readError == nil { // Resume from the last sync, if any
+		if unmarshalError := json.Unmarshal(stateData, &lastSync); unmarshalError != nil { // Decode it
+			logError(unmarshalError) // Log the error; everything is requested again
+		}
+	}
+	catalogURL := primaryBase.JoinPath("api", "catalog")                     // The primary's catalog
+	if lastSync.Primary == primaryBase.String() && lastSync.SyncedTo != "" { // Only ask for what changed since then
+		catalogURL.RawQuery = url.Values{"since": {lastSync.SyncedTo}}.Encode() // Rows seen at or after the last sync
+	}
+
+	httpClient := &http.Client{Timeout: 15 * time.Minute, CheckRedirect: refuseRedirectsOffHost(primaryBase.Host)} // Same limit as file downloads
+	catalogResponse, getError := httpClient.Get(catalogURL.String())                                               // Request the catalog
+	if getError != nil {                                                                                           // Check if the primary is unreachable
+		return fmt.Errorf("sync: %w", getError) // Return the error
+	}
+	defer catalogResponse.Body.Close()               // Ensure the body is closed
+	if catalogResponse.StatusCode != http.StatusOK { // Check if the primary refused
+		return fmt.Errorf("sync: %s answered %s", catalogURL, catalogResponse.Status) // Return a clear message
+	}
+	primaryCatalog := &catalog{}                                                                         // The primary's changed rows
+	if decodeError := json.NewDecoder(catalogResponse.Body).Decode(primaryCatalog); decodeError != nil { // Decode the catalog
+		return fmt.Errorf("sync: %w", decodeError) // Return the error
+	}
+
+	failedCount := 0                                                                                                                                   // Files the primary could not deliver intact
+	copiedCount, mergedCount, skippedCount, mergeError := mergeCatalogEntries(primaryCatalog, func(otherEntry *catalogEntry, localPath string) error { // Download files from the primary
+		fetchError := fetchVerifiedFile(httpClient, primaryBase.JoinPath("files", otherEntry.Path).String(), otherEntry, localPath) // Download the file
+		if fetchError != nil {                                                                                                      // Check if the download failed
+			failedCount++ // Retry it at the next sync
+		}
+		return fetchError // Return any error
+	}) // End of file downloader
+	if mergeError != nil { // Check if the archive could not be written
+		return fmt.Errorf("sync: %w", mergeError) // Return the error
+	}
+	mergeCatalogRecords(primaryCatalog)                          // Combine everything besides the entries
+	removedCount := applyCatalogRemovals(primaryCatalog.Removed) // Drop what the primary removed
+
+	saveCatalog(catalogPath)                                          // Persist the synced catalog
+	writeChecksums(filepath.Join(outputDirectory, checksumsFilename)) // List the synced files' hashes
+	if failedCount == 0 {                                             // Only a complete sync moves the starting point forward
+		stateData, marshalError := json.MarshalIndent(syncState{Primary: primaryBase.String(), SyncedTo: catalogResponse.Header.Get("Last-Modified")}, "", "  ") // Encode the state
+		if marshalError != nil {                                                                                                                                 // Check if encoding failed
+			return fmt.Errorf("sync: %w", marshalError) // Return the error
+		}
+		if writeError := writeArchiveFile(syncStatePath, append(stateData, '\n'), 0o644); writeError != nil { // Record the sync
+			logError(writeError) // Log the error; the next sync requests more than needed
+		}
+	}
+	log.Printf("Synced %d changed entries from %s: %d file(s) downloaded, %d removed, %d skipped, %d failed", mergedCount, primaryBase, copiedCount, removedCount, skippedCount, failedCount) // Summary
+	return nil                                                                                                                                                                                // Success
+} // End of runSync function
+
+// Drops the entries another archive removed (see stampCatalogChanges), unless this archive changed them after the
+// removal, and deletes their files when no remaining entry shares them; returns the number of entries dropped
+func applyCatalogRemovals(removed map[string]string) int { // Function to apply another archive's tombstones
+	removedCount := 0                                              // Entries dropped
+	for _, removedURL := range slices.Sorted(maps.Keys(removed)) { // Apply each tombstone in a stable order
+		localEntry, found := archiveCatalog.Entries[removedURL]  // This archive's record of the URL
+		if !found || localEntry.Modified > removed[removedURL] { // RFC 3339 timestamps sort as text
+			continue // Unknown here, or changed here since
+		}
+		delete(archiveCatalog.Entries, removedURL)                                                                                                                                                                         // Forget the entry
+		removedCount++                                                                                                                                                                                                     // Count it
+		localPath := filepath.FromSlash(localEntry.Path)                                                                                                                                                                   // The entry's file
+		if slices.ContainsFunc(slices.Collect(maps.Values(archiveCatalog.Entries)), func(other *catalogEntry) bool { return other.Path == localEntry.Path }) || !isArchivedFilePath(localPath) || !fileExists(localPath) { // Keep shared files, and never touch files outside the archive
+			continue // Leave the file alone
+		}
+		if removeError := removeArchiveFile(localPath); removeError != nil { // Delete the file
+			logError(removeError) // Log the error
+		}
+	}
+	return removedCount // Return the count
+} // End of applyCatalogRemovals function
+
+// Downloads a file to localPath, replacing it only once the content matches the entry's size and hash
+func fetchVerifiedFile(httpClient *http.Client, fileURL string, entry *catalogEntry, localPath string) error { // Function to download a verified file
+	contentHasher, expectedHash := hash.Hash(sha256.New()), entry.SHA256 // Prefer SHA-256, as sameContent does
+	if expectedHash == "" {                                              // Archives using -hash=blake3
+		contentHasher, expectedHash = blake3.New(), entry.BLAKE3 // Use BLAKE3 instead
+	}
+	if expectedHash == "" { // Unhashed entries cannot be verified
+		return fmt.Errorf("no content hash to verify %s against", fileURL) // Return a clear message
+	}
+
+	fileResponse, getError := httpClient.Get(fileURL) // Request the file
+	if getError != nil {                              // Check if the request failed
+		return getError // Return the error
+	}
+	defer fileResponse.Body.Close()               // Ensure the body is closed
+	if fileResponse.StatusCode != http.StatusOK { // Check if the server refused
+		return fmt.Errorf("%s answered %s", fileURL, fileResponse.Status) // Return a clear message
+	}
+
+	partialFile, createError := os.CreateTemp(filepath.Dir(localPath), ".sync-*") // Download next to the destination, so the rename is atomic
+	if createError != nil {                                                       // Check if the file could not be created
+		return createError // Return the error
+	}
+	defer os.Remove(partialFile.Name())                                                              // Clean up unless renamed
+	copiedBytes, copyError := io.Copy(io.MultiWriter(partialFile, contentHasher), fileResponse.Body) // Download and hash at once
+	if closeError := partialFile.Close(); copyError == nil {                                         // Check if the download was written completely
+		copyError = closeError // Report the close error instead
+	}
+	if copyError != nil { // Check if the download failed
+		return copyError // Return the error
+	}
+	if actualHash := hex.EncodeToString(contentHasher.Sum(nil)); copiedBytes != entry.Size || actualHash != expectedHash { // Check the content
+		return fmt.Errorf("%s does not match the catalog (%d bytes, hash %s)", fileURL, copiedBytes, actualHash) // Return a clear message
+	}
+	renameError := os.Rename(partialFile.Name(), localPath)                                   // Move the verified file into place
+	recordAudit(auditEntry{Action: "write", Path: localPath, Size: copiedBytes}, renameError) // Audit the download
+	return renameError                                                                        // Return any rename error
+} // End of fetchVerifiedFile function
+
+// Adds the entries of other whose keys target lacks, returning target, which is created when nil
+func mergeMissingKeys[Value any](target map[string]Value, other map[string]Value) map[string]Value { // Function to combine catalog maps
+	for key, value := range other { // Visit each of the other side's entries
+		if _, found := target[key]; found { // This side's record wins
+			continue // Keep it
+		}
+		if target == nil { // Create the map on first use
+			target = make(map[string]Value) // Start an empty map
+		}
+		target[key] = value // Adopt the other side's record
+	} // End of map loop
+	return target // Return the combined map
+} // End of mergeMissingKeys function
+
+// Fills in what target does not know from other, an entry for the same URL: empty fields are taken over, the first and
+// last sightings widen to cover both, and the download histories are combined
+func mergeEntryMetadata(target *catalogEntry, other *catalogEntry) { // Function to merge two records of one URL
+	for _, field := range []struct{ targetField, otherField *string }{ // Text fields where a value beats none
+		{&target.Kind, &other.Kind}, {&target.Version, &other.Version}, {&target.VersionSource, &other.VersionSource}, {&target.Language, &other.Language},
+		{&target.SourcePage, &other.SourcePage}, {&target.MirrorURL, &other.MirrorURL}, {&target.UpgradedFrom, &other.UpgradedFrom}, {&target.Model, &other.Model}, {&target.ModelSource, &other.ModelSource},
+		{&target.PublishedChecksum, &other.PublishedChecksum}, {&target.ChecksumStatus, &other.ChecksumStatus},
+		{&target.ETag, &other.ETag}, {&target.LastModified, &other.LastModified}, {&target.ReuploadOf, &other.ReuploadOf},
+	} { // End of field list
+		if *field.targetField == "" { // Only fill gaps
+			*field.targetField = *field.otherField // Take the other side's value
+		}
+	}
+	if other.FirstSeen != "" && (target.FirstSeen == "" || other.FirstSeen < target.FirstSeen) { // RFC 3339 timestamps sort as text
+		target.FirstSeen = other.FirstSeen // The other side saw it first
+	}
+	target.LastSeen = max(target.LastSeen, other.LastSeen) // The latest sighting on either side
+	target.Encrypted = target.Encrypted || other.Encrypted // Either side may have detected it
+
+	for _, record := range other.History { // Add the other side's downloads
+		if !slices.Contains(target.History, record) { // Skip downloads both sides recorded
+			target.History = append(target.History, record) // Add the download
+		}
+	}
+	slices.SortFunc(target.History, func(first, second fetchRecord) int { return strings.Compare(first.FetchedAt, second.FetchedAt) }) // Oldest first
+} // End of mergeEntryMetadata function
+
+// Moves the PDFs dropped into the inbox into the archive: files still being written (modified within the last
+// -inbox-settle) are left for the next poll, files imported, restored, or already archived leave the inbox, and
+// files that cannot be imported are moved to its "rejected" subdirectory. Callers must hold archiveRunMutex.
+func processInbox(inboxDirectory string, outputDirectory string) { // Function to empty the inbox
+	inboxEntries, readError := os.ReadDir(inboxDirectory) // List the inbox
+	if readError != nil {                                 // Check if the inbox is unreadable
+		logError(readError) // Log the error
+		return              // Try again at the next poll
+	}
+	var droppedFiles []string               // PDFs ready to import
+	for _, dirEntry := range inboxEntries { // Check each entry
+		fileInfo, infoError := dirEntry.Info()                                                                                                                  // Size and modification time
+		if infoError != nil || dirEntry.IsDir() || !strings.EqualFold(filepath.Ext(dirEntry.Name()), ".pdf") || time.Since(fileInfo.ModTime()) < *inboxSettle { // Only PDFs that finished copying
+			continue // Leave the entry
+		}
+		droppedFiles = append(droppedFiles, filepath.Join(inboxDirectory, dirEntry.Name())) // Import it
+	}
+	if len(droppedFiles) == 0 { // Check if anything was dropped
+		return // Nothing to do
+	}
+
+	catalogPath := filepath.Join(outputDirectory, catalogFilename)         // Where the catalog is stored
+	brokenLinksPath := filepath.Join(outputDirectory, brokenLinksFilename) // Where links failing across runs are listed
+	loadCatalog(catalogPath)                                               // Load the catalog to match against
+	loadBrokenLinks(brokenLinksPath)                                       // Failing links may be exactly what was dropped
+	knownURLsByName := knownURLsByFileName()                               // URLs to match file names against
+	for _, droppedFile := range droppedFiles {                             // Import each file
+		outcome, importError := importPDFFile(droppedFile, outputDirectory, knownURLsByName) // Import the file
+		if importError != nil {                                                              // Check if an I/O error interrupted it
+			logErrorf("Failed to import %s from the inbox %v", droppedFile, importError) // Log the error; the file stays for the next poll
+			continue                                                                     // Try the next file
+		}
+		if outcome == "rejected" { // Keep rejected files out of the way, but at hand
+			rejectedDirectory := filepath.Join(inboxDirectory, "rejected")              // Where rejected files go
+			if mkdirError := os.MkdirAll(rejectedDirectory, 0o755); mkdirError != nil { // Create it
+				logError(mkdirError) // Log the error
+				continue             // Try the next file
+			}
+			if renameError := renameArchiveFile(droppedFile, filepath.Join(rejectedDirectory, filepath.Base(droppedFile))); renameError != nil { // Move the file aside
+				logError(renameError) // Log the error
+			}
+			continue // Done with this file
+		}
+		if removeError := removeArchiveFile(droppedFile); removeError != nil { // The archive has the file now
+			logError(removeError) // Log the error
+		}
+		emitEvent("inbox_file_processed", map[string]any{"file": filepath.Base(droppedFile), "outcome": outcome}) // Notify listeners
+	}
+	saveCatalog(catalogPath)                                          // Persist the imported entries
+	saveBrokenLinks(brokenLinksPath)                                  // Persist the recovered links
+	writeChecksums(filepath.Join(outputDirectory, checksumsFilename)) // List the new files' hashes
+} // End of processInbox function
+
+// Prints the cataloged files matching the query flags, one per line, so scripts can pick files out of the archive
+// (e.g. "query -product zorro -lang en -latest"). Paths are printed by default, URLs with -url, whole entries with -json.
+func runQuery(arguments []string) error { // Function implementing the query subcommand
+	queryFlags := flag.NewFlagSet("query", flag.ContinueOnError)                                                           // The subcommand's own flags
+	product := queryFlags.String("product", "", "match files whose product key contains this text or whose model is this") // Product filter
+	language := queryFlags.String("lang", "", "match files in this ISO 639-1 language")                                    // Language filter
+	kind := queryFlags.String("kind", "", "match only \"manual\", \"firmware\" or \"software\" files")                     // Kind filter
+	latest := queryFlags.Bool("latest", false, "keep only the newest revision of each product, language, and kind")        // Newest revisions only
+	printURLs := queryFlags.Bool("url", false, "print source URLs instead of file paths")                                  // Print URLs
+	printJSON := queryFlags.Bool("json", false, "print each matching catalog entry as a line of JSON")                     // Print entries
+	if parseError := queryFlags.Parse(arguments); parseError != nil {                                                      // Parse the subcommand's flags
+		return parseError // Return the error
+	}
+
+	var matches []*catalogEntry                    // Files matching every filter
+	for _, entry := range archiveCatalog.Entries { // Check every cataloged file
+		if *product != "" && !strings.Contains(strings.ToLower(entry.Product), strings.ToLower(*product)) && !strings.EqualFold(entry.Model, *product) { // Check the product
+			continue // Another product
+		}
+		if (*language != "" && !strings.EqualFold(entry.Language, *language)) || (*kind != "" && entry.Kind != *kind) { // Check the language and kind
+			continue // Another language or kind
+		}
+		matches = append(matches, entry) // Keep the file
+	}
+	slices.SortFunc(matches, func(first, second *catalogEntry) int { // Group by product, newest revision first
+		if order := strings.Compare(first.Product, second.Product); order != 0 { // Compare the products
+			return order // Alphabetical by product
+		}
+		if order := compareManualVersions(second.Version, first.Version); order != 0 { // Compare the revisions
+			return order // Newer first
+		}
+		return strings.Compare(second.FirstSeen, first.FirstSeen) // Most recently downloaded first
+	}) // End of match sort
+
+	seenGroups := make(map[string]bool) // Product, language, and kind combinations already printed, for -latest
+	for _, entry := range matches {     // Print each match
+		group := entry.Product + "\x00" + entry.Language + "\x00" + entry.Kind // The file's group
+		if *latest && seenGroups[group] {                                      // Check if a newer revision was printed
+			continue // Skip older revisions
+		}
+		seenGroups[group] = true // Remember the group
+		switch {
+		case *printJSON:
+			entryJSON, marshalError := json.Marshal(entry) // Encode the entry
+			if marshalError != nil {                       // Check if encoding failed
+				return marshalError // Return the error
+			}
+			fmt.Println(string(entryJSON)) // One entry per line
+		case *printURLs:
+			fmt.Println(entry.URL) // The source URL
+		default:
+			fmt.Println(entry.Path) // The file path
+		}
+	}
+	return nil // Every match was printed
+} // End of runQuery function
+
+// Scrapes the source pages and prints which links are new or no longer listed compared with the catalog, without downloading anything.
+// Nothing is printed when the site and catalog agree, so the command can run from cron and only mail when something changed.
+func runCheck(sourceURLs []string) { // Function implementing the check subcommand
+	pageLinks := make(map[string][]string) // Downloadable links of each source page that was scraped successfully
+	for _, sourceURL := range sourceURLs { // Visit each source page
+		if !isUrlValid(sourceURL) { // Skip invalid URLs
+			continue // Move on to the next page
+		}
+		htmlContent := scrapePage(sourceURL) // Render the page
+		if htmlContent == "" {               // Check if the page could not be scraped
+			logWarningf("Could not scrape %s; its links are left out of the comparison", sourceURL) // Avoid reporting everything as removed
+			continue                                                                                // Move on to the next page
+		}
+		linkHTML := scopeToSelectors(sourceURL, htmlContent)                                                                                                          // Limit extraction exactly as a run would
+		pageLinks[sourceURL] = slices.Concat(extractPDFUrls(sourceURL, linkHTML), extractFirmwareUrls(sourceURL, linkHTML), extractSoftwareUrls(sourceURL, linkHTML)) // Collect every downloadable link
+	}
+
+	newLinks, removedLinks := catalogDifferences(pageLinks, len(sourceURLs)) // Compare the site with the catalog
+	for _, link := range newLinks {                                          // Print each new link
+		fmt.Println("+ " + link) // Prefix additions with "+"
+	}
+	for _, link := range removedLinks { // Print each removed link
+		fmt.Println("- " + link) // Prefix removals with "-"
+	}
+	if len(newLinks) > 0 || len(removedLinks) > 0 { // Summarize only when something changed
+		fmt.Printf("%d new, %d removed\n", len(newLinks), len(removedLinks)) // Print the summary
+	}
+} // End of runCheck function
+
+// Compares the links of the scraped source pages, keyed by page, with the catalog, returning the links that are not
+// cataloged and the cataloged links of those pages that are no longer listed, both sorted. Links are compared in the
+// form a run catalogs them; sourceCount is the number of source pages, so entries without a source page are only
+// reported removed when every page was scraped.
+func catalogDifferences(pageLinks map[string][]string, sourceCount int) ([]string, []string) { // Function to compare the site with the catalog
+	liveLinks := make(map[string]bool) // Catalog keys of the links currently listed
+	for _, links := range pageLinks {  // Visit each scraped page
+		for _, link := range links { // Record each of its links
+			liveLinks[catalogKeyForLink(link)] = true // Record the live link
+		}
+	}
+
+	var newLinks, removedLinks []string // Differences between the site and the catalog
+	for link := range liveLinks {       // Links on the site that are not cataloged are new
+		if _, found := archiveCatalog.Entries[link]; !found { // Check the catalog
+			newLinks = append(newLinks, link) // Record the new link
+		}
+	}
+	for link, entry := range archiveCatalog.Entries { // Cataloged links from a compared page that are gone were removed
+		_, scraped := pageLinks[entry.SourcePage]                                                // Whether the entry's page was compared
+		fromComparedPage := scraped || (entry.SourcePage == "" && len(pageLinks) == sourceCount) // Entries without a source page predate source tracking and came from the source pages
+		if fromComparedPage && !liveLinks[link] {                                                // Check whether the link is still listed
+			removedLinks = append(removedLinks, link) // Record the removed link
+		}
+	}
+	sort.Strings(newLinks)        // Sort for stable output
+	sort.Strings(removedLinks)    // Sort for stable output
+	return newLinks, removedLinks // Return the differences
+} // End of catalogDifferences function
+
+// Returns the key a run would catalog a scraped link under: its canonical form, or the https:// form of a plain link
+// whose entry -https-upgrade already moved there
+func catalogKeyForLink(link string) string { // Function to match scraped links with catalog keys
+	canonicalLink := canonicalLinkURL(link)                       // Cache-busted and tracked variants collapse into one key
+	if _, found := archiveCatalog.Entries[canonicalLink]; found { // Check the catalog
+		return canonicalLink // Cataloged as is
+	}
+	parsedLink, parseError := url.Parse(canonicalLink)    // Parse the link
+	if parseError != nil || parsedLink.Scheme != "http" { // Only plaintext links are upgraded
+		return canonicalLink // Not cataloged yet
+	}
+	parsedLink.Scheme = "https"    // The upgraded link, built as upgradeQueueToHTTPS does
+	if parsedLink.Port() == "80" { // The plaintext port does not speak TLS
+		parsedLink.Host = parsedLink.Hostname() // Use the default HTTPS port instead
+	}
+	if _, found := archiveCatalog.Entries[parsedLink.String()]; found { // Check whether an earlier run upgraded the link
+		return parsedLink.String() // Cataloged under the upgraded link
+	}
+	return canonicalLink // Not cataloged yet
+} // End of catalogKeyForLink function
+
+// Counters describing one run, reported in the run_finished event
+type runStats struct { // Fields stored for each run
+	mutex      sync.Mutex // Guards the counters, which the dashboard reads while the run updates them
+	StartedAt  time.Time  `json:"started_at"`  // When the run started
+	FinishedAt time.Time  `json:"finished_at"` // When the run finished
+	Downloaded int        `json:"downloaded"`  // Files downloaded successfully
+	Skipped    int        `json:"skipped"`     // Files skipped because they were already on disk
+	Failed     int        `json:"failed"`      // Downloads that failed or produced corrupt files
+
+	FailureThresholdExceeded bool `json:"failure_threshold_exceeded,omitempty"` // More downloads failed than -max-failure-percent allows
+	PagesBlocked             int  `json:"pages_blocked,omitempty"`              // Scrapes answered with an anti-bot block or challenge page
+
+	BytesTransferred int64            `json:"bytes_transferred"`    // Response bytes received over HTTP during the run
+	HostBytes        map[string]int64 `json:"host_bytes,omitempty"` // Response bytes received during the run, by host
+
+	PeakBytesPerSecond    int64 `json:"peak_bytes_per_second"`    // Highest throughput over any one-second interval
+	AverageBytesPerSecond int64 `json:"average_bytes_per_second"` // Bytes transferred divided by the run's duration
+	currentBytesPerSecond int64 // Throughput over the latest one-second interval
+} // End of runStats struct
+
+// Returns the current, average so far, and peak throughput in bytes per second
+func (stats *runStats) throughput() (int64, int64, int64) { // Method to read the speeds safely
+	stats.mutex.Lock()                          // Lock the counters
+	defer stats.mutex.Unlock()                  // Unlock when done
+	averageSpeed := stats.AverageBytesPerSecond // Final average of a finished run
+	if stats.FinishedAt.IsZero() {              // Check if the run is still going
+		if elapsed := time.Since(stats.StartedAt).Seconds(); elapsed > 0 { // Guard against a zero duration
+			averageSpeed = int64(float64(stats.BytesTransferred) / elapsed) // Average so far
+		}
+	}
+	return stats.currentBytesPerSecond, averageSpeed, stats.PeakBytesPerSecond // Return a consistent snapshot
+} // End of throughput method
+
+// Measures the run's throughput once a second, keeping the current and peak speeds up to date and logging the speed
+// every 30 seconds while data flows when the dashboard is not showing it. The returned function stops sampling and
+// records the run's average speed.
+func startThroughputSampler(stats *runStats) func() { // Function to measure throughput during a run
+	stopSampling := make(chan struct{}) // Closed to stop the sampler
+	samplerDone := make(chan struct{})  // Closed once the sampler has stopped
+	go func() {                         // Sample in the background
+		defer close(samplerDone)               // Signal that sampling stopped
+		ticker := time.NewTicker(time.Second)  // One sample per second
+		defer ticker.Stop()                    // Release the ticker
+		var previousBytes, reportedBytes int64 // Totals at the previous sample and at the previous log line
+		for sample := 1; ; sample++ {          // Sample until stopped
+			select {
+			case <-stopSampling: // The run is over
+				return // Stop sampling
+			case <-ticker.C: // Time for a sample
+			}
+			stats.mutex.Lock()                                                                    // Lock the counters
+			stats.currentBytesPerSecond = stats.BytesTransferred - previousBytes                  // Bytes in the last second
+			stats.PeakBytesPerSecond = max(stats.PeakBytesPerSecond, stats.currentBytesPerSecond) // Keep the peak
+			previousBytes = stats.BytesTransferred                                                // Start the next interval
+			stats.mutex.Unlock()                                                                  // Unlock
+			if !*tuiMode && sample%30 == 0 && previousBytes > reportedBytes {                     // Log the speed now and then while data flows
+				currentSpeed, averageSpeed, _ := stats.throughput()                                                                                                       // Read the speeds
+				log.Printf("Throughput: %s/s now, %s/s average, %s so far", formatByteCount(currentSpeed), formatByteCount(averageSpeed), formatByteCount(previousBytes)) // Report them
+				reportedBytes = previousBytes                                                                                                                             // Wait for more data before the next line
+			}
+		}
+	}()
+	return func() { // Stop function
+		close(stopSampling)                                                // Stop sampling
+		<-samplerDone                                                      // Wait for the last sample
+		stats.mutex.Lock()                                                 // Lock the counters
+		if elapsed := time.Since(stats.StartedAt).Seconds(); elapsed > 0 { // Guard against a zero duration
+			stats.AverageBytesPerSecond = int64(float64(stats.BytesTransferred) / elapsed) // The run's average
+		}
+		stats.currentBytesPerSecond = 0 // Nothing is flowing anymore
+		stats.mutex.Unlock()            // Unlock
+	}
+} // End of startThroughputSampler function
+
+// Counts bytes received from a host
+func (stats *runStats) addTransfer(host string, byteCount int64) { // Method to account for transferred bytes
+	stats.mutex.Lock()                  // Lock the counters
+	defer stats.mutex.Unlock()          // Unlock when done
+	stats.BytesTransferred += byteCount // Count the run's total
+	if stats.HostBytes == nil {         // First transfer of the run
+		stats.HostBytes = make(map[string]int64) // Start the per-host totals
+	}
+	stats.HostBytes[host] += byteCount // Count the host's total
+} // End of addTransfer method
+
+// Returns a copy of the bytes transferred in total and by host
+func (stats *runStats) transfers() (int64, map[string]int64) { // Method to read the transfer totals safely
+	stats.mutex.Lock()                                         // Lock the counters
+	defer stats.mutex.Unlock()                                 // Unlock when done
+	return stats.BytesTransferred, maps.Clone(stats.HostBytes) // Return a consistent snapshot
+} // End of transfers method
+
+// Adds delta to one of the run's counters
+func (stats *runStats) add(counter *int, delta int) { // Method to update a counter safely
+	stats.mutex.Lock()   // Lock the counters
+	*counter += delta    // Update the counter
+	stats.mutex.Unlock() // Unlock
+} // End of add method
+
+// Clears the counters for a new run starting now; they are cleared in place because status handlers keep reading them
+func (stats *runStats) reset() { // Method to start a run's counters
+	stats.mutex.Lock()                                                                           // Lock the counters
+	defer stats.mutex.Unlock()                                                                   // Unlock when done
+	stats.StartedAt, stats.FinishedAt = time.Now().UTC(), time.Time{}                            // The run starts now and has not finished
+	stats.Downloaded, stats.Skipped, stats.Failed, stats.PagesBlocked = 0, 0, 0, 0               // No files or pages yet
+	stats.FailureThresholdExceeded = false                                                       // Nothing has failed yet
+	stats.BytesTransferred, stats.HostBytes = 0, nil                                             // Nothing transferred yet
+	stats.PeakBytesPerSecond, stats.AverageBytesPerSecond, stats.currentBytesPerSecond = 0, 0, 0 // No speeds yet
+} // End of reset method
+
+// Records that more downloads failed than -max-failure-percent allows
+func (stats *runStats) markFailed() { // Method to flag a failed run safely
+	stats.mutex.Lock()                    // Lock the counters
+	stats.FailureThresholdExceeded = true // Mark the run as failed
+	stats.mutex.Unlock()                  // Unlock
+} // End of markFailed method
+
+// Records that the run ended now
+func (stats *runStats) finish() { // Method to close a run's counters safely
+	stats.mutex.Lock()                  // Lock the counters
+	stats.FinishedAt = time.Now().UTC() // Record when the run ended
+	stats.mutex.Unlock()                // Unlock
+} // End of finish method
+
+// Returns when the current or last run started and whether it exceeded -max-failure-percent
+func (stats *runStats) status() (time.Time, bool) { // Method to read the run's state safely
+	stats.mutex.Lock()                                     // Lock the counters
+	defer stats.mutex.Unlock()                             // Unlock when done
+	return stats.StartedAt, stats.FailureThresholdExceeded // Return a consistent snapshot
+} // End of status method
+
+// Returns the downloaded, skipped, and failed counters
+func (stats *runStats) counts() (int, int, int) { // Method to read the counters safely
+	stats.mutex.Lock()                                   // Lock the counters
+	defer stats.mutex.Unlock()                           // Unlock when done
+	return stats.Downloaded, stats.Skipped, stats.Failed // Return a consistent snapshot
+} // End of counts method
+
+// Context of the archive run in progress, cancelled when -strict stops the run early; downloads and Chrome sessions
+// are started from it, and the run's loops stop taking new work once it is done
+var currentRun = struct {
+	sync.Mutex                    // Guards context and cancel
+	context    context.Context    // The run's context
+	cancel     context.CancelFunc // Stops the run
+}{context: context.Background(), cancel: func() {}}
+
+// Reason of the first error a -strict run stopped on, which makes main exit non-zero once the run has cleaned up
+var strictFailure = struct {
+	sync.Mutex        // Guards reason
+	reason     string // Describes the error; empty while no run stopped
+}{}
+
+// Starts a new run context, returning the function that ends it
+func startRunContext() context.CancelFunc { // Function to give a run its context
+	runContext, cancelRun := context.WithCancel(context.Background()) // Cancelled by -strict or when the run ends
+	currentRun.Lock()                                                 // Lock the run
+	currentRun.context, currentRun.cancel = runContext, cancelRun     // Make it the current run
+	currentRun.Unlock()                                               // Unlock
+	return cancelRun                                                  // The caller ends the run with it
+} // End of startRunContext function
+
+// Returns the context of the run in progress, or the background context outside runs
+func runContext() context.Context { // Function to read the run's context
+	currentRun.Lock()         // Lock the run
+	defer currentRun.Unlock() // Unlock when done
+	return currentRun.context // The run's context
+} // End of runContext function
+
+// Reports whether the run in progress was stopped and should not start new work
+func runStopped() bool { // Function to check for a stopped run
+	return runContext().Err() != nil // Cancelled runs are stopped
+} // End of runStopped function
+
+// Records the first error of a -strict run and cancels the run, which then skips its remaining work but still saves
+// the catalog and its reports
+func recordStrictFailure(eventData any) { // Function to stop a run on its first error
+	strictFailure.Lock()            // Lock the reason
+	if strictFailure.reason == "" { // Only the first error counts
+		strictFailure.reason = fmt.Sprint(eventData)                                                     // Remember it
+		logErrorf("Stopping the run after the first error (-strict); finishing up first: %v", eventData) // Explain what happens next
+	}
+	strictFailure.Unlock() // Unlock
+	currentRun.Lock()      // Lock the run
+	currentRun.cancel()    // Stop the run
+	currentRun.Unlock()    // Unlock
+} // End of recordStrictFailure function
+
+// Exits non-zero when a -strict run stopped on an error; called from main once the runs have cleaned up
+func exitOnStrictFailure() { // Function to report a stopped -strict run
+	if strictRunFailed() { // Check if a run stopped
+		strictFailure.Lock()                                                                // Lock the reason
+		defer strictFailure.Unlock()                                                        // Unlock when done
+		exitAfterWebhooks("Stopped on the first error (-strict): %s", strictFailure.reason) // Exit non-zero
+	}
+} // End of exitOnStrictFailure function
+
+// Exits non-zero like logFatalf once the queued webhook events are delivered, so listeners hear about the failure
+// the process stops on
+func exitAfterWebhooks(format string, values ...any) { // Function to stop the program after a failed run
+	drainWebhooks()                                         // Deliver the queued events first
+	log.Output(2, "FATAL: "+fmt.Sprintf(format, values...)) // Tag the line like logFatalf
+	os.Exit(1)                                              // Stop like log.Fatalf
+} // End of exitAfterWebhooks function
+
+// Reports whether a -strict run stopped on an error
+func strictRunFailed() bool { // Function to check for a stopped -strict run
+	strictFailure.Lock()              // Lock the reason
+	defer strictFailure.Unlock()      // Unlock when done
+	return strictFailure.reason != "" // A recorded reason means a run stopped
+} // End of strictRunFailed function
+
+// Posts a lifecycle event to the configured webhook as {"event": …, "time": …, "data": …}.
+// When a secret is configured the body is signed with HMAC-SHA256 in the X-Signature-256 header as "sha256=<hex>".
+func emitEvent(eventName string, eventData any) { // Function to notify the webhook about an event
+	feedSystemdWatchdog()                    // Every event is progress
+	if eventName == "error" && *strictMode { // Stop the run once listeners have been handed the error
+		defer recordStrictFailure(eventData) // Cancel the run after the event is queued; it is delivered before the process exits
+	}
+	eventBody, marshalError := json.Marshal(map[string]any{ // Encode the event envelope
+		"event": eventName,                             // Event type
+		"time":  time.Now().UTC().Format(time.RFC3339), // When the event happened
+		"data":  eventData,                             // Event-specific details
+	}) // End of event envelope
+	if marshalError != nil { // Check if encoding failed
+		logError(marshalError) // Log the encoding error
+		return                 // Nothing to send
+	}
+
+	publishEvent(eventBody)        // Hand the event to gRPC stream subscribers
+	if *eventsFormat == "ndjson" { // Stream events to stdout for scripts
+		stdoutEvents.Lock()                      // Keep concurrent events on separate lines
+		os.Stdout.Write(append(eventBody, '\n')) // One event per line
+		stdoutEvents.Unlock()                    // Unlock stdout
+	}
+	if *webhookURL == "" { // Webhooks are optional
+		return // Nothing to notify
+	}
+
+	webhookSenderOnce.Do(func() { go deliverWebhooks() }) // Start the sender on the first event
+	webhookPending.Add(1)                                 // Count the event until it is delivered
+	select {
+	case webhookQueue <- webhookDelivery{eventName: eventName, eventBody: eventBody}: // Hand the event to the sender
+	default: // The receiver is slower than the run
+		webhookPending.Done()                                                  // The event will never be delivered
+		logWarningf("Webhook queue is full; dropping the %s event", eventName) // Log the loss
+	}
+} // End of emitEvent function
+
+// One event waiting to be posted to the webhook
+type webhookDelivery struct { // Fields of a queued event
+	eventName string // Event type, sent as X-Event
+	eventBody []byte // Encoded event envelope
+} // End of webhookDelivery struct
+
+// Events waiting for the webhook sender; a slow receiver never holds up the run, and events beyond the queue are dropped
+var webhookQueue = make(chan webhookDelivery, 256)
+
+var webhookSenderOnce sync.Once   // Starts the sender on the first event
+var webhookPending sync.WaitGroup // Events queued but not yet delivered
+
+// Posts queued events to the webhook one at a time, in the order they happened
+func deliverWebhooks() { // Function running the webhook sender
+	for delivery := range webhookQueue { // Send each event
+		sendWebhook(delivery.eventName, delivery.eventBody) // Post it
+		webhookPending.Done()                               // The event is delivered or given up on
+	}
+} // End of deliverWebhooks function
+
+// Waits up to 30 seconds for the queued webhook events to be delivered, so events of a finished run are not lost when
+// the process exits
+func drainWebhooks() { // Function to flush the webhook queue
+	drained := make(chan struct{}) // Closed once the queue is empty
+	go func() {                    // Wait in the background so the wait can time out
+		webhookPending.Wait() // Wait for every queued event
+		close(drained)        // Report it
+	}() // End of drain goroutine
+	select {
+	case <-drained: // Every event was delivered
+	case <-time.After(30 * time.Second): // The receiver is too slow
+		logWarning("Exiting with webhook events still queued") // Log the loss
+	}
+} // End of drainWebhooks function
+
+// Posts one encoded event to the configured webhook, signing it when a secret is configured
+func sendWebhook(eventName string, eventBody []byte) { // Function to deliver one event
+	webhookRequest, requestError := http.NewRequest(http.MethodPost, *webhookURL, bytes.NewReader(eventBody)) // Build the POST request
+	if requestError != nil {                                                                                  // Check if the request could not be built
+		logError(requestError) // Log the error
+		return                 // Nothing to send
+	}
+	webhookRequest.Header.Set("Content-Type", "application/json") // Declare the JSON body
+	webhookRequest.Header.Set("X-Event", eventName)               // Let receivers route without parsing the body
+	if *webhookSecret != "" {                                     // Sign the body when a secret is configured
+		signature := hmac.New(sha256.New, []byte(*webhookSecret))                                      // Create the HMAC
+		signature.Write(eventBody)                                                                     // Sign the exact bytes sent
+		webhookRequest.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(signature.Sum(nil))) // Attach the signature
+	}
+
+	webhookClient := &http.Client{Timeout: 10 * time.Second}       // A slow receiver must not hold up the events behind it for long
+	webhookResponse, sendError := webhookClient.Do(webhookRequest) // Send the event
+	if sendError != nil {                                          // Check if sending failed
+		logErrorf("Failed to send %s webhook %v", eventName, sendError) // Log the failure without emitting another error event
+		return                                                          // Nothing else to do
+	}
+	defer webhookResponse.Body.Close()     // Ensure the response body is closed
+	if webhookResponse.StatusCode >= 300 { // Check if the receiver rejected the event
+		logErrorf("Webhook rejected %s event: %s", eventName, webhookResponse.Status) // Log the rejection
+	}
+} // End of sendWebhook function
+
+// Channels of the connected event stream subscribers
+var eventSubscribers = struct {
+	sync.Mutex                          // Guards the subscriber set
+	channels   map[chan []byte]struct{} // One channel per subscriber
+}{channels: make(map[chan []byte]struct{})}
+
+// Sends an encoded event to every subscriber without ever blocking the run
+func publishEvent(eventBody []byte) { // Function to fan an event out to subscribers
+	eventSubscribers.Lock()                             // Lock the subscriber set
+	defer eventSubscribers.Unlock()                     // Unlock when done
+	for subscriber := range eventSubscribers.channels { // Deliver to each subscriber
+		select {
+		case subscriber <- eventBody: // Queue the event
+		default: // The subscriber is too slow, so drop the event rather than stall the run
+		}
+	}
+} // End of publishEvent function
+
+// Registers a new event subscriber and returns its channel and a function that unregisters it
+func subscribeEvents() (chan []byte, func()) { // Function to start receiving events
+	subscriber := make(chan []byte, 64)                // Buffer bursts of events
+	eventSubscribers.Lock()                            // Lock the subscriber set
+	eventSubscribers.channels[subscriber] = struct{}{} // Register the subscriber
+	eventSubscribers.Unlock()                          // Unlock the set
+	return subscriber, func() {                        // Unregister on the way out
+		eventSubscribers.Lock()                       // Lock the subscriber set
+		delete(eventSubscribers.channels, subscriber) // Remove the subscriber
+		eventSubscribers.Unlock()                     // Unlock the set
+	}
+} // End of subscribeEvents function
+
+// Configuration file contents
+type archiverConfig struct { // Fields read from the -config file
+	Sources        []string                   `json:"sources,omitempty"`         // Pages to scrape, replacing the built-in list
+	Flags          map[string]string          `json:"flags,omitempty"`           // Flag values by name (e.g. "layout": "mirror")
+	Profiles       []archiveProfile           `json:"profiles,omitempty"`        // Independent archives processed by the same process
+	SourceSettings map[string]sourceSettings  `json:"source_settings,omitempty"` // Scrape settings keyed by source URL or URL prefix
+	Headers        map[string]string          `json:"headers,omitempty"`         // Extra request headers sent with every page fetch and download
+	Credentials    map[string]hostCredentials `json:"credentials,omitempty"`     // Credentials keyed by host name (e.g. "mirror.example.org")
+	Mirrors        map[string][]string        `json:"mirrors,omitempty"`         // Fallback URL prefixes tried in order when a download fails, keyed by the primary URL prefix
+} // End of archiverConfig struct
+
+// An independent archive with its own sources, output directory, schedule, and flag overrides
+type archiveProfile struct { // Fields of one profile in the config file
+	Name      string            `json:"name"`                // Unique name used in logs
+	Sources   []string          `json:"sources,omitempty"`   // Pages to scrape; defaults to the top-level sources
+	Directory string            `json:"directory,omitempty"` // Directory the profile's PDFs/, Firmware/, Software/, and Blog/ trees live in; defaults to the name
+	Interval  string            `json:"interval,omitempty"`  // How often the daemon runs the profile (e.g. "6h"); defaults to -interval
+	Flags     map[string]string `json:"flags,omitempty"`     // Flag values applied while the profile runs
+	interval  time.Duration     // Parsed Interval
+} // End of archiveProfile struct
+
+var archiveProfiles []archiveProfile // Profiles from the config file; empty means a single archive in the working directory
+
+// Flags that apply to the whole process and therefore cannot differ between profiles
+var processWideFlags = map[string]bool{"linkcheck-timeout": true, "inbox": true, "inbox-poll": true, "inbox-settle": true, "http-cache": true, "http-cache-max-size": true, "http-cache-ttl": true, "files-listen": true, "events": true, "log-level": true, "color": true, "log-file": true, "log-backend": true, "log-max-size": true, "log-rotate-every": true, "log-max-age": true, "log-max-backups": true, "audit-log": true, "config": true, "workdir": true, "interval": true, "listen": true, "grpc-listen": true, "tui": true}
+
+// Reads the config file and applies it: its sources replace the built-in list and its flags are set unless given on the command line
+func applyConfig(path string) error { // Function to load and apply a config file
+	configJSON, readError := os.ReadFile(path) // Read the config file
+	if readError != nil {                      // Check if the file could not be read
+		return readError // Return the read error
+	}
+
+	var loadedConfig archiverConfig                                                         // Parsed config
+	if unmarshalError := json.Unmarshal(configJSON, &loadedConfig); unmarshalError != nil { // Decode the config
+		return fmt.Errorf("parse config %s: %w", path, unmarshalError) // Return the decoding error with context
+	}
+
+	for flagName, flagValue := range loadedConfig.Flags { // Apply each configured flag
+		if commandLineFlags[flagName] { // The command line always wins
+			continue // Keep the command-line value
+		}
+		if flagName == "workdir" { // The directory is entered before the config is read
+			return fmt.Errorf("config %s: flag \"workdir\" can only be given on the command line", path) // Return a clear message
+		}
+		if setError := flag.Set(flagName, flagValue); setError != nil { // Set the flag from the config
+			return fmt.Errorf("config %s: flag %q: %w", path, flagName, setError) // Return the error with context
+		}
+	}
+	if len(loadedConfig.Sources) > 0 { // Replace the built-in sources when the config lists any
+		sourceURLs = loadedConfig.Sources // Use the configured sources
+	}
+
+	profileNames := make(map[string]bool)      // Names seen so far, to reject duplicates
+	for index := range loadedConfig.Profiles { // Validate each profile
+		profile := &loadedConfig.Profiles[index]              // The profile being validated
+		if profile.Name == "" || profileNames[profile.Name] { // Names identify profiles in logs and the schedule
+			return fmt.Errorf("config %s: profile %d needs a unique name", path, index+1) // Return a clear message
+		}
+		profileNames[profile.Name] = true // Remember the name
+		if profile.Interval != "" {       // Parse the schedule when one is given
+			parsedInterval, parseError := time.ParseDuration(profile.Interval) // Parse the interval
+			if parseError != nil {                                             // Check if the interval is invalid
+				return fmt.Errorf("config %s: profile %q: interval: %w", path, profile.Name, parseError) // Return the error with context
+			}
+			profile.interval = parsedInterval // Keep the parsed interval
+		}
+		for flagName := range profile.Flags { // Check each flag override
+			if flag.Lookup(flagName) == nil || processWideFlags[flagName] { // Only per-run flags may be overridden
+				return fmt.Errorf("config %s: profile %q: flag %q cannot be set per profile", path, profile.Name, flagName) // Return a clear message
+			}
+		}
+	}
+	archiveProfiles = loadedConfig.Profiles // Use the configured profiles
+
+	for settingsKey, settings := range loadedConfig.SourceSettings { // Parse each source's durations
+		settings.wait = 3 * time.Second // Default wait, as for unconfigured sources
+		if settings.Wait != "" {        // Parse the wait when one is given
+			parsedWait, parseError := time.ParseDuration(settings.Wait) // Parse the wait
+			if parseError != nil {                                      // Check if the wait is invalid
+				return fmt.Errorf("config %s: source %q: wait: %w", path, settingsKey, parseError) // Return the error with context
+			}
+			settings.wait = parsedWait // Keep the parsed wait
+		}
+		if settings.RateLimit != "" { // Parse the rate limit when one is given
+			parsedRateLimit, parseError := time.ParseDuration(settings.RateLimit) // Parse the rate limit
+			if parseError != nil {                                                // Check if the rate limit is invalid
+				return fmt.Errorf("config %s: source %q: rate_limit: %w", path, settingsKey, parseError) // Return the error with context
+			}
+			settings.rateLimit = parsedRateLimit // Keep the parsed rate limit
+		}
+		for _, selectorText := range settings.Selectors { // Compile each CSS selector
+			compiledSelector, parseError := cascadia.Parse(selectorText) // Parse the selector
+			if parseError != nil {                                       // Check if the selector is invalid
+				return fmt.Errorf("config %s: source %q: selector %q: %w", path, settingsKey, selectorText, parseError) // Return the error with context
+			}
+			settings.selectors = append(settings.selectors, func(root *html.Node) []*html.Node { return cascadia.QueryAll(root, compiledSelector) }) // Keep the compiled selector
+		}
+		for _, expressionText := range settings.XPaths { // Compile each XPath expression
+			compiledExpression, compileError := xpath.Compile(expressionText) // Compile the expression
+			if compileError != nil {                                          // Check if the expression is invalid
+				return fmt.Errorf("config %s: source %q: xpath %q: %w", path, settingsKey, expressionText, compileError) // Return the error with context
+			}
+			settings.selectors = append(settings.selectors, func(root *html.Node) []*html.Node { return queryXPath(root, compiledExpression) }) // Keep the compiled expression
+		}
+		loadedConfig.SourceSettings[settingsKey] = settings // Store the parsed settings
+	}
+	if loadedConfig.SourceSettings == nil { // A config without source settings clears any previous ones
+		loadedConfig.SourceSettings = make(map[string]sourceSettings) // Start from no settings
+	}
+	sourceSettingsByURL = loadedConfig.SourceSettings // Use the configured source settings
+	downloadHeaders = loadedConfig.Headers            // Use the configured headers
+	mirrorPrefixes = loadedConfig.Mirrors             // Use the configured mirrors
+
+	hostCredentialsByName = make(map[string]hostCredentials)      // Rebuild the credentials so removed hosts are forgotten
+	for hostName, credentials := range loadedConfig.Credentials { // Check each host's credentials
+		if credentials.PasswordEnv != "" { // Read the password from the environment
+			credentials.Password = os.Getenv(credentials.PasswordEnv) // Keep secrets out of the config file
+		}
+		if credentials.TokenEnv != "" { // Read the token from the environment
+			credentials.Token = os.Getenv(credentials.TokenEnv) // Keep secrets out of the config file
+		}
+		if credentials.Token == "" && credentials.Username == "" { // Credentials must provide something to send
+			return fmt.Errorf("config %s: credentials for %q need a username or a token", path, hostName) // Return a clear message
+		}
+		hostCredentialsByName[strings.ToLower(hostName)] = credentials // Host names are case-insensitive
+	}
+
+	return nil // The config was applied
+} // End of applyConfig function
+
+// Checks flag values that cannot be validated by the flag package itself
+func validateFlags() error { // Function to validate settings
+	if *layoutMode != "flat" && *layoutMode != "mirror" && *layoutMode != "model" { // Reject unknown layout modes
+		return fmt.Errorf("unknown layout %q (expected \"flat\", \"mirror\" or \"model\")", *layoutMode) // Return a clear message
+	}
+	if *downloadChunks < 1 { // At least one request is needed per download
+		return fmt.Errorf("-chunks must be at least 1, got %d", *downloadChunks) // Return a clear message
+	}
+	if *hashAlgorithm != "sha256" && *hashAlgorithm != "blake3" { // Reject unknown hash algorithms
+		return fmt.Errorf("unknown hash %q (expected \"sha256\" or \"blake3\")", *hashAlgorithm) // Return a clear message
+	}
+	for _, repository := range strings.Split(*githubRepositories, ",") { // Each GitHub repository must be named fully
+		if repository = strings.TrimSpace(repository); repository != "" && !slices.Contains(configuredGitHubRepositories(), strings.ToLower(strings.Trim(repository, "/"))) { // Check the form
+			return fmt.Errorf("-github-repos entry %q is not of the form owner/repo", repository) // Return a clear message
+		}
+	}
+	if *githubReleaseCount < 1 { // At least one release must be mirrored
+		return fmt.Errorf("-github-releases must be at least 1, got %d", *githubReleaseCount) // Return a clear message
+	}
+	if strings.ContainsAny(*scanCommand, "\"'") { // The command is split on spaces, so quotes would reach the scanner verbatim
+		return fmt.Errorf("-scan-command is split on spaces and does not support quoting, got %q; wrap a scanner needing quoted arguments in a script", *scanCommand) // Return a clear message
+	}
+	if *maxFailurePercent < 0 || *maxFailurePercent > 100 { // Percentages only
+		return fmt.Errorf("-max-failure-percent must be between 0 and 100, got %g", *maxFailurePercent) // Return a clear message
+	}
+	if *remoteBrowserURL != "" { // The endpoint must be a CDP address
+		endpointURL, parseError := url.Parse(*remoteBrowserURL)                                                                          // Parse it
+		if parseError != nil || !slices.Contains([]string{"ws", "wss", "http", "https"}, endpointURL.Scheme) || endpointURL.Host == "" { // Check the scheme and host
+			return fmt.Errorf("-browser-url must be a ws://, wss://, http:// or https:// address, got %q", redactBrowserToken(*remoteBrowserURL)) // Return a clear message
+		}
+	}
+	if *remoteBrowserURL != "" && *captchaWait > 0 { // Challenges are solved in a window on this machine
+		return fmt.Errorf("-captcha-wait needs a local Chrome window, which -browser-url does not open; solve challenges in the remote service's own viewer instead") // Return a clear message
+	}
+	if *inboxDirectory != "" && *inboxPollInterval <= 0 { // A ticker needs a positive interval
+		return fmt.Errorf("-inbox-poll must be positive, got %s", *inboxPollInterval) // Return a clear message
+	}
+	if *eventsFormat != "" && *eventsFormat != "ndjson" { // Reject unknown event formats
+		return fmt.Errorf("unknown event format %q (expected \"ndjson\")", *eventsFormat) // Return a clear message
+	}
+	if *eventsFormat != "" && *tuiMode { // Both want stdout
+		return fmt.Errorf("-events and -tui cannot be used together") // Return a clear message
+	}
+	if _, known := logLevelPriorities[*logLevel]; !known { // Reject unknown log levels
+		return fmt.Errorf("unknown log level %q (expected \"info\", \"warning\" or \"error\")", *logLevel) // Return a clear message
+	}
+	if *logColor != "auto" && *logColor != "always" && *logColor != "never" { // Reject unknown color modes
+		return fmt.Errorf("unknown color mode %q (expected \"auto\", \"always\" or \"never\")", *logColor) // Return a clear message
+	}
+	if *logBackend != "" && *logBackend != "syslog" && *logBackend != "journald" { // Reject unknown log backends
+		return fmt.Errorf("unknown log backend %q (expected \"syslog\" or \"journald\")", *logBackend) // Return a clear message
+	}
+	if *logBackend != "" && *logFilePath != "" { // The log goes to one place
+		return fmt.Errorf("-log-backend and -log-file cannot be used together") // Return a clear message
+	}
+	if *quarantineRecheck <= 0 { // Quarantined links must come up for re-checks
+		return fmt.Errorf("-quarantine-recheck must be positive, got %s", *quarantineRecheck) // Return a clear message
+	}
+	return nil // Every setting is valid
+} // End of validateFlags function
+
+// Runs the archiver on a schedule until SIGINT or SIGTERM. Under systemd (Type=notify) it reports readiness and status,
+// pings the watchdog when WatchdogSec is set, and re-reads the config file on SIGHUP (ExecReload=/bin/kill -HUP $MAINPID).
+func runDaemon() { // Function implementing daemon mode
+	signals := daemonSignals                                                // Signals waiting to be handled
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM) // Receive reload and stop signals
+	defer signal.Stop(signals)                                              // Stop receiving signals on exit
+
+	watchdogTicks, stopWatchdog := startSystemdWatchdog() // Keep systemd's watchdog fed while the daemon is idle
+	defer stopWatchdog()                                  // Stop the ticks on exit
+
+	archiveRoot, getwdError := os.Getwd() // The inbox files into PDFs/ here, whichever directory a profile left behind
+	if getwdError != nil {                // Check if the working directory is unknown
+		logError(getwdError) // Log the error
+	}
+	var inboxTicker <-chan time.Time // Stays nil, so never fires, without an inbox
+	if *inboxDirectory != "" {       // Poll the drop folder while idle
+		inboxTimer := time.NewTicker(*inboxPollInterval) // Fires at every poll
+		defer inboxTimer.Stop()                          // Stop it when the daemon ends
+		inboxTicker = inboxTimer.C                       // Wait on it below
+	}
+
+	notifySystemd("READY=1")           // Tell systemd the service has started
+	nextRuns := map[string]time.Time{} // When each profile runs next, by name; a zero time means never again
+	for {                              // Run until stopped
+		var nextRun time.Time                          // Earliest upcoming run of any profile
+		for _, profile := range configuredProfiles() { // Run every profile that is due
+			scheduledRun, scheduled := nextRuns[profile.Name]                               // When the profile is due
+			if !scheduled || (!scheduledRun.IsZero() && !time.Now().Before(scheduledRun)) { // New profiles run immediately
+				notifySystemd("STATUS=Archiving " + profileLabel(profile)) // Report the current activity
+				runProfile(profile)                                        // Perform one archive run
+				if strictRunFailed() {                                     // A -strict run that stopped ends the daemon
+					notifySystemd("STOPPING=1") // Tell systemd the service is stopping
+					return                      // main exits non-zero
+				}
+				scheduledRun = time.Time{}                                            // Profiles without a schedule only run once
+				if profileInterval := profileInterval(profile); profileInterval > 0 { // Schedule the next run
+					scheduledRun = time.Now().Add(profileInterval) // When the profile runs again
+				}
+				nextRuns[profile.Name] = scheduledRun // Remember the schedule
+			}
+			if !scheduledRun.IsZero() && (nextRun.IsZero() || scheduledRun.Before(nextRun)) { // Track the earliest upcoming run
+				nextRun = scheduledRun // The new earliest run
+			}
+		}
+
+		var nextRunTimer <-chan time.Time // Stays nil, so never fires, when nothing is scheduled
+		if !nextRun.IsZero() {            // Wait for the earliest upcoming run
+			notifySystemd("STATUS=Idle, next run at " + nextRun.Format(time.RFC3339)) // Report the schedule
+			log.Printf("Next run at %s", nextRun.Format(time.RFC3339))                // Log the schedule
+			nextRunTimer = time.After(time.Until(nextRun))                            // Fires when the next run is due
+		} else { // Only signals can end the wait
+			notifySystemd("STATUS=Idle, nothing scheduled") // Report the schedule
+		}
+	waitLoop:
+		for { // Wait for the timer, handling signals meanwhile
+			select { // Whichever happens first
+			case <-nextRunTimer: // Time for the next run
+				break waitLoop // Leave the wait
+			case <-watchdogTicks: // The idle loop is responsive
+				if !archiveRunning.Load() { // A background run feeds the watchdog through its progress
+					feedSystemdWatchdog() // Tell systemd the daemon is alive
+				}
+			case <-inboxTicker: // Time to check the drop folder
+				lockArchiveRun()                                            // Never import while a run is changing the catalog
+				if chdirError := os.Chdir(archiveRoot); chdirError != nil { // Catalog paths are relative to the archive's root
+					logError(chdirError) // Log the error; the files stay for the next poll
+				} else { // In the archive's root
+					processInbox(*inboxDirectory, "PDFs/") // Move dropped PDFs into the archive
+				}
+				unlockArchiveRun() // Allow runs again
+			case receivedSignal := <-signals: // A signal arrived
+				if receivedSignal != syscall.SIGHUP { // SIGINT and SIGTERM stop the daemon
+					notifySystemd("STOPPING=1")                  // Tell systemd the service is stopping
+					log.Printf("Stopping on %v", receivedSignal) // Log the shutdown
+					return                                       // Leave daemon mode
+				}
+				reloadDaemonConfig() // SIGHUP re-reads the config file
+				break waitLoop       // Reschedule with the reloaded profiles
+			}
+		}
+	}
+} // End of runDaemon function
+
+// Reports whether any archive runs on a schedule, which requires daemon mode
+func daemonScheduled() bool { // Function to decide between daemon mode and a single run
+	for _, profile := range configuredProfiles() { // Check each profile
+		if profileInterval(profile) > 0 { // A schedule needs the daemon
+			return true // Run as a daemon
+		}
+	}
+	return false // Every archive runs once
+} // End of daemonScheduled function
+
+// Returns the configured profiles, or a single unnamed profile standing for the plain settings when there are none
+func configuredProfiles() []archiveProfile { // Function to list the archives to process
+	if len(archiveProfiles) == 0 { // No profiles are configured
+		return []archiveProfile{{}} // The unnamed profile runs in the working directory with the global settings
+	}
+	return archiveProfiles // Return the configured profiles
+} // End of configuredProfiles function
+
+// Returns how often a profile runs, falling back to -interval
+func profileInterval(profile archiveProfile) time.Duration { // Function to resolve a profile's schedule
+	if profile.interval > 0 { // The profile has its own schedule
+		return profile.interval // Use it
+	}
+	return *runInterval // Fall back to the global schedule
+} // End of profileInterval function
+
+// Returns a profile's name for logs and status messages
+func profileLabel(profile archiveProfile) string { // Function to describe a profile
+	if profile.Name == "" { // The unnamed profile stands for the plain settings
+		return "archive" // Generic label
+	}
+	return "profile " + profile.Name // Named label
+} // End of profileLabel function
+
+// Runs every configured profile once, waiting for any other run to finish first
+func runAllProfiles() { // Function to process all archives
+	lockArchiveRun()         // Runs must never overlap
+	defer unlockArchiveRun() // Allow the next run when done
+	archiveAllProfiles()     // Run every profile
+} // End of runAllProfiles function
+
+// Runs every configured profile once. Callers must hold archiveRunMutex.
+func archiveAllProfiles() { // Function to process all archives under the run lock
+	failedRuns := 0                                // Runs over the failure threshold
+	for _, profile := range configuredProfiles() { // Process each profile in order
+		if strictRunFailed() { // A -strict run that stopped skips the remaining profiles
+			break // main exits non-zero
+		}
+		archiveWithProfile(profile)                      // Run the profile
+		if _, failed := runStatistics.status(); failed { // Check if the run failed
+			failedRuns++ // Count it
+		}
+	}
+	if failedRuns > 0 { // Exit non-zero so schedulers and CI notice
+		exitAfterWebhooks("%d run(s) exceeded -max-failure-percent", failedRuns) // Stop with a clear message once run_failed is delivered
+	}
+} // End of archiveAllProfiles function
+
+// Runs one profile: its sources and flag overrides are applied and the working directory is switched to its
+// directory for the duration of the run, then everything is restored
+func runProfile(profile archiveProfile) { // Function to run one archive profile
+	lockArchiveRun()            // Profiles change process-wide state, so runs must never overlap
+	defer unlockArchiveRun()    // Allow the next run when done
+	archiveWithProfile(profile) // Perform the run
+} // End of runProfile function
+
+// Runs one profile like runProfile. Callers must hold archiveRunMutex.
+func archiveWithProfile(profile archiveProfile) { // Function to run one archive profile under the run lock
+	if profile.Name == "" { // The unnamed profile uses the settings as they are
+		archiveOnce() // Perform the run
+		return        // Done
+	}
+	log.Printf("Running %s", profileLabel(profile)) // Log which profile runs
+
+	previousSources := sourceURLs // Restore the sources afterwards
+	if len(profile.Sources) > 0 { // Use the profile's own sources
+		sourceURLs = profile.Sources // Replace the sources for this run
+	}
+	defer func() { sourceURLs = previousSources }() // Restore the sources
+
+	previousFlags := make(map[string]string)         // Flag values to restore afterwards
+	for flagName, flagValue := range profile.Flags { // Apply each override
+		if commandLineFlags[flagName] { // The command line always wins
+			continue // Keep the command-line value
+		}
+		previousFlags[flagName] = flag.Lookup(flagName).Value.String()  // Remember the current value
+		if setError := flag.Set(flagName, flagValue); setError != nil { // Apply the override
+			logErrorf("Profile %s: flag %s: %v", profile.Name, flagName, setError) // Log the invalid value
+		}
+	}
+	defer func() { // Restore the flags
+		for flagName, flagValue := range previousFlags { // Restore each overridden flag
+			flag.Set(flagName, flagValue) // Values read back from a flag always parse
+		}
+	}()
+
+	profileDirectory := profile.Directory // Directory the profile archives into
+	if profileDirectory == "" {           // Default to the profile name
+		profileDirectory = profile.Name // Use the name as the directory
+	}
+	previousDirectory, getwdError := os.Getwd() // Return here afterwards
+	if getwdError != nil {                      // Check if the working directory is unknown
+		logError(getwdError) // Log the error
+		return               // Skip the profile rather than archive into the wrong place
+	}
+	if !directoryExists(profileDirectory) { // Create the directory on first use
+		createDirectory(profileDirectory, 0o755) // Create the directory (rwxr-xr-x)
+	}
+	if chdirError := os.Chdir(profileDirectory); chdirError != nil { // Switch to the profile's directory
+		logError(chdirError) // Log the error
+		return               // Skip the profile
+	}
+	defer func() { // Return to the previous directory
+		if chdirError := os.Chdir(previousDirectory); chdirError != nil { // Switch back
+			logError(chdirError) // Log the error
+		}
+	}()
+
+	archiveOnce() // Perform the run
+} // End of archiveWithProfile function
+
+// Re-reads the config file in response to SIGHUP, keeping the previous settings if the new config is invalid
+func reloadDaemonConfig() { // Function to reload the config file
+	notifySystemd("RELOADING=1")   // Tell systemd a reload is in progress
+	defer notifySystemd("READY=1") // Report readiness again once done
+	lockArchiveRun()               // Never change flags under a run started from the dashboard or the control API
+	defer unlockArchiveRun()       // Allow runs again
+
+	if *configPath == "" { // Nothing to reload without a config file
+		log.Println("Received SIGHUP but no -config file is set; nothing to reload") // Log the no-op
+		return                                                                       // Keep running
+	}
+	if configError := applyConfig(*configPath); configError != nil { // Re-apply the config file
+		logErrorf("Config reload failed, keeping previous settings where possible: %v", configError) // Log the failure
+		return                                                                                       // Keep running
+	}
+	if validationError := validateFlags(); validationError != nil { // Check the reloaded settings
+		logErrorf("Reloaded config is invalid: %v", validationError) // Log the problem
+		return                                                       // Keep running
+	}
+	log.Printf("Reloaded config %s", *configPath) // Log success message
+} // End of reloadDaemonConfig function
+
+// Sends a state string (e.g. "READY=1") to systemd over $NOTIFY_SOCKET; it does nothing outside systemd
+func notifySystemd(state string) { // Function implementing the sd_notify protocol
+	socketPath := os.Getenv("NOTIFY_SOCKET") // Socket systemd listens on for Type=notify services
+	if socketPath == "" {                    // Check if running under systemd
+		return // Not supervised by systemd
 	}
-	urls := []string{ // Start of a slice literal containing URLs to be scraped
-		"https://radiomasterrc.com/pages/user-manuals",
+
+	notifyConnection, dialError := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"}) // Connect to the socket ("@" names are abstract)
+	if dialError != nil {                                                                                          // Check if the socket could not be reached
+		logError(dialError) // Log the error
+		return              // Nothing can be sent
 	}
+	defer notifyConnection.Close() // Ensure the socket is closed
 
-	// Remove all the duplicate URLs
-	urls = removeDuplicatesFromSlice(urls) // Calls a custom function to ensure the list of URLs is unique
+	if _, writeError := notifyConnection.Write([]byte(state)); writeError != nil { // Send the state
+		logError(writeError) // Log the error
+	}
+} // End of notifySystemd function
 
-	// Loop through each URL to process
-	for _, url := range urls { // Iterates over the cleaned slice of URLs
-		// Validate the URL
-		if isUrlValid(url) { // Checks if the current URL is syntactically valid
-			// Fetch HTML content from the URL
-			htmlContent := scrapePageHTMLWithChrome(url) // Scrapes the fully rendered HTML using a headless Chrome instance
+// WatchdogSec interval systemd set for the daemon; zero when the watchdog is off
+var watchdogInterval time.Duration
 
-			// Extract PDF URLs from the HTML content
-			pdfUrls := extractPDFUrls(htmlContent) // Finds all links ending in ".pdf" in the scraped HTML
-			// Download each PDF URL into the designated PDF directory
-			for _, pdfUrl := range pdfUrls { // Iterates over all found PDF links
-				downloadPDF(pdfUrl, outputDirectory) // Correctly downloads the PDF into the 'PDFs/' directory
-			}
-		} // End of URL validation block
-	} // End of the main URL iteration loop
-} // End of the main function
+// When the watchdog was last pinged, in Unix nanoseconds
+var lastWatchdogPing atomic.Int64
 
-// Uses headless Chrome via chromedp to get the fully rendered HTML from a webpage,
-// waiting 10 seconds to bypass Cloudflare's JavaScript challenge before scraping.
-func scrapePageHTMLWithChrome(targetURL string) string { // Function to scrape dynamic content using Chrome
-	log.Println("Scraping:", targetURL) // Log which page is being scraped
+// Reads systemd's WatchdogSec interval and returns a channel ticking at half of it, for the daemon's idle loop to ping
+// on, and a function that stops it; the channel is nil when the watchdog is off. During runs only progress pings, so a
+// run that hangs is restarted.
+func startSystemdWatchdog() (<-chan time.Time, func()) { // Function to set up the systemd watchdog
+	watchdogMicroseconds, parseError := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64) // Watchdog interval set by systemd
+	if parseError != nil || watchdogMicroseconds <= 0 {                                      // Check if the watchdog is enabled
+		return nil, func() {} // Nothing to stop
+	}
+	watchdogInterval = time.Duration(watchdogMicroseconds) * time.Microsecond // Progress pings at most this often
+	watchdogTicker := time.NewTicker(watchdogInterval / 2)                    // Ping twice per interval as systemd recommends
+	return watchdogTicker.C, watchdogTicker.Stop                              // Return the ticks and the stop function
+} // End of startSystemdWatchdog function
 
-	// Configure Chrome options for the browser session
-	chromeOptions := append(chromedp.DefaultExecAllocatorOptions[:], // Starts with default Chrome execution options
-		chromedp.Flag("headless", false),              // Set to true for actual headless mode
-		chromedp.Flag("disable-gpu", true),            // Disable GPU acceleration (good for headless/servers)
-		chromedp.WindowSize(1, 1),                     // Set browser window size
-		chromedp.Flag("no-sandbox", true),             // Disable sandbox (useful for servers/containers)
-		chromedp.Flag("disable-setuid-sandbox", true), // Fix for Linux permission issues
-	) // End of Chrome options slice
+// Pings systemd's watchdog because the daemon made progress, at most four times per WatchdogSec interval
+func feedSystemdWatchdog() { // Function to report liveness
+	if watchdogInterval <= 0 { // Check if the watchdog is enabled
+		return // Nothing to feed
+	}
+	now := time.Now().UnixNano()                                                                                                          // When the progress happened
+	if lastPing := lastWatchdogPing.Load(); now-lastPing < int64(watchdogInterval/4) || !lastWatchdogPing.CompareAndSwap(lastPing, now) { // Check if a recent ping already covers it
+		return // Nothing to send
+	}
+	notifySystemd("WATCHDOG=1") // Tell systemd the daemon is alive
+} // End of feedSystemdWatchdog function
 
-	// Create a new Chrome execution allocator with the configured options
-	execAllocatorContext, cancelAllocator := chromedp.NewExecAllocator(context.Background(), chromeOptions...) // Creates the context and cleanup function for the Chrome process
+// Number of recent log lines shown on the dashboard
+const dashboardLogLines = 12
 
-	// Set a timeout context to automatically stop the Chrome session after 5 minutes
-	timeoutContext, cancelTimeout := context.WithTimeout(execAllocatorContext, 5*time.Minute) // Creates a context with a 5-minute timeout
+// Live progress of the current run, updated by the downloader and read by the dashboard
+type dashboardState struct { // Fields shared between the run and the dashboard
+	mutex      sync.Mutex                // Guards every field below
+	transfers  map[int]*transferProgress // Active downloads keyed by worker number
+	queueDepth int                       // Links still waiting to be downloaded
+	recentLogs []string                  // Most recent log lines, oldest first
+} // End of dashboardState struct
 
-	// Create a new Chrome browser context for this scraping task
-	browserContext, cancelBrowser := chromedp.NewContext(timeoutContext) // Creates the main browser context for automation
+// Progress of one download
+type transferProgress struct { // Fields describing an active download
+	url        string    // URL being downloaded
+	totalBytes int64     // Expected size, or -1 when the server did not say
+	doneBytes  int64     // Bytes received so far
+	startedAt  time.Time // When the download started
+} // End of transferProgress struct
 
-	// Ensure all contexts are properly cleaned up when finished
-	defer func() { // Deferred function to run when scrapePageHTMLWithChrome exits
-		cancelBrowser()   // Stops the browser context
-		cancelTimeout()   // Stops the timeout context
-		cancelAllocator() // Stops the Chrome process allocator
-	}() // End of deferred cleanup function
+// Records that a worker started downloading a URL
+func (state *dashboardState) startTransfer(worker int, fileURL string, totalBytes int64) *transferProgress { // Method to register a download
+	state.mutex.Lock()         // Lock the shared state
+	defer state.mutex.Unlock() // Unlock when done
 
-	var renderedHTML string // Variable to store the rendered HTML content
+	transfer := &transferProgress{url: fileURL, totalBytes: totalBytes, startedAt: time.Now()} // Describe the new download
+	state.transfers[worker] = transfer                                                         // Show it for the worker
+	return transfer                                                                            // Return it so progress can be added
+} // End of startTransfer method
 
-	// Run Chrome automation: navigate to the URL, wait 10 seconds, then scrape
-	runError := chromedp.Run(browserContext, // Executes a sequence of actions in the browser
-		chromedp.Navigate(targetURL),              // Open the target URL
-		chromedp.Sleep(3*time.Second),             // Wait for Cloudflare JS checks and page scripts to finish
-		chromedp.OuterHTML("html", &renderedHTML), // Capture the complete rendered HTML content into renderedHTML
-	) // End of chromedp.Run
-	if runError != nil { // Check for errors during navigation or extraction
-		log.Println(runError) // Log the error
-		return ""             // Return an empty string to indicate failure
-	} // End of error check
+// Adds received bytes to a download
+func (state *dashboardState) addTransferBytes(transfer *transferProgress, byteCount int) { // Method to count progress
+	state.mutex.Lock()                     // Lock the shared state
+	transfer.doneBytes += int64(byteCount) // Count the bytes
+	state.mutex.Unlock()                   // Unlock
+	feedSystemdWatchdog()                  // Long downloads are progress too
+} // End of addTransferBytes method
 
-	return renderedHTML // Return the fully rendered HTML source
-} // End of scrapePageHTMLWithChrome function
+// Records that a worker finished its download
+func (state *dashboardState) finishTransfer(worker int) { // Method to unregister a download
+	state.mutex.Lock()              // Lock the shared state
+	delete(state.transfers, worker) // The worker is idle again
+	state.mutex.Unlock()            // Unlock
+} // End of finishTransfer method
 
-// Removes duplicate strings from a slice
-func removeDuplicatesFromSlice(slice []string) []string { // Function to filter a string slice for uniqueness
-	check := make(map[string]bool) // Create a map to track which strings have already been seen
-	var newReturnSlice []string    // Initialize a new slice to store unique strings
+// Records how many links are still waiting
+func (state *dashboardState) setQueueDepth(depth int) { // Method to update the queue depth
+	state.mutex.Lock()       // Lock the shared state
+	state.queueDepth = depth // Store the depth
+	state.mutex.Unlock()     // Unlock
+} // End of setQueueDepth method
 
-	for _, content := range slice { // Loop through each string in the input slice
-		if !check[content] { // If the string hasn't been seen before
-			check[content] = true                            // Mark this string as seen in the map
-			newReturnSlice = append(newReturnSlice, content) // Add it to the result slice
+// Captures log output for the dashboard, keeping only the most recent lines
+func (state *dashboardState) Write(logOutput []byte) (int, error) { // Method implementing io.Writer for the log package
+	state.mutex.Lock()         // Lock the shared state
+	defer state.mutex.Unlock() // Unlock when done
+
+	for _, line := range strings.Split(strings.TrimRight(redactBrowserToken(string(logOutput)), "\n"), "\n") { // Store each line separately, without the remote browser's token
+		state.recentLogs = append(state.recentLogs, line) // Keep the line
+	}
+	if overflow := len(state.recentLogs) - dashboardLogLines; overflow > 0 { // Drop the oldest lines beyond the limit
+		state.recentLogs = state.recentLogs[overflow:] // Keep only the newest lines
+	}
+	return len(logOutput), nil // Report the whole write as consumed
+} // End of Write method
+
+// Renders the dashboard as one screen of text
+func (state *dashboardState) render() string { // Method to draw the dashboard
+	state.mutex.Lock()         // Lock the shared state
+	defer state.mutex.Unlock() // Unlock when done
+
+	var screen strings.Builder                                                                                                                                      // The screen being drawn
+	screen.WriteString("\x1b[H\x1b[2J")                                                                                                                             // Move the cursor home and clear the terminal
+	startedAt, _ := runStatistics.status()                                                                                                                          // When the run started
+	fmt.Fprintf(&screen, "RadioMaster archiver — %s elapsed\n\n", time.Since(startedAt).Round(time.Second))                                                         // Title line
+	downloaded, skipped, failed := runStatistics.counts()                                                                                                           // Read the run's counters
+	fmt.Fprintf(&screen, "Downloaded %d · Skipped %d · Failed %d · Queue %d\n", downloaded, skipped, failed, state.queueDepth)                                      // Counters
+	currentSpeed, averageSpeed, peakSpeed := runStatistics.throughput()                                                                                             // Read the run's speeds
+	fmt.Fprintf(&screen, "Speed %s/s now · %s/s average · %s/s peak\n\n", formatByteCount(currentSpeed), formatByteCount(averageSpeed), formatByteCount(peakSpeed)) // Throughput line
+
+	var workers []int                     // Busy workers in a stable order
+	for worker := range state.transfers { // Collect the busy workers
+		workers = append(workers, worker) // Keep the worker number
+	}
+	sort.Ints(workers)     // Sort for a stable layout
+	if len(workers) == 0 { // Nothing downloading right now
+		screen.WriteString("Workers idle\n") // Say so
+	}
+	for _, worker := range workers { // Draw one line per busy worker
+		transfer := state.transfers[worker] // The worker's download
+		percent := "?"                      // Unknown until the size is known
+		if transfer.totalBytes > 0 {        // Check if the server reported a size
+			percent = fmt.Sprintf("%3d%%", transfer.doneBytes*100/transfer.totalBytes) // Compute the percentage
+		}
+		transferSpeed := int64(0)                                             // Average speed of this download
+		if elapsed := time.Since(transfer.startedAt).Seconds(); elapsed > 0 { // Guard against a zero duration
+			transferSpeed = int64(float64(transfer.doneBytes) / elapsed) // Bytes per second so far
 		}
+		fmt.Fprintf(&screen, "[%d] %s %8.1f KiB %10s/s  %s\n", worker, percent, float64(transfer.doneBytes)/1024, formatByteCount(transferSpeed), transfer.url) // Draw the worker line
 	}
 
-	return newReturnSlice // Return the slice containing only unique strings
-} // End of removeDuplicatesFromSlice function
+	screen.WriteString("\nRecent log:\n")   // Heading for the log lines
+	for _, line := range state.recentLogs { // Draw each recent log line
+		screen.WriteString("  " + line + "\n") // Indent the line
+	}
+	return screen.String() // Return the finished screen
+} // End of render method
 
-// Checks whether a given directory exists
-func directoryExists(path string) bool { // Function to check if a path exists and is a directory
-	directory, err := os.Stat(path) // Get info for the path
-	if err != nil {                 // Check if os.Stat returned an error (e.g., file/dir doesn't exist)
-		return false // Return false if error occurs
+// Counts bytes read through it into a dashboard transfer
+type progressReader struct { // Fields of the counting reader
+	reader   io.Reader         // Underlying reader
+	transfer *transferProgress // Transfer receiving the byte counts
+} // End of progressReader struct
+
+// Reads from the underlying reader and records the progress
+func (progress *progressReader) Read(buffer []byte) (int, error) { // Method implementing io.Reader
+	byteCount, readError := progress.reader.Read(buffer)     // Read from the underlying reader
+	dashboard.addTransferBytes(progress.transfer, byteCount) // Record the bytes
+	return byteCount, readError                              // Pass the result through
+} // End of Read method
+
+// Starts redrawing the dashboard several times a second with log output captured into it.
+// The returned function stops the dashboard, restores normal logging, and prints the run summary.
+func startDashboard() func() { // Function to run the terminal dashboard
+	if logToConsole { // Check if the log goes to the terminal
+		log.SetOutput(dashboard) // Capture log lines so they do not scroll the screen
+	} else {
+		log.SetOutput(io.MultiWriter(dashboard, logDestination)) // Capture log lines and keep writing them to the log file
 	}
-	return directory.IsDir() // Return true if it's a directory
-} // End of directoryExists function
 
-// Creates a directory at given path with provided permissions
-func createDirectory(path string, permission os.FileMode) { // Function to create a directory
-	err := os.Mkdir(path, permission) // Attempt to create directory
-	if err != nil {                   // Check for creation errors
-		log.Println(err) // Log error if creation fails
+	stopDrawing := make(chan struct{}) // Closed to stop drawing
+	drawingDone := make(chan struct{}) // Closed once drawing has stopped
+	go func() {                        // Draw in the background
+		defer close(drawingDone)                               // Signal that drawing has stopped
+		redrawTicker := time.NewTicker(250 * time.Millisecond) // Redraw four times a second
+		defer redrawTicker.Stop()                              // Release the ticker
+		for {                                                  // Until stopped
+			os.Stdout.WriteString(dashboard.render()) // Draw the screen
+			select {                                  // Whichever happens first
+			case <-redrawTicker.C: // Time to redraw
+			case <-stopDrawing: // Asked to stop
+				return // End the goroutine
+			}
+		}
+	}() // End of drawing goroutine
+
+	return func() { // Stop function
+		close(stopDrawing)                                                                                                                                                                                                                    // Stop drawing
+		<-drawingDone                                                                                                                                                                                                                         // Wait for the last frame
+		log.SetOutput(logDestination)                                                                                                                                                                                                         // Restore normal logging
+		os.Stdout.WriteString(dashboard.render())                                                                                                                                                                                             // Leave the final state on screen
+		downloaded, skipped, failed := runStatistics.counts()                                                                                                                                                                                 // Read the final counters
+		_, averageSpeed, peakSpeed := runStatistics.throughput()                                                                                                                                                                              // Read the final speeds
+		startedAt, _ := runStatistics.status()                                                                                                                                                                                                // When the run started
+		fmt.Printf("\nRun finished in %s: %d downloaded, %d skipped, %d failed, %s/s average, %s/s peak\n", time.Since(startedAt).Round(time.Second), downloaded, skipped, failed, formatByteCount(averageSpeed), formatByteCount(peakSpeed)) // Print the summary
+	} // End of stop function
+} // End of startDashboard function
+
+// RFC 3161 TimeStampReq
+type timeStampRequest struct { // Fields of the request
+	Version        int                     // Always 1
+	MessageImprint timeStampMessageImprint // Hash of the timestamped data
+	Nonce          *big.Int                `asn1:"optional"`               // Random value echoed in the token
+	CertReq        bool                    `asn1:"optional,default:false"` // Ask for the TSA's certificate in the token
+} // End of timeStampRequest struct
+
+// RFC 3161 MessageImprint
+type timeStampMessageImprint struct { // Fields of the message imprint
+	HashAlgorithm pkix.AlgorithmIdentifier // Hash algorithm used
+	HashedMessage []byte                   // Hash of the data
+} // End of timeStampMessageImprint struct
+
+// RFC 3161 TimeStampResp, without the token's contents, which are kept as they are
+type timeStampResponse struct { // Fields of the response
+	Status struct { // PKIStatusInfo
+		Status int // 0 granted, 1 granted with modifications, anything else a rejection
 	}
-} // End of createDirectory function
+	TimeStampToken asn1.RawValue `asn1:"optional"` // CMS SignedData with the timestamp
+} // End of timeStampResponse struct
 
-// Verifies whether a string is a valid URL format
-func isUrlValid(uri string) bool { // Function to perform basic URL format validation
-	_, err := url.ParseRequestURI(uri) // Try parsing the URL
-	return err == nil                  // Return true if valid (parsing was successful, err is nil)
-} // End of isUrlValid function
+// Object identifier of SHA-256
+var sha256OID = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
 
-// Checks if a file exists at the specified path
-func fileExists(filename string) bool { // Function to check if a file exists (and is not a directory)
-	info, err := os.Stat(filename) // Try to get file information
-	if err != nil {                // If an error occurs, it likely means the file does not exist
-		return false // Return false because os.Stat couldn't find the file
+// Asks an RFC 3161 time-stamping authority to timestamp a file's SHA-256 and stores its reply as "<file>.tsr", which
+// "openssl ts -verify -in <file>.tsr -data <file> -CAfile <tsa-ca>" checks
+func timestampFile(filePath string, authorityURL string) { // Function to obtain a trusted timestamp
+	fileHash, hashError := sha256File(filePath) // Hash the file
+	if hashError != nil {                       // Check if the file could not be read
+		logError(hashError) // Log the error
+		return              // Nothing to timestamp
+	}
+	hashBytes, _ := hex.DecodeString(fileHash)                            // The hash as bytes; sha256File always returns valid hex
+	nonce, nonceError := rand.Int(rand.Reader, big.NewInt(math.MaxInt64)) // Random nonce against replayed replies
+	if nonceError != nil {                                                // Check if randomness was unavailable
+		logError(nonceError) // Log the error
+		return               // Nothing to timestamp
+	}
+	requestDER, marshalError := asn1.Marshal(timeStampRequest{ // Encode the request
+		Version: 1, // RFC 3161 version
+		MessageImprint: timeStampMessageImprint{ // What is timestamped
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: sha256OID, Parameters: asn1.NullRawValue}, // SHA-256
+			HashedMessage: hashBytes,                                                                     // The file's hash
+		},
+		Nonce:   nonce, // Random nonce
+		CertReq: true,  // Include the TSA's certificate so the token verifies on its own
+	}) // End of request
+	if marshalError != nil { // Check if encoding failed
+		logError(marshalError) // Log the error
+		return                 // Nothing to send
 	}
-	return !info.IsDir() // Return true only if the path exists and is not a directory
-} // End of fileExists function
 
-// Converts a raw URL into a sanitized filename safe for filesystem
-func urlToFilename(rawURL string) string { // Function to create a clean filename from a URL
-	lower := strings.ToLower(rawURL)    // Convert the input URL to lowercase for consistency
-	lower = strings.Split(lower, "?")[0] // Remove URL query parameters
+	httpClient := &http.Client{Timeout: time.Minute}                                                                     // TSAs answer quickly
+	httpResponse, postError := httpClient.Post(authorityURL, "application/timestamp-query", bytes.NewReader(requestDER)) // Send the request
+	if postError != nil {                                                                                                // Check for request errors
+		logErrorf("Failed to timestamp %s with %s %v", filePath, authorityURL, postError) // Log the error
+		return                                                                            // Nothing was timestamped
+	}
+	defer httpResponse.Body.Close()                                                // Close the response when done
+	responseDER, readError := io.ReadAll(io.LimitReader(httpResponse.Body, 1<<20)) // Replies are a few kilobytes
+	if readError != nil || httpResponse.StatusCode != http.StatusOK {              // Check for transport errors
+		logErrorf("Failed to timestamp %s with %s: %s %v", filePath, authorityURL, httpResponse.Status, readError) // Log the error
+		return                                                                                                     // Nothing was timestamped
+	}
+	var timestampReply timeStampResponse                                                          // The decoded reply
+	if _, unmarshalError := asn1.Unmarshal(responseDER, &timestampReply); unmarshalError != nil { // Decode the reply
+		logErrorf("Invalid timestamp reply from %s %v", authorityURL, unmarshalError) // Log the error
+		return                                                                        // Nothing was timestamped
+	}
+	if timestampReply.Status.Status > 1 || len(timestampReply.TimeStampToken.FullBytes) == 0 { // Check if the TSA refused
+		logErrorf("%s refused to timestamp %s (status %d)", authorityURL, filePath, timestampReply.Status.Status) // Log the rejection
+		return                                                                                                    // Nothing was timestamped
+	}
+	if writeError := writeArchiveFile(filePath+".tsr", responseDER, 0o644); writeError != nil { // Store the reply next to the file
+		logErrorf("Failed to write %s.tsr %v", filePath, writeError) // Log the write failure
+	}
+} // End of timestampFile function
 
-	lower = getFilename(lower) // Extract just the filename part from the URL
+// An in-toto v1 statement (https://in-toto.io/Statement/v1) attesting the files one run downloaded
+type provenanceStatement struct { // Fields of the statement
+	Type          string                  `json:"_type"`         // Statement type
+	Subject       []provenanceResource    `json:"subject"`       // Files the statement is about
+	PredicateType string                  `json:"predicateType"` // Type of the predicate
+	Predicate     slsaProvenancePredicate `json:"predicate"`     // SLSA provenance of the files
+} // End of provenanceStatement struct
 
-	// Get the file extension from the extracted filename
-	ext := getFileExtension(lower) // Get the original file extension (e.g., ".pdf" or ".zip")
+// A file or URL with its digests, as in-toto subjects and SLSA resolved dependencies describe them
+type provenanceResource struct { // Fields of a resource descriptor
+	Name   string            `json:"name,omitempty"`   // Path of the archived file
+	URI    string            `json:"uri,omitempty"`    // URL the file was downloaded from
+	Digest map[string]string `json:"digest,omitempty"` // Content hashes by algorithm; omitted for sources of rewritten files
+} // End of provenanceResource struct
 
-	reNonAlnum := regexp.MustCompile(`[^a-z0-9]`)   // Create a regex to match any non-alphanumeric characters
-	safe := reNonAlnum.ReplaceAllString(lower, "_") // Replace all non-alphanumeric characters with underscores
+// The SLSA provenance v1 predicate (https://slsa.dev/provenance/v1)
+type slsaProvenancePredicate struct { // Fields of the predicate
+	BuildDefinition struct { // What the run did
+		BuildType            string               `json:"buildType"`            // Kind of run
+		ExternalParameters   map[string]any       `json:"externalParameters"`   // Inputs chosen by the operator
+		ResolvedDependencies []provenanceResource `json:"resolvedDependencies"` // URLs the files were downloaded from
+	} `json:"buildDefinition"`
+	RunDetails struct { // Who ran it and when
+		Builder struct { // The archiver
+			ID      string            `json:"id"`      // Identity of the archiver
+			Version map[string]string `json:"version"` // Archiver and Go versions
+		} `json:"builder"`
+		Metadata struct { // Timing of the run
+			InvocationID string `json:"invocationId"` // Identifies the run
+			StartedOn    string `json:"startedOn"`    // RFC 3339 start of the run
+			FinishedOn   string `json:"finishedOn"`   // RFC 3339 end of the run
+		} `json:"metadata"`
+	} `json:"runDetails"`
+} // End of slsaProvenancePredicate struct
 
-	safe = regexp.MustCompile(`_+`).ReplaceAllString(safe, "_") // Replace multiple consecutive underscores with a single underscore
-	safe = strings.Trim(safe, "_")                              // Remove leading and trailing underscores from the filename
+// Identity of the archiver in provenance statements
+const provenanceBuilderID = "https://github.com/Strong-Foundation/radiomasterrc-com-documentation"
 
-	var invalidSubstrings = []string{ // Define a list of unwanted substrings to clean from the filename
-		"_pdf", // Common redundant suffix
-		"_zip", // Common redundant suffix
-		"_txt", // Common redundant suffix
-	} // End of invalid substrings slice
+// Writes an in-toto statement with SLSA provenance for the files downloaded during the run to
+// "<started>.intoto.json" in provenancePath, and signs it like the manifest; runs that downloaded nothing write none
+func writeRunProvenance(provenancePath string, sourcePages []string, stats *runStats) { // Function to attest a run
+	statement := provenanceStatement{Type: "https://in-toto.io/Statement/v1", PredicateType: "https://slsa.dev/provenance/v1"} // The statement
+	runStart := stats.StartedAt.Truncate(time.Second)                                                                          // Catalog timestamps have second precision
+	for _, entry := range archiveCatalog.Entries {                                                                             // Find the files this run downloaded
+		downloadedAt, parseError := time.Parse(time.RFC3339, entry.FirstSeen) // When the file was downloaded
+		if parseError != nil || downloadedAt.Before(runStart) {               // Check if it was downloaded by an earlier run
+			continue // Only this run's files
+		}
+		sha256Hash, blake3Hash, _, hashError := hashArchivedFile(filepath.FromSlash(entry.Path)) // Hash the file as it is now, after every rewrite
+		if hashError != nil {                                                                    // Check if the file could not be read
+			logErrorf("Not attesting %s %v", entry.Path, hashError) // Log the error
+			continue                                                // Only files that exist are attested
+		}
+		digest := make(map[string]string) // Hashes of the final file
+		if sha256Hash != "" {             // SHA-256 with -hash=sha256
+			digest["sha256"] = sha256Hash // Record it
+		}
+		if blake3Hash != "" { // BLAKE3 with -hash=blake3
+			digest["blake3"] = blake3Hash // Record it
+		}
+		sourceDigest := digest      // The download is the file, unless it was rewritten
+		if entry.DownloadSize > 0 { // -stamp-xmp or -linearize rewrote it, and the download's own hash was not kept
+			sourceDigest = nil // Name the source without a digest
+		}
+		statement.Subject = append(statement.Subject, provenanceResource{Name: entry.Path, Digest: digest})                                                                                   // The archived file
+		statement.Predicate.BuildDefinition.ResolvedDependencies = append(statement.Predicate.BuildDefinition.ResolvedDependencies, provenanceResource{URI: entry.URL, Digest: sourceDigest}) // Where it came from
+	}
+	if len(statement.Subject) == 0 { // Check if the run downloaded anything
+		return // Nothing to attest
+	}
+	sort.Slice(statement.Subject, func(first, second int) bool { return statement.Subject[first].Name < statement.Subject[second].Name }) // Stable order
+	dependencies := statement.Predicate.BuildDefinition.ResolvedDependencies                                                              // The source URLs
+	sort.Slice(dependencies, func(first, second int) bool { return dependencies[first].URI < dependencies[second].URI })                  // Stable order
 
-	for _, invalidPre := range invalidSubstrings { // Iterate over the unwanted substrings
-		safe = removeSubstring(safe, invalidPre) // Remove each unwanted substring from the filename
-	} // End of substring removal loop
+	statement.Predicate.BuildDefinition.BuildType = provenanceBuilderID + "/archive-run@v1"                                // Kind of run
+	statement.Predicate.BuildDefinition.ExternalParameters = map[string]any{"sources": sourcePages, "layout": *layoutMode} // Operator inputs
+	statement.Predicate.RunDetails.Builder.ID = provenanceBuilderID                                                        // The archiver
+	statement.Predicate.RunDetails.Builder.Version = map[string]string{"go": runtime.Version()}                            // Go version
+	if buildInfo, found := debug.ReadBuildInfo(); found {                                                                  // Version stamped in by the Go toolchain
+		statement.Predicate.RunDetails.Builder.Version["archiver"] = buildInfo.Main.Version // Module version, "(devel)" for local builds
+		for _, setting := range buildInfo.Settings {                                        // Look for the commit
+			if setting.Key == "vcs.revision" { // The commit the binary was built from
+				statement.Predicate.RunDetails.Builder.Version["revision"] = setting.Value // Record it
+			}
+		}
+	}
+	startedOn := stats.StartedAt.UTC().Format(time.RFC3339)                                          // Start of the run
+	statement.Predicate.RunDetails.Metadata.InvocationID = startedOn                                 // Runs never overlap, so the start time identifies one
+	statement.Predicate.RunDetails.Metadata.StartedOn = startedOn                                    // Start of the run
+	statement.Predicate.RunDetails.Metadata.FinishedOn = stats.FinishedAt.UTC().Format(time.RFC3339) // End of the run
 
-	if getFileExtension(safe) == "" { // Check if the sanitized filename has no extension
-		safe = safe + ext // Append the original file extension (e.g., .pdf) to ensure completeness
+	if !directoryExists(provenancePath) { // Create the directory on first use
+		createDirectory(provenancePath, 0o755) // Create the directory (rwxr-xr-x)
+	}
+	statementJSON, marshalError := json.MarshalIndent(statement, "", "  ") // Encode the statement as indented JSON
+	if marshalError != nil {                                               // Check if encoding failed
+		logError(marshalError) // Log the encoding error
+		return                 // Nothing to write
 	}
+	statementPath := filepath.Join(provenancePath, stats.StartedAt.UTC().Format("20060102T150405Z")+".intoto.json") // One file per run
+	if writeError := writeArchiveFile(statementPath, append(statementJSON, '\n'), 0o644); writeError != nil {       // Save the statement
+		logErrorf("Failed to write %s %v", statementPath, writeError) // Log the write failure
+		return                                                        // Nothing to sign
+	}
+	signArchiveFiles(statementPath) // Sign it like the manifest, when a key is configured
+} // End of writeRunProvenance function
 
-	return safe // Return the sanitized, safe filename
-} // End of urlToFilename function
+// Appends one run's statistics to the run history file
+func appendRunHistory(historyPath string, stats *runStats) { // Function to record a finished run
+	runJSON, marshalError := json.Marshal(stats) // Encode the run as one JSON line
+	if marshalError != nil {                     // Check if encoding failed
+		logError(marshalError) // Log the encoding error
+		return                 // Nothing to write
+	}
 
-// Gets the file extension from a given file path
-func getFileExtension(path string) string { // Function to extract the file extension
-	return filepath.Ext(path) // Use filepath.Ext to extract and return the file extension
-} // End of getFileExtension function
+	historyFile, openError := os.OpenFile(historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644) // Open the history for appending
+	if openError != nil {                                                                          // Check if the file could not be opened
+		logError(openError) // Log the error
+		return              // Nothing can be written
+	}
+	defer historyFile.Close() // Ensure the file is closed
 
-// Removes all instances of a specific substring from input string
-func removeSubstring(input string, toRemove string) string { // Function to remove all occurrences of a substring
-	result := strings.ReplaceAll(input, toRemove, "") // Replace every occurrence of 'toRemove' with an empty string
-	return result                                     // Return the cleaned string after removal
-} // End of removeSubstring function
+	_, writeError := historyFile.Write(append(runJSON, '\n'))                                               // Append the run
+	recordAudit(auditEntry{Action: "append", Path: historyPath, Size: int64(len(runJSON) + 1)}, writeError) // Audit the append
+	if writeError != nil {                                                                                  // Check if the write failed
+		logError(writeError) // Log the write failure
+	}
+} // End of appendRunHistory function
 
-// Extracts filename from full path (e.g. "/dir/file.pdf" → "file.pdf")
-func getFilename(path string) string { // Function to get only the base filename
-	return filepath.Base(path) // Use Base function to get file name only
-} // End of getFilename function
+// Reads the run history file, newest run first
+func readRunHistory(historyPath string) []*runStats { // Function to load past runs
+	historyData, readError := os.ReadFile(historyPath) // Read the whole history
+	if readError != nil {                              // Check if the file could not be read
+		return nil // No history yet
+	}
 
-// Extracts all links to PDF files from the given HTML string
-func extractPDFUrls(htmlContent string) []string { // Function to find links ending in ".pdf"
-	var pdfLinks []string // Slice to store all found PDF links
+	var runs []*runStats                                            // Parsed runs
+	for _, line := range strings.Split(string(historyData), "\n") { // Parse each line
+		run := &runStats{}                                                       // One parsed run
+		if json.Unmarshal([]byte(line), run) == nil && !run.StartedAt.IsZero() { // Skip blank or damaged lines
+			runs = append([]*runStats{run}, runs...) // Prepend so the newest run comes first
+		}
+	}
+	return runs // Return the runs
+} // End of readRunHistory function
 
-	parsedHTML, parseError := html.Parse(strings.NewReader(htmlContent)) // Parse the input HTML content
-	if parseError != nil {                                               // Check if HTML parsing failed
-		log.Println(parseError) // Log the parsing error
-		return nil              // Return nil since parsing failed
+// Reads the catalog from disk without touching the in-memory catalog a running archive may be updating
+func readCatalogFile(catalogPath string) *catalog { // Function to load a catalog snapshot
+	snapshot := &catalog{Entries: make(map[string]*catalogEntry)}             // Start from an empty catalog
+	if catalogJSON, readError := os.ReadFile(catalogPath); readError == nil { // Read the catalog file
+		if unmarshalError := json.Unmarshal(catalogJSON, snapshot); unmarshalError != nil { // Decode it
+			logError(unmarshalError) // Log the decoding error
+		}
 	}
+	return snapshot // Return the snapshot
+} // End of readCatalogFile function
 
-	var exploreHTML func(*html.Node) // Define a recursive function to explore HTML nodes
+// HTML of the web dashboard
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{"byteCount": formatByteCount}).Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>RadioMaster manuals</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 1.5rem; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2rem; }
+th, td { text-align: left; padding: .3rem .6rem; border-bottom: 1px solid #ddd; }
+.status { padding: .5rem; background: #eef; }
+</style>
+</head>
+<body>
+<h1>RadioMaster manuals</h1>
+<form method="post" action="/scrape">
+<button type="submit" {{if .Running}}disabled{{end}}>{{if .Running}}Scrape running…{{else}}Scrape now{{end}}</button>
+</form>
+{{with .Message}}<p class="status">{{.}}</p>{{end}}
+<h2>Files ({{len .Entries}})</h2>
+<table>
+<tr><th>Product</th><th>Version</th><th>Kind</th><th>Size</th><th>First seen</th><th>File</th></tr>
+{{range .Entries}}<tr><td>{{.Product}}</td><td>{{.Version}}</td><td>{{.Kind}}</td><td>{{.Size}}</td><td>{{.FirstSeen}}</td><td><a href="/files/{{.Path}}">{{.Path}}</a>{{if eq .Kind "manual"}} · <a href="/view/{{.Path}}">read</a>{{end}}</td></tr>
+{{end}}</table>
+<h2>Run history</h2>
+<table>
+<tr><th>Started</th><th>Finished</th><th>Downloaded</th><th>Skipped</th><th>Failed</th><th>Transferred</th></tr>
+{{range .Runs}}<tr><td>{{.StartedAt.Format "2006-01-02 15:04"}}</td><td>{{.FinishedAt.Format "2006-01-02 15:04"}}</td><td>{{.Downloaded}}</td><td>{{.Skipped}}</td><td>{{.Failed}}</td><td>{{byteCount .BytesTransferred}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
 
-	exploreHTML = func(currentNode *html.Node) { // The implementation of the recursive traversal function
-		if currentNode.Type == html.ElementNode && currentNode.Data == "a" { // Check if the node is an <a> tag
-			for _, attribute := range currentNode.Attr { // Iterate over the <a> tag's attributes
-				if attribute.Key == "href" { // Look for the href attribute
-					link := strings.TrimSpace(attribute.Val)             // Get the href value and trim spaces
-					if strings.Contains(strings.ToLower(link), ".pdf") { // Check if the link contains ".pdf" (case-insensitive)
-						pdfLinks = append(pdfLinks, link) // Add the link to the pdfLinks slice
-					}
+// Directory and settings the servers read, captured once at startup and passed to them explicitly, because profile
+// runs switch the working directory and flags while the servers keep answering requests
+type serverSettings struct { // Fields fixed for the lifetime of a server
+	directory           string // Absolute directory of the archive the servers show
+	siteDirectory       string // -site-dir at startup
+	archivalDirectory   string // -archival-dir at startup
+	compressedDirectory string // -compressed-dir at startup
+	markdownIndexPath   string // -markdown-index at startup
+} // End of serverSettings struct
+
+// Captures the servers' settings from the working directory and flags as they are before any run starts
+func captureServerSettings() serverSettings { // Function to fix the servers' view of the archive
+	directory, getwdError := os.Getwd() // The archive's directory
+	if getwdError != nil {              // Check if the working directory is unknown
+		logFatal(getwdError) // Stop with a clear message
+	}
+	return serverSettings{ // The settings as they are now
+		directory:           directory,            // Absolute, so later directory changes do not matter
+		siteDirectory:       *siteDirectory,       // Relative to the directory
+		archivalDirectory:   *archivalDirectory,   // Relative to the directory
+		compressedDirectory: *compressedDirectory, // Relative to the directory
+		markdownIndexPath:   *markdownIndexPath,   // Relative to the directory
+	}
+} // End of captureServerSettings function
+
+// Serves the web dashboard: the catalog and run history at "/", manual scrapes via POST "/scrape",
+// cataloged files below "/files/", a reader for manuals below "/view/", and JSON at "/api/catalog" and "/api/runs"
+func runServer(listenAddress string, settings serverSettings) { // Function implementing serve mode
+	outputDirectory := filepath.Join(settings.directory, "PDFs")      // Directory holding the catalog and run history
+	catalogPath := filepath.Join(outputDirectory, catalogFilename)    // Where the catalog is stored
+	historyPath := filepath.Join(outputDirectory, runHistoryFilename) // Where the run history is stored
+
+	serveMux := http.NewServeMux() // Routes requests to handlers
+
+	serveMux.HandleFunc("GET /{$}", func(writer http.ResponseWriter, request *http.Request) { // Dashboard page
+		snapshot := readCatalogFile(catalogPath) // Load the current catalog
+		var entries []*catalogEntry              // Entries sorted for display
+		for _, entry := range snapshot.Entries { // Collect every entry
+			entries = append(entries, entry) // Keep the entry
+		}
+		sort.Slice(entries, func(first, second int) bool { // Sort by product, then path
+			if entries[first].Product != entries[second].Product { // Compare products first
+				return entries[first].Product < entries[second].Product // Alphabetical by product
+			}
+			return entries[first].Path < entries[second].Path // Then alphabetical by path
+		}) // End of entry sort
+
+		running := archiveRunning.Load() // Whether a run is in progress
+
+		renderError := dashboardTemplate.Execute(writer, map[string]any{ // Render the page
+			"Entries": entries,                            // Cataloged files
+			"Runs":    readRunHistory(historyPath),        // Past runs, newest first
+			"Running": running,                            // Whether a run is in progress
+			"Message": request.URL.Query().Get("message"), // Status message after a redirect
+		}) // End of template data
+		if renderError != nil { // Check if rendering failed
+			logError(renderError) // Log the error
+		}
+	}) // End of dashboard handler
+
+	serveMux.HandleFunc("POST /scrape", func(writer http.ResponseWriter, request *http.Request) { // Manual scrape trigger
+		if !startBackgroundRun() { // Refuse to start a second run; a started run returns immediately
+			http.Redirect(writer, request, "/?message="+url.QueryEscape("A scrape is already running."), http.StatusSeeOther) // Tell the user
+			return                                                                                                            // Nothing to start
+		}
+		http.Redirect(writer, request, "/?message="+url.QueryEscape("Scrape started."), http.StatusSeeOther) // Tell the user
+	}) // End of scrape handler
+
+	serveMux.HandleFunc("GET /files/", func(writer http.ResponseWriter, request *http.Request) { // Cataloged file downloads
+		entry := catalogedFile(catalogPath, strings.TrimPrefix(request.URL.Path, "/files/")) // Only cataloged files may be served
+		if entry == nil {                                                                    // Check if the file is unknown
+			http.NotFound(writer, request) // Anything else does not exist as far as the dashboard is concerned
+			return                         // Done
+		}
+		http.ServeFile(writer, request, filepath.Join(settings.directory, filepath.FromSlash(entry.Path))) // Serve the file with range support
+	}) // End of file handler
+
+	serveMux.HandleFunc("GET /view/", func(writer http.ResponseWriter, request *http.Request) { // Manual reader
+		entry := catalogedFile(catalogPath, strings.TrimPrefix(request.URL.Path, "/view/")) // Only cataloged manuals can be read
+		if entry == nil || entry.Kind != "manual" {                                         // Check if the manual is unknown
+			http.NotFound(writer, request) // Nothing to show
+			return                         // Done
+		}
+		var pageNumbers []int                                                                    // Pages rendered as images, when poppler is installed
+		if _, lookupError := exec.LookPath("pdftoppm"); lookupError == nil && !entry.Encrypted { // Phones often cannot show PDFs inline, but every browser shows images
+			for pageNumber := 1; pageNumber <= pdfPageCount(filepath.Join(settings.directory, filepath.FromSlash(entry.Path))); pageNumber++ { // List every page
+				pageNumbers = append(pageNumbers, pageNumber) // Keep the page
+			}
+		}
+		if renderError := viewerTemplate.Execute(writer, map[string]any{"Entry": entry, "Pages": pageNumbers}); renderError != nil { // Render the reader
+			logError(renderError) // Log the error
+		}
+	}) // End of viewer handler
+
+	renderSlots := make(chan struct{}, 4)                                                        // At most four pdftoppm processes at once, however many pages are requested
+	serveMux.HandleFunc("GET /pages/", func(writer http.ResponseWriter, request *http.Request) { // Manual pages as images
+		entry := catalogedFile(catalogPath, strings.TrimPrefix(request.URL.Path, "/pages/")) // Only cataloged manuals can be rendered
+		pageNumber, parseError := strconv.Atoi(request.URL.Query().Get("page"))              // Page to render
+		if entry == nil || entry.Kind != "manual" || parseError != nil || pageNumber < 1 {   // Check the request
+			http.NotFound(writer, request) // Nothing to render
+			return                         // Done
+		}
+		select {
+		case renderSlots <- struct{}{}: // Wait for a free slot
+			defer func() { <-renderSlots }() // Free it when the page is sent
+		case <-request.Context().Done(): // The reader moved on while waiting
+			return // Nothing to send
+		}
+		pageImage, renderError := exec.CommandContext(request.Context(), "pdftoppm", "-png", "-r", "110", "-f", strconv.Itoa(pageNumber), "-l", strconv.Itoa(pageNumber), "-singlefile", filepath.Join(settings.directory, filepath.FromSlash(entry.Path))).Output() // Render the page to stdout
+		if renderError != nil || len(pageImage) == 0 {                                                                                                                                                                                                               // Check if rendering failed, e.g. past the last page
+			http.NotFound(writer, request) // Nothing to show
+			return                         // Done
+		}
+		writer.Header().Set("Content-Type", "image/png")      // Declare the image
+		writer.Header().Set("Cache-Control", "max-age=86400") // Archived manuals do not change under their path
+		writer.Write(pageImage)                               // Send the page
+	}) // End of page image handler
+
+	serveMux.HandleFunc("GET /api/catalog", func(writer http.ResponseWriter, request *http.Request) { // Catalog as JSON
+		if catalogInfo, statError := os.Stat(catalogPath); statError == nil { // Date the catalog, which replicas sync from
+			writer.Header().Set("Last-Modified", catalogInfo.ModTime().UTC().Format(http.TimeFormat)) // When it was last saved
+		}
+		snapshot := readCatalogFile(catalogPath)                    // Load the current catalog
+		if since := request.URL.Query().Get("since"); since != "" { // Only rows changed or removed since then, for replicas
+			sinceTime, parseError := http.ParseTime(since) // Same format as Last-Modified
+			if parseError != nil {                         // Check if the date is unreadable
+				http.Error(writer, "since must be an HTTP date", http.StatusBadRequest) // Tell the client
+				return                                                                  // Done
+			}
+			for entryURL, entry := range snapshot.Entries { // Drop the rows that did not change
+				if modified, parseError := time.Parse(time.RFC3339, cmp.Or(entry.Modified, entry.LastSeen)); parseError == nil && modified.Before(sinceTime) { // Every save that changes a row dates it; older catalogs only have LastSeen
+					delete(snapshot.Entries, entryURL) // Unchanged since then
+				}
+			}
+			for entryURL, removedAt := range snapshot.Removed { // Drop the older tombstones
+				if removedTime, parseError := time.Parse(time.RFC3339, removedAt); parseError == nil && removedTime.Before(sinceTime) { // Removed before the last sync
+					delete(snapshot.Removed, entryURL) // Already synced
 				}
 			}
 		}
+		writeJSONResponse(writer, snapshot) // Send the catalog
+	}) // End of catalog API handler
 
-		for childNode := currentNode.FirstChild; childNode != nil; childNode = childNode.NextSibling { // Recursively traverse child nodes
-			exploreHTML(childNode)
+	serveMux.HandleFunc("GET /api/runs", func(writer http.ResponseWriter, request *http.Request) { // Run history as JSON
+		writeJSONResponse(writer, readRunHistory(historyPath)) // Send the run history
+	}) // End of runs API handler
+
+	log.Printf("Serving dashboard on http://%s/", listenAddress) // Log where the dashboard is
+	logFatal(http.ListenAndServe(listenAddress, serveMux))       // Serve until the process is stopped
+} // End of runServer function
+
+// Lists the archive's top-level directories when there is no index site to show
+var fileServerTemplate = template.Must(template.New("files").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>RadioMaster archive</title>
+</head>
+<body>
+<h1>RadioMaster archive</h1>
+<ul>
+{{range .}}<li><a href="/{{.}}">{{.}}</a></li>
+{{end}}</ul>
+<p>E-reader apps such as KOReader can browse the manuals through the OPDS catalog at <a href="/opds">/opds</a>.</p>
+</body>
+</html>
+`))
+
+// Serves the archive tree read-only for browsing on the LAN: the downloaded files with range requests and content types,
+// the -site-dir index at "/" when there is one, the Markdown index, and an OPDS catalog of the manuals at "/opds" for
+// e-reader apps. Nothing else in the working directory, such as
+// the config file, is reachable.
+func runFileServer(listenAddress string, settings serverSettings) { // Function implementing serve-files mode
+	mime.AddExtensionType(".md", "text/markdown; charset=utf-8") // Not in every system's MIME table
+
+	servedRoots := slices.Clone(archiveRoots)                                                                                                             // Trees written by every run
+	for _, optionalRoot := range []string{settings.siteDirectory, settings.archivalDirectory, settings.compressedDirectory, settings.markdownIndexPath} { // Trees and files written on request
+		if optionalRoot = strings.Trim(filepath.ToSlash(filepath.Clean(optionalRoot)), "/"); optionalRoot != "" && optionalRoot != "." && !strings.HasPrefix(optionalRoot, "..") { // Only paths inside the working directory
+			servedRoots = append(servedRoots, optionalRoot) // Serve it too
 		}
 	}
 
-	exploreHTML(parsedHTML) // Begin traversal from the root node
-	return pdfLinks         // Return all found PDF links
-} // End of extractPDFUrls function
+	serveMux := http.NewServeMux()                                                            // Routes requests to handlers
+	fileServer := http.FileServer(http.Dir(settings.directory))                               // Serves files with range requests, modification times, and content types
+	serveMux.HandleFunc("GET /{$}", func(writer http.ResponseWriter, request *http.Request) { // Front page
+		if settings.siteDirectory != "" && fileExists(filepath.Join(settings.directory, settings.siteDirectory, "index.html")) { // Prefer the generated index site
+			http.Redirect(writer, request, "/"+strings.Trim(filepath.ToSlash(filepath.Clean(settings.siteDirectory)), "/")+"/", http.StatusFound) // Show it
+			return                                                                                                                                // Done
+		}
+		var existingRoots []string         // Roots that exist on disk
+		for _, root := range servedRoots { // Check each root
+			if _, statError := os.Stat(filepath.Join(settings.directory, root)); statError == nil { // Check if the root exists
+				existingRoots = append(existingRoots, root) // List it
+			}
+		}
+		if renderError := fileServerTemplate.Execute(writer, existingRoots); renderError != nil { // Render the listing
+			logError(renderError) // Log the error
+		}
+	}) // End of front page handler
+	serveMux.HandleFunc("GET /", func(writer http.ResponseWriter, request *http.Request) { // Archive files
+		requestedPath := strings.TrimPrefix(path.Clean(request.URL.Path), "/") // Path relative to the working directory
+		for _, segment := range strings.Split(requestedPath, "/") {            // Hide dotfiles such as .git
+			if strings.HasPrefix(segment, ".") { // Check if the segment is hidden
+				http.NotFound(writer, request) // Pretend it does not exist
+				return                         // Done
+			}
+		}
+		for _, root := range servedRoots { // Only the archive tree is served
+			if requestedPath == root || strings.HasPrefix(requestedPath, root+"/") { // Check if the path is inside the root
+				fileServer.ServeHTTP(writer, request) // Serve the file or directory listing
+				return                                // Done
+			}
+		}
+		http.NotFound(writer, request) // Anything else does not exist as far as the file server is concerned
+	}) // End of file handler
 
-// Downloads a PDF from the given URL and saves it in the specified directory
-func downloadPDF(pdfURL, outputDirectory string) bool { // Function to download and save a PDF file
-	safeFilename := strings.ToLower(urlToFilename(pdfURL))       // Generate a sanitized, lowercase filename
-	fullFilePath := filepath.Join(outputDirectory, safeFilename) // Build the complete file path for saving
+	serveMux.HandleFunc("GET /opds", func(writer http.ResponseWriter, request *http.Request) { // OPDS navigation feed listing the products
+		writeOPDSFeed(writer, opdsNavigationFeed(readCatalogFile(filepath.Join(settings.directory, "PDFs", catalogFilename)))) // Render the feed
+	}) // End of navigation feed handler
+	serveMux.HandleFunc("GET /opds/products/{product}", func(writer http.ResponseWriter, request *http.Request) { // OPDS acquisition feed of one product's manuals
+		writeOPDSFeed(writer, opdsProductFeed(readCatalogFile(filepath.Join(settings.directory, "PDFs", catalogFilename)), request.PathValue("product"))) // Render the feed
+	}) // End of acquisition feed handler
+
+	log.Printf("Serving the archive on http://%s/", listenAddress) // Log where the files are
+	logFatal(http.ListenAndServe(listenAddress, serveMux))         // Serve until the process is stopped
+} // End of runFileServer function
+
+const opdsFeedType = "application/atom+xml;profile=opds-catalog" // Media type of OPDS 1.2 feeds
+
+// An Atom feed in the OPDS 1.2 catalog format
+type opdsFeed struct { // Fields of an OPDS feed
+	XMLName     xml.Name    `xml:"feed"`          // Root element
+	Namespace   string      `xml:"xmlns,attr"`    // Atom namespace
+	DCNamespace string      `xml:"xmlns:dc,attr"` // Dublin Core namespace, for entry languages
+	ID          string      `xml:"id"`            // Stable identifier of the feed
+	Title       string      `xml:"title"`         // Title shown by the reader app
+	Updated     string      `xml:"updated"`       // RFC 3339 time of the newest entry
+	Links       []opdsLink  `xml:"link"`          // Self and start links
+	Entries     []opdsEntry `xml:"entry"`         // Products or manuals
+} // End of opdsFeed struct
+
+// One product or manual in an OPDS feed
+type opdsEntry struct { // Fields of an OPDS entry
+	ID       string     `xml:"id"`                    // Stable identifier of the entry
+	Title    string     `xml:"title"`                 // Product or manual title
+	Updated  string     `xml:"updated"`               // RFC 3339 time of the last change
+	Language string     `xml:"dc:language,omitempty"` // ISO 639-1 language of a manual
+	Content  string     `xml:"content,omitempty"`     // Short description
+	Links    []opdsLink `xml:"link"`                  // Subsection or acquisition links
+} // End of opdsEntry struct
+
+// One link of an OPDS feed or entry
+type opdsLink struct { // Fields of an Atom link
+	Rel    string `xml:"rel,attr"`              // Relation, e.g. "subsection" or the OPDS acquisition relation
+	Href   string `xml:"href,attr"`             // Target, absolute on this server
+	Type   string `xml:"type,attr"`             // Media type of the target
+	Length int64  `xml:"length,attr,omitempty"` // Size of an acquired file in bytes
+} // End of opdsLink struct
 
-	if fileExists(fullFilePath) { // Skip download if the file already exists
-		log.Printf("File already exists, skipping: %s", fullFilePath) // Log the skip message
-		return false                                                  // Return false since no download occurred
+// Returns the catalog's manuals that are on disk, grouped by product
+func opdsManualsByProduct(snapshot *catalog) map[string][]*catalogEntry { // Function to pick the manuals to offer
+	manualsByProduct := make(map[string][]*catalogEntry) // Manuals keyed by product
+	for _, entry := range snapshot.Entries {             // Visit every cataloged file
+		if entry.Kind == "firmware" || entry.Kind == "software" || !fileExists(filepath.FromSlash(entry.Path)) { // Only manuals that can be downloaded
+			continue // Leave the file out
+		}
+		product := cmp.Or(entry.Product, "other")                            // Files without a product are grouped together
+		manualsByProduct[product] = append(manualsByProduct[product], entry) // Add the manual
 	}
+	return manualsByProduct // Return the groups
+} // End of opdsManualsByProduct function
 
-	httpClient := &http.Client{Timeout: 15 * time.Minute} // Create an HTTP client with a 15-minute timeout
+// Builds the OPDS navigation feed with one subsection per product
+func opdsNavigationFeed(snapshot *catalog) opdsFeed { // Function to build the root feed
+	feed := opdsFeed{ID: "urn:radiomaster-archive:opds", Title: "RadioMaster manuals", Links: []opdsLink{ // Describe the feed
+		{Rel: "self", Href: "/opds", Type: opdsFeedType + ";kind=navigation"},  // This feed
+		{Rel: "start", Href: "/opds", Type: opdsFeedType + ";kind=navigation"}, // The root feed
+	}} // End of feed
+	manualsByProduct := opdsManualsByProduct(snapshot)                   // Manuals to offer
+	for _, product := range slices.Sorted(maps.Keys(manualsByProduct)) { // One entry per product, alphabetically
+		productUpdated := ""                              // Newest manual of the product
+		for _, entry := range manualsByProduct[product] { // Find it
+			productUpdated = max(productUpdated, entry.FirstSeen) // RFC 3339 timestamps sort as text
+		}
+		feed.Updated = max(feed.Updated, productUpdated)                                                                                                                                                                                  // The feed changes with its newest manual
+		feed.Entries = append(feed.Entries, opdsEntry{ID: "urn:radiomaster-archive:product:" + product, Title: product, Updated: productUpdated, Content: fmt.Sprintf("%d manual(s)", len(manualsByProduct[product])), Links: []opdsLink{ // Link the product's feed
+			{Rel: "subsection", Href: "/opds/products/" + url.PathEscape(product), Type: opdsFeedType + ";kind=acquisition"}, // The product's manuals
+		}}) // End of product entry
+	}
+	feed.Updated = cmp.Or(feed.Updated, time.Now().UTC().Format(time.RFC3339)) // An empty archive still needs a date
+	return feed                                                                // Return the feed
+} // End of opdsNavigationFeed function
 
-	httpResponse, requestError := httpClient.Get(pdfURL) // Send an HTTP GET request
-	if requestError != nil {                             // Check for request errors
-		log.Printf("Failed to download %s %v", pdfURL, requestError) // Log the error
-		return false                                                 // Return false on failure
+// Builds the OPDS acquisition feed listing one product's manuals, newest revision first
+func opdsProductFeed(snapshot *catalog, product string) opdsFeed { // Function to build a product feed
+	productPath := "/opds/products/" + url.PathEscape(product)                                                         // Where this feed is served
+	feed := opdsFeed{ID: "urn:radiomaster-archive:product:" + product, Title: product + " manuals", Links: []opdsLink{ // Describe the feed
+		{Rel: "self", Href: productPath, Type: opdsFeedType + ";kind=acquisition"}, // This feed
+		{Rel: "start", Href: "/opds", Type: opdsFeedType + ";kind=navigation"},     // The root feed
+		{Rel: "up", Href: "/opds", Type: opdsFeedType + ";kind=navigation"},        // Back to the products
+	}} // End of feed
+	manuals := opdsManualsByProduct(snapshot)[product] // The product's manuals
+	sort.Slice(manuals, func(first, second int) bool { // Newest revision first
+		return compareManualVersions(manuals[first].Version, manuals[second].Version) > 0 // Highest version first
+	}) // End of manual sort
+	for _, entry := range manuals { // One entry per manual
+		title := strings.TrimSpace(strings.Join([]string{cmp.Or(entry.Model, product), entry.Version}, " ")) // E.g. "TX16S 1.4"
+		if entry.Language != "" {                                                                            // Tell translations apart
+			title += " (" + entry.Language + ")" // Add the language
+		}
+		entryID := cmp.Or(entry.URL, "urn:radiomaster-archive:file:"+url.PathEscape(entry.Path))                                                                                        // The source URL keys the catalog, so it is unique and stable; identical copies still get their own
+		feed.Updated = max(feed.Updated, entry.FirstSeen)                                                                                                                               // The feed changes with its newest manual
+		feed.Entries = append(feed.Entries, opdsEntry{ID: entryID, Title: title, Updated: entry.FirstSeen, Language: entry.Language, Content: path.Base(entry.Path), Links: []opdsLink{ // Offer the file
+			{Rel: "http://opds-spec.org/acquisition/open-access", Href: (&url.URL{Path: "/" + entry.Path}).EscapedPath(), Type: "application/pdf", Length: entry.Size}, // Served by the file handler
+		}}) // End of manual entry
 	}
-	defer httpResponse.Body.Close() // Ensure the response body is closed
+	feed.Updated = cmp.Or(feed.Updated, time.Now().UTC().Format(time.RFC3339)) // An empty product still needs a date
+	return feed                                                                // Return the feed
+} // End of opdsProductFeed function
 
-	if httpResponse.StatusCode != http.StatusOK { // Verify that the HTTP status is 200 OK
-		log.Printf("Download failed for %s %s", pdfURL, httpResponse.Status) // Log the non-OK status
-		return false                                                         // Return false on non-200 status
+// Writes an OPDS feed as an XML response
+func writeOPDSFeed(writer http.ResponseWriter, feed opdsFeed) { // Function to send a feed
+	feed.Namespace = "http://www.w3.org/2005/Atom"             // Atom feeds
+	feed.DCNamespace = "http://purl.org/dc/terms/"             // Dublin Core terms, for entry languages
+	feedXML, marshalError := xml.MarshalIndent(feed, "", "  ") // Encode the feed
+	if marshalError != nil {                                   // Check if encoding failed
+		http.Error(writer, marshalError.Error(), http.StatusInternalServerError) // Report it
+		return                                                                   // Nothing to send
 	}
+	feedKind := "navigation"                                  // Type of the feed, from its self link
+	if strings.HasSuffix(feed.Links[0].Type, "acquisition") { // Check if the feed offers files
+		feedKind = "acquisition" // It does
+	}
+	writer.Header().Set("Content-Type", opdsFeedType+";kind="+feedKind) // Let the reader app recognize the feed
+	writer.Write(append([]byte(xml.Header), feedXML...))                // Send the feed
+} // End of writeOPDSFeed function
 
-	contentType := httpResponse.Header.Get("Content-Type") // Get the content type of the response
+// Reading page for one manual: page images rendered by the server, or the browser's own PDF viewer when they are unavailable
+var viewerTemplate = template.Must(template.New("viewer").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Entry.Product}} {{.Entry.Version}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 0; background: #555; }
+header { padding: .6rem 1rem; background: #fff; position: sticky; top: 0; }
+img { display: block; width: 100%; max-width: 60rem; margin: .5rem auto; background: #fff; }
+iframe { width: 100%; height: calc(100vh - 3rem); border: 0; }
+</style>
+</head>
+<body>
+<header><a href="/">←</a> {{.Entry.Product}} {{.Entry.Version}} · <a href="/files/{{.Entry.Path}}" download>Download</a></header>
+{{range .Pages}}<img src="/pages/{{$.Entry.Path}}?page={{.}}" alt="Page {{.}}" loading="lazy">
+{{else}}<iframe src="/files/{{.Entry.Path}}" title="{{.Entry.Path}}"></iframe>
+{{end}}</body>
+</html>
+`))
 
-	// Validate that the response is a PDF or binary stream
-	if !strings.Contains(contentType, "binary/octet-stream") && // Check for generic binary/octet-stream
-		!strings.Contains(contentType, "application/pdf") { // Check for standard application/pdf
-		log.Printf("Invalid content type for %s %s (expected binary/octet-stream or application/pdf)", pdfURL, contentType) // Log the invalid content type
-		return false                                                                                                        // Return false if content type is incorrect
+// Returns the catalog entry stored at a path relative to the working directory, or nil if no cataloged file is there
+func catalogedFile(catalogPath string, requestedPath string) *catalogEntry { // Function to look up a served file
+	for _, entry := range cachedCatalogFile(catalogPath).Entries { // Only cataloged files may be served
+		if entry.Path == requestedPath && pathWithinDirectory(".", filepath.FromSlash(entry.Path)) { // Check if this is the requested file, and never serve outside the working directory
+			return entry // The file
+		}
 	}
+	return nil // Not cataloged
+} // End of catalogedFile function
+
+// Catalog last read for looking up served files, reused while the file on disk is unchanged
+var servedCatalog = struct {
+	sync.Mutex           // Guards the fields
+	path       string    // Catalog file the snapshot was read from
+	modTime    time.Time // Modification time of the file when it was read
+	size       int64     // Size of the file when it was read
+	snapshot   *catalog  // The parsed catalog; callers must not change it
+}{}
 
-	var responseBuffer bytes.Buffer                                        // Buffer to store the downloaded data
-	bytesWritten, copyError := io.Copy(&responseBuffer, httpResponse.Body) // Copy data from response body into buffer
-	if copyError != nil {                                                  // Check for read errors
-		log.Printf("Failed to read PDF data from %s %v", pdfURL, copyError) // Log the read failure
-		return false                                                        // Return false on read error
+// Returns the catalog at catalogPath for read-only lookups, parsing it again only after the file changed
+func cachedCatalogFile(catalogPath string) *catalog { // Function to load a shared catalog snapshot
+	catalogInfo, statError := os.Stat(catalogPath)                                                                                                                                                // Check the file for changes
+	servedCatalog.Lock()                                                                                                                                                                          // Lock the snapshot
+	defer servedCatalog.Unlock()                                                                                                                                                                  // Unlock when done
+	if statError == nil && servedCatalog.snapshot != nil && servedCatalog.path == catalogPath && servedCatalog.modTime.Equal(catalogInfo.ModTime()) && servedCatalog.size == catalogInfo.Size() { // Check if the file is unchanged
+		return servedCatalog.snapshot // Reuse the parsed catalog
 	}
-	if bytesWritten == 0 { // Handle empty downloads
-		log.Printf("Downloaded 0 bytes for %s; not creating file", pdfURL) // Log empty download
-		return false                                                       // Return false if no data was downloaded
+	snapshot := readCatalogFile(catalogPath) // Parse the file
+	if statError == nil {                    // Only files that exist can be checked for changes
+		servedCatalog.path, servedCatalog.modTime, servedCatalog.size, servedCatalog.snapshot = catalogPath, catalogInfo.ModTime(), catalogInfo.Size(), snapshot // Remember it
+	}
+	return snapshot // Return the catalog
+} // End of cachedCatalogFile function
+
+var pdfinfoPagesPattern = regexp.MustCompile(`(?m)^Pages:\s+(\d+)`) // Page count line of pdfinfo's output
+
+// Returns the number of pages of a PDF according to poppler's pdfinfo, or 0 if it is unavailable
+func pdfPageCount(pdfPath string) int { // Function to count a PDF's pages
+	infoOutput, runError := exec.Command("pdfinfo", pdfPath).Output() // Read the document information
+	if runError != nil {                                              // Check if pdfinfo is missing or failed
+		return 0 // Unknown
+	}
+	pagesMatch := pdfinfoPagesPattern.FindSubmatch(infoOutput) // Find the page count line
+	if pagesMatch == nil {                                     // Check if the line is missing
+		return 0 // Unknown
+	}
+	pageCount, _ := strconv.Atoi(string(pagesMatch[1])) // The digits always parse
+	return pageCount                                    // The page count
+} // End of pdfPageCount function
+
+// Writes a value as an indented JSON response
+func writeJSONResponse(writer http.ResponseWriter, value any) { // Function to send JSON
+	writer.Header().Set("Content-Type", "application/json")           // Declare the JSON body
+	jsonEncoder := json.NewEncoder(writer)                            // Encode straight into the response
+	jsonEncoder.SetIndent("", "  ")                                   // Indent for readability
+	if encodeError := jsonEncoder.Encode(value); encodeError != nil { // Send the value
+		logError(encodeError) // Log the error
+	}
+} // End of writeJSONResponse function
+
+// Service description of the gRPC control API; the messages are protobuf well-known types, see archiver.proto
+var archiverServiceDesc = grpc.ServiceDesc{
+	ServiceName: "radiomaster.archiver.v1.Archiver", // Fully qualified service name
+	HandlerType: (*any)(nil),                        // Handlers are plain functions, so no interface is required
+	Methods: []grpc.MethodDesc{ // Unary methods
+		{MethodName: "TriggerScrape", Handler: unaryStructHandler(triggerScrapeRPC)}, // Starts a run
+		{MethodName: "GetStatus", Handler: unaryStructHandler(getStatusRPC)},         // Reports the current run
+	},
+	Streams: []grpc.StreamDesc{ // Streaming methods
+		{StreamName: "StreamEvents", Handler: streamEventsRPC, ServerStreams: true}, // Streams lifecycle events
+	},
+	Metadata: "archiver.proto", // Source of the service definition
+}
+
+// Serves the gRPC control API until the process stops
+func runGRPCServer(listenAddress string) { // Function to run the control service
+	listener, listenError := net.Listen("tcp", listenAddress) // Open the listening socket
+	if listenError != nil {                                   // Check if the address is unusable
+		logError(listenError) // Log the error
+		return                // The archiver keeps working without the control API
+	}
+
+	grpcServer := grpc.NewServer()                                   // Create the server
+	grpcServer.RegisterService(&archiverServiceDesc, nil)            // Register the control service
+	log.Printf("Serving gRPC control API on %s", listenAddress)      // Log where the API is
+	if serveError := grpcServer.Serve(listener); serveError != nil { // Serve until stopped
+		logError(serveError) // Log why serving stopped
+	}
+} // End of runGRPCServer function
+
+// Adapts a function taking no arguments and returning a struct to a unary gRPC handler with an Empty request
+func unaryStructHandler(method func(context.Context) (*structpb.Struct, error)) grpc.MethodHandler { // Function to build a handler
+	return func(server any, ctx context.Context, decode func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) { // The gRPC handler
+		request := new(emptypb.Empty)                           // The request carries no fields
+		if decodeError := decode(request); decodeError != nil { // Decode it anyway to validate the call
+			return nil, decodeError // Reject malformed requests
+		}
+		if interceptor == nil { // No interceptors are installed
+			return method(ctx) // Call the method directly
+		}
+		return interceptor(ctx, request, &grpc.UnaryServerInfo{Server: server}, func(ctx context.Context, _ any) (any, error) { // Run through the interceptor
+			return method(ctx) // Call the method
+		}) // End of interceptor call
+	}
+} // End of unaryStructHandler function
+
+// Starts a run in the background, failing with ABORTED when one is already in progress
+func triggerScrapeRPC(ctx context.Context) (*structpb.Struct, error) { // Function implementing TriggerScrape
+	if !startBackgroundRun() { // Refuse to start a second run; a started run returns immediately
+		return nil, status.Error(codes.Aborted, "a scrape is already running") // Tell the caller
+	}
+	return structpb.NewStruct(map[string]any{"started": true}) // Confirm the start
+} // End of triggerScrapeRPC function
+
+// Reports whether a run is in progress along with the counters of the current or last run
+func getStatusRPC(ctx context.Context) (*structpb.Struct, error) { // Function implementing GetStatus
+	running := archiveRunning.Load()                      // Whether a run is in progress
+	startedAt, _ := runStatistics.status()                // When the current or last run started
+	downloaded, skipped, failed := runStatistics.counts() // Read the counters safely
+	return structpb.NewStruct(map[string]any{             // Build the status
+		"running":    running,                        // Whether a run is in progress
+		"started_at": startedAt.Format(time.RFC3339), // When the current or last run started
+		"downloaded": downloaded,                     // Files downloaded
+		"skipped":    skipped,                        // Files already on disk
+		"failed":     failed,                         // Failed downloads
+	}) // End of status
+} // End of getStatusRPC function
+
+// Streams every lifecycle event, shaped like the webhook payload, until the client disconnects
+func streamEventsRPC(server any, stream grpc.ServerStream) error { // Function implementing StreamEvents
+	if receiveError := stream.RecvMsg(new(emptypb.Empty)); receiveError != nil { // Read the empty request
+		return receiveError // Reject malformed requests
+	}
+
+	events, unsubscribe := subscribeEvents() // Start receiving events
+	defer unsubscribe()                      // Stop receiving when the client leaves
+	for {
+		select {
+		case <-stream.Context().Done(): // The client disconnected
+			return nil // End the stream
+		case eventBody := <-events: // An event arrived
+			event := new(structpb.Struct)                                                       // The protobuf form of the event
+			if unmarshalError := protojson.Unmarshal(eventBody, event); unmarshalError != nil { // Convert the JSON envelope
+				logError(unmarshalError) // Log the conversion error
+				continue                 // Skip the event
+			}
+			if sendError := stream.SendMsg(event); sendError != nil { // Send the event
+				return sendError // The client is gone
+			}
+		}
+	}
+} // End of streamEventsRPC function
+
+// Returns a new hasher for the algorithm chosen with -hash
+func newContentHasher() hash.Hash { // Function to create the content hasher
+	if *hashAlgorithm == "blake3" { // BLAKE3 is several times faster on CPUs without SHA extensions
+		return blake3.New() // 256-bit BLAKE3
+	}
+	return sha256.New() // SHA-256 is the default
+} // End of newContentHasher function
+
+// Returns a hex digest made by newContentHasher in the matching field: SHA-256 or BLAKE3
+func contentHashFields(digest string) (string, string) { // Function to file a content hash
+	if *hashAlgorithm == "blake3" { // Report the digest in the BLAKE3 field
+		return "", digest // No SHA-256 was computed
 	}
+	return digest, "" // No BLAKE3 was computed
+} // End of contentHashFields function
 
-	outputFile, fileCreateError := os.Create(fullFilePath) // Create the output file for saving
-	if fileCreateError != nil {                            // Handle file creation errors
-		log.Printf("Failed to create file for %s %v", pdfURL, fileCreateError) // Log the creation failure
-		return false                                                           // Return false on file creation error
+// Links cataloged files whose content is byte-identical to a file of another product, logging newly found links
+func rebuildCrossProductDuplicates() { // Function to find files shared between products
+	entriesByContent := make(map[string][]*catalogEntry) // Entries grouped by content hash
+	for _, entry := range archiveCatalog.Entries {       // Group every cataloged file
+		contentKey := "sha256:" + entry.SHA256 // Prefer SHA-256, as sameContent does
+		if entry.SHA256 == "" {                // Fall back to BLAKE3
+			contentKey = "blake3:" + entry.BLAKE3 // Entries hashed with BLAKE3
+		}
+		if entry.SHA256 == "" && entry.BLAKE3 == "" { // Unhashed entries cannot be compared
+			continue // Skip it
+		}
+		entriesByContent[contentKey] = append(entriesByContent[contentKey], entry) // Add it to its group
 	}
-	defer outputFile.Close() // Ensure the file is closed after writing
 
-	if _, writeError := responseBuffer.WriteTo(outputFile); writeError != nil { // Write buffer contents to file
-		log.Printf("Failed to write PDF to file for %s %v", pdfURL, writeError) // Log the write failure
-		return false                                                            // Return false on write error
+	for _, group := range entriesByContent { // Link each group's entries
+		for _, entry := range group { // Decide each entry's links
+			var sharedWith []string       // Identical files of other products
+			for _, other := range group { // Compare with the rest of the group
+				if other.Product != entry.Product { // Only other products count; same-product copies are re-uploads
+					sharedWith = append(sharedWith, other.URL) // Link them
+				}
+			}
+			slices.Sort(sharedWith)                                                 // Keep the catalog stable between runs
+			if !slices.Equal(sharedWith, entry.SharedWith) && len(sharedWith) > 0 { // Check if the entry gained links
+				log.Printf("%s (%s) is byte-identical to %s", entry.Path, entry.Product, strings.Join(sharedWith, ", ")) // Report the shared file
+			}
+			entry.SharedWith = sharedWith // Store the links
+		}
 	}
+} // End of rebuildCrossProductDuplicates function
 
-	log.Printf("Successfully downloaded %d bytes: %s → %s", bytesWritten, pdfURL, fullFilePath) // Log success message
-	return true                                                                                 // Indicate successful download
-} // End of downloadPDF function
\ No newline at end of file
+// Reports whether two catalog entries have the same content, comparing whichever hash both of them carry
+func sameContent(first *catalogEntry, second *catalogEntry) bool { // Function to compare content hashes
+	if first.SHA256 != "" && second.SHA256 != "" { // Both have SHA-256
+		return first.SHA256 == second.SHA256 // Compare them
+	}
+	if first.BLAKE3 != "" && second.BLAKE3 != "" { // Both have BLAKE3
+		return first.BLAKE3 == second.BLAKE3 // Compare them
+	}
+	return false // Entries hashed with different algorithms cannot be shown to match
+} // End of sameContent function
@@ -0,0 +1,540 @@
+package main // Tests live beside the code they exercise
+
+import (
+	"bytes"             // Firmware content
+	"maps"              // Listing catalog keys
+	"net/http"          // Headers of server answers
+	"net/http/httptest" // Local servers standing in for the vendor's
+	"net/netip"         // Addresses to classify
+	"os"                // Files the downloads leave behind
+	"os/exec"           // Child processes that exit
+	"path/filepath"     // Paths in the platform's form
+	"slices"            // Comparing results
+	"strings"           // Building digests
+	"sync"              // Guarding what the webhook received
+	"testing"           // Go's test framework
+	"time"              // Start of the test run
+) // End of import block
+
+// Checks that merging another archive's records adopts what this archive lacks and keeps what it already has
+func TestMergeCatalogRecords(t *testing.T) { // Test of mergeCatalogRecords
+	testCases := []struct { // Each case merges one catalog into a fresh one
+		name         string   // What the case covers
+		localCatalog *catalog // This archive's catalog before the merge
+		otherCatalog *catalog // The catalog merged in
+		wantProduct  string   // Name expected for the product page "p"
+		wantUpdates  int      // Updates expected on the timeline of product "tx16s"
+	}{
+		{
+			name:         "adopts missing records",
+			localCatalog: &catalog{Entries: map[string]*catalogEntry{}},
+			otherCatalog: &catalog{Products: map[string]*productRecord{"p": {URL: "p", Name: "Other"}}, UpdateTimeline: map[string][]*documentUpdate{"tx16s": {{URL: "https://example.com/a.pdf", LastModified: "2024-01-02T03:04:05Z"}}}},
+			wantProduct:  "Other",
+			wantUpdates:  1,
+		},
+		{
+			name:         "keeps local records",
+			localCatalog: &catalog{Entries: map[string]*catalogEntry{}, Products: map[string]*productRecord{"p": {URL: "p", Name: "Local"}}},
+			otherCatalog: &catalog{Products: map[string]*productRecord{"p": {URL: "p", Name: "Other"}}},
+			wantProduct:  "Local",
+		},
+		{
+			name:         "skips known and malformed dates",
+			localCatalog: &catalog{Entries: map[string]*catalogEntry{}, UpdateTimeline: map[string][]*documentUpdate{"tx16s": {{URL: "https://example.com/a.pdf", LastModified: "2024-01-02T03:04:05Z"}}}},
+			otherCatalog: &catalog{Products: map[string]*productRecord{"p": {URL: "p", Name: "Other"}}, UpdateTimeline: map[string][]*documentUpdate{"tx16s": {{URL: "https://example.com/a.pdf", LastModified: "2024-01-02T03:04:05Z"}, {URL: "https://example.com/b.pdf", LastModified: "yesterday"}}}},
+			wantProduct:  "Other",
+			wantUpdates:  1,
+		},
+	}
+
+	savedCatalog := archiveCatalog                      // The catalog other code sees
+	t.Cleanup(func() { archiveCatalog = savedCatalog }) // Restore it after the test
+	for _, testCase := range testCases {                // Run each case
+		archiveCatalog = testCase.localCatalog                                                               // Merge into the case's catalog
+		mergeCatalogRecords(testCase.otherCatalog)                                                           // Merge the other catalog
+		if product := archiveCatalog.Products["p"]; product == nil || product.Name != testCase.wantProduct { // Check the product page
+			t.Errorf("%s: product page = %+v, want name %q", testCase.name, product, testCase.wantProduct) // Report the mismatch
+		}
+		if updates := len(archiveCatalog.UpdateTimeline["tx16s"]); updates != testCase.wantUpdates { // Check the timeline
+			t.Errorf("%s: %d update(s) on the timeline, want %d", testCase.name, updates, testCase.wantUpdates) // Report the mismatch
+		}
+	}
+} // End of TestMergeCatalogRecords function
+
+// Checks which differences between a server's answer and a cataloged download are reported
+func TestHeaderChanges(t *testing.T) { // Test of headerChanges
+	entry := &catalogEntry{Size: 100, ETag: `"abc"`, LastModified: "Mon, 01 Jan 2024 00:00:00 GMT"} // A cataloged download
+	testCases := []struct {                                                                         // Each case compares one answer
+		name          string        // What the case covers
+		entry         *catalogEntry // The cataloged download
+		contentLength int64         // Size the server reported, -1 when unknown
+		header        http.Header   // Headers the server sent
+		want          []string      // Differences expected
+	}{
+		{name: "unchanged", entry: entry, contentLength: 100, header: http.Header{"Etag": {`"abc"`}, "Last-Modified": {"Mon, 01 Jan 2024 00:00:00 GMT"}}},
+		{name: "unknown size and missing headers", entry: entry, contentLength: -1, header: http.Header{}},
+		{name: "size changed", entry: entry, contentLength: 120, header: http.Header{}, want: []string{"size 100 → 120"}},
+		{name: "rewritten file compared by download size", entry: &catalogEntry{Size: 150, DownloadSize: 100}, contentLength: 100, header: http.Header{}},
+		{name: "ETag and date changed", entry: entry, contentLength: 100, header: http.Header{"Etag": {`"def"`}, "Last-Modified": {"Tue, 02 Jan 2024 00:00:00 GMT"}}, want: []string{`ETag "abc" → "def"`, "Last-Modified Mon, 01 Jan 2024 00:00:00 GMT → Tue, 02 Jan 2024 00:00:00 GMT"}},
+		{name: "nothing cataloged to compare", entry: &catalogEntry{Size: 100}, contentLength: 100, header: http.Header{"Etag": {`"def"`}, "Last-Modified": {"Tue, 02 Jan 2024 00:00:00 GMT"}}},
+	}
+
+	for _, testCase := range testCases { // Run each case
+		if changes := headerChanges(testCase.entry, testCase.contentLength, testCase.header); !slices.Equal(changes, testCase.want) { // Compare the differences
+			t.Errorf("%s: headerChanges() = %q, want %q", testCase.name, changes, testCase.want) // Report the mismatch
+		}
+	}
+} // End of TestHeaderChanges function
+
+// Checks that spellings of the same download link share one canonical form, and that links selecting other files keep
+// their differences
+func TestCanonicalLinkURL(t *testing.T) { // Test of canonicalLinkURL
+	testCases := []struct { // Each case canonicalizes one link
+		name           string // What the case covers
+		link           string // Link as found on a page
+		keepParameters string // Value of -keep-params
+		want           string // Canonical form expected
+	}{
+		{name: "host case and default port", link: "HTTPS://Cdn.Shopify.COM:443/s/files/a.pdf", want: "https://cdn.shopify.com/s/files/a.pdf"},
+		{name: "other ports kept", link: "http://example.com:8080/a.pdf", want: "http://example.com:8080/a.pdf"},
+		{name: "fragment dropped", link: "https://example.com/a.pdf#page=2", want: "https://example.com/a.pdf"},
+		{name: "unreserved characters decoded", link: "https://example.com/%7Euser/a%2db.pdf", want: "https://example.com/~user/a-b.pdf"},
+		{name: "reserved encodings upper-cased", link: "https://example.com/a%2fb.pdf", want: "https://example.com/a%2Fb.pdf"},
+		{name: "tracking parameters dropped", link: "https://example.com/a.pdf?utm_source=x&fbclid=y&id=3", want: "https://example.com/a.pdf?id=3"},
+		{name: "Shopify version dropped", link: "https://cdn.shopify.com/s/files/a.pdf?v=1712345678", want: "https://cdn.shopify.com/s/files/a.pdf"},
+		{name: "store CDN path version dropped", link: "https://radiomasterrc.com/cdn/shop/files/a.pdf?v=1712345678", want: "https://radiomasterrc.com/cdn/shop/files/a.pdf"},
+		{name: "other hosts' version kept", link: "https://example.com/a.pdf?v=2", want: "https://example.com/a.pdf?v=2"},
+		{name: "kept parameters survive", link: "https://example.com/a.pdf?_=1&utm_source=x", keepParameters: "_", want: "https://example.com/a.pdf?_=1"},
+		{name: "untouched query keeps its order", link: "https://example.com/a.pdf?b=2&a=1", want: "https://example.com/a.pdf?b=2&a=1"},
+		{name: "signed query left alone", link: "https://bucket.s3.amazonaws.com/a.pdf?utm_source=x&X-Amz-Signature=abc", want: "https://bucket.s3.amazonaws.com/a.pdf?utm_source=x&X-Amz-Signature=abc"},
+		{name: "other schemes left alone", link: "mailto:Support@Example.com", want: "mailto:Support@Example.com"},
+	}
+
+	savedKeepParameters := *keepParameters                      // The flag other code sees
+	t.Cleanup(func() { *keepParameters = savedKeepParameters }) // Restore it after the test
+	for _, testCase := range testCases {                        // Run each case
+		*keepParameters = testCase.keepParameters                                     // Use the case's keep-list
+		if canonical := canonicalLinkURL(testCase.link); canonical != testCase.want { // Compare the canonical form
+			t.Errorf("%s: canonicalLinkURL(%q) = %q, want %q", testCase.name, testCase.link, canonical, testCase.want) // Report the mismatch
+		}
+	}
+} // End of TestCanonicalLinkURL function
+
+// Checks which download hosts the allow-list accepts, with and without -allowed-hosts, mirrors and -github-repos
+func TestDownloadHostAllowed(t *testing.T) { // Test of downloadHostAllowed
+	testCases := []struct { // Each case checks one link
+		name         string              // What the case covers
+		link         string              // Link to download
+		allowedHosts string              // Value of -allowed-hosts
+		repositories string              // Value of -github-repos
+		mirrors      map[string][]string // Mirrors from the config file
+		want         bool                // Whether the download is allowed
+	}{
+		{name: "vendor store", link: "https://radiomasterrc.com/a.pdf", want: true},
+		{name: "vendor subdomain", link: "https://www.RadioMasterRC.com./a.pdf", want: true},
+		{name: "Shopify CDN", link: "https://cdn.shopify.com/s/files/a.pdf", want: true},
+		{name: "lookalike domain", link: "https://evilradiomasterrc.com/a.pdf", want: false},
+		{name: "file host not listed", link: "https://drive.google.com/uc?id=1", want: false},
+		{name: "file host listed", link: "https://drive.google.com/uc?id=1", allowedHosts: "example.org, .google.com", want: true},
+		{name: "wildcard", link: "https://anything.example/a.pdf", allowedHosts: "*", want: true},
+		{name: "mirror host", link: "https://mirror.example.net/a.pdf", mirrors: map[string][]string{"https://radiomasterrc.com/": {"https://mirror.example.net/"}}, want: true},
+		{name: "configured release asset", link: "https://github.com/EdgeTX/edgetx/releases/download/v2.10.0/fw.zip", repositories: "EdgeTX/edgetx", want: true},
+		{name: "other repository", link: "https://github.com/someone/else/releases/download/v1/fw.zip", repositories: "EdgeTX/edgetx", want: false},
+		{name: "release asset host", link: "https://objects.githubusercontent.com/a", repositories: "EdgeTX/edgetx", want: true},
+		{name: "release asset host without repositories", link: "https://objects.githubusercontent.com/a", want: false},
+		{name: "malformed link", link: "https://radiomasterrc.com/%zz", want: false},
+	}
+
+	savedAllowedHosts, savedRepositories, savedMirrors := *allowedHosts, *githubRepositories, mirrorPrefixes // Settings other code sees
+	t.Cleanup(func() {
+		*allowedHosts, *githubRepositories, mirrorPrefixes = savedAllowedHosts, savedRepositories, savedMirrors
+	}) // Restore them after the test
+	for _, testCase := range testCases { // Run each case
+		*allowedHosts, *githubRepositories, mirrorPrefixes = testCase.allowedHosts, testCase.repositories, testCase.mirrors // Use the case's settings
+		if allowed := downloadHostAllowed(testCase.link); allowed != testCase.want {                                        // Check the link
+			t.Errorf("%s: downloadHostAllowed(%q) = %v, want %v", testCase.name, testCase.link, allowed, testCase.want) // Report the mismatch
+		}
+	}
+} // End of TestDownloadHostAllowed function
+
+// Checks which addresses count as public, so scraped links never reach internal services
+func TestIsPublicAddress(t *testing.T) { // Test of isPublicAddress
+	testCases := []struct { // Each case classifies one address
+		address string // Address to classify
+		want    bool   // Whether it is public
+	}{
+		{address: "93.184.216.34", want: true},
+		{address: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{address: "127.0.0.1", want: false},
+		{address: "10.1.2.3", want: false},
+		{address: "172.16.0.1", want: false},
+		{address: "192.168.1.1", want: false},
+		{address: "169.254.169.254", want: false},
+		{address: "100.64.0.1", want: false},
+		{address: "198.18.0.1", want: false},
+		{address: "192.0.0.8", want: false},
+		{address: "0.0.0.0", want: false},
+		{address: "224.0.0.1", want: false},
+		{address: "::1", want: false},
+		{address: "fe80::1", want: false},
+		{address: "fd00::1", want: false},
+		{address: "::ffff:127.0.0.1", want: false},
+		{address: "::ffff:93.184.216.34", want: true},
+	}
+
+	for _, testCase := range testCases { // Run each case
+		if public := isPublicAddress(netip.MustParseAddr(testCase.address)); public != testCase.want { // Classify the address
+			t.Errorf("isPublicAddress(%s) = %v, want %v", testCase.address, public, testCase.want) // Report the mismatch
+		}
+	}
+} // End of TestIsPublicAddress function
+
+// Checks that paths built from outside names cannot escape their directory
+func TestPathWithinDirectory(t *testing.T) { // Test of pathWithinDirectory
+	testCases := []struct { // Each case checks one path
+		directory     string // Directory the path must stay in
+		candidatePath string // Path to check
+		want          bool   // Whether the path stays inside
+	}{
+		{directory: "PDFs", candidatePath: filepath.Join("PDFs", "a.pdf"), want: true},
+		{directory: "PDFs", candidatePath: filepath.Join("PDFs", "tx16s", "a.pdf"), want: true},
+		{directory: "PDFs", candidatePath: filepath.Join("PDFs", "tx16s", "..", "a.pdf"), want: true},
+		{directory: "PDFs", candidatePath: "PDFs", want: true},
+		{directory: "PDFs", candidatePath: filepath.Join("PDFs", "..", "main.go"), want: false},
+		{directory: "PDFs", candidatePath: filepath.Join("PDFsX", "a.pdf"), want: false},
+		{directory: "PDFs", candidatePath: filepath.Join("..", "PDFs", "a.pdf"), want: false},
+		{directory: "/srv/archive", candidatePath: "/srv/archive/PDFs/a.pdf", want: true},
+		{directory: "/srv/archive", candidatePath: "/etc/passwd", want: false},
+	}
+
+	for _, testCase := range testCases { // Run each case
+		if within := pathWithinDirectory(testCase.directory, testCase.candidatePath); within != testCase.want { // Check the path
+			t.Errorf("pathWithinDirectory(%q, %q) = %v, want %v", testCase.directory, testCase.candidatePath, within, testCase.want) // Report the mismatch
+		}
+	}
+} // End of TestPathWithinDirectory function
+
+// Checks which checksums are taken from page text: only digests labelled with an algorithm their length fits, the
+// strongest first
+func TestFindPublishedChecksum(t *testing.T) { // Test of findPublishedChecksum
+	md5Digest, sha1Digest, sha256Digest, sha512Digest := strings.Repeat("a", 32), strings.Repeat("b", 40), strings.Repeat("C", 64), strings.Repeat("d", 128) // Digests of each length
+	testCases := []struct {                                                                                                                                  // Each case searches one text
+		name string // What the case covers
+		text string // Page text
+		want string // Checksum expected
+	}{
+		{name: "no checksum", text: "Release notes for v2.10", want: ""},
+		{name: "bare digest ignored", text: "Download " + sha256Digest, want: ""},
+		{name: "labelled SHA-256", text: "SHA-256: " + sha256Digest, want: "sha256:" + strings.ToLower(sha256Digest)},
+		{name: "checksum wording", text: "sha256 checksum: " + sha256Digest, want: "sha256:" + strings.ToLower(sha256Digest)},
+		{name: "SHA256SUM label", text: "SHA256SUM: " + sha256Digest, want: "sha256:" + strings.ToLower(sha256Digest)},
+		{name: "MD5 hash", text: "MD5 hash " + md5Digest, want: "md5:" + md5Digest},
+		{name: "label must fit the length", text: "SHA1: " + sha256Digest, want: ""},
+		{name: "strongest wins", text: "MD5: " + md5Digest + " SHA1: " + sha1Digest + " SHA512: " + sha512Digest, want: "sha512:" + sha512Digest},
+	}
+
+	for _, testCase := range testCases { // Run each case
+		if checksum := findPublishedChecksum(testCase.text); checksum != testCase.want { // Search the text
+			t.Errorf("%s: findPublishedChecksum() = %q, want %q", testCase.name, checksum, testCase.want) // Report the mismatch
+		}
+	}
+} // End of TestFindPublishedChecksum function
+
+// Checks where release assets of the -github-repos repositories are filed, and that other links are left alone
+func TestGitHubReleaseDirectory(t *testing.T) { // Test of githubReleaseDirectory
+	testCases := []struct { // Each case files one link
+		name   string // What the case covers
+		rawURL string // Link to a release asset
+		want   string // Directory expected, "" for links that are not filed by tag
+	}{
+		{name: "configured repository", rawURL: "https://github.com/EdgeTX/EdgeTX/releases/download/v2.10.0/fw.zip", want: filepath.Join("edgetx", "edgetx", "v2.10.0")},
+		{name: "escaped tag", rawURL: "https://github.com/ExpressLRS/ExpressLRS/releases/download/3.4.0%2Brc1/fw.zip", want: filepath.Join("expresslrs", "expresslrs", "3.4.0+rc1")},
+		{name: "slash in tag", rawURL: "https://github.com/EdgeTX/edgetx/releases/download/a%2Fb/fw.zip", want: filepath.Join("edgetx", "edgetx", "a_b")},
+		{name: "dot-dot tag", rawURL: "https://github.com/EdgeTX/edgetx/releases/download/%2E%2E/fw.zip", want: ""},
+		{name: "other repository", rawURL: "https://github.com/someone/else/releases/download/v1/fw.zip", want: ""},
+		{name: "not a release asset", rawURL: "https://github.com/EdgeTX/edgetx/archive/refs/tags/v2.10.0.zip", want: ""},
+		{name: "other host", rawURL: "https://example.com/EdgeTX/edgetx/releases/download/v2.10.0/fw.zip", want: ""},
+	}
+
+	savedRepositories := *githubRepositories                      // The flag other code sees
+	t.Cleanup(func() { *githubRepositories = savedRepositories }) // Restore it after the test
+	*githubRepositories = "EdgeTX/edgetx, ExpressLRS/ExpressLRS"  // Repositories mirrored by tag
+	for _, testCase := range testCases {                          // Run each case
+		if directory := githubReleaseDirectory(testCase.rawURL); directory != testCase.want { // File the link
+			t.Errorf("%s: githubReleaseDirectory(%q) = %q, want %q", testCase.name, testCase.rawURL, directory, testCase.want) // Report the mismatch
+		}
+	}
+} // End of TestGitHubReleaseDirectory function
+
+// Checks that the check subcommand matches scraped links with catalog keys the way a run stores them, so a Shopify
+// file whose link carries a changing "?v=" and a plain link an earlier run upgraded to HTTPS are neither new nor removed
+func TestCatalogDifferencesMatchesCatalogKeys(t *testing.T) { // Test of catalogDifferences
+	savedCatalog := archiveCatalog                               // The catalog other code sees
+	t.Cleanup(func() { archiveCatalog = savedCatalog })          // Restore it after the test
+	sourcePage := "https://radiomasterrc.com/pages/user-manuals" // The source page the files were found on
+	archiveCatalog = &catalog{Entries: map[string]*catalogEntry{ // Files earlier runs downloaded from the page
+		"https://cdn.shopify.com/s/files/1/tx16s.pdf": {URL: "https://cdn.shopify.com/s/files/1/tx16s.pdf", SourcePage: sourcePage},
+		"https://example.com/boxer.pdf":               {URL: "https://example.com/boxer.pdf", SourcePage: sourcePage},
+		"https://cdn.shopify.com/s/files/1/gone.pdf":  {URL: "https://cdn.shopify.com/s/files/1/gone.pdf", SourcePage: sourcePage},
+	}}
+
+	newLinks, removedLinks := catalogDifferences(map[string][]string{sourcePage: { // The page as scraped now
+		"https://cdn.shopify.com/s/files/1/tx16s.pdf?v=1712345678", // Republished since the download
+		"http://example.com/boxer.pdf",                             // Downloaded over HTTPS
+		"https://cdn.shopify.com/s/files/1/zorro.pdf?v=1712345678", // Not downloaded yet
+	}}, 1)
+	if want := []string{"https://cdn.shopify.com/s/files/1/zorro.pdf"}; !slices.Equal(newLinks, want) { // Only the new file is new
+		t.Errorf("new links = %q, want %q", newLinks, want) // Report the mismatch
+	}
+	if want := []string{"https://cdn.shopify.com/s/files/1/gone.pdf"}; !slices.Equal(removedLinks, want) { // Only the missing file is removed
+		t.Errorf("removed links = %q, want %q", removedLinks, want) // Report the mismatch
+	}
+} // End of TestCatalogDifferencesMatchesCatalogKeys function
+
+// Checks that a package whose signed link expired is downloaded through the fresh link found on its page, with the
+// attempt and the catalog entry recorded under that link rather than the rejected one
+func TestDownloadPackageQueueUsesRefreshedLink(t *testing.T) { // Test of the fresh-link retry in downloadPackageQueue
+	firmwareData := append([]byte("FIRMWARE"), bytes.Repeat([]byte{0}, minFirmwareSize)...)                 // Large enough to pass the sanity checks
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) { // The vendor's page and CDN
+		switch {
+		case request.URL.Path == "/firmware": // The page listing the package with a fresh signature
+			writer.Write([]byte(`<a href="/fw.bin?Expires=2&Signature=fresh">Firmware</a>`)) // The fresh link
+		case request.URL.Query().Get("Signature") == "fresh": // The fresh signature is accepted
+			writer.Header().Set("Content-Type", "application/octet-stream") // A firmware image
+			writer.Write(firmwareData)                                      // The package
+		default: // The old signature has expired
+			http.Error(writer, "expired", http.StatusForbidden) // Rejected
+		}
+	}))
+	defer server.Close() // Stop the server after the test
+
+	t.Chdir(t.TempDir())                                                                // Keep the downloads out of the repository
+	plainFetch := false                                                                 // Fetch the page without Chrome
+	savedCatalog, savedStats, savedSources := archiveCatalog, runStatistics, sourceURLs // State other code sees
+	savedPrivate, savedSettings := *allowPrivateAddresses, sourceSettingsByURL          // Settings other code sees
+	t.Cleanup(func() {                                                                  // Restore everything after the test
+		archiveCatalog, runStatistics, sourceURLs = savedCatalog, savedStats, savedSources // The state
+		*allowPrivateAddresses, sourceSettingsByURL = savedPrivate, savedSettings          // The settings
+	})
+	archiveCatalog = &catalog{Entries: make(map[string]*catalogEntry)}                 // Nothing downloaded yet
+	runStatistics = &runStats{StartedAt: time.Now()}                                   // Counters of the test run
+	sourceURLs = []string{server.URL + "/firmware"}                                    // The page is a source, so its host is allowed
+	*allowPrivateAddresses = true                                                      // The server listens on loopback
+	sourceSettingsByURL = map[string]sourceSettings{server.URL: {Chrome: &plainFetch}} // Scrape the page with a plain GET
+	resetDownloadStatuses()                                                            // Forget statuses of other tests
+
+	staleURL := server.URL + "/fw.bin?Expires=1&Signature=stale"                                   // The link the run queued
+	freshURL := server.URL + "/fw.bin?Expires=2&Signature=fresh"                                   // The link on the page now
+	linkSources := map[string]string{staleURL: server.URL + "/firmware"}                           // Where the stale link was found
+	attempted := downloadPackageQueue([]string{staleURL}, "Firmware/", "firmware", linkSources, 0) // Download the queue
+
+	if !slices.Equal(attempted, []string{freshURL}) { // The outcome belongs to the fresh link
+		t.Errorf("attempted links = %q, want %q", attempted, []string{freshURL}) // Report the mismatch
+	}
+	if _, found := archiveCatalog.Entries[freshURL]; !found { // The file is cataloged under the fresh link
+		t.Errorf("no catalog entry for %s; entries: %v", freshURL, slices.Collect(maps.Keys(archiveCatalog.Entries))) // Report the mismatch
+	}
+	if _, _, failed := runStatistics.counts(); failed != 0 { // The successful retry leaves no failure behind
+		t.Errorf("%d failed download(s) counted, want 0", failed) // Report the mismatch
+	}
+	if _, statError := os.Stat(outputPathForURL(freshURL, "Firmware/")); statError != nil { // The package is on disk
+		t.Errorf("package not saved: %v", statError) // Report the problem
+	}
+} // End of TestDownloadPackageQueueUsesRefreshedLink function
+
+// Checks that a manual announces itself once: downloading its URL again after it changed updates the entry and its
+// history but sends no second new_manual_found event, while a new URL for the product is a new edition
+func TestRecordCatalogEntryAnnouncesEachURLOnce(t *testing.T) { // Test of recordCatalogEntry
+	var received struct { // Events the webhook received
+		sync.Mutex          // Guards events; the sender posts from its own goroutine
+		events     []string // X-Event of each delivery, in order
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) { // The webhook receiver
+		received.Lock()                                                          // Lock the events
+		received.events = append(received.events, request.Header.Get("X-Event")) // Record the event
+		received.Unlock()                                                        // Unlock
+	}))
+	defer server.Close() // Stop the server after the test
+
+	savedCatalog, savedWebhook := archiveCatalog, *webhookURL                      // State other code sees
+	t.Cleanup(func() { archiveCatalog, *webhookURL = savedCatalog, savedWebhook }) // Restore it after the test
+	archiveCatalog = &catalog{Entries: make(map[string]*catalogEntry)}             // Nothing cataloged yet
+	*webhookURL = server.URL                                                       // Send events to the receiver
+
+	manualURL := "https://cdn.shopify.com/s/files/1/tx16s_manual.pdf"                                                                         // The manual's link
+	recordCatalogEntry(&catalogEntry{URL: manualURL, Kind: "manual", Product: "tx16s", Version: "1.0", SHA256: "aa", Size: 1})                // First download
+	recordCatalogEntry(&catalogEntry{URL: manualURL, Kind: "manual", Product: "tx16s", Version: "1.1", SHA256: "bb", Size: 2})                // Re-fetched after it changed
+	recordCatalogEntry(&catalogEntry{URL: manualURL + "?edition=2", Kind: "manual", Product: "tx16s", Version: "2.0", SHA256: "cc", Size: 3}) // A new edition under its own link
+	drainWebhooks()                                                                                                                           // Wait for the deliveries
+
+	received.Lock()                                                                                     // Lock the events
+	defer received.Unlock()                                                                             // Unlock when done
+	if want := []string{"new_manual_found", "new_manual_found"}; !slices.Equal(received.events, want) { // One event per URL
+		t.Errorf("webhook events = %q, want %q", received.events, want) // Report the mismatch
+	}
+	if history := archiveCatalog.Entries[manualURL].History; len(history) != 2 || history[1].SHA256 != "bb" { // Both downloads are in the history
+		t.Errorf("history = %+v, want both downloads", history) // Report the mismatch
+	}
+} // End of TestRecordCatalogEntryAnnouncesEachURLOnce function
+
+// Checks that exiting over a failed run delivers the webhook events queued before the exit
+func TestExitAfterWebhooksDeliversQueuedEvents(t *testing.T) { // Test of exitAfterWebhooks
+	if receiverURL := os.Getenv("EXIT_AFTER_WEBHOOKS_URL"); receiverURL != "" { // Running as the child process that exits
+		*webhookURL = receiverURL                                            // Send events to the parent's receiver
+		emitEvent("run_failed", map[string]any{"failed": 3, "attempted": 4}) // Queue the event the exit must not lose
+		exitAfterWebhooks("%d run(s) exceeded -max-failure-percent", 1)      // Exit the way archiveAllProfiles does
+	}
+	var received struct { // Events the webhook received
+		sync.Mutex          // Guards events; the server answers on its own goroutines
+		events     []string // X-Event of each delivery, in order
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) { // The webhook receiver
+		received.Lock()                                                          // Lock the events
+		received.events = append(received.events, request.Header.Get("X-Event")) // Record the event
+		received.Unlock()                                                        // Unlock
+	}))
+	defer server.Close() // Stop the server after the test
+
+	child := exec.Command(os.Args[0], "-test.run=^TestExitAfterWebhooksDeliversQueuedEvents$") // Re-run this test in a child
+	child.Env = append(os.Environ(), "EXIT_AFTER_WEBHOOKS_URL="+server.URL)                    // Point it at the receiver
+	output, err := child.CombinedOutput()                                                      // Wait for it to exit
+	if exitError, ok := err.(*exec.ExitError); !ok || exitError.ExitCode() != 1 {              // The child must exit non-zero
+		t.Fatalf("child exit = %v, want exit status 1; output:\n%s", err, output) // Report the mismatch
+	}
+	if !strings.Contains(string(output), "FATAL: 1 run(s) exceeded -max-failure-percent") { // The reason is logged like logFatalf
+		t.Errorf("child output lacks the FATAL line:\n%s", output) // Report the mismatch
+	}
+
+	received.Lock()                                                           // Lock the events
+	defer received.Unlock()                                                   // Unlock when done
+	if want := []string{"run_failed"}; !slices.Equal(received.events, want) { // The queued event arrived before the exit
+		t.Errorf("webhook events = %q, want %q", received.events, want) // Report the mismatch
+	}
+} // End of TestExitAfterWebhooksDeliversQueuedEvents function
+
+// Checks that long filenames are cut to the length limit with the URL hash, whatever their shape
+func TestTruncateFilenameWithHash(t *testing.T) { // Test of truncateFilenameWithHash
+	testCases := []struct { // Each case truncates one filename
+		name     string // What the case covers
+		filename string // Filename to truncate
+		wantExt  string // Extension the result must end with
+	}{
+		{name: "short name kept", filename: "tx16s_manual.pdf", wantExt: ".pdf"},
+		{name: "long base name", filename: strings.Repeat("a", 250) + ".pdf", wantExt: ".pdf"},
+		{name: "extension only", filename: "." + strings.Repeat("a", 250), wantExt: ""},
+		{name: "long extension", filename: "manual." + strings.Repeat("b", 250), wantExt: ""},
+	}
+	for _, testCase := range testCases { // Run every case
+		t.Run(testCase.name, func(t *testing.T) { // Run the case as a subtest
+			got := truncateFilenameWithHash(testCase.filename, "https://example.com/"+testCase.filename) // Truncate the filename
+			if len(got) > maxFilenameLength {                                                            // The result must fit
+				t.Errorf("len(%q) = %d, want at most %d", got, len(got), maxFilenameLength) // Report the mismatch
+			}
+			if !strings.HasSuffix(got, testCase.wantExt) { // The extension survives
+				t.Errorf("truncateFilenameWithHash(%q) = %q, want suffix %q", testCase.filename, got, testCase.wantExt) // Report the mismatch
+			}
+			if len(testCase.filename) <= maxFilenameLength && got != testCase.filename { // Short names are untouched
+				t.Errorf("truncateFilenameWithHash(%q) = %q, want it unchanged", testCase.filename, got) // Report the mismatch
+			}
+		})
+	}
+} // End of TestTruncateFilenameWithHash function
+
+// Checks that -http-cache-ttl answers from disk only what the server allows to be reused without asking
+func TestCachingTransportHonorsNoCache(t *testing.T) { // Test of cachingTransport and cacheIsFresh
+	testCases := []struct { // Each case fetches one page twice
+		name         string // What the case covers
+		cacheControl string // Cache-Control the server sends
+		vary         string // Vary the server sends
+		wantHits     int    // Requests expected to reach the server
+	}{
+		{name: "ttl answers from disk", cacheControl: "max-age=0", wantHits: 1},
+		{name: "no-cache is revalidated", cacheControl: "no-cache", wantHits: 2},
+		{name: "no-store is not kept", cacheControl: "no-store", wantHits: 2},
+		{name: "vary on cookie is not kept", cacheControl: "max-age=0", vary: "Cookie", wantHits: 2},
+	}
+	savedTTL := *httpCacheTTL                      // Setting other code sees
+	t.Cleanup(func() { *httpCacheTTL = savedTTL }) // Restore it after the test
+	*httpCacheTTL = time.Hour                      // Long enough for both requests
+	for _, testCase := range testCases {           // Run every case
+		t.Run(testCase.name, func(t *testing.T) { // Run the case as a subtest
+			var hits int                                                                                            // Requests that reached the server
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) { // The vendor's site
+				hits++                                                      // Count the request
+				writer.Header().Set("Cache-Control", testCase.cacheControl) // The server's caching rules
+				if testCase.vary != "" {                                    // Some responses vary on request headers
+					writer.Header().Set("Vary", testCase.vary) // Name the header
+				}
+				writer.Write([]byte("<html>manuals</html>")) // The page
+			}))
+			defer server.Close() // Stop the server after the test
+
+			transport := &cachingTransport{next: http.DefaultTransport, directory: t.TempDir()} // A cache of its own
+			for range 2 {                                                                       // Fetch the page twice
+				request, _ := http.NewRequest(http.MethodGet, server.URL, nil) // The page request
+				response, err := transport.RoundTrip(request)                  // Fetch it through the cache
+				if err != nil {                                                // Check if the request failed
+					t.Fatalf("RoundTrip: %v", err) // Stop the case
+				}
+				response.Body.Close() // Release the body
+			}
+			if hits != testCase.wantHits { // Check how often the server was asked
+				t.Errorf("server hits = %d, want %d", hits, testCase.wantHits) // Report the mismatch
+			}
+		})
+	}
+} // End of TestCachingTransportHonorsNoCache function
+
+// Checks that the log file rotates once it is too big or too old, and falls back to stderr when it cannot be reopened
+func TestRotatingLogFileRotates(t *testing.T) { // Test of rotatingLogFile
+	savedSize, savedInterval, savedBackups := *logMaxSize, *logRotateInterval, *logMaxBackups                      // Settings other code sees
+	t.Cleanup(func() { *logMaxSize, *logRotateInterval, *logMaxBackups = savedSize, savedInterval, savedBackups }) // Restore them after the test
+	*logMaxBackups = 0                                                                                             // Keep every rotated copy
+
+	testCases := []struct { // Each case writes two lines
+		name        string        // What the case covers
+		maxSize     int           // -log-max-size in MiB
+		interval    time.Duration // -log-rotate-every
+		lineSize    int           // Bytes in each line
+		wantRotated int           // Rotated copies expected
+	}{
+		{name: "small and young", maxSize: 1, interval: time.Hour, lineSize: 10, wantRotated: 0},
+		{name: "too big", maxSize: 1, interval: 0, lineSize: 600 << 10, wantRotated: 1},
+		{name: "too old", maxSize: 0, interval: time.Nanosecond, lineSize: 10, wantRotated: 1},
+	}
+	for _, testCase := range testCases { // Run every case
+		t.Run(testCase.name, func(t *testing.T) { // Run the case as a subtest
+			*logMaxSize, *logRotateInterval = testCase.maxSize, testCase.interval // Configure rotation
+			logPath := filepath.Join(t.TempDir(), "archive.log")                  // The log file
+			logFile, err := openRotatingLogFile(logPath)                          // Open it
+			if err != nil {                                                       // Check if it could not be opened
+				t.Fatalf("openRotatingLogFile: %v", err) // Stop the case
+			}
+			defer func() { logFile.file.Close() }()              // Close whichever file is current after the case
+			line := bytes.Repeat([]byte("x"), testCase.lineSize) // One log line
+			logFile.Write(line)                                  // First line starts the file
+			logFile.Write(line)                                  // Second line may rotate it
+			rotated, _ := filepath.Glob(logPath + ".*")          // Rotated copies beside the file
+			if len(rotated) != testCase.wantRotated {            // Check how often it rotated
+				t.Errorf("rotated copies = %q, want %d", rotated, testCase.wantRotated) // Report the mismatch
+			}
+		})
+	}
+
+	t.Run("reopen fails", func(t *testing.T) { // The directory vanished under the log file
+		logDirectory := filepath.Join(t.TempDir(), "logs")                              // Directory removed later
+		os.Mkdir(logDirectory, 0o755)                                                   // Create it
+		logFile, err := openRotatingLogFile(filepath.Join(logDirectory, "archive.log")) // Open the log file
+		if err != nil {                                                                 // Check if it could not be opened
+			t.Fatalf("openRotatingLogFile: %v", err) // Stop the case
+		}
+		logFile.Write([]byte("first line\n"))                                                                 // Give it content
+		os.RemoveAll(logDirectory)                                                                            // Neither renaming nor reopening can succeed now
+		if err := logFile.rotate(); err == nil || !strings.Contains(err.Error(), "reopening it failed too") { // The reopen failure is reported
+			t.Errorf("rotate() = %v, want the reopen failure reported", err) // Report the mismatch
+		}
+		if logFile.file != nil { // Write must fall back to stderr
+			t.Errorf("file = %v after a failed reopen, want nil", logFile.file) // Report the mismatch
+		}
+	})
+} // End of TestRotatingLogFileRotates function
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"          // Implements command-line flag parsing
+	"fmt"           // Implements formatted I/O
+	"log"           // Implements simple logging
+	"os"            // Provides platform-independent interface to operating system functionality
+	"path/filepath" // Implements utility routines for manipulating filepaths
+	"syscall"       // Provides signal numbers such as SIGTERM
+	"time"          // Provides functionality for measuring and displaying time
+
+	"golang.org/x/sys/windows/svc"     // Implements the Windows service control protocol
+	"golang.org/x/sys/windows/svc/mgr" // Installs and removes Windows services
+)
+
+const windowsServiceName = "RadioMasterArchiver" // Name the service is registered under
+
+const stopWaitHint = 30 * time.Second // How long the service manager is told to wait between stop progress reports while a run drains
+
+func init() { // Register the Windows entry point with main
+	platformMain = windowsMain // Handle service commands and service runs
+} // End of init function
+
+// Handles the install-service and remove-service subcommands, and runs as a service when started by the service manager
+func windowsMain() bool { // Function implementing the Windows-specific entry point
+	isService, detectError := svc.IsWindowsService() // Check if the service manager started the program
+	if detectError != nil {                          // Check if detection failed
+		logFatal(detectError) // Stop with a clear message
+	}
+	if isService { // Running under the service manager
+		if runError := svc.Run(windowsServiceName, &archiverService{}); runError != nil { // Run until the service manager stops the service
+			logFatal(runError) // Stop with a clear message
+		}
+		return true // The service run is complete
+	}
+
+	switch flag.Arg(0) { // Check for service subcommands
+	case "install-service": // Register the archiver as an automatic-start service
+		if installError := installWindowsService(flag.Args()[1:]); installError != nil { // Install the service
+			logFatal(installError) // Stop with a clear message
+		}
+		log.Printf("Installed service %s", windowsServiceName) // Log success message
+		return true                                            // The command is complete
+	case "remove-service": // Unregister the service
+		if removeError := removeWindowsService(); removeError != nil { // Remove the service
+			logFatal(removeError) // Stop with a clear message
+		}
+		log.Printf("Removed service %s", windowsServiceName) // Log success message
+		return true                                          // The command is complete
+	}
+
+	return false // Not a Windows service command
+} // End of windowsMain function
+
+// Registers this executable as an automatic-start Windows service running in daemon mode from the current directory.
+// Extra arguments are passed to the service on every start (e.g. "-interval=12h -layout=mirror").
+func installWindowsService(serviceArguments []string) error { // Function to install the Windows service
+	executablePath, executableError := os.Executable() // Path of this program
+	if executableError != nil {                        // Check if the path could not be found
+		return executableError // Return the error
+	}
+	currentDirectory, directoryError := os.Getwd() // The archive lives in the directory the service is installed from
+	if directoryError != nil {                     // Check if the directory could not be read
+		return directoryError // Return the error
+	}
+
+	serviceManager, connectError := mgr.Connect() // Connect to the service control manager (needs an elevated prompt)
+	if connectError != nil {                      // Check if the connection failed
+		return fmt.Errorf("connect to service manager (run as administrator): %w", connectError) // Return the error with a hint
+	}
+	defer serviceManager.Disconnect() // Ensure the connection is closed
+
+	if existingService, openError := serviceManager.OpenService(windowsServiceName); openError == nil { // Check for an earlier installation
+		existingService.Close()                                                  // Release the handle
+		return fmt.Errorf("service %s is already installed", windowsServiceName) // Refuse to install twice
+	}
+
+	startArguments := []string{"-workdir=" + filepath.Clean(currentDirectory)} // Services start in System32, so pin the archive directory
+	if !hasFlagArgument(serviceArguments, "interval") {                        // A service must keep running
+		startArguments = append(startArguments, "-interval=24h") // Default to one run per day, like the scheduled CI job
+	}
+	startArguments = append(startArguments, serviceArguments...) // Add the user's arguments
+
+	createdService, createError := serviceManager.CreateService(windowsServiceName, executablePath, mgr.Config{ // Register the service
+		DisplayName: "RadioMaster documentation archiver",                       // Name shown in services.msc
+		Description: "Periodically downloads RadioMaster manuals and firmware.", // Description shown in services.msc
+		StartType:   mgr.StartAutomatic,                                         // Start with Windows
+	}, startArguments...) // End of service registration
+	if createError != nil { // Check if registration failed
+		return createError // Return the error
+	}
+	defer createdService.Close() // Release the handle
+
+	return nil // The service was installed
+} // End of installWindowsService function
+
+// Stops and unregisters the Windows service
+func removeWindowsService() error { // Function to remove the Windows service
+	serviceManager, connectError := mgr.Connect() // Connect to the service control manager (needs an elevated prompt)
+	if connectError != nil {                      // Check if the connection failed
+		return fmt.Errorf("connect to service manager (run as administrator): %w", connectError) // Return the error with a hint
+	}
+	defer serviceManager.Disconnect() // Ensure the connection is closed
+
+	installedService, openError := serviceManager.OpenService(windowsServiceName) // Open the installed service
+	if openError != nil {                                                         // Check if the service exists
+		return fmt.Errorf("service %s is not installed: %w", windowsServiceName, openError) // Return the error with context
+	}
+	defer installedService.Close() // Release the handle
+
+	_, _ = installedService.Control(svc.Stop) // Ask a running service to stop; an error just means it was not running
+	return installedService.Delete()          // Unregister the service
+} // End of removeWindowsService function
+
+// Reports whether a flag with the given name appears in an argument list (as "-name", "--name", "-name=…")
+func hasFlagArgument(arguments []string, flagName string) bool { // Function to look for a flag among raw arguments
+	for _, argument := range arguments { // Check each argument
+		for _, prefix := range []string{"-" + flagName, "--" + flagName} { // Both single and double dashes are accepted
+			if argument == prefix || len(argument) > len(prefix) && argument[:len(prefix)+1] == prefix+"=" { // Check for "-name" or "-name=value"
+				return true // The flag is present
+			}
+		}
+	}
+	return false // The flag is absent
+} // End of hasFlagArgument function
+
+// Windows service handler running the archiver in daemon mode
+type archiverService struct{} // No state beyond the daemon itself
+
+// Runs daemon mode in the background and translates service manager requests into daemon signals
+func (service *archiverService) Execute(arguments []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) { // Function implementing svc.Handler
+	status <- svc.Status{State: svc.StartPending} // Report that the service is starting
+
+	if *runInterval <= 0 { // Services must keep running
+		*runInterval = 24 * time.Hour // Fall back to a daily run
+	}
+	daemonDone := make(chan struct{}) // Closed when daemon mode exits
+	go func() {                       // Run the daemon in the background
+		runDaemon()       // Archive on a schedule until stopped
+		close(daemonDone) // Signal that the daemon has exited
+	}() // End of daemon goroutine
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown | svc.AcceptParamChange} // Report that the service is running
+	for {                                                                                                          // Handle service manager requests
+		select { // Whichever happens first
+		case request := <-requests: // A request from the service manager
+			switch request.Cmd { // Pick the handling for the request
+			case svc.Interrogate: // Status query
+				status <- request.CurrentStatus // Repeat the current status
+			case svc.ParamChange: // Equivalent of SIGHUP
+				daemonSignals <- syscall.SIGHUP // Re-read the config file
+			case svc.Stop, svc.Shutdown: // Stop requests
+				status <- svc.Status{State: svc.StopPending, CheckPoint: 1, WaitHint: uint32(stopWaitHint / time.Millisecond)} // Report that the service is stopping
+				daemonSignals <- syscall.SIGTERM                                                                               // Ask the daemon to stop after the current run
+				for checkPoint := uint32(2); ; checkPoint++ {                                                                  // Keep reporting progress while the run drains
+					select { // Whichever happens first
+					case <-daemonDone: // The daemon has stopped
+						return false, 0 // Report a clean stop
+					case <-time.After(stopWaitHint / 2): // Still draining
+						status <- svc.Status{State: svc.StopPending, CheckPoint: checkPoint, WaitHint: uint32(stopWaitHint / time.Millisecond)} // Tell the service manager the stop is progressing
+					}
+				}
+			}
+		case <-daemonDone: // The daemon exited on its own
+			return false, 0 // Report a clean stop
+		}
+	}
+} // End of Execute method
@@ -0,0 +1,96 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"bytes"           // Implements functions for the manipulation of byte slices
+	"encoding/binary" // Encodes the length of multi-line journal fields
+	"fmt"             // Implements formatted I/O
+	"io"              // Provides basic interfaces to I/O primitives
+	"log/syslog"      // Sends messages to the system log service
+	"net"             // Sends datagrams to the journal socket
+	"os"              // Provides platform-independent interface to operating system functionality
+	"path/filepath"   // Implements utility routines for manipulating filepaths
+	"sync"            // Guards the journal connection
+)
+
+const journalSocketPath = "/run/systemd/journal/socket" // Socket systemd-journald reads native protocol datagrams from
+
+func init() { // Register the system log backends with main
+	openSystemLog = openUnixSystemLog // Offer syslog and journald
+} // End of init function
+
+// Opens the named system log backend as a writer that gives each log line its own priority
+func openUnixSystemLog(backend string) (io.Writer, error) { // Function to open a system log backend
+	identifier := filepath.Base(os.Args[0]) // Tag messages with the program name
+	switch backend {                        // Pick the backend
+	case "syslog":
+		syslogWriter, dialError := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, identifier) // Connect to the local syslog service
+		if dialError != nil {                                                                // Check if there is no syslog service
+			return nil, fmt.Errorf("connect to syslog: %w", dialError) // Return a clear message
+		}
+		return &syslogLogWriter{writer: syslogWriter}, nil // Log through syslog
+	case "journald":
+		journalConnection, dialError := net.Dial("unixgram", journalSocketPath) // Connect to the journal
+		if dialError != nil {                                                   // Check if journald is not running
+			return nil, fmt.Errorf("connect to journald: %w", dialError) // Return a clear message
+		}
+		return &journalLogWriter{connection: journalConnection, identifier: identifier}, nil // Log through the journal
+	}
+	return nil, fmt.Errorf("unknown log backend %q", backend) // Return a clear message
+} // End of openUnixSystemLog function
+
+// Writer that sends each log line to syslog at the priority its message calls for
+type syslogLogWriter struct { // State of the syslog backend
+	writer *syslog.Writer // Connection to the syslog service
+} // End of syslogLogWriter struct
+
+// Sends one log line to syslog
+func (logWriter *syslogLogWriter) Write(logOutput []byte) (int, error) { // Method implementing io.Writer for the log package
+	message := string(bytes.TrimRight(logOutput, "\n")) // Syslog frames messages itself
+	var writeError error                                // Result of the write
+	switch logMessagePriority(message) {                // Send at the matching priority
+	case syslogPriorityCritical:
+		writeError = logWriter.writer.Crit(message) // Why the program stops
+	case syslogPriorityError:
+		writeError = logWriter.writer.Err(message) // Errors
+	case syslogPriorityWarning:
+		writeError = logWriter.writer.Warning(message) // Warnings
+	default:
+		writeError = logWriter.writer.Info(message) // Everything else
+	}
+	if writeError != nil { // Check if the message was not sent
+		return 0, writeError // Return the error
+	}
+	return len(logOutput), nil // The whole line was sent
+} // End of Write method
+
+// Writer that sends each log line to systemd-journald using its native protocol, with PRIORITY and SYSLOG_IDENTIFIER fields
+type journalLogWriter struct { // State of the journald backend
+	mutex      sync.Mutex // Keeps datagrams whole while goroutines log concurrently
+	connection net.Conn   // Datagram connection to the journal socket
+	identifier string     // SYSLOG_IDENTIFIER of every entry
+} // End of journalLogWriter struct
+
+// Sends one log line to the journal
+func (logWriter *journalLogWriter) Write(logOutput []byte) (int, error) { // Method implementing io.Writer for the log package
+	message := bytes.TrimRight(logOutput, "\n")                                  // The journal frames entries itself
+	var datagram bytes.Buffer                                                    // One journal entry
+	fmt.Fprintf(&datagram, "PRIORITY=%d\n", logMessagePriority(string(message))) // Priority of the entry
+	fmt.Fprintf(&datagram, "SYSLOG_IDENTIFIER=%s\n", logWriter.identifier)       // Program name
+	if bytes.IndexByte(message, '\n') < 0 {                                      // Check if the message fits the simple form
+		fmt.Fprintf(&datagram, "MESSAGE=%s\n", message) // Single-line field
+	} else {
+		datagram.WriteString("MESSAGE\n")                                  // Multi-line fields are length-prefixed
+		binary.Write(&datagram, binary.LittleEndian, uint64(len(message))) // Length of the value
+		datagram.Write(message)                                            // The value
+		datagram.WriteByte('\n')                                           // End of the field
+	}
+
+	logWriter.mutex.Lock()                                                                // Lock the connection
+	defer logWriter.mutex.Unlock()                                                        // Unlock when done
+	if _, writeError := logWriter.connection.Write(datagram.Bytes()); writeError != nil { // Send the entry
+		return 0, writeError // Return the error
+	}
+	return len(logOutput), nil // The whole line was sent
+} // End of Write method